@@ -0,0 +1,52 @@
+//
+// main.go
+//
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/golang/glog"
+
+	"WardrobeManagerMS/pkg/api"
+	repo "WardrobeManagerMS/pkg/repository"
+)
+
+var mongoServer = flag.String("mongo", "database", "mongo server address")
+var imageStore = flag.String("image-store", repo.FileStore, "image repository backend, \"file\" or \"gridfs\"")
+var imageDir = flag.String("image-dir", "/tmp/ImageDb", "image directory for the file backend")
+var minAge = flag.Duration("min-age", time.Hour, "never collect images younger than this")
+var dryRun = flag.Bool("dry-run", true, "only report orphaned images, set to false to delete them")
+
+func init() {
+	flag.Parse()
+}
+
+func main() {
+
+	wardrobeRepo, err := repo.NewWardrobeRepository(*mongoServer)
+	if err != nil {
+		glog.Errorf(" Initializing Mongo repository failed  : %v", err)
+		os.Exit(1)
+	}
+
+	imageRepo, err := repo.NewImageRepository(*imageStore, *imageDir, *mongoServer)
+	if err != nil {
+		glog.Errorf(" Initializing %s repository failed  : %v", *imageStore, err)
+		os.Exit(1)
+	}
+
+	report, err := api.NewImageCollector(wardrobeRepo, imageRepo, *minAge).Collect(*dryRun)
+	if err != nil {
+		glog.Errorf(" Image gc failed : %v", err)
+		os.Exit(1)
+	}
+
+	out, _ := json.MarshalIndent(report, "", "  ")
+	fmt.Println(string(out))
+}
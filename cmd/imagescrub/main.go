@@ -0,0 +1,71 @@
+//
+// main.go
+//
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/golang/glog"
+
+	"WardrobeManagerMS/pkg/api"
+	repo "WardrobeManagerMS/pkg/repository"
+)
+
+var mongoServer = flag.String("mongo", "database", "mongo server address")
+var imageStore = flag.String("image-store", repo.FileStore, "image repository backend, \"file\" or \"gridfs\"")
+var imageDir = flag.String("image-dir", "/tmp/ImageDb", "image directory for the file backend")
+var masterKeys = flag.String("master-keys", "", "master key file, set when images are encrypted at rest")
+var dataKeys = flag.String("data-keys", "", "wrapped per user data key file, required with -master-keys")
+var mark = flag.Bool("mark", true, "record the image state on affected items, set to false to only report")
+
+func init() {
+	flag.Parse()
+}
+
+func main() {
+
+	if *masterKeys != "" && *dataKeys == "" {
+		glog.Errorf(" No data key file configured, set -data-keys with -master-keys")
+		os.Exit(2)
+	}
+
+	wardrobeRepo, err := repo.NewWardrobeRepository(*mongoServer)
+	if err != nil {
+		glog.Errorf(" Initializing Mongo repository failed  : %v", err)
+		os.Exit(1)
+	}
+
+	imageRepo, err := repo.NewImageRepository(*imageStore, *imageDir, *mongoServer)
+	if err != nil {
+		glog.Errorf(" Initializing %s repository failed  : %v", *imageStore, err)
+		os.Exit(1)
+	}
+
+	// checksums are taken over the plain image
+	if *masterKeys != "" {
+		keys, err := repo.OpenKeyRing(*masterKeys, *dataKeys)
+		if err != nil {
+			glog.Errorf(" Opening key ring failed : %v", err)
+			os.Exit(1)
+		}
+		imageRepo = repo.NewEncryptedImageRepository(imageRepo, keys)
+	}
+
+	report, err := api.NewImageScrubber(wardrobeRepo, imageRepo).Scrub(*mark)
+	if err != nil {
+		glog.Errorf(" Image scrub failed : %v", err)
+		os.Exit(1)
+	}
+
+	out, _ := json.MarshalIndent(report, "", "  ")
+	fmt.Println(string(out))
+
+	if len(report.Damaged) > 0 {
+		os.Exit(3)
+	}
+}
@@ -7,10 +7,13 @@
 package main
 
 import (
+	"crypto/rand"
 	"flag"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang/glog"
@@ -28,13 +31,53 @@ const mongoServer = "database"
 const txChannel = "Label"
 const rxChannel = "Text"
 
+var imageStore = flag.String("image-store", repo.FileStore, "image repository backend, \"file\" or \"gridfs\"")
+
+var masterKeys = flag.String("master-keys", "", "master key file, enables image encryption at rest when set")
+var dataKeys = flag.String("data-keys", "", "wrapped per user data key file, required with -master-keys, keep it on persistent storage as images cannot be decrypted without it")
+
+var urlKey = flag.String("url-key", "", "file holding the image url signing secret, random per process when empty")
+var urlTTL = flag.Duration("url-ttl", 15*time.Minute, "minimum lifetime of signed image urls")
+
+var jwksFile = flag.String("jwks", "", "JWKS file to verify bearer tokens against")
+var jwtIssuer = flag.String("jwt-issuer", "", "required bearer token issuer")
+var jwtAudience = flag.String("jwt-audience", "", "required bearer token audience")
+var jwtUserClaim = flag.String("jwt-user-claim", "sub", "bearer token claim holding the username")
+var apiKeysFile = flag.String("api-keys", "", "file of hashed static api keys")
+var insecureNoAuth = flag.Bool("insecure-no-auth", false, "serve the api without authentication, to anyone, when neither -jwks nor -api-keys is set")
+
+var maxItems = flag.Int("max-items", 0, "maximum number of items per user, 0 is unlimited")
+var maxImageBytes = flag.Int64("max-image-bytes", 0, "maximum bytes of images per user, 0 is unlimited")
+
+var gcInterval = flag.Duration("gc-interval", 0, "interval between orphaned image collections, 0 disables")
+var gcMinAge = flag.Duration("gc-min-age", time.Hour, "never collect images younger than this")
+var gcDryRun = flag.Bool("gc-dry-run", false, "only report orphaned images")
+
+var webhookInterval = flag.Duration("webhook-interval", 2*time.Second, "interval between looks for webhook deliveries due")
+var webhookTimeout = flag.Duration("webhook-timeout", 10*time.Second, "timeout of a webhook delivery attempt")
+var webhookBackoff = flag.Duration("webhook-backoff", 30*time.Second, "delay before the first retry of a failed webhook delivery, doubling after")
+var webhookAttempts = flag.Int("webhook-attempts", 8, "attempts of a webhook delivery before it is given up")
+var webhookAllowPrivate = flag.Bool("webhook-allow-private", false, "let webhooks reach loopback, private and link-local addresses, for testing only")
+var labelTimeout = flag.Duration("label-timeout", 2*time.Minute, "how long to wait on label to text before sending a label again, 0 waits forever")
+var labelAttempts = flag.Int("label-attempts", 3, "attempts of a label to text job before it is marked timed out")
+var labelInterval = flag.Duration("label-interval", 30*time.Second, "interval between checks for label to text jobs timed out, 0 disables")
+
 func init() {
 	flag.Parse()
 }
 
 func main() {
 
-	glog.Infof("Starting WM with {GIN-debug=%s}, {Image=%s}", logFile, imageRepo)
+	glog.Infof("Starting WM with {GIN-debug=%s}, {Image=%s}, {Image-store=%s}", logFile, imageRepo, *imageStore)
+
+	if *jwksFile == "" && *apiKeysFile == "" && !*insecureNoAuth {
+		glog.Errorf(" No authentication configured, set -jwks or -api-keys, or -insecure-no-auth to serve the api open")
+		return
+	}
+	if *masterKeys != "" && *dataKeys == "" {
+		glog.Errorf(" No data key file configured, set -data-keys with -master-keys")
+		return
+	}
 	r := gin.Default()
 
 	f, err2 := os.OpenFile(logFile, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0660)
@@ -50,19 +93,116 @@ func main() {
 		return
 	}
 
-	imageRepo, err1 := repo.NewFileImageRepository("/tmp/ImageDb")
+	mongoUserRepo, err := repo.NewUserRepository(mongoServer)
+	if err != nil {
+		glog.Errorf(" Initializing Mongo user repository failed  : %v", err)
+		return
+	}
+
+	mongoShareRepo, err := repo.NewShareRepository(mongoServer)
+	if err != nil {
+		glog.Errorf(" Initializing Mongo share repository failed  : %v", err)
+		return
+	}
+
+	mongoLinkRepo, err := repo.NewLinkRepository(mongoServer)
+	if err != nil {
+		glog.Errorf(" Initializing Mongo link repository failed  : %v", err)
+		return
+	}
+
+	mongoHookRepo, err := repo.NewWebhookRepository(mongoServer)
+	if err != nil {
+		glog.Errorf(" Initializing Mongo webhook repository failed  : %v", err)
+		return
+	}
+
+	imageRepo, err1 := repo.NewImageRepository(*imageStore, "/tmp/ImageDb", mongoServer)
 	if err1 != nil {
-		glog.Errorf(" Initializing file repository failed  : %v", err1)
+		glog.Errorf(" Initializing %s repository failed  : %v", *imageStore, err1)
 		return
 	}
 
-	ws, err2 := api.NewWardrobeService(mongoWardrobeRepo, imageRepo, redisServer, rxChannel, txChannel)
+	if *masterKeys != "" {
+		keys, err := repo.OpenKeyRing(*masterKeys, *dataKeys)
+		if err != nil {
+			glog.Errorf(" Opening key ring failed : %v", err)
+			return
+		}
+		imageRepo = repo.NewEncryptedImageRepository(imageRepo, keys)
+	}
+
+	quota := api.Quota{
+		MaxItems:      *maxItems,
+		MaxImageBytes: *maxImageBytes,
+	}
+
+	labels := api.LabelJobs{
+		Timeout:     *labelTimeout,
+		MaxAttempts: *labelAttempts,
+		Interval:    *labelInterval,
+	}
+
+	ws, err2 := api.NewWardrobeService(mongoWardrobeRepo, mongoUserRepo, mongoShareRepo, mongoLinkRepo, mongoHookRepo, imageRepo, quota, labels, redisServer, rxChannel, txChannel)
 	if err2 != nil {
 		glog.Errorf(" NewWardrobService failed : %v", err2)
 		return
 	}
 
-	server := app.NewWardrobeServer(r, ws)
+	if *gcInterval > 0 {
+		gc := api.NewImageCollector(mongoWardrobeRepo, imageRepo, *gcMinAge)
+		go gc.Run(*gcInterval, *gcDryRun, make(chan struct{}))
+	}
+
+	dispatcher := api.NewWebhookDispatcher(mongoHookRepo, api.NewWebhookClient(*webhookTimeout, *webhookAllowPrivate), *webhookBackoff, *webhookAttempts)
+	go dispatcher.Run(*webhookInterval, make(chan struct{}))
+
+	var secret []byte
+	if *urlKey != "" {
+		secret, err = ioutil.ReadFile(*urlKey)
+		if err != nil {
+			glog.Errorf(" Reading url signing key failed : %v", err)
+			return
+		}
+	} else {
+		glog.Warningf("No -url-key given, image urls will not survive a restart")
+		secret = make([]byte, 32)
+		if _, err = rand.Read(secret); err != nil {
+			glog.Errorf(" Generating url signing key failed : %v", err)
+			return
+		}
+	}
+
+	auth := make([]app.Authenticator, 0)
+	if *jwksFile != "" {
+		jwtAuth, err := app.NewJWKSAuthenticator(*jwksFile, *jwtIssuer, *jwtAudience, *jwtUserClaim)
+		if err != nil {
+			glog.Errorf(" Initializing jwt authentication failed : %v", err)
+			return
+		}
+		auth = append(auth, jwtAuth)
+	}
+	if *apiKeysFile != "" {
+		keyAuth, err := app.NewAPIKeyAuthenticator(*apiKeysFile)
+		if err != nil {
+			glog.Errorf(" Initializing api key authentication failed : %v", err)
+			return
+		}
+		auth = append(auth, keyAuth)
+	}
+	if len(auth) == 0 {
+		auth = append(auth, app.InsecureNoAuth())
+	}
+
+	server := app.NewWardrobeServer(r, ws, app.NewURLSigner(secret, *urlTTL), auth...)
+
+	// serve gRPC next to the REST api, on the same service, a server that
+	// only answers on one of them is not left running
+	go func() {
+		if err := server.RunGRPC(); err != nil {
+			glog.Fatalf(" gRPC server failed : %v", err)
+		}
+	}()
 
 	// start the server
 	err = server.Run()
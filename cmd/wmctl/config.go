@@ -0,0 +1,179 @@
+//
+// config.go
+//
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+const defaultServer = "http://127.0.0.1:57401"
+
+// config is the file of server profiles, one of them is current
+type config struct {
+	Current  string              `json:"current"`
+	Profiles map[string]*profile `json:"profiles"`
+}
+
+// profile is a server, the credentials to call it and the user whose
+// closet is managed
+type profile struct {
+	Server string `json:"server"`
+	User   string `json:"user,omitempty"`
+	APIKey string `json:"api-key,omitempty"`
+	Token  string `json:"token,omitempty"`
+}
+
+func defaultConfigPath() string {
+	if path := os.Getenv("WMCTL_CONFIG"); path != "" {
+		return path
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "wmctl.json"
+	}
+	return filepath.Join(dir, "wmctl", "config.json")
+}
+
+// loadConfig reads the config at path, a missing file is an empty config
+func loadConfig(path string) (*config, error) {
+
+	c := &config{Profiles: make(map[string]*profile)}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Error reading config %s : %w", path, err)
+	}
+
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, fmt.Errorf("Error decoding config %s : %w", path, err)
+	}
+	if c.Profiles == nil {
+		c.Profiles = make(map[string]*profile)
+	}
+	return c, nil
+}
+
+// save writes the config only the user can read, it holds credentials
+func (c *config) save(path string) error {
+
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("Error creating config directory : %w", err)
+	}
+	if err := ioutil.WriteFile(path, append(data, '\n'), 0600); err != nil {
+		return fmt.Errorf("Error writing config %s : %w", path, err)
+	}
+	return nil
+}
+
+// profile is the profile called name, the current one if name is empty.
+// Without any profile the local server is called without credentials.
+func (c *config) profile(name string) (*profile, error) {
+
+	if name == "" {
+		name = c.Current
+	}
+	if name == "" && len(c.Profiles) == 0 {
+		return &profile{Server: defaultServer}, nil
+	}
+
+	p, ok := c.Profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("No profile %q in %s", name, *configPath)
+	}
+	if p.Server == "" {
+		return nil, fmt.Errorf("Profile %q has no server", name)
+	}
+	return p, nil
+}
+
+func profileCommand(args []string) error {
+
+	if len(args) == 0 {
+		return fmt.Errorf("%w, profile needs a command", errUsage)
+	}
+
+	c, err := loadConfig(*configPath)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "list":
+		names := make([]string, 0, len(c.Profiles))
+		for name := range c.Profiles {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			p := c.Profiles[name]
+			current := " "
+			if name == c.Current {
+				current = "*"
+			}
+			fmt.Printf("%s %s\t%s\t%s\n", current, name, p.Server, p.User)
+		}
+		return nil
+
+	case "set":
+		fs := flag.NewFlagSet("profile set", flag.ContinueOnError)
+		server := fs.String("server", "", "server url")
+		user := fs.String("user", "", "user whose closet is managed")
+		apiKey := fs.String("api-key", "", "api key")
+		token := fs.String("token", "", "bearer token")
+		if err := parseFlags(fs, args[1:], 1); err != nil {
+			return err
+		}
+
+		name := fs.Arg(0)
+		p, ok := c.Profiles[name]
+		if !ok {
+			p = &profile{Server: defaultServer}
+			c.Profiles[name] = p
+		}
+		fs.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "server":
+				p.Server = *server
+			case "user":
+				p.User = *user
+			case "api-key":
+				p.APIKey = *apiKey
+			case "token":
+				p.Token = *token
+			}
+		})
+		if c.Current == "" {
+			c.Current = name
+		}
+		return c.save(*configPath)
+
+	case "use":
+		if len(args) != 2 {
+			return fmt.Errorf("%w of profile use", errUsage)
+		}
+		if _, ok := c.Profiles[args[1]]; !ok {
+			return fmt.Errorf("No profile %q in %s", args[1], *configPath)
+		}
+		c.Current = args[1]
+		return c.save(*configPath)
+	}
+
+	return fmt.Errorf("%w, unknown command profile %s", errUsage, args[0])
+}
@@ -0,0 +1,152 @@
+//
+// import.go
+//
+
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// importColumns are the columns of an import file, named in its header
+var importColumns = []string{"description", "brand", "tags", "photo", "label"}
+
+// importRow is an item of an import file and how adding it went
+type importRow struct {
+	Line        int    `json:"line"`
+	Description string `json:"description"`
+	Error       string `json:"error,omitempty"`
+
+	brand, photo, label string
+	tags                []string
+}
+
+// readImport reads the rows of the CSV file at path, image paths are made
+// relative to its directory
+func readImport(path string) ([]*importRow, error) {
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("Error reading %s : %w", path, err)
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("%s is empty", path)
+	}
+
+	index := make(map[string]int)
+	for i, name := range records[0] {
+		index[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range importColumns {
+		if _, ok := index[name]; !ok {
+			return nil, fmt.Errorf("%s has no %s column", path, name)
+		}
+	}
+
+	dir := filepath.Dir(path)
+	resolve := func(p string) string {
+		if p == "" || filepath.IsAbs(p) {
+			return p
+		}
+		return filepath.Join(dir, p)
+	}
+
+	rows := make([]*importRow, 0, len(records)-1)
+	for i, record := range records[1:] {
+		rows = append(rows, &importRow{
+			Line:        i + 2,
+			Description: record[index["description"]],
+			brand:       record[index["brand"]],
+			tags:        splitTags(record[index["tags"]], ";"),
+			photo:       resolve(record[index["photo"]]),
+			label:       resolve(record[index["label"]]),
+		})
+	}
+	return rows, nil
+}
+
+// importItems adds every row of an import file, a failed row does not stop
+// the others
+func importItems(ctx context.Context, e *env, args []string) error {
+
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	workers := fs.Int("workers", 4, "items uploaded at once")
+	if err := parseFlags(fs, args, 1); err != nil {
+		return err
+	}
+	if *workers < 1 {
+		*workers = 1
+	}
+
+	rows, err := readImport(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	work := make(chan *importRow)
+	var wg sync.WaitGroup
+	for i := 0; i < *workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for row := range work {
+				if err := importRowItem(ctx, e, row); err != nil {
+					row.Error = err.Error()
+				}
+			}
+		}()
+	}
+	for _, row := range rows {
+		work <- row
+	}
+	close(work)
+	wg.Wait()
+
+	failed := 0
+	table := make([][]string, 0, len(rows))
+	for _, row := range rows {
+		status := "added"
+		if row.Error != "" {
+			status = row.Error
+			failed++
+		}
+		table = append(table, []string{fmt.Sprint(row.Line), row.Description, status})
+	}
+
+	err = e.out.print(rows, []string{"LINE", "DESCRIPTION", "STATUS"}, table)
+	if err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d items failed to import", failed, len(rows))
+	}
+	return nil
+}
+
+func importRowItem(ctx context.Context, e *env, row *importRow) error {
+
+	if row.Description == "" {
+		return fmt.Errorf("no description")
+	}
+
+	item, close, err := newItem(row.Description, row.brand, row.tags, row.photo, row.label)
+	if err != nil {
+		return err
+	}
+	defer close()
+
+	return e.client.AddWardrobe(ctx, e.user, item)
+}
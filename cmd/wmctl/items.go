@@ -0,0 +1,259 @@
+//
+// items.go
+//
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"WardrobeManagerMS/pkg/api"
+	"WardrobeManagerMS/pkg/client"
+)
+
+// filters collects repeated -filter field=value flags
+type filters map[string]string
+
+func (f filters) String() string {
+	var parts []string
+	for field, value := range f {
+		parts = append(parts, field+"="+value)
+	}
+	return strings.Join(parts, ",")
+}
+
+func (f filters) Set(s string) error {
+	field, value := s, ""
+	if i := strings.Index(s, "="); i >= 0 {
+		field, value = s[:i], s[i+1:]
+	}
+	if field == "" || value == "" {
+		return fmt.Errorf("filter %q is not field=value", s)
+	}
+	f[field] = value
+	return nil
+}
+
+// listFlags are the flags of the listings, limit caps the entries listed
+// across pages
+func listFlags(fs *flag.FlagSet) (*api.ListOptions, *int) {
+	opts := &api.ListOptions{Filter: filters{}}
+	fs.StringVar(&opts.Sort, "sort", "", "created, last-worn, likes or description, - reverses it")
+	fs.Var(filters(opts.Filter), "filter", "field=value to filter on, repeatable")
+	limit := fs.Int("limit", 0, "most entries to list, 0 lists all")
+	return opts, limit
+}
+
+// pageSize is the size of the pages fetched to list limit entries
+func pageSize(limit int) int {
+	if limit > 0 && limit < api.MaxListLimit {
+		return limit
+	}
+	return api.MaxListLimit
+}
+
+func splitTags(s string, sep string) []string {
+	var tags []string
+	for _, tag := range strings.Split(s, sep) {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// openImage opens an image file for upload, its type is told by its
+// extension
+func openImage(path string) (client.Upload, io.Closer, error) {
+	upload, f, err := client.OpenFile(path, mime.TypeByExtension(filepath.Ext(path)))
+	if err != nil {
+		return client.Upload{}, nil, err
+	}
+	return upload, f, nil
+}
+
+// newItem opens the photo and label of an item, close releases them
+func newItem(description, brand string, tags []string, photo, label string) (item client.NewItem, close func(), err error) {
+
+	main, mainFile, err := openImage(photo)
+	if err != nil {
+		return item, nil, err
+	}
+	labelUpload, labelFile, err := openImage(label)
+	if err != nil {
+		mainFile.Close()
+		return item, nil, err
+	}
+
+	item = client.NewItem{
+		Description: description,
+		Brand:       brand,
+		Tags:        tags,
+		Main:        main,
+		Label:       labelUpload,
+	}
+	return item, func() {
+		mainFile.Close()
+		labelFile.Close()
+	}, nil
+}
+
+func addItem(ctx context.Context, e *env, args []string) error {
+
+	fs := flag.NewFlagSet("item add", flag.ContinueOnError)
+	description := fs.String("description", "", "description of the item")
+	brand := fs.String("brand", "", "brand of the item")
+	tags := fs.String("tags", "", "comma separated tags")
+	if err := parseFlags(fs, args, 2); err != nil {
+		return err
+	}
+	if *description == "" {
+		return fmt.Errorf("%w, item add needs a -description", errUsage)
+	}
+
+	item, close, err := newItem(*description, *brand, splitTags(*tags, ","), fs.Arg(0), fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	defer close()
+
+	err = e.client.AddWardrobe(ctx, e.user, item)
+	if err != nil {
+		return err
+	}
+	return e.out.message("added %s", *description)
+}
+
+func listItems(ctx context.Context, e *env, args []string) error {
+
+	fs := flag.NewFlagSet("item list", flag.ContinueOnError)
+	opts, limit := listFlags(fs)
+	if err := parseFlags(fs, args, 0); err != nil {
+		return err
+	}
+
+	items := []*api.GetWardrobeResponse{}
+	opts.Limit = pageSize(*limit)
+	for {
+		page, err := e.client.GetAllWardrobe(ctx, e.user, *opts)
+		if err != nil {
+			return err
+		}
+		items = append(items, page.Items...)
+
+		if page.Next == "" || (*limit > 0 && len(items) >= *limit) {
+			break
+		}
+		opts.Cursor = page.Next
+	}
+	if *limit > 0 && len(items) > *limit {
+		items = items[:*limit]
+	}
+
+	return e.out.items(items)
+}
+
+func getItem(ctx context.Context, e *env, args []string) error {
+
+	fs := flag.NewFlagSet("item get", flag.ContinueOnError)
+	if err := parseFlags(fs, args, 1); err != nil {
+		return err
+	}
+
+	item, err := e.client.GetWardrobe(ctx, e.user, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	return e.out.item(item)
+}
+
+func deleteItem(ctx context.Context, e *env, args []string) error {
+
+	fs := flag.NewFlagSet("item delete", flag.ContinueOnError)
+	if err := parseFlags(fs, args, 1); err != nil {
+		return err
+	}
+
+	err := e.client.DeleteWardrobe(ctx, e.user, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	return e.out.message("deleted %s", fs.Arg(0))
+}
+
+func searchItems(ctx context.Context, e *env, args []string) error {
+
+	fs := flag.NewFlagSet("item search", flag.ContinueOnError)
+	limit := fs.Int("limit", 0, "most items to find, the server's default if 0")
+	if err := parseFlags(fs, args, -1); err != nil {
+		return err
+	}
+
+	hits, err := e.client.Search(ctx, e.user, strings.Join(fs.Args(), " "), *limit)
+	if err != nil {
+		return err
+	}
+	return e.out.hits(hits)
+}
+
+func downloadImage(ctx context.Context, e *env, args []string) error {
+
+	fs := flag.NewFlagSet("item image", flag.ContinueOnError)
+	label := fs.Bool("label", false, "download the label instead of the photo")
+	out := fs.String("out", "", "file to write, <id>-photo or <id>-label with the extension of the image by default")
+	if err := parseFlags(fs, args, 1); err != nil {
+		return err
+	}
+
+	id := fs.Arg(0)
+	item, err := e.client.GetWardrobe(ctx, e.user, id)
+	if err != nil {
+		return err
+	}
+
+	uri, kind := item.MainImage, "photo"
+	if *label {
+		uri, kind = item.LabelImage, "label"
+	}
+
+	image, err := e.client.OpenImage(ctx, uri)
+	if err != nil {
+		return err
+	}
+	defer image.Close()
+
+	if *out == "-" {
+		_, err = io.Copy(os.Stdout, image)
+		return err
+	}
+
+	path := *out
+	if path == "" {
+		path = id + "-" + kind
+		if exts, _ := mime.ExtensionsByType(image.ContentType); len(exts) > 0 {
+			path += exts[0]
+		}
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(f, image)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path)
+		return fmt.Errorf("Error writing %s : %w", path, err)
+	}
+
+	return e.out.message("wrote %s, %d bytes", path, n)
+}
@@ -0,0 +1,210 @@
+//
+// main.go
+//
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"WardrobeManagerMS/pkg/client"
+)
+
+var configPath = flag.String("config", defaultConfigPath(), "config file with the server profiles")
+var profileName = flag.String("profile", "", "profile to use instead of the current one")
+var userName = flag.String("user", "", "user whose closet is managed, instead of the one of the profile")
+var output = flag.String("o", "table", "output format, \"table\" or \"json\"")
+var timeout = flag.Duration("timeout", 5*time.Minute, "time limit of the command")
+
+const usage = `usage: wmctl [flags] command [command flags] [args]
+
+commands:
+  item add -description d [-brand b] [-tags t,...] photo label
+                        add an item from its photo and label image files
+  item list [-sort s] [-filter field=value] [-limit n]
+                        list the items
+  item get id           show an item
+  item delete id        delete an item
+  item search query     search the items
+  item image [-label] [-out file] id
+                        download the photo or label of an item, - writes
+                        it to stdout
+  outfit add -top id -bottom id -description d
+                        add an outfit
+  outfit list [-sort s] [-filter field=value] [-limit n]
+                        list the outfits
+  outfit get id         show an outfit
+  outfit delete id      delete an outfit
+  import [-workers n] file.csv
+                        add the items listed in a CSV file with the columns
+                        description, brand, tags, photo and label. Tags are
+                        separated by ";", image paths are relative to the
+                        file.
+  profile list          list the profiles
+  profile set [-server url] [-user u] [-api-key k] [-token t] name
+                        add or change a profile
+  profile use name      make a profile the current one
+
+The server, credentials and user come from the current profile of the
+config file, WMCTL_API_KEY and WMCTL_TOKEN override its credentials.
+
+flags:
+`
+
+// command runs with the arguments after its name
+type command func(ctx context.Context, env *env, args []string) error
+
+var commands = map[string]map[string]command{
+	"item": {
+		"add":    addItem,
+		"list":   listItems,
+		"get":    getItem,
+		"delete": deleteItem,
+		"search": searchItems,
+		"image":  downloadImage,
+	},
+	"outfit": {
+		"add":    addOutfit,
+		"list":   listOutfits,
+		"get":    getOutfit,
+		"delete": deleteOutfit,
+	},
+	"import": {
+		"": importItems,
+	},
+}
+
+// errUsage is returned by a command called the wrong way
+var errUsage = errors.New("invalid usage")
+
+// env is what a command works with
+type env struct {
+	client *client.Client
+	user   string
+	out    *printer
+}
+
+func init() {
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+}
+
+func main() {
+
+	if flag.NArg() < 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	err := run(flag.Args())
+	if errors.Is(err, errUsage) {
+		fmt.Fprintf(os.Stderr, "wmctl: %v\n\n", err)
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "wmctl: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string) error {
+
+	if args[0] == "profile" {
+		return profileCommand(args[1:])
+	}
+
+	group, ok := commands[args[0]]
+	if !ok {
+		return fmt.Errorf("%w, unknown command %s", errUsage, args[0])
+	}
+
+	cmd, ok := group[""]
+	args = args[1:]
+	if !ok {
+		if len(args) == 0 {
+			return fmt.Errorf("%w, %s needs a command", errUsage, flag.Arg(0))
+		}
+		cmd, ok = group[args[0]]
+		if !ok {
+			return fmt.Errorf("%w, unknown command %s %s", errUsage, flag.Arg(0), args[0])
+		}
+		args = args[1:]
+	}
+
+	out, err := newPrinter(*output, os.Stdout)
+	if err != nil {
+		return err
+	}
+
+	env, err := newEnv(out)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	return cmd(ctx, env, args)
+}
+
+// newEnv connects to the server of the profile in use
+func newEnv(out *printer) (*env, error) {
+
+	config, err := loadConfig(*configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := config.profile(*profileName)
+	if err != nil {
+		return nil, err
+	}
+
+	options := client.Options{
+		APIKey: p.APIKey,
+		Token:  p.Token,
+	}
+	if key := os.Getenv("WMCTL_API_KEY"); key != "" {
+		options.APIKey = key
+	}
+	if token := os.Getenv("WMCTL_TOKEN"); token != "" {
+		options.Token = token
+	}
+
+	c, err := client.New(p.Server, options)
+	if err != nil {
+		return nil, err
+	}
+
+	user := p.User
+	if *userName != "" {
+		user = *userName
+	}
+	if user == "" {
+		return nil, fmt.Errorf("No user, set one in the profile or with -user")
+	}
+
+	return &env{client: c, user: user, out: out}, nil
+}
+
+// parseFlags parses the flags of a command, expecting nargs arguments
+// after them or at least one when nargs is negative
+func parseFlags(fs *flag.FlagSet, args []string, nargs int) error {
+	fs.SetOutput(os.Stderr)
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("%w, %v", errUsage, err)
+	}
+	if (nargs < 0 && fs.NArg() == 0) || (nargs >= 0 && fs.NArg() != nargs) {
+		return fmt.Errorf("%w of %s", errUsage, fs.Name())
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+//
+// outfits.go
+//
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"WardrobeManagerMS/pkg/api"
+)
+
+func addOutfit(ctx context.Context, e *env, args []string) error {
+
+	fs := flag.NewFlagSet("outfit add", flag.ContinueOnError)
+	var outfit api.NewOutfitRequest
+	fs.StringVar(&outfit.TopId, "top", "", "id of the top")
+	fs.StringVar(&outfit.BottomId, "bottom", "", "id of the bottom")
+	fs.StringVar(&outfit.Description, "description", "", "description of the outfit")
+	if err := parseFlags(fs, args, 0); err != nil {
+		return err
+	}
+	if outfit.TopId == "" || outfit.BottomId == "" || outfit.Description == "" {
+		return fmt.Errorf("%w, outfit add needs -top, -bottom and -description", errUsage)
+	}
+
+	err := e.client.AddOutfit(ctx, e.user, outfit)
+	if err != nil {
+		return err
+	}
+	return e.out.message("added %s", outfit.Description)
+}
+
+func listOutfits(ctx context.Context, e *env, args []string) error {
+
+	fs := flag.NewFlagSet("outfit list", flag.ContinueOnError)
+	opts, limit := listFlags(fs)
+	if err := parseFlags(fs, args, 0); err != nil {
+		return err
+	}
+
+	outfits := []*api.GetOutfitResponse{}
+	opts.Limit = pageSize(*limit)
+	for {
+		page, err := e.client.GetAllOutfits(ctx, e.user, *opts)
+		if err != nil {
+			return err
+		}
+		outfits = append(outfits, page.Outfits...)
+
+		if page.Next == "" || (*limit > 0 && len(outfits) >= *limit) {
+			break
+		}
+		opts.Cursor = page.Next
+	}
+	if *limit > 0 && len(outfits) > *limit {
+		outfits = outfits[:*limit]
+	}
+
+	return e.out.outfits(outfits)
+}
+
+func getOutfit(ctx context.Context, e *env, args []string) error {
+
+	fs := flag.NewFlagSet("outfit get", flag.ContinueOnError)
+	if err := parseFlags(fs, args, 1); err != nil {
+		return err
+	}
+
+	outfit, err := e.client.GetOutfit(ctx, e.user, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	return e.out.outfit(outfit)
+}
+
+func deleteOutfit(ctx context.Context, e *env, args []string) error {
+
+	fs := flag.NewFlagSet("outfit delete", flag.ContinueOnError)
+	if err := parseFlags(fs, args, 1); err != nil {
+		return err
+	}
+
+	err := e.client.DeleteOutfit(ctx, e.user, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	return e.out.message("deleted %s", fs.Arg(0))
+}
@@ -0,0 +1,118 @@
+//
+// output.go
+//
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"WardrobeManagerMS/pkg/api"
+)
+
+// printer writes results as an aligned table or as JSON
+type printer struct {
+	json bool
+	w    io.Writer
+}
+
+func newPrinter(format string, w io.Writer) (*printer, error) {
+	switch format {
+	case "table":
+		return &printer{w: w}, nil
+	case "json":
+		return &printer{json: true, w: w}, nil
+	}
+	return nil, fmt.Errorf("%w, unknown output format %s", errUsage, format)
+}
+
+// print writes v as JSON, or the rows of the table under header
+func (p *printer) print(v interface{}, header []string, rows [][]string) error {
+
+	if p.json {
+		enc := json.NewEncoder(p.w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+
+	tw := tabwriter.NewWriter(p.w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
+
+// message reports what a command did, as {"message"} in JSON
+func (p *printer) message(format string, args ...interface{}) error {
+	text := fmt.Sprintf(format, args...)
+	if p.json {
+		return p.print(map[string]string{"message": text}, nil, nil)
+	}
+	_, err := fmt.Fprintln(p.w, text)
+	return err
+}
+
+func (p *printer) items(items []*api.GetWardrobeResponse) error {
+	rows := make([][]string, 0, len(items))
+	for _, item := range items {
+		rows = append(rows, []string{item.Id, item.Description, item.Brand, strings.Join(item.Tags, ","), day(item.Created), day(item.LastWorn)})
+	}
+	return p.print(items, []string{"ID", "DESCRIPTION", "BRAND", "TAGS", "CREATED", "LAST WORN"}, rows)
+}
+
+func (p *printer) item(item *api.GetWardrobeResponse) error {
+	rows := [][]string{
+		{"id", item.Id},
+		{"description", item.Description},
+		{"brand", item.Brand},
+		{"tags", strings.Join(item.Tags, ",")},
+		{"label text", item.LabelText},
+		{"image state", item.ImageState},
+		{"created", day(item.Created)},
+		{"last worn", day(item.LastWorn)},
+	}
+	return p.print(item, []string{"FIELD", "VALUE"}, rows)
+}
+
+func (p *printer) hits(hits []*api.SearchHit) error {
+	rows := make([][]string, 0, len(hits))
+	for _, hit := range hits {
+		rows = append(rows, []string{hit.Item.Id, hit.Item.Description, hit.Item.Brand, fmt.Sprintf("%.2f", hit.Score), strings.Join(hit.Fields, ",")})
+	}
+	return p.print(hits, []string{"ID", "DESCRIPTION", "BRAND", "SCORE", "MATCHED"}, rows)
+}
+
+func (p *printer) outfits(outfits []*api.GetOutfitResponse) error {
+	rows := make([][]string, 0, len(outfits))
+	for _, outfit := range outfits {
+		rows = append(rows, []string{outfit.Id, outfit.Description, outfit.TopId, outfit.BottomId, fmt.Sprint(outfit.LikeCount), day(outfit.Created), day(outfit.LastWorn)})
+	}
+	return p.print(outfits, []string{"ID", "DESCRIPTION", "TOP", "BOTTOM", "LIKES", "CREATED", "LAST WORN"}, rows)
+}
+
+func (p *printer) outfit(outfit *api.GetOutfitResponse) error {
+	rows := [][]string{
+		{"id", outfit.Id},
+		{"description", outfit.Description},
+		{"top", outfit.TopId},
+		{"bottom", outfit.BottomId},
+		{"likes", fmt.Sprint(outfit.LikeCount)},
+		{"dislikes", fmt.Sprint(outfit.DislikeCount)},
+		{"created", day(outfit.Created)},
+		{"last worn", day(outfit.LastWorn)},
+	}
+	return p.print(outfit, []string{"FIELD", "VALUE"}, rows)
+}
+
+func day(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return t.Local().Format("2006-01-02")
+}
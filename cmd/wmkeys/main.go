@@ -0,0 +1,120 @@
+//
+// main.go
+//
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/golang/glog"
+
+	repo "WardrobeManagerMS/pkg/repository"
+)
+
+var masterKeys = flag.String("master-keys", "/etc/wardrobe/master.keys", "master key file")
+var dataKeys = flag.String("data-keys", "", "wrapped per user data key file, required but for genkey")
+var user = flag.String("user", "", "user whose data key is rotated")
+var mongoServer = flag.String("mongo", "database", "mongo server address")
+var imageStore = flag.String("image-store", repo.FileStore, "image repository backend, \"file\" or \"gridfs\"")
+var imageDir = flag.String("image-dir", "/tmp/ImageDb", "image directory for the file backend")
+
+const usage = `usage: wmkeys [flags] command
+
+commands:
+  genkey     add a new master key and make it active
+  rewrap     wrap every data key with the active master key
+  rotate     issue -user a new data key, retiring the old one
+  reencrypt  move plain and retired key images onto their owner's data key
+
+rewrap and rotate rewrite the data key file, run them while the server
+is stopped.
+
+flags:
+`
+
+func init() {
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+}
+
+func main() {
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	err := run(flag.Arg(0))
+	if err != nil {
+		glog.Errorf(" %s failed : %v", flag.Arg(0), err)
+		fmt.Fprintf(os.Stderr, "%s failed : %v\n", flag.Arg(0), err)
+		os.Exit(1)
+	}
+}
+
+func run(command string) error {
+
+	if command == "genkey" {
+		id, err := repo.GenerateMasterKey(*masterKeys)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("active master key %s\n", id)
+		return nil
+	}
+
+	if *dataKeys == "" {
+		return fmt.Errorf("-data-keys is required")
+	}
+
+	keys, err := repo.OpenKeyRing(*masterKeys, *dataKeys)
+	if err != nil {
+		return err
+	}
+
+	switch command {
+	case "rewrap":
+		count, err := keys.Rewrap()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("rewrapped %d data keys\n", count)
+
+	case "rotate":
+		if *user == "" {
+			return fmt.Errorf("-user is required")
+		}
+		id, err := keys.RotateUserKey(*user)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("user %s now encrypts with data key %s, run reencrypt to move old images\n", *user, id)
+
+	case "reencrypt":
+		imageRepo, err := repo.NewImageRepository(*imageStore, *imageDir, *mongoServer)
+		if err != nil {
+			return err
+		}
+		wardrobeRepo, err := repo.NewWardrobeRepository(*mongoServer)
+		if err != nil {
+			return err
+		}
+		count, err := repo.ReEncrypt(imageRepo, keys, wardrobeRepo)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("re-encrypted %d images\n", count)
+
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	return nil
+}
@@ -3,13 +3,17 @@ module WardrobeManagerMS
 go 1.16
 
 require (
-	github.com/gin-gonic/gin v1.7.1 // indirect
-	github.com/golang/glog v0.0.0-20210429001901-424d2337a529 // indirect
-	github.com/gomodule/redigo v1.8.5 // indirect
-	github.com/google/uuid v1.2.0 // indirect
+	github.com/gin-gonic/gin v1.7.1
+	github.com/golang/glog v0.0.0-20210429001901-424d2337a529
+	github.com/gomodule/redigo v1.8.5
+	github.com/google/uuid v1.2.0
+	github.com/graphql-go/graphql v0.8.1
 	github.com/modern-go/concurrent v0.0.0-20180306012644-bacd9c7ef1dd // indirect
 	github.com/modern-go/reflect2 v1.0.1 // indirect
 	go.mongodb.org/mongo-driver v1.5.2
+	google.golang.org/genproto v0.0.0-20200526211855-cb27e3aa2013
+	google.golang.org/grpc v1.43.0
+	google.golang.org/protobuf v1.27.1
 	gopkg.in/go-playground/assert.v1 v1.2.1 // indirect
 	gopkg.in/go-playground/validator.v8 v8.18.2 // indirect
 )
@@ -0,0 +1,349 @@
+//
+// access.go
+//
+
+package api
+
+import (
+	"github.com/golang/glog"
+)
+
+// callerService is the WardrobeService as seen by caller, every call first
+// checks caller holds the role it needs in the closet it acts on
+type callerService struct {
+	w      *wardrobeService
+	caller string
+}
+
+// As returns the service acting on behalf of caller
+func (w *wardrobeService) As(caller string) WardrobeService {
+	return &callerService{
+		w:      w,
+		caller: caller,
+	}
+}
+
+func (c *callerService) authorize(user string, need Role) error {
+
+	role, err := c.w.Access(c.caller, user)
+	if err != nil {
+		return err
+	}
+
+	if !role.Allows(need) {
+		glog.Warningf("Forbidden {caller=%s}, {user=%s}, {role=%s}, {need=%s}", c.caller, user, role, need)
+		return &Forbidden{
+			User:  c.caller,
+			Owner: user,
+			Role:  need,
+		}
+	}
+
+	return nil
+}
+
+func (c *callerService) AddWardrobe(newWd NewWardrobeRequest) error {
+	if err := c.authorize(newWd.User, RoleContributor); err != nil {
+		return err
+	}
+	return c.w.AddWardrobe(newWd)
+}
+
+func (c *callerService) DeleteWardrobe(user string, id string) error {
+	if err := c.authorize(user, RoleManager); err != nil {
+		return err
+	}
+	return c.w.DeleteWardrobe(user, id)
+}
+
+func (c *callerService) GetWardrobe(user string, id string) (*GetWardrobeResponse, error) {
+	if err := c.authorize(user, RoleViewer); err != nil {
+		return nil, err
+	}
+	return c.w.GetWardrobe(user, id)
+}
+
+func (c *callerService) GetWardrobes(user string, ids []string) ([]*GetWardrobeResponse, error) {
+	if err := c.authorize(user, RoleViewer); err != nil {
+		return nil, err
+	}
+	return c.w.GetWardrobes(user, ids)
+}
+
+func (c *callerService) GetAllWardrobe(user string, opts ListOptions) (*GetWardrobePage, error) {
+	if err := c.authorize(user, RoleViewer); err != nil {
+		return nil, err
+	}
+	return c.w.GetAllWardrobe(user, opts)
+}
+
+// GetFile is not scoped to a user, the closet referencing filename is the
+// one checked. Images of closets the caller may not see do not exist.
+func (c *callerService) GetFile(filename string, cb HandleFile) error {
+
+	wc, err := c.w.db.FindByImage(filename)
+	switch err.(type) {
+	case nil:
+	case *UserNotFound:
+		return &NoSuchFileOrDirectory{File: filename}
+	default:
+		return err
+	}
+
+	cid, err := c.w.userId(c.caller)
+	switch err.(type) {
+	case nil:
+	case *UserNotFound:
+		return &NoSuchFileOrDirectory{File: filename}
+	default:
+		return err
+	}
+
+	role, err := c.w.role(cid, wc.User)
+	if err != nil {
+		return err
+	}
+	if !role.Allows(RoleViewer) {
+		return &NoSuchFileOrDirectory{File: filename}
+	}
+
+	return c.w.GetFile(filename, cb)
+}
+
+func (c *callerService) GetImage(user string, id string, filename string, cb HandleImage) error {
+	if err := c.authorize(user, RoleViewer); err != nil {
+		return err
+	}
+	return c.w.GetImage(user, id, filename, cb)
+}
+
+func (c *callerService) GetUsage(user string) (*GetUsageResponse, error) {
+	if err := c.authorize(user, RoleViewer); err != nil {
+		return nil, err
+	}
+	return c.w.GetUsage(user)
+}
+
+func (c *callerService) Search(user string, query string, limit int) ([]*SearchHit, error) {
+	if err := c.authorize(user, RoleViewer); err != nil {
+		return nil, err
+	}
+	return c.w.Search(user, query, limit)
+}
+
+// RegisterUser only lets callers register themselves
+func (c *callerService) RegisterUser(newUser NewUserRequest) (*GetUserResponse, error) {
+	if newUser.Username != c.caller {
+		return nil, &Forbidden{
+			User:  c.caller,
+			Owner: newUser.Username,
+			Role:  RoleOwner,
+		}
+	}
+	return c.w.RegisterUser(newUser)
+}
+
+func (c *callerService) GetUser(user string) (*GetUserResponse, error) {
+	if err := c.authorize(user, RoleViewer); err != nil {
+		return nil, err
+	}
+	return c.w.GetUser(user)
+}
+
+func (c *callerService) UpdateUser(user string, update UpdateUserRequest) (*GetUserResponse, error) {
+	if err := c.authorize(user, RoleOwner); err != nil {
+		return nil, err
+	}
+	return c.w.UpdateUser(user, update)
+}
+
+func (c *callerService) DeleteUser(user string) error {
+	if err := c.authorize(user, RoleOwner); err != nil {
+		return err
+	}
+	return c.w.DeleteUser(user)
+}
+
+// As never lets a caller act as someone else
+func (c *callerService) As(caller string) WardrobeService {
+	return c
+}
+
+// Access of others is for managers of the closet to know
+func (c *callerService) Access(caller string, user string) (Role, error) {
+	if caller != c.caller {
+		if err := c.authorize(user, RoleManager); err != nil {
+			return RoleNone, err
+		}
+	}
+	return c.w.Access(caller, user)
+}
+
+func (c *callerService) ShareCloset(user string, newShare NewShareRequest) (*GetShareResponse, error) {
+	if err := c.authorize(user, RoleManager); err != nil {
+		return nil, err
+	}
+	return c.w.ShareCloset(user, newShare)
+}
+
+func (c *callerService) AcceptShare(user string, owner string) error {
+	if err := c.authorize(user, RoleOwner); err != nil {
+		return err
+	}
+	return c.w.AcceptShare(user, owner)
+}
+
+// RevokeShare lets a grantee leave a closet on its own
+func (c *callerService) RevokeShare(user string, grantee string) error {
+	if grantee != c.caller {
+		if err := c.authorize(user, RoleManager); err != nil {
+			return err
+		}
+	}
+	return c.w.RevokeShare(user, grantee)
+}
+
+func (c *callerService) GetShares(user string) ([]*GetShareResponse, error) {
+	if err := c.authorize(user, RoleManager); err != nil {
+		return nil, err
+	}
+	return c.w.GetShares(user)
+}
+
+func (c *callerService) GetSharedWithMe(user string) ([]*GetShareResponse, error) {
+	if err := c.authorize(user, RoleOwner); err != nil {
+		return nil, err
+	}
+	return c.w.GetSharedWithMe(user)
+}
+
+// CreateShareLink publishes part of a closet, which is for managers
+func (c *callerService) CreateShareLink(user string, newLink NewShareLinkRequest) (*GetShareLinkResponse, error) {
+	if err := c.authorize(user, RoleManager); err != nil {
+		return nil, err
+	}
+	return c.w.CreateShareLink(user, newLink)
+}
+
+func (c *callerService) GetShareLinks(user string) ([]*GetShareLinkResponse, error) {
+	if err := c.authorize(user, RoleManager); err != nil {
+		return nil, err
+	}
+	return c.w.GetShareLinks(user)
+}
+
+func (c *callerService) RevokeShareLink(user string, id string) error {
+	if err := c.authorize(user, RoleManager); err != nil {
+		return err
+	}
+	return c.w.RevokeShareLink(user, id)
+}
+
+// GetLook needs nothing but the token
+func (c *callerService) GetLook(token string) (*GetLookResponse, error) {
+	return c.w.GetLook(token)
+}
+
+func (c *callerService) GetLookImage(token string, filename string, cb HandleImage) error {
+	return c.w.GetLookImage(token, filename, cb)
+}
+
+func (c *callerService) AddOutfit(newOt NewOutfitRequest) error {
+	if err := c.authorize(newOt.User, RoleContributor); err != nil {
+		return err
+	}
+	return c.w.AddOutfit(newOt)
+}
+
+func (c *callerService) DeleteOutfit(user string, id string) error {
+	if err := c.authorize(user, RoleManager); err != nil {
+		return err
+	}
+	return c.w.DeleteOutfit(user, id)
+}
+
+func (c *callerService) GetOutfit(user string, id string) (*GetOutfitResponse, error) {
+	if err := c.authorize(user, RoleViewer); err != nil {
+		return nil, err
+	}
+	return c.w.GetOutfit(user, id)
+}
+
+func (c *callerService) GetOutfits(user string, ids []string) ([]*GetOutfitResponse, error) {
+	if err := c.authorize(user, RoleViewer); err != nil {
+		return nil, err
+	}
+	return c.w.GetOutfits(user, ids)
+}
+
+func (c *callerService) GetAllOutfits(user string, opts ListOptions) (*GetOutfitPage, error) {
+	if err := c.authorize(user, RoleViewer); err != nil {
+		return nil, err
+	}
+	return c.w.GetAllOutfits(user, opts)
+}
+
+// ReactOutfit is for anyone who may see the outfit
+func (c *callerService) ReactOutfit(user string, id string, reaction Reaction) (*GetOutfitResponse, error) {
+	if err := c.authorize(user, RoleViewer); err != nil {
+		return nil, err
+	}
+	return c.w.ReactOutfit(user, id, reaction)
+}
+
+func (c *callerService) LogWear(newWear NewWearRequest) (*GetWearResponse, error) {
+	if err := c.authorize(newWear.User, RoleContributor); err != nil {
+		return nil, err
+	}
+	return c.w.LogWear(newWear)
+}
+
+func (c *callerService) GetWears(user string, limit int) ([]*GetWearResponse, error) {
+	if err := c.authorize(user, RoleViewer); err != nil {
+		return nil, err
+	}
+	return c.w.GetWears(user, limit)
+}
+
+// CreateWebhook sends closet events elsewhere, which is for managers
+func (c *callerService) CreateWebhook(user string, newHook NewWebhookRequest) (*GetWebhookResponse, error) {
+	if err := c.authorize(user, RoleManager); err != nil {
+		return nil, err
+	}
+	return c.w.CreateWebhook(user, newHook)
+}
+
+func (c *callerService) GetWebhooks(user string) ([]*GetWebhookResponse, error) {
+	if err := c.authorize(user, RoleManager); err != nil {
+		return nil, err
+	}
+	return c.w.GetWebhooks(user)
+}
+
+func (c *callerService) DeleteWebhook(user string, id string) error {
+	if err := c.authorize(user, RoleManager); err != nil {
+		return err
+	}
+	return c.w.DeleteWebhook(user, id)
+}
+
+func (c *callerService) GetDeliveries(user string, id string, limit int) ([]*GetDeliveryResponse, error) {
+	if err := c.authorize(user, RoleManager); err != nil {
+		return nil, err
+	}
+	return c.w.GetDeliveries(user, id, limit)
+}
+
+func (c *callerService) Redeliver(user string, id string, delivery string) (*GetDeliveryResponse, error) {
+	if err := c.authorize(user, RoleManager); err != nil {
+		return nil, err
+	}
+	return c.w.Redeliver(user, id, delivery)
+}
+
+func (c *callerService) WatchEvents(user string, lastEventId string) (*EventStream, error) {
+	if err := c.authorize(user, RoleViewer); err != nil {
+		return nil, err
+	}
+	return c.w.WatchEvents(user, lastEventId)
+}
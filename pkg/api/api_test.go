@@ -9,18 +9,39 @@ package api_test
 import (
 	"WardrobeManagerMS/pkg/api"
 	repo "WardrobeManagerMS/pkg/repository"
+	"bytes"
 	"crypto/md5"
+	"crypto/sha256"
 	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
 	"testing"
+	"time"
+)
+
+// Redis and MongoDB are external services; tests needing them only run
+// when their address is exported in the environment.
+const (
+	redisServerEnv = "WM_TEST_REDIS"
+	mongoServerEnv = "WM_TEST_MONGO"
 )
 
 type mockWardRepo struct{}
 
 func (m *mockWardRepo) Add(user string, wards *api.WardrobeCloset) error {
 	if user == "WardrobeDbUnavailableUser" {
-		return api.ResourceUnavailable{}
+		return &api.ResourceUnavailable{}
 	}
 
 	return nil
@@ -35,12 +56,28 @@ func (m *mockWardRepo) Get(user string) (*api.WardrobeCloset, error) {
 	return &api.WardrobeCloset{}, nil
 }
 
+func (m *mockWardRepo) GetAll() ([]*api.WardrobeCloset, error) {
+	return []*api.WardrobeCloset{}, nil
+}
+
+func (m *mockWardRepo) FindByImage(file string) (*api.WardrobeCloset, error) {
+	return nil, &api.UserNotFound{User: file}
+}
+
 func (m *mockWardRepo) Update(user string, wards *api.WardrobeCloset) error {
 	fmt.Printf("Updating user %s to repository\n", user)
 	fmt.Println(wards)
 	return nil
 }
 
+func (m *mockWardRepo) SetImageState(user string, id string, state string) error {
+	return nil
+}
+
+func (m *mockWardRepo) ListLabelsDue(sentBefore time.Time) ([]string, error) {
+	return []string{}, nil
+}
+
 func (m *mockWardRepo) DeleteAll(user string) error {
 	return nil
 }
@@ -69,14 +106,452 @@ func (m *mockImageRepo) DeleteFile(name string) error {
 	return nil
 }
 
+func (m *mockImageRepo) AddFileFromFile(name string, rd io.Reader) error {
+	fmt.Printf("Adding file to image folders %s\n", name)
+	_, err := io.Copy(io.Discard, rd)
+	return err
+}
+
+func (m *mockImageRepo) GetFileWithHandler(filename string, fileHandler api.HandleFile) error {
+	return nil
+}
+
+func (m *mockImageRepo) ListFiles() ([]api.ImageInfo, error) {
+	return []api.ImageInfo{}, nil
+}
+
+// memWardRepo and memImageRepo keep everything in maps so tests can inspect
+// what a service left behind
+type memWardRepo struct {
+	closets map[string]*api.WardrobeCloset
+}
+
+func newMemWardRepo() *memWardRepo {
+	return &memWardRepo{closets: make(map[string]*api.WardrobeCloset)}
+}
+
+func (m *memWardRepo) Add(user string, wards *api.WardrobeCloset) error {
+	m.closets[user] = wards
+	return nil
+}
+
+func (m *memWardRepo) Get(user string) (*api.WardrobeCloset, error) {
+	wc, ok := m.closets[user]
+	if !ok {
+		return nil, &api.UserNotFound{User: user}
+	}
+	return wc, nil
+}
+
+func (m *memWardRepo) GetAll() ([]*api.WardrobeCloset, error) {
+	all := make([]*api.WardrobeCloset, 0, len(m.closets))
+	for _, wc := range m.closets {
+		all = append(all, wc)
+	}
+	return all, nil
+}
+
+func (m *memWardRepo) FindByImage(file string) (*api.WardrobeCloset, error) {
+	for _, wc := range m.closets {
+		for _, ward := range wc.Wardrobes {
+			if ward.MainFile == file || ward.LabelFile == file {
+				return wc, nil
+			}
+		}
+	}
+	return nil, &api.UserNotFound{User: file}
+}
+
+func (m *memWardRepo) Update(user string, wards *api.WardrobeCloset) error {
+	m.closets[user] = wards
+	return nil
+}
+
+func (m *memWardRepo) SetImageState(user string, id string, state string) error {
+	if wc, ok := m.closets[user]; ok {
+		for i := range wc.Wardrobes {
+			if wc.Wardrobes[i].Identifier == id {
+				wc.Wardrobes[i].ImageState = state
+				return nil
+			}
+		}
+	}
+	return &api.ItemNotFound{User: user, Id: id}
+}
+
+func (m *memWardRepo) ListLabelsDue(sentBefore time.Time) ([]string, error) {
+	users := make([]string, 0)
+	for user, wc := range m.closets {
+		for _, ward := range wc.Wardrobes {
+			job := ward.Label
+			if job.State == api.LabelPending || job.State == api.LabelSent && !sentBefore.IsZero() && !job.Sent.After(sentBefore) {
+				users = append(users, user)
+				break
+			}
+		}
+	}
+	return users, nil
+}
+
+func (m *memWardRepo) DeleteAll(user string) error {
+	delete(m.closets, user)
+	return nil
+}
+
+type memUserRepo struct {
+	users map[string]*api.User
+}
+
+func newMemUserRepo() *memUserRepo {
+	return &memUserRepo{users: make(map[string]*api.User)}
+}
+
+func (m *memUserRepo) Add(user *api.User) error {
+	if _, err := m.GetByUsername(user.Username); err == nil {
+		return &api.DuplicateUser{User: user.Username}
+	}
+	if _, ok := m.users[user.Identifier]; ok {
+		return &api.DuplicateUser{User: user.Username}
+	}
+	u := *user
+	m.users[user.Identifier] = &u
+	return nil
+}
+
+func (m *memUserRepo) Get(id string) (*api.User, error) {
+	u, ok := m.users[id]
+	if !ok {
+		return nil, &api.UserNotFound{User: id}
+	}
+	c := *u
+	return &c, nil
+}
+
+func (m *memUserRepo) GetByUsername(username string) (*api.User, error) {
+	for _, u := range m.users {
+		if u.Username == username {
+			c := *u
+			return &c, nil
+		}
+	}
+	return nil, &api.UserNotFound{User: username}
+}
+
+func (m *memUserRepo) Update(user *api.User) error {
+	u := *user
+	m.users[user.Identifier] = &u
+	return nil
+}
+
+func (m *memUserRepo) Delete(id string) error {
+	delete(m.users, id)
+	return nil
+}
+
+type memShareRepo struct {
+	shares map[[2]string]*api.Share
+}
+
+func newMemShareRepo() *memShareRepo {
+	return &memShareRepo{shares: make(map[[2]string]*api.Share)}
+}
+
+func (m *memShareRepo) Add(share *api.Share) error {
+	sh := *share
+	m.shares[[2]string{share.Owner, share.User}] = &sh
+	return nil
+}
+
+func (m *memShareRepo) Get(owner string, user string) (*api.Share, error) {
+	sh, ok := m.shares[[2]string{owner, user}]
+	if !ok {
+		return nil, &api.ShareNotFound{Owner: owner, User: user}
+	}
+	c := *sh
+	return &c, nil
+}
+
+func (m *memShareRepo) ListByOwner(owner string) ([]*api.Share, error) {
+	shares := make([]*api.Share, 0)
+	for k, sh := range m.shares {
+		if k[0] == owner {
+			c := *sh
+			shares = append(shares, &c)
+		}
+	}
+	return shares, nil
+}
+
+func (m *memShareRepo) ListByUser(user string) ([]*api.Share, error) {
+	shares := make([]*api.Share, 0)
+	for k, sh := range m.shares {
+		if k[1] == user {
+			c := *sh
+			shares = append(shares, &c)
+		}
+	}
+	return shares, nil
+}
+
+func (m *memShareRepo) Update(share *api.Share) error {
+	return m.Add(share)
+}
+
+func (m *memShareRepo) Delete(owner string, user string) error {
+	delete(m.shares, [2]string{owner, user})
+	return nil
+}
+
+type memLinkRepo struct {
+	links map[string]*api.ShareLink
+}
+
+func newMemLinkRepo() *memLinkRepo {
+	return &memLinkRepo{links: make(map[string]*api.ShareLink)}
+}
+
+func (m *memLinkRepo) Add(link *api.ShareLink) error {
+	l := *link
+	m.links[link.Identifier] = &l
+	return nil
+}
+
+func (m *memLinkRepo) Get(id string) (*api.ShareLink, error) {
+	l, ok := m.links[id]
+	if !ok {
+		return nil, &api.LinkNotFound{Link: id}
+	}
+	c := *l
+	return &c, nil
+}
+
+func (m *memLinkRepo) GetByToken(tokenSum string) (*api.ShareLink, error) {
+	for _, l := range m.links {
+		if l.TokenSum == tokenSum {
+			c := *l
+			return &c, nil
+		}
+	}
+	return nil, &api.LinkNotFound{}
+}
+
+func (m *memLinkRepo) ListByOwner(owner string) ([]*api.ShareLink, error) {
+	links := make([]*api.ShareLink, 0)
+	for _, l := range m.links {
+		if l.Owner == owner {
+			c := *l
+			links = append(links, &c)
+		}
+	}
+	return links, nil
+}
+
+func (m *memLinkRepo) Delete(id string) error {
+	delete(m.links, id)
+	return nil
+}
+
+type memHookRepo struct {
+	mu         sync.Mutex
+	hooks      map[string]*api.Webhook
+	deliveries map[string]*api.Delivery
+}
+
+func newMemHookRepo() *memHookRepo {
+	return &memHookRepo{
+		hooks:      make(map[string]*api.Webhook),
+		deliveries: make(map[string]*api.Delivery),
+	}
+}
+
+func (m *memHookRepo) Add(hook *api.Webhook) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	h := *hook
+	m.hooks[hook.Identifier] = &h
+	return nil
+}
+
+func (m *memHookRepo) Get(id string) (*api.Webhook, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	h, ok := m.hooks[id]
+	if !ok {
+		return nil, &api.WebhookNotFound{Webhook: id}
+	}
+	c := *h
+	return &c, nil
+}
+
+func (m *memHookRepo) ListByOwner(owner string) ([]*api.Webhook, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	hooks := make([]*api.Webhook, 0)
+	for _, h := range m.hooks {
+		if h.Owner == owner {
+			c := *h
+			hooks = append(hooks, &c)
+		}
+	}
+	return hooks, nil
+}
+
+func (m *memHookRepo) Delete(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.hooks, id)
+	return nil
+}
+
+func (m *memHookRepo) AddDelivery(delivery *api.Delivery) error {
+	return m.UpdateDelivery(delivery)
+}
+
+func (m *memHookRepo) GetDelivery(id string) (*api.Delivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	d, ok := m.deliveries[id]
+	if !ok {
+		return nil, &api.DeliveryNotFound{Delivery: id}
+	}
+	c := *d
+	return &c, nil
+}
+
+func (m *memHookRepo) UpdateDelivery(delivery *api.Delivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	d := *delivery
+	m.deliveries[delivery.Identifier] = &d
+	return nil
+}
+
+func (m *memHookRepo) ListDeliveries(webhook string, limit int) ([]*api.Delivery, error) {
+	return m.list(func(d *api.Delivery) bool { return d.Webhook == webhook }, func(a, b *api.Delivery) bool { return a.Created.After(b.Created) }, limit)
+}
+
+func (m *memHookRepo) ClaimDue(now time.Time, lease time.Duration, limit int) ([]*api.Delivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	due := make([]*api.Delivery, 0)
+	for _, d := range m.deliveries {
+		if d.State == api.DeliveryPending && !d.Next.After(now) {
+			due = append(due, d)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].Next.Before(due[j].Next) })
+	if limit > 0 && len(due) > limit {
+		due = due[:limit]
+	}
+	claimed := make([]*api.Delivery, 0, len(due))
+	for _, d := range due {
+		d.Next = now.Add(lease)
+		c := *d
+		claimed = append(claimed, &c)
+	}
+	return claimed, nil
+}
+
+func (m *memHookRepo) list(match func(d *api.Delivery) bool, less func(a, b *api.Delivery) bool, limit int) ([]*api.Delivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	deliveries := make([]*api.Delivery, 0)
+	for _, d := range m.deliveries {
+		if match(d) {
+			c := *d
+			deliveries = append(deliveries, &c)
+		}
+	}
+	sort.Slice(deliveries, func(i, j int) bool { return less(deliveries[i], deliveries[j]) })
+	if limit > 0 && len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+	}
+	return deliveries, nil
+}
+
+func (m *memHookRepo) DeleteDeliveries(webhook string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id, d := range m.deliveries {
+		if d.Webhook == webhook {
+			delete(m.deliveries, id)
+		}
+	}
+	return nil
+}
+
+type memImageRepo struct {
+	files map[string]api.ImageInfo
+	data  map[string][]byte
+}
+
+func newMemImageRepo() *memImageRepo {
+	return &memImageRepo{
+		files: make(map[string]api.ImageInfo),
+		data:  make(map[string][]byte),
+	}
+}
+
+func (m *memImageRepo) AddFile(name string, file []byte) error {
+	m.files[name] = api.ImageInfo{Name: name, Size: int64(len(file)), ModTime: time.Now()}
+	m.data[name] = file
+	return nil
+}
+
+func (m *memImageRepo) GetFile(name string) ([]byte, error) {
+	data, ok := m.data[name]
+	if !ok {
+		return []byte{}, &api.NoSuchFileOrDirectory{File: name}
+	}
+	return data, nil
+}
+
+func (m *memImageRepo) UpdateFile(name string, file []byte) error {
+	return m.AddFile(name, file)
+}
+
+func (m *memImageRepo) DeleteFile(name string) error {
+	if _, ok := m.data[name]; !ok {
+		return &api.NoSuchFileOrDirectory{File: name}
+	}
+	delete(m.files, name)
+	delete(m.data, name)
+	return nil
+}
+
+func (m *memImageRepo) AddFileFromFile(name string, rd io.Reader) error {
+	data, err := io.ReadAll(rd)
+	if err != nil {
+		return err
+	}
+	return m.AddFile(name, data)
+}
+
+func (m *memImageRepo) GetFileWithHandler(filename string, fileHandler api.HandleFile) error {
+	return nil
+}
+
+func (m *memImageRepo) ListFiles() ([]api.ImageInfo, error) {
+	infos := make([]api.ImageInfo, 0, len(m.files))
+	for _, info := range m.files {
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
 func TestAddWardrobeService(t *testing.T) {
 
+	redisServer := os.Getenv(redisServerEnv)
+	if redisServer == "" {
+		t.Skipf("%s not set, skipping", redisServerEnv)
+	}
+
 	mockWardrobe := &mockWardRepo{}
 	mockImage := &mockImageRepo{}
 
-	ws, err := api.NewWardrobeService(mockWardrobe, mockImage)
+	ws, err := api.NewWardrobeService(mockWardrobe, newMemUserRepo(), newMemShareRepo(), newMemLinkRepo(), newMemHookRepo(), mockImage, api.Quota{}, api.LabelJobs{}, redisServer, "Text", "Label")
 	if err != nil {
-		t.Errorf(" NewWardrobService failed : %v", err)
+		t.Fatalf(" NewWardrobService failed : %v", err)
 	}
 
 	cases := []struct {
@@ -87,22 +562,24 @@ func TestAddWardrobeService(t *testing.T) {
 		{
 			name: "BasicAddNewWardrobeRequest",
 			newWd: api.NewWardrobeRequest{
-				User:        "foobar",
-				Id:          "",
-				Description: "Leggings",
-				MainImage:   []byte{0xAA, 0xBB, 0xCC},
-				LabelImage:  []byte{0xAA, 0xBB, 0xCC},
+				User:           "foobar",
+				Description:    "Leggings",
+				MainImage:      []byte{0xAA, 0xBB, 0xCC},
+				LabelImage:     []byte{0xAA, 0xBB, 0xCC},
+				MainImageMime:  tsFileHeader(t, "main-image", []byte{0xAA, 0xBB, 0xCC}),
+				LabelImageMime: tsFileHeader(t, "label-image", []byte{0xAA, 0xBB, 0xCC}),
 			},
 			expected: nil,
 		},
 		{
 			name: "WardrobeDBIsUnavailable",
 			newWd: api.NewWardrobeRequest{
-				User:        "WardrobeDbUnavailableUser",
-				Id:          "",
-				Description: "Leggings",
-				MainImage:   []byte{0xAA, 0xBB, 0xCC},
-				LabelImage:  []byte{0xAA, 0xBB, 0xCC},
+				User:           "WardrobeDbUnavailableUser",
+				Description:    "Leggings",
+				MainImage:      []byte{0xAA, 0xBB, 0xCC},
+				LabelImage:     []byte{0xAA, 0xBB, 0xCC},
+				MainImageMime:  tsFileHeader(t, "main-image", []byte{0xAA, 0xBB, 0xCC}),
+				LabelImageMime: tsFileHeader(t, "label-image", []byte{0xAA, 0xBB, 0xCC}),
 			},
 			expected: &api.ResourceUnavailable{
 				Server: "someserver:57400",
@@ -111,11 +588,12 @@ func TestAddWardrobeService(t *testing.T) {
 		{
 			name: "DuplicateImageFile",
 			newWd: api.NewWardrobeRequest{
-				User:        "DuplicateImageFileUser",
-				Id:          "",
-				Description: "DupLeggings",
-				MainImage:   []byte{0xAA, 0xBB, 0xCC},
-				LabelImage:  []byte{0xAA, 0xBB, 0xCC},
+				User:           "DuplicateImageFileUser",
+				Description:    "DupLeggings",
+				MainImage:      []byte{0xAA, 0xBB, 0xCC},
+				LabelImage:     []byte{0xAA, 0xBB, 0xCC},
+				MainImageMime:  tsFileHeader(t, "main-image", []byte{0xAA, 0xBB, 0xCC}),
+				LabelImageMime: tsFileHeader(t, "label-image", []byte{0xAA, 0xBB, 0xCC}),
 			},
 			expected: &api.DuplicateFile{
 				File: "",
@@ -133,7 +611,7 @@ func TestAddWardrobeService(t *testing.T) {
 						t.Errorf("Expected nil, got %v", err)
 					}
 				} else {
-					if errors.As(err, &c.expected) == false {
+					if tsErrorAs(err, c.expected) == false {
 						t.Errorf("Expected %v, got %v", c.expected, err)
 					}
 				}
@@ -148,16 +626,42 @@ func TestAddWardrobeService(t *testing.T) {
 
 func TestAddWardrobeServiceWithMongoDB(t *testing.T) {
 
-	mongoWardrobe, err1 := repo.NewWardrobeRepository()
+	redisServer := os.Getenv(redisServerEnv)
+	mongoServer := os.Getenv(mongoServerEnv)
+	if redisServer == "" || mongoServer == "" {
+		t.Skipf("%s or %s not set, skipping", redisServerEnv, mongoServerEnv)
+	}
+
+	mongoWardrobe, err1 := repo.NewWardrobeRepository(mongoServer)
 	if err1 != nil {
-		t.Errorf(" Initializing Mongo repository failed  : %v", err1)
+		t.Fatalf(" Initializing Mongo repository failed  : %v", err1)
+	}
+
+	mongoUser, err2 := repo.NewUserRepository(mongoServer)
+	if err2 != nil {
+		t.Fatalf(" Initializing Mongo user repository failed  : %v", err2)
+	}
+
+	mongoShare, err3 := repo.NewShareRepository(mongoServer)
+	if err3 != nil {
+		t.Fatalf(" Initializing Mongo share repository failed  : %v", err3)
+	}
+
+	mongoLink, err4 := repo.NewLinkRepository(mongoServer)
+	if err4 != nil {
+		t.Fatalf(" Initializing Mongo link repository failed  : %v", err4)
+	}
+
+	mongoHook, err5 := repo.NewWebhookRepository(mongoServer)
+	if err5 != nil {
+		t.Fatalf(" Initializing Mongo webhook repository failed  : %v", err5)
 	}
 
 	mockImage := &mockImageRepo{}
 
-	ws, err := api.NewWardrobeService(mongoWardrobe, mockImage)
+	ws, err := api.NewWardrobeService(mongoWardrobe, mongoUser, mongoShare, mongoLink, mongoHook, mockImage, api.Quota{}, api.LabelJobs{}, redisServer, "Text", "Label")
 	if err != nil {
-		t.Errorf(" NewWardrobService failed : %v", err)
+		t.Fatalf(" NewWardrobService failed : %v", err)
 	}
 
 	cases := []struct {
@@ -168,11 +672,12 @@ func TestAddWardrobeServiceWithMongoDB(t *testing.T) {
 		{
 			name: "BasicAddNewWardrobeRequest",
 			newWd: api.NewWardrobeRequest{
-				User:        "foobar",
-				Id:          "",
-				Description: "Leggings",
-				MainImage:   []byte{0xAA, 0xBB, 0xCC},
-				LabelImage:  []byte{0xAA, 0xBB, 0xCC},
+				User:           "foobar",
+				Description:    "Leggings",
+				MainImage:      []byte{0xAA, 0xBB, 0xCC},
+				LabelImage:     []byte{0xAA, 0xBB, 0xCC},
+				MainImageMime:  tsFileHeader(t, "main-image", []byte{0xAA, 0xBB, 0xCC}),
+				LabelImageMime: tsFileHeader(t, "label-image", []byte{0xAA, 0xBB, 0xCC}),
 			},
 			expected: nil,
 		},
@@ -188,7 +693,7 @@ func TestAddWardrobeServiceWithMongoDB(t *testing.T) {
 						t.Errorf("Expected nil, got %v", err)
 					}
 				} else {
-					if errors.As(err, &c.expected) == false {
+					if tsErrorAs(err, c.expected) == false {
 						t.Errorf("Expected %v, got %v", c.expected, err)
 					}
 				}
@@ -200,8 +705,1457 @@ func TestAddWardrobeServiceWithMongoDB(t *testing.T) {
 
 }
 
-func tsGenUniqImageFileName(user string, filename string) string {
-	stringToHash := []byte(user + "_image_" + filename)
-	md5Bytes := md5.Sum(stringToHash)
-	return hex.EncodeToString(md5Bytes[:])
+// failWardRepo fails every write
+type failWardRepo struct {
+	memWardRepo
+}
+
+func (m *failWardRepo) Add(user string, wards *api.WardrobeCloset) error {
+	return &api.ResourceUnavailable{Server: "someserver:57400"}
+}
+
+func (m *failWardRepo) Update(user string, wards *api.WardrobeCloset) error {
+	return &api.ResourceUnavailable{Server: "someserver:57400"}
+}
+
+// failLabelImageRepo fails the second file written
+type failLabelImageRepo struct {
+	memImageRepo
+}
+
+func (m *failLabelImageRepo) AddFileFromFile(name string, rd io.Reader) error {
+	if len(m.data) > 0 {
+		return errors.New("disk full")
+	}
+	return m.memImageRepo.AddFileFromFile(name, rd)
+}
+
+// userImageRepo hands out per user views of a memImageRepo and records
+// the user of every lookup and delete, "" for the shared view
+type userImageRepo struct {
+	*memImageRepo
+	user  string
+	users *[]string
+}
+
+func (m *userImageRepo) ForUser(user string) api.ImageRepository {
+	return &userImageRepo{m.memImageRepo, user, m.users}
+}
+
+func (m *userImageRepo) GetFile(name string) ([]byte, error) {
+	*m.users = append(*m.users, m.user)
+	return m.memImageRepo.GetFile(name)
+}
+
+func (m *userImageRepo) DeleteFile(name string) error {
+	*m.users = append(*m.users, m.user)
+	return m.memImageRepo.DeleteFile(name)
+}
+
+func TestAddWardrobeRollback(t *testing.T) {
+
+	newWd := func() api.NewWardrobeRequest {
+		return api.NewWardrobeRequest{
+			User:           "foobar",
+			Description:    "Leggings",
+			MainImageMime:  tsFileHeader(t, "main-image", []byte{0xAA, 0xBB, 0xCC}),
+			LabelImageMime: tsFileHeader(t, "label-image", []byte{0xAA, 0xBB, 0xCC}),
+		}
+	}
+
+	t.Run("DatabaseFailure", func(t *testing.T) {
+		imageRepo := newMemImageRepo()
+		ws := api.NewTestWardrobeService(&failWardRepo{*newMemWardRepo()}, newMemUserRepo(), newMemShareRepo(), newMemLinkRepo(), newMemHookRepo(), imageRepo, api.Quota{})
+
+		err := ws.AddWardrobe(newWd())
+		if tsErrorAs(err, &api.ResourceUnavailable{}) == false {
+			t.Errorf("Expected ResourceUnavailable, got %v", err)
+		}
+		if len(imageRepo.data) != 0 {
+			t.Errorf("Expected no images left behind, got %d", len(imageRepo.data))
+		}
+	})
+
+	t.Run("LabelImageFailure", func(t *testing.T) {
+		imageRepo := &failLabelImageRepo{*newMemImageRepo()}
+		wardRepo := newMemWardRepo()
+		ws := api.NewTestWardrobeService(wardRepo, newMemUserRepo(), newMemShareRepo(), newMemLinkRepo(), newMemHookRepo(), imageRepo, api.Quota{})
+
+		err := ws.AddWardrobe(newWd())
+		if err == nil {
+			t.Errorf("Expected error, got nil")
+		}
+		if len(imageRepo.data) != 0 {
+			t.Errorf("Expected no images left behind, got %d", len(imageRepo.data))
+		}
+		if _, err := wardRepo.Get("foobar"); err == nil {
+			t.Errorf("Expected no closet to be created")
+		}
+	})
+
+	t.Run("UserImages", func(t *testing.T) {
+		imageRepo := &userImageRepo{memImageRepo: newMemImageRepo(), users: &[]string{}}
+		ws := api.NewTestWardrobeService(&failWardRepo{*newMemWardRepo()}, newMemUserRepo(), newMemShareRepo(), newMemLinkRepo(), newMemHookRepo(), imageRepo, api.Quota{})
+
+		ws.AddWardrobe(newWd())
+		if len(imageRepo.data) != 0 {
+			t.Errorf("Expected no images left behind, got %d", len(imageRepo.data))
+		}
+		// two duplicate checks and two deletes, all in the store written to
+		if users := *imageRepo.users; len(users) != 4 || users[0] == "" || users[3] != users[0] {
+			t.Errorf("Expected the images of the user looked up and removed, got %q", users)
+		}
+	})
+}
+
+func TestAddWardrobeQuota(t *testing.T) {
+
+	wardRepo := newMemWardRepo()
+	wardRepo.Add("foobar", &api.WardrobeCloset{
+		User: "foobar",
+		Wardrobes: []api.Wardrobe{
+			{Identifier: "a", MainSize: 100, LabelSize: 20},
+			{Identifier: "b", MainSize: 100, LabelSize: 20},
+		},
+	})
+
+	cases := []struct {
+		name     string
+		quota    api.Quota
+		resource string
+	}{
+		{
+			name:     "MaxItems",
+			quota:    api.Quota{MaxItems: 2},
+			resource: "items",
+		},
+		{
+			name:     "MaxImageBytes",
+			quota:    api.Quota{MaxImageBytes: 241},
+			resource: "image-bytes",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			imageRepo := newMemImageRepo()
+			ws := api.NewTestWardrobeService(wardRepo, newMemUserRepo(), newMemShareRepo(), newMemLinkRepo(), newMemHookRepo(), imageRepo, c.quota)
+
+			err := ws.AddWardrobe(api.NewWardrobeRequest{
+				User:           "foobar",
+				Description:    "Leggings",
+				MainImageMime:  tsFileHeader(t, "main-image", []byte{0xAA, 0xBB, 0xCC}),
+				LabelImageMime: tsFileHeader(t, "label-image", []byte{0xAA, 0xBB, 0xCC}),
+			})
+
+			var qe *api.QuotaExceeded
+			if errors.As(err, &qe) == false || qe.Resource != c.resource {
+				t.Errorf("Expected %s quota exceeded, got %v", c.resource, err)
+			}
+			if len(imageRepo.data) != 0 {
+				t.Errorf("Expected nothing stored, got %d images", len(imageRepo.data))
+			}
+		})
+	}
+
+	usage, err := api.NewTestWardrobeService(wardRepo, newMemUserRepo(), newMemShareRepo(), newMemLinkRepo(), newMemHookRepo(), newMemImageRepo(), api.Quota{MaxItems: 10}).GetUsage("foobar")
+	if err != nil {
+		t.Fatalf("Expected nil, got %v", err)
+	}
+	expected := api.GetUsageResponse{Items: 2, MaxItems: 10, ImageBytes: 240}
+	if *usage != expected {
+		t.Errorf("Expected %+v, got %+v", expected, *usage)
+	}
+}
+
+func TestImageCollector(t *testing.T) {
+
+	wardRepo := newMemWardRepo()
+	imageRepo := newMemImageRepo()
+
+	wardRepo.Add("foobar", &api.WardrobeCloset{
+		User: "foobar",
+		Wardrobes: []api.Wardrobe{
+			{Identifier: "kept", MainFile: "kept-main", LabelFile: "kept-label"},
+			{Identifier: "dangling", MainFile: "gone-main", LabelFile: "kept-label2"},
+		},
+	})
+
+	old := time.Now().Add(-2 * time.Hour)
+	for _, name := range []string{"kept-main", "kept-label", "kept-label2", "orphan"} {
+		imageRepo.AddFile(name, []byte{0xAA})
+		imageRepo.files[name] = api.ImageInfo{Name: name, Size: 1, ModTime: old}
+	}
+	imageRepo.AddFile("in-flight", []byte{0xAA})
+
+	gc := api.NewImageCollector(wardRepo, imageRepo, time.Hour)
+
+	report, err := gc.Collect(true)
+	if err != nil {
+		t.Fatalf("Expected nil, got %v", err)
+	}
+	if !reflect.DeepEqual(report.Orphans, []string{"orphan"}) || len(report.Deleted) != 0 {
+		t.Errorf("Expected orphan reported only, got %+v", report)
+	}
+	if !reflect.DeepEqual(report.Skipped, []string{"in-flight"}) {
+		t.Errorf("Expected in-flight skipped, got %v", report.Skipped)
+	}
+	expected := []api.DanglingImage{{User: "foobar", Id: "dangling", File: "gone-main"}}
+	if !reflect.DeepEqual(report.Dangling, expected) {
+		t.Errorf("Expected %v, got %v", expected, report.Dangling)
+	}
+	if _, err := imageRepo.GetFile("orphan"); err != nil {
+		t.Errorf("Dry run deleted orphan : %v", err)
+	}
+
+	report, err = gc.Collect(false)
+	if err != nil {
+		t.Fatalf("Expected nil, got %v", err)
+	}
+	if !reflect.DeepEqual(report.Deleted, []string{"orphan"}) {
+		t.Errorf("Expected orphan deleted, got %v", report.Deleted)
+	}
+	if _, err := imageRepo.GetFile("orphan"); err == nil {
+		t.Errorf("Expected orphan to be gone")
+	}
+}
+
+// scrubWardRepo refuses to write back whole closets, the scrubber runs next
+// to the server and would undo what it wrote since
+type scrubWardRepo struct {
+	*memWardRepo
+}
+
+func (m scrubWardRepo) Update(user string, wards *api.WardrobeCloset) error {
+	return fmt.Errorf("closet of %s written back", user)
+}
+
+func TestImageScrubber(t *testing.T) {
+
+	imageRepo, _ := repo.NewFileImageRepository(t.TempDir())
+	image := []byte("some image bytes")
+	sum := sha256.Sum256(image)
+
+	files := []string{"good", "truncated", "corrupted", "missing"}
+	wardRepo := newMemWardRepo()
+	wc := &api.WardrobeCloset{User: "foobar"}
+	for _, file := range files {
+		wc.Wardrobes = append(wc.Wardrobes, api.Wardrobe{
+			Identifier: file,
+			MainFile:   file,
+			MainSize:   int64(len(image)),
+			MainSum:    hex.EncodeToString(sum[:]),
+		})
+	}
+	wc.Wardrobes = append(wc.Wardrobes, api.Wardrobe{Identifier: "legacy", MainFile: "good"})
+	wardRepo.Add("foobar", wc)
+
+	imageRepo.AddFile("good", image)
+	imageRepo.AddFile("truncated", image[:4])
+	imageRepo.AddFile("corrupted", bytes.ToUpper(image))
+
+	report, err := api.NewImageScrubber(scrubWardRepo{wardRepo}, imageRepo).Scrub(true)
+	if err != nil {
+		t.Fatalf("Expected nil, got %v", err)
+	}
+	if report.Scanned != 4 || report.Unverified != 1 || report.Marked != 3 {
+		t.Errorf("Unexpected report %+v", report)
+	}
+
+	for _, ward := range wc.Wardrobes {
+		expected := map[string]string{
+			"truncated": api.ImageTruncated,
+			"corrupted": api.ImageCorrupted,
+			"missing":   api.ImageMissing,
+		}[ward.Identifier]
+		if ward.ImageState != expected {
+			t.Errorf("Expected %s to be marked %q, got %q", ward.Identifier, expected, ward.ImageState)
+		}
+	}
+
+	// reads are verified as well
+	ws := api.NewTestWardrobeService(wardRepo, newMemUserRepo(), newMemShareRepo(), newMemLinkRepo(), newMemHookRepo(), imageRepo, api.Quota{})
+	served := false
+	err = ws.GetFile("good", func(path string) error {
+		served = true
+		return nil
+	})
+	if err != nil || !served {
+		t.Errorf("Expected good image served, got %v", err)
+	}
+
+	err = ws.GetFile("corrupted", func(path string) error {
+		t.Errorf("Corrupted image must not be served")
+		return nil
+	})
+	var cm *api.ChecksumMismatch
+	if errors.As(err, &cm) == false {
+		t.Errorf("Expected ChecksumMismatch, got %v", err)
+	}
+}
+
+func TestImageScrubberEncrypted(t *testing.T) {
+
+	dir := t.TempDir()
+	masterPath := filepath.Join(dir, "master.keys")
+	repo.GenerateMasterKey(masterPath)
+	keys, err := repo.OpenKeyRing(masterPath, filepath.Join(dir, "data.keys"))
+	if err != nil {
+		t.Fatalf("Expected nil, got %v", err)
+	}
+	plainRepo, _ := repo.NewFileImageRepository(filepath.Join(dir, "images"))
+	imageRepo := repo.NewEncryptedImageRepository(plainRepo, keys)
+
+	image := []byte("some image bytes")
+	sum := sha256.Sum256(image)
+	imageRepo.(api.UserImageRepository).ForUser("foobar").AddFile("good", image)
+
+	// a flipped bit fails authentication, a cut off header cannot be read
+	stored, _ := plainRepo.GetFile("good")
+	tampered := append([]byte{}, stored...)
+	tampered[len(tampered)-1] ^= 0x01
+	plainRepo.AddFile("tampered", tampered)
+	plainRepo.AddFile("truncated", stored[:8])
+
+	wardRepo := newMemWardRepo()
+	wc := &api.WardrobeCloset{User: "foobar"}
+	for _, file := range []string{"good", "tampered", "truncated"} {
+		wc.Wardrobes = append(wc.Wardrobes, api.Wardrobe{
+			Identifier: file,
+			MainFile:   file,
+			MainSize:   int64(len(image)),
+			MainSum:    hex.EncodeToString(sum[:]),
+		})
+	}
+	wardRepo.Add("foobar", wc)
+
+	report, err := api.NewImageScrubber(wardRepo, imageRepo).Scrub(false)
+	if err != nil {
+		t.Fatalf("Expected damaged images reported, got %v", err)
+	}
+	if report.Scanned != 3 || len(report.Damaged) != 2 {
+		t.Fatalf("Unexpected report %+v", report)
+	}
+	for _, damaged := range report.Damaged {
+		if damaged.State != api.ImageCorrupted {
+			t.Errorf("Expected %s corrupted, got %q", damaged.File, damaged.State)
+		}
+	}
+
+	ws := api.NewTestWardrobeService(wardRepo, newMemUserRepo(), newMemShareRepo(), newMemLinkRepo(), newMemHookRepo(), imageRepo, api.Quota{})
+	err = ws.GetFile("tampered", func(path string) error {
+		t.Errorf("Tampered image must not be served")
+		return nil
+	})
+	var cm *api.ChecksumMismatch
+	if errors.As(err, &cm) == false || cm.State != api.ImageCorrupted {
+		t.Errorf("Expected ChecksumMismatch, got %v", err)
+	}
+}
+
+func TestUsers(t *testing.T) {
+
+	wardRepo := newMemWardRepo()
+	userRepo := newMemUserRepo()
+	ws := api.NewTestWardrobeService(wardRepo, userRepo, newMemShareRepo(), newMemLinkRepo(), newMemHookRepo(), newMemImageRepo(), api.Quota{})
+
+	user, err := ws.RegisterUser(api.NewUserRequest{
+		Username:    "foobar",
+		DisplayName: "Foo Bar",
+		Preferences: map[string]string{"size": "M"},
+	})
+	if err != nil {
+		t.Fatalf("Expected nil, got %v", err)
+	}
+	if user.Id == "" || user.Id == "foobar" {
+		t.Errorf("Expected a generated id, got %q", user.Id)
+	}
+
+	_, err = ws.RegisterUser(api.NewUserRequest{Username: "foobar"})
+	if tsErrorAs(err, &api.DuplicateUser{}) == false {
+		t.Errorf("Expected DuplicateUser, got %v", err)
+	}
+
+	// the closet and its image names are keyed by id
+	wardRepo.Add(user.Id, &api.WardrobeCloset{
+		User:      user.Id,
+		Wardrobes: []api.Wardrobe{{Identifier: "item", MainFile: "main", LabelFile: "label"}},
+	})
+
+	updated, err := ws.UpdateUser("foobar", api.UpdateUserRequest{
+		Username:    "foobar",
+		Preferences: map[string]string{"size": "", "colour": "blue"},
+	})
+	if err != nil {
+		t.Fatalf("Expected nil, got %v", err)
+	}
+	if updated.Id != user.Id || updated.DisplayName != "Foo Bar" {
+		t.Errorf("Unexpected user after update %+v", updated)
+	}
+	if !reflect.DeepEqual(updated.Preferences, map[string]string{"colour": "blue"}) {
+		t.Errorf("Unexpected preferences %v", updated.Preferences)
+	}
+
+	// credentials name the user, a rename would hand the closet to whoever
+	// registers the old name next
+	asFoobar := ws.As("foobar")
+	if _, err := asFoobar.UpdateUser("foobar", api.UpdateUserRequest{Username: "barfoo"}); tsErrorAs(err, &api.InvalidRequest{}) == false {
+		t.Errorf("Expected InvalidRequest renaming, got %v", err)
+	}
+	ward, err := asFoobar.GetWardrobe("foobar", "item")
+	if err != nil || ward.MainImage != "main" {
+		t.Errorf("Expected item after a refused rename, got %v, %v", ward, err)
+	}
+	if _, err := ws.RegisterUser(api.NewUserRequest{Username: "barfoo"}); err != nil {
+		t.Fatalf("Expected nil, got %v", err)
+	}
+	if _, err := ws.As("barfoo").GetWardrobe("foobar", "item"); tsErrorAs(err, &api.Forbidden{}) == false {
+		t.Errorf("Expected Forbidden for another user, got %v", err)
+	}
+
+	// closets from before user accounts are adopted, keeping their key
+	wardRepo.Add("legacy", &api.WardrobeCloset{User: "legacy"})
+
+	legacy, err := ws.GetUser("legacy")
+	if err != nil || legacy.Id != "legacy" {
+		t.Errorf("Expected legacy closet adopted, got %+v, %v", legacy, err)
+	}
+
+	err = ws.DeleteUser("foobar")
+	if err != nil {
+		t.Fatalf("Expected nil, got %v", err)
+	}
+	if _, err := wardRepo.Get(user.Id); err == nil {
+		t.Errorf("Expected closet deleted with the user")
+	}
+}
+
+func TestClosetSharing(t *testing.T) {
+
+	wardRepo := newMemWardRepo()
+	ws := api.NewTestWardrobeService(wardRepo, newMemUserRepo(), newMemShareRepo(), newMemLinkRepo(), newMemHookRepo(), newMemImageRepo(), api.Quota{})
+
+	for _, name := range []string{"alice", "bob", "carol"} {
+		if _, err := ws.RegisterUser(api.NewUserRequest{Username: name}); err != nil {
+			t.Fatalf("Expected nil, got %v", err)
+		}
+	}
+	alice, _ := ws.GetUser("alice")
+	wardRepo.Add(alice.Id, &api.WardrobeCloset{
+		User:      alice.Id,
+		Wardrobes: []api.Wardrobe{{Identifier: "item"}},
+		Outfits:   []api.Outfit{{Identifier: "look"}},
+	})
+
+	asAlice, asBob, asCarol := ws.As("alice"), ws.As("bob"), ws.As("carol")
+
+	if _, err := asBob.GetWardrobe("alice", "item"); tsErrorAs(err, &api.Forbidden{}) == false {
+		t.Errorf("Expected Forbidden before sharing, got %v", err)
+	}
+	if _, err := asBob.ShareCloset("alice", api.NewShareRequest{User: "bob", Role: api.RoleManager}); tsErrorAs(err, &api.Forbidden{}) == false {
+		t.Errorf("Expected Forbidden sharing someone else's closet, got %v", err)
+	}
+
+	_, err := asAlice.ShareCloset("alice", api.NewShareRequest{User: "bob", Role: api.RoleViewer})
+	if err != nil {
+		t.Fatalf("Expected nil, got %v", err)
+	}
+
+	// invitations grant nothing until accepted
+	if _, err := asBob.GetWardrobe("alice", "item"); tsErrorAs(err, &api.Forbidden{}) == false {
+		t.Errorf("Expected Forbidden before accepting, got %v", err)
+	}
+	if err := asCarol.AcceptShare("bob", "alice"); tsErrorAs(err, &api.Forbidden{}) == false {
+		t.Errorf("Expected Forbidden accepting for someone else, got %v", err)
+	}
+	if err := asBob.AcceptShare("bob", "alice"); err != nil {
+		t.Fatalf("Expected nil, got %v", err)
+	}
+
+	shared, err := asBob.GetSharedWithMe("bob")
+	if err != nil || len(shared) != 1 || shared[0].Owner != "alice" || !shared[0].Accepted {
+		t.Errorf("Unexpected shared closets %+v, %v", shared, err)
+	}
+
+	if _, err := asBob.GetWardrobe("alice", "item"); err != nil {
+		t.Errorf("Expected viewer to read, got %v", err)
+	}
+	if err := asBob.DeleteOutfit("alice", "look"); tsErrorAs(err, &api.Forbidden{}) == false {
+		t.Errorf("Expected Forbidden for viewer deleting, got %v", err)
+	}
+	if _, err := asBob.GetShares("alice"); tsErrorAs(err, &api.Forbidden{}) == false {
+		t.Errorf("Expected Forbidden for viewer listing shares, got %v", err)
+	}
+
+	// a new role keeps the share accepted
+	asAlice.ShareCloset("alice", api.NewShareRequest{User: "bob", Role: api.RoleManager})
+	if err := asBob.DeleteOutfit("alice", "look"); err != nil {
+		t.Errorf("Expected manager to delete, got %v", err)
+	}
+	if _, err := asBob.GetShares("alice"); err != nil {
+		t.Errorf("Expected manager to list shares, got %v", err)
+	}
+	if _, err := asBob.UpdateUser("alice", api.UpdateUserRequest{Preferences: map[string]string{"size": "S"}}); tsErrorAs(err, &api.Forbidden{}) == false {
+		t.Errorf("Expected Forbidden for manager updating owner, got %v", err)
+	}
+
+	// grantees may leave on their own
+	if err := asBob.RevokeShare("alice", "bob"); err != nil {
+		t.Fatalf("Expected nil, got %v", err)
+	}
+	if _, err := asBob.GetWardrobe("alice", "item"); tsErrorAs(err, &api.Forbidden{}) == false {
+		t.Errorf("Expected Forbidden after revoking, got %v", err)
+	}
+}
+
+func TestShareLinks(t *testing.T) {
+
+	wardRepo := newMemWardRepo()
+	linkRepo := newMemLinkRepo()
+	imageRepo, _ := repo.NewFileImageRepository(t.TempDir())
+	ws := api.NewTestWardrobeService(wardRepo, newMemUserRepo(), newMemShareRepo(), linkRepo, newMemHookRepo(), imageRepo, api.Quota{})
+
+	user, err := ws.RegisterUser(api.NewUserRequest{Username: "foobar"})
+	if err != nil {
+		t.Fatalf("Expected nil, got %v", err)
+	}
+	wardRepo.Add(user.Id, &api.WardrobeCloset{
+		User: user.Id,
+		Wardrobes: []api.Wardrobe{
+			{Identifier: "top", MainFile: "top-main", LabelFile: "top-label"},
+			{Identifier: "bottom", MainFile: "bottom-main", LabelFile: "bottom-label"},
+			{Identifier: "private", MainFile: "private-main", LabelFile: "private-label"},
+		},
+		Outfits: []api.Outfit{{Identifier: "look", TopId: "top", BottomId: "bottom"}},
+	})
+	for _, file := range []string{"top-main", "private-main"} {
+		imageRepo.AddFile(file, []byte(file))
+	}
+
+	if _, err := ws.CreateShareLink("foobar", api.NewShareLinkRequest{Items: []string{"nothing"}}); err == nil {
+		t.Errorf("Expected error sharing an unknown item")
+	}
+
+	link, err := ws.CreateShareLink("foobar", api.NewShareLinkRequest{Outfit: "look"})
+	if err != nil {
+		t.Fatalf("Expected nil, got %v", err)
+	}
+	if len(link.Token) < 40 {
+		t.Errorf("Expected an unguessable token, got %q", link.Token)
+	}
+
+	look, err := ws.GetLook(link.Token)
+	if err != nil {
+		t.Fatalf("Expected nil, got %v", err)
+	}
+	if look.Outfit == nil || len(look.Items) != 2 {
+		t.Errorf("Expected the outfit and its two items, got %+v", look)
+	}
+
+	served := false
+	err = ws.GetLookImage(link.Token, "top-main", func(content io.ReadSeeker, meta api.ImageMeta) error {
+		served = true
+		return nil
+	})
+	if err != nil || !served {
+		t.Errorf("Expected image of the look served, got %v", err)
+	}
+	err = ws.GetLookImage(link.Token, "private-main", func(content io.ReadSeeker, meta api.ImageMeta) error {
+		t.Errorf("Image outside the look must not be served")
+		return nil
+	})
+	if tsErrorAs(err, &api.NoSuchFileOrDirectory{}) == false {
+		t.Errorf("Expected NoSuchFileOrDirectory, got %v", err)
+	}
+
+	if _, err := ws.GetLook(link.Token + "x"); tsErrorAs(err, &api.LinkNotFound{}) == false {
+		t.Errorf("Expected LinkNotFound for a wrong token, got %v", err)
+	}
+
+	// expired links are gone
+	for _, l := range linkRepo.links {
+		l.Expires = time.Now().Add(-time.Minute)
+	}
+	if _, err := ws.GetLook(link.Token); tsErrorAs(err, &api.LinkNotFound{}) == false {
+		t.Errorf("Expected LinkNotFound once expired, got %v", err)
+	}
+
+	links, err := ws.GetShareLinks("foobar")
+	if err != nil || len(links) != 1 || links[0].Token != "" {
+		t.Errorf("Expected one link without its token, got %+v, %v", links, err)
+	}
+	if err := ws.RevokeShareLink("foobar", link.Id); err != nil {
+		t.Fatalf("Expected nil, got %v", err)
+	}
+	if len(linkRepo.links) != 0 {
+		t.Errorf("Expected link to be revoked")
+	}
+}
+
+func tsGenUniqImageFileName(user string, filename string) string {
+	stringToHash := []byte(user + "_image_" + filename)
+	md5Bytes := md5.Sum(stringToHash)
+	return hex.EncodeToString(md5Bytes[:])
+}
+
+// tsErrorAs reports whether err wraps an error of the same type as expected.
+func tsErrorAs(err error, expected error) bool {
+	target := reflect.New(reflect.TypeOf(expected))
+	return errors.As(err, target.Interface())
+}
+
+// tsFileHeader wraps content in a multipart form the way gin would hand it
+// to the handler.
+func tsFileHeader(t *testing.T, field string, content []byte) *multipart.FileHeader {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+
+	fw, err := mw.CreateFormFile(field, field+".jpeg")
+	if err != nil {
+		t.Fatalf("Error creating form file : %v", err)
+	}
+	fw.Write(content)
+	mw.Close()
+
+	form, err := multipart.NewReader(&body, mw.Boundary()).ReadForm(1 << 20)
+	if err != nil {
+		t.Fatalf("Error reading form : %v", err)
+	}
+
+	return form.File[field][0]
+}
+
+func TestErrorKinds(t *testing.T) {
+
+	wardRepo := newMemWardRepo()
+	wardRepo.Add("foobar", &api.WardrobeCloset{
+		User:      "foobar",
+		Wardrobes: []api.Wardrobe{{Identifier: "item", MainFile: "main", LabelFile: "label"}},
+	})
+	ws := api.NewTestWardrobeService(wardRepo, newMemUserRepo(), newMemShareRepo(), newMemLinkRepo(), newMemHookRepo(), newMemImageRepo(), api.Quota{})
+
+	_, err := ws.GetWardrobe("foobar", "missing")
+	if tsErrorAs(err, &api.ItemNotFound{}) == false {
+		t.Errorf("Expected ItemNotFound, got %v", err)
+	}
+
+	err = ws.DeleteOutfit("foobar", "missing")
+	if tsErrorAs(err, &api.OutfitNotFound{}) == false {
+		t.Errorf("Expected OutfitNotFound, got %v", err)
+	}
+
+	cases := []struct {
+		name string
+		err  error
+		kind api.ErrorKind
+		code string
+	}{
+		{"Outfit", err, api.KindNotFound, "outfit-not-found"},
+		{"Wrapped", fmt.Errorf("delete : %w", &api.DuplicateFile{}), api.KindConflict, "duplicate-file"},
+		{"Validation", &api.InvalidRequest{Field: "expires", Reason: "in the past"}, api.KindValidation, "invalid-expires"},
+		{"Unavailable", &api.ResourceUnavailable{Server: "redis"}, api.KindUnavailable, "unavailable"},
+		{"Plain", errors.New("boom"), api.KindInternal, "internal-error"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if kind := api.ErrorKindOf(c.err); kind != c.kind {
+				t.Errorf("Expected kind %s, got %s", c.kind, kind)
+			}
+			if code := api.ErrorCodeOf(c.err); code != c.code {
+				t.Errorf("Expected code %s, got %s", c.code, code)
+			}
+		})
+	}
+}
+
+func TestListing(t *testing.T) {
+
+	day := func(d int) time.Time { return time.Date(2026, 10, d, 0, 0, 0, 0, time.UTC) }
+
+	wardRepo := newMemWardRepo()
+	wardRepo.Add("foobar", &api.WardrobeCloset{
+		User: "foobar",
+		Wardrobes: []api.Wardrobe{
+			{Identifier: "a", Description: "Shirt", Created: day(3)},
+			{Identifier: "b", Description: "jeans", Created: day(1), LastWorn: day(9)},
+			{Identifier: "c", Description: "Skirt", Created: day(2), ImageState: "damaged"},
+			{Identifier: "d", Description: "Blouse", Created: day(4)},
+		},
+		Outfits: []api.Outfit{
+			{Identifier: "o1", TopId: "a", BottomId: "b", Description: "Office", LikeCount: 2, Created: day(5)},
+			{Identifier: "o2", TopId: "d", BottomId: "c", Description: "Party", LikeCount: 5, Created: day(6)},
+		},
+	})
+	wardRepo.Add("empty", &api.WardrobeCloset{User: "empty"})
+	ws := api.NewTestWardrobeService(wardRepo, newMemUserRepo(), newMemShareRepo(), newMemLinkRepo(), newMemHookRepo(), newMemImageRepo(), api.Quota{})
+
+	// all pages of a listing, following the cursors
+	list := func(opts api.ListOptions) []string {
+		var ids []string
+		for {
+			page, err := ws.GetAllWardrobe("foobar", opts)
+			if err != nil {
+				t.Fatalf("Expected nil, got %v", err)
+			}
+			for _, ward := range page.Items {
+				ids = append(ids, ward.Id)
+			}
+			if page.Next == "" {
+				return ids
+			}
+			opts.Cursor = page.Next
+		}
+	}
+
+	cases := []struct {
+		name     string
+		opts     api.ListOptions
+		expected []string
+	}{
+		{"Created", api.ListOptions{}, []string{"b", "c", "a", "d"}},
+		{"CreatedPaged", api.ListOptions{Limit: 1}, []string{"b", "c", "a", "d"}},
+		{"Description", api.ListOptions{Sort: "description", Limit: 3}, []string{"d", "b", "a", "c"}},
+		{"LastWorn", api.ListOptions{Sort: "-last-worn", Limit: 2}, []string{"b", "d", "c", "a"}},
+		{"Likes", api.ListOptions{Sort: "-likes", Limit: 2}, []string{"d", "c", "b", "a"}},
+		{"Filter", api.ListOptions{Filter: map[string]string{"description": "IR"}}, []string{"c", "a"}},
+		{"FilterState", api.ListOptions{Filter: map[string]string{"image-state": "damaged"}}, []string{"c"}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if ids := list(c.opts); !reflect.DeepEqual(ids, c.expected) {
+				t.Errorf("Expected %v, got %v", c.expected, ids)
+			}
+		})
+	}
+
+	// a cursor stays valid when the item it points at is gone
+	page, _ := ws.GetAllWardrobe("foobar", api.ListOptions{Limit: 2})
+	if err := ws.DeleteWardrobe("foobar", "c"); err != nil {
+		t.Fatalf("Expected nil, got %v", err)
+	}
+	rest, err := ws.GetAllWardrobe("foobar", api.ListOptions{Limit: 2, Cursor: page.Next})
+	if err != nil || len(rest.Items) != 2 || rest.Items[0].Id != "a" {
+		t.Errorf("Expected a and d after deleted c, got %v %v", rest, err)
+	}
+
+	outfits, err := ws.GetAllOutfits("foobar", api.ListOptions{Sort: "-likes", Filter: map[string]string{"item": "d"}})
+	if err != nil || len(outfits.Outfits) != 1 || outfits.Outfits[0].Id != "o2" {
+		t.Errorf("Expected outfit o2, got %v %v", outfits, err)
+	}
+
+	empty, err := ws.GetAllOutfits("empty", api.ListOptions{})
+	if err != nil || empty.Outfits == nil || len(empty.Outfits) != 0 || empty.Next != "" {
+		t.Errorf("Expected an empty page, got %v %v", empty, err)
+	}
+
+	invalid := []struct {
+		name  string
+		opts  api.ListOptions
+		field string
+	}{
+		{"Sort", api.ListOptions{Sort: "colour"}, "sort"},
+		{"Filter", api.ListOptions{Filter: map[string]string{"colour": "red"}}, "filter"},
+		{"Limit", api.ListOptions{Limit: api.MaxListLimit + 1}, "limit"},
+		{"Cursor", api.ListOptions{Cursor: "garbage"}, "cursor"},
+		{"CursorOtherSort", api.ListOptions{Cursor: page.Next, Sort: "likes"}, "cursor"},
+	}
+
+	for _, c := range invalid {
+		t.Run("Invalid"+c.name, func(t *testing.T) {
+			_, err := ws.GetAllWardrobe("foobar", c.opts)
+			var ir *api.InvalidRequest
+			if !errors.As(err, &ir) || ir.Field != c.field {
+				t.Errorf("Expected invalid %s, got %v", c.field, err)
+			}
+		})
+	}
+}
+
+func TestSearch(t *testing.T) {
+
+	wardRepo := newMemWardRepo()
+	wardRepo.Add("foobar", &api.WardrobeCloset{
+		User: "foobar",
+		Wardrobes: []api.Wardrobe{
+			{Identifier: "sweater", Description: "Grey merino sweater", Brand: "Icebreaker", Tags: []string{"wool", "winter"},
+				LabelText: "100% MERINO WOOL. DRY CLEAN ONLY"},
+			{Identifier: "shirt", Description: "Linen shirt", Brand: "Uniqlo", Tags: []string{"summer"},
+				LabelText: "Machine wash cold. Do not dry clean. Only iron on low"},
+			{Identifier: "scarf", Description: "Scarf", Tags: []string{"merino"},
+				LabelText: "Hand wash"},
+			{Identifier: "jeans", Description: "Slim jeans", Brand: "Levi's"},
+		},
+	})
+	ws := api.NewTestWardrobeService(wardRepo, newMemUserRepo(), newMemShareRepo(), newMemLinkRepo(), newMemHookRepo(), newMemImageRepo(), api.Quota{})
+
+	cases := []struct {
+		name     string
+		query    string
+		expected []string
+	}{
+		{"Description", "merino", []string{"sweater", "scarf"}},
+		{"Phrase", "dry clean only", []string{"sweater", "shirt"}},
+		{"CaseAndPlural", "JEAN", []string{"jeans"}},
+		{"Brand", "uniqlo", []string{"shirt"}},
+		{"AllWords", "merino hand", []string{"scarf"}},
+		{"StopWords", "the scarf", []string{"scarf"}},
+		{"None", "cashmere", []string{}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			hits, err := ws.Search("foobar", c.query, 0)
+			if err != nil {
+				t.Fatalf("Expected nil, got %v", err)
+			}
+			ids := make([]string, 0)
+			for _, hit := range hits {
+				ids = append(ids, hit.Item.Id)
+			}
+			if !reflect.DeepEqual(ids, c.expected) {
+				t.Errorf("Expected %v, got %v", c.expected, ids)
+			}
+		})
+	}
+
+	hits, _ := ws.Search("foobar", "merino", 1)
+	if len(hits) != 1 || !reflect.DeepEqual(hits[0].Fields, []string{"description", "label-text"}) {
+		t.Errorf("Expected the sweater matched in description and label text, got %+v", hits)
+	}
+
+	_, err := ws.Search("foobar", " ?! ", 0)
+	if tsErrorAs(err, &api.InvalidRequest{}) == false {
+		t.Errorf("Expected InvalidRequest, got %v", err)
+	}
+}
+
+func TestWears(t *testing.T) {
+
+	day := func(d int) time.Time { return time.Date(2026, 10, d, 0, 0, 0, 0, time.UTC) }
+
+	wardRepo := newMemWardRepo()
+	wardRepo.Add("foobar", &api.WardrobeCloset{
+		User: "foobar",
+		Wardrobes: []api.Wardrobe{
+			{Identifier: "a", Description: "Shirt"},
+			{Identifier: "b", Description: "Jeans", LastWorn: day(9)},
+			{Identifier: "c", Description: "Scarf"},
+		},
+		Outfits: []api.Outfit{
+			{Identifier: "o1", TopId: "a", BottomId: "b", Description: "Office"},
+		},
+	})
+	ws := api.NewTestWardrobeService(wardRepo, newMemUserRepo(), newMemShareRepo(), newMemLinkRepo(), newMemHookRepo(), newMemImageRepo(), api.Quota{})
+
+	worn := day(5)
+	wear, err := ws.LogWear(api.NewWearRequest{User: "foobar", Outfit: "o1", Items: []string{"c", "a"}, Worn: &worn})
+	if err != nil {
+		t.Fatalf("Expected nil, got %v", err)
+	}
+	if !reflect.DeepEqual(wear.Items, []string{"a", "b", "c"}) {
+		t.Errorf("Expected the outfit items and the scarf, got %v", wear.Items)
+	}
+
+	if _, err := ws.LogWear(api.NewWearRequest{User: "foobar", Items: []string{"c"}}); err != nil {
+		t.Fatalf("Expected nil, got %v", err)
+	}
+
+	// an earlier wear does not move last worn back
+	items, err := ws.GetWardrobes("foobar", []string{"b", "missing", "a"})
+	if err != nil || len(items) != 3 || items[1] != nil {
+		t.Fatalf("Expected b, nil and a, got %v %v", items, err)
+	}
+	if !items[0].LastWorn.Equal(day(9)) || !items[2].LastWorn.Equal(worn) {
+		t.Errorf("Unexpected last worn %v and %v", items[0].LastWorn, items[2].LastWorn)
+	}
+
+	outfits, err := ws.GetOutfits("foobar", []string{"o1"})
+	if err != nil || len(outfits) != 1 || !outfits[0].LastWorn.Equal(worn) {
+		t.Errorf("Expected o1 last worn on the 5th, got %v %v", outfits, err)
+	}
+
+	wears, err := ws.GetWears("foobar", 0)
+	if err != nil || len(wears) != 2 || wears[1].Id != wear.Id {
+		t.Fatalf("Expected the logged wears, last first, got %v %v", wears, err)
+	}
+	if wears, _ := ws.GetWears("foobar", 1); len(wears) != 1 || wears[0].Outfit != "" {
+		t.Errorf("Expected the latest wear only, got %v", wears)
+	}
+
+	invalid := []struct {
+		name  string
+		wear  api.NewWearRequest
+		check error
+	}{
+		{"Empty", api.NewWearRequest{User: "foobar"}, &api.InvalidRequest{}},
+		{"NoOutfit", api.NewWearRequest{User: "foobar", Outfit: "o2"}, &api.OutfitNotFound{}},
+		{"NoItem", api.NewWearRequest{User: "foobar", Items: []string{"d"}}, &api.ItemNotFound{}},
+	}
+
+	for _, c := range invalid {
+		t.Run(c.name, func(t *testing.T) {
+			if _, err := ws.LogWear(c.wear); !tsErrorAs(err, c.check) {
+				t.Errorf("Expected %T, got %v", c.check, err)
+			}
+		})
+	}
+}
+
+func TestWebhooks(t *testing.T) {
+
+	// the receiver checks the signature and fails the first attempt
+	var mu sync.Mutex
+	var received []api.Event
+	var secret string
+	attempts := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		body, _ := ioutil.ReadAll(r.Body)
+		sig := r.Header.Get("X-Wardrobe-Signature")
+		var ts int64
+		fmt.Sscanf(sig, "t=%d,", &ts)
+		if sig != api.WebhookSignature(secret, time.Unix(ts, 0), body) {
+			t.Errorf("Unexpected signature %s", sig)
+		}
+		attempts++
+		if attempts == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		var event api.Event
+		if err := json.Unmarshal(body, &event); err != nil || string(event.Type) != r.Header.Get("X-Wardrobe-Event") {
+			t.Errorf("Unexpected event %s %v", body, err)
+		}
+		received = append(received, event)
+	}))
+	defer srv.Close()
+
+	wardRepo := newMemWardRepo()
+	wardRepo.Add("foobar", &api.WardrobeCloset{
+		User: "foobar",
+		Wardrobes: []api.Wardrobe{
+			{Identifier: "a", Description: "Shirt"},
+			{Identifier: "b", Description: "Jeans"},
+		},
+		Outfits: []api.Outfit{
+			{Identifier: "o1", TopId: "a", BottomId: "b", Description: "Office"},
+		},
+	})
+	wardRepo.Add("mallory", &api.WardrobeCloset{User: "mallory"})
+	hookRepo := newMemHookRepo()
+	ws := api.NewTestWardrobeService(wardRepo, newMemUserRepo(), newMemShareRepo(), newMemLinkRepo(), hookRepo, newMemImageRepo(), api.Quota{})
+	dispatcher := api.NewWebhookDispatcher(hookRepo, srv.Client(), time.Millisecond, 3)
+
+	hook, err := ws.CreateWebhook("foobar", api.NewWebhookRequest{URL: srv.URL, Events: []api.EventType{api.EventOutfitReacted}})
+	if err != nil || hook.Secret == "" {
+		t.Fatalf("Expected a webhook with its secret, got %v %v", hook, err)
+	}
+	secret = hook.Secret
+
+	if hooks, err := ws.GetWebhooks("foobar"); err != nil || len(hooks) != 1 || hooks[0].Secret != "" {
+		t.Errorf("Expected the webhook without its secret, got %v %v", hooks, err)
+	}
+
+	if _, err := ws.ReactOutfit("foobar", "o1", api.ReactionLike); err != nil {
+		t.Fatalf("Expected nil, got %v", err)
+	}
+
+	// the first attempt fails and is retried after the backoff
+	if err := dispatcher.Dispatch(); err != nil {
+		t.Fatalf("Expected nil, got %v", err)
+	}
+	deliveries, err := ws.GetDeliveries("foobar", hook.Id, 0)
+	if err != nil || len(deliveries) != 1 {
+		t.Fatalf("Expected a delivery, got %v %v", deliveries, err)
+	}
+	if d := deliveries[0]; d.State != api.DeliveryPending || d.Attempts != 1 || d.Status != http.StatusInternalServerError || d.Next == nil {
+		t.Errorf("Expected a pending delivery to retry, got %+v", d)
+	}
+
+	time.Sleep(5 * time.Millisecond)
+	dispatcher.Dispatch()
+	deliveries, _ = ws.GetDeliveries("foobar", hook.Id, 0)
+	if d := deliveries[0]; d.State != api.DeliveryDelivered || d.Attempts != 2 || d.Status != http.StatusOK {
+		t.Errorf("Expected a delivered delivery, got %+v", d)
+	}
+	if len(received) != 1 || received[0].Type != api.EventOutfitReacted || received[0].User != "foobar" {
+		t.Fatalf("Expected the outfit reaction, got %+v", received)
+	}
+
+	// a redelivery sends the same event again
+	again, err := ws.Redeliver("foobar", hook.Id, deliveries[0].Id)
+	if err != nil || again.State != api.DeliveryPending || again.Event != deliveries[0].Event {
+		t.Fatalf("Expected a pending redelivery, got %v %v", again, err)
+	}
+	dispatcher.Dispatch()
+	if len(received) != 2 || received[1].Id != received[0].Id {
+		t.Errorf("Expected the event twice, got %+v", received)
+	}
+	if deliveries, _ := ws.GetDeliveries("foobar", hook.Id, 1); len(deliveries) != 1 || deliveries[0].Id != again.Id {
+		t.Errorf("Expected the redelivery first, got %v", deliveries)
+	}
+
+	invalid := []struct {
+		name  string
+		call  func() error
+		check error
+	}{
+		{"Url", func() error {
+			_, err := ws.CreateWebhook("foobar", api.NewWebhookRequest{URL: "ftp://example.com"})
+			return err
+		}, &api.InvalidRequest{}},
+		{"Event", func() error {
+			_, err := ws.CreateWebhook("foobar", api.NewWebhookRequest{URL: srv.URL, Events: []api.EventType{"item.worn"}})
+			return err
+		}, &api.InvalidRequest{}},
+		{"Reaction", func() error {
+			_, err := ws.ReactOutfit("foobar", "o1", "love")
+			return err
+		}, &api.InvalidRequest{}},
+		{"OtherUser", func() error {
+			_, err := ws.GetDeliveries("mallory", hook.Id, 0)
+			return err
+		}, &api.WebhookNotFound{}},
+		{"NoDelivery", func() error {
+			_, err := ws.Redeliver("foobar", hook.Id, "missing")
+			return err
+		}, &api.DeliveryNotFound{}},
+	}
+
+	for _, c := range invalid {
+		t.Run(c.name, func(t *testing.T) {
+			if err := c.call(); !tsErrorAs(err, c.check) {
+				t.Errorf("Expected %T, got %v", c.check, err)
+			}
+		})
+	}
+
+	// deleting the webhook fails what is still pending
+	ws.ReactOutfit("foobar", "o1", api.ReactionDislike)
+	if err := ws.DeleteWebhook("foobar", hook.Id); err != nil {
+		t.Fatalf("Expected nil, got %v", err)
+	}
+	if _, err := ws.GetDeliveries("foobar", hook.Id, 0); !tsErrorAs(err, &api.WebhookNotFound{}) {
+		t.Errorf("Expected WebhookNotFound, got %v", err)
+	}
+	dispatcher.Dispatch()
+	if len(received) != 2 {
+		t.Errorf("Expected no delivery to a deleted webhook, got %+v", received)
+	}
+}
+
+func TestWebhookClaims(t *testing.T) {
+
+	var mu sync.Mutex
+	received := make(map[string]int)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		received[r.Header.Get("X-Wardrobe-Delivery")]++
+	}))
+	defer srv.Close()
+
+	wardRepo := newMemWardRepo()
+	wardRepo.Add("foobar", &api.WardrobeCloset{
+		User:      "foobar",
+		Wardrobes: []api.Wardrobe{{Identifier: "a"}, {Identifier: "b"}},
+		Outfits:   []api.Outfit{{Identifier: "o1", TopId: "a", BottomId: "b"}},
+	})
+	hookRepo := newMemHookRepo()
+	ws := api.NewTestWardrobeService(wardRepo, newMemUserRepo(), newMemShareRepo(), newMemLinkRepo(), hookRepo, newMemImageRepo(), api.Quota{})
+	if _, err := ws.CreateWebhook("foobar", api.NewWebhookRequest{URL: srv.URL}); err != nil {
+		t.Fatalf("Expected nil, got %v", err)
+	}
+	for i := 0; i < 20; i++ {
+		if _, err := ws.ReactOutfit("foobar", "o1", api.ReactionLike); err != nil {
+			t.Fatalf("Expected nil, got %v", err)
+		}
+	}
+
+	// servers dispatching side by side each send what they claimed
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		dispatcher := api.NewWebhookDispatcher(hookRepo, srv.Client(), time.Millisecond, 3)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			dispatcher.Dispatch()
+		}()
+	}
+	wg.Wait()
+
+	if len(received) != 20 {
+		t.Errorf("Expected 20 deliveries, got %d", len(received))
+	}
+	for id, count := range received {
+		if count != 1 {
+			t.Errorf("Expected delivery %s sent once, got %d", id, count)
+		}
+	}
+}
+
+// slowHookRepo holds up the first listing of webhooks until released
+type slowHookRepo struct {
+	*memHookRepo
+	once    sync.Once
+	blocked chan struct{}
+	release chan struct{}
+}
+
+func (m *slowHookRepo) ListByOwner(owner string) ([]*api.Webhook, error) {
+	m.once.Do(func() {
+		close(m.blocked)
+		<-m.release
+	})
+	return m.memHookRepo.ListByOwner(owner)
+}
+
+func TestWebhookStorageOutsideLock(t *testing.T) {
+
+	wardRepo := newMemWardRepo()
+	wardRepo.Add("foobar", &api.WardrobeCloset{
+		User:      "foobar",
+		Wardrobes: []api.Wardrobe{{Identifier: "a"}, {Identifier: "b"}},
+		Outfits:   []api.Outfit{{Identifier: "o1", TopId: "a", BottomId: "b"}},
+	})
+	hookRepo := &slowHookRepo{memHookRepo: newMemHookRepo(), blocked: make(chan struct{}), release: make(chan struct{})}
+	ws := api.NewTestWardrobeService(wardRepo, newMemUserRepo(), newMemShareRepo(), newMemLinkRepo(), hookRepo, newMemImageRepo(), api.Quota{})
+	hook, err := ws.CreateWebhook("foobar", api.NewWebhookRequest{URL: "http://example.com/hook"})
+	if err != nil {
+		t.Fatalf("Expected nil, got %v", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ws.ReactOutfit("foobar", "o1", api.ReactionLike)
+	}()
+	<-hookRepo.blocked
+
+	// a slow webhook store holds up no other change to the closets
+	changed := make(chan error, 1)
+	go func() {
+		_, err := ws.ReactOutfit("foobar", "o1", api.ReactionDislike)
+		changed <- err
+	}()
+	select {
+	case err := <-changed:
+		if err != nil {
+			t.Errorf("Expected nil, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Expected a change while the webhook store is slow")
+	}
+
+	close(hookRepo.release)
+	<-done
+
+	deliveries, _ := ws.GetDeliveries("foobar", hook.Id, 0)
+	if len(deliveries) != 2 {
+		t.Fatalf("Expected both reactions delivered, got %d", len(deliveries))
+	}
+	var first api.Event
+	stored, _ := hookRepo.GetDelivery(deliveries[1].Id)
+	json.Unmarshal(stored.Payload, &first)
+	if reaction, _ := first.Data.(map[string]interface{})["reaction"].(string); reaction != string(api.ReactionLike) {
+		t.Errorf("Expected the events in order, got %s first", stored.Payload)
+	}
+}
+
+func TestWebhookClient(t *testing.T) {
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/redirect" {
+			http.Redirect(w, r, "/internal", http.StatusFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	// the test receiver is on loopback like anything inside the network
+	client := api.NewWebhookClient(time.Second, false)
+	for _, target := range []string{srv.URL, "http://169.254.169.254/latest/meta-data/", "http://10.0.0.1/", "http://[::1]:80/"} {
+		if resp, err := client.Post(target, "application/json", nil); err == nil {
+			resp.Body.Close()
+			t.Errorf("Expected %s refused, got %s", target, resp.Status)
+		}
+	}
+
+	// redirects are answers, they are not followed
+	client = api.NewWebhookClient(time.Second, true)
+	resp, err := client.Post(srv.URL+"/redirect", "application/json", nil)
+	if err != nil {
+		t.Fatalf("Expected nil, got %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Errorf("Expected the redirect not followed, got %s", resp.Status)
+	}
+}
+
+func TestEventStream(t *testing.T) {
+
+	wardRepo := newMemWardRepo()
+	wardRepo.Add("foobar", &api.WardrobeCloset{
+		User: "foobar",
+		Wardrobes: []api.Wardrobe{
+			{Identifier: "a", Description: "Shirt"},
+			{Identifier: "b", Description: "Jeans"},
+		},
+		Outfits: []api.Outfit{
+			{Identifier: "o1", TopId: "a", BottomId: "b", Description: "Office"},
+		},
+	})
+	ws := api.NewTestWardrobeService(wardRepo, newMemUserRepo(), newMemShareRepo(), newMemLinkRepo(), newMemHookRepo(), newMemImageRepo(), api.Quota{})
+
+	stream, err := ws.WatchEvents("foobar", "")
+	if err != nil || len(stream.Replay) != 0 {
+		t.Fatalf("Expected a stream without replay, got %v %v", stream, err)
+	}
+
+	if err := ws.AddOutfit(api.NewOutfitRequest{User: "foobar", TopId: "a", BottomId: "b", Description: "Party"}); err != nil {
+		t.Fatalf("Expected nil, got %v", err)
+	}
+	if _, err := ws.ReactOutfit("foobar", "o1", api.ReactionLike); err != nil {
+		t.Fatalf("Expected nil, got %v", err)
+	}
+
+	created, reacted := <-stream.Events, <-stream.Events
+	if created.Type != api.EventOutfitCreated || reacted.Type != api.EventOutfitReacted || reacted.User != "foobar" {
+		t.Fatalf("Expected the outfit created and reacted to, got %+v %+v", created, reacted)
+	}
+	stream.Close()
+	if _, ok := <-stream.Events; ok {
+		t.Errorf("Expected a closed stream")
+	}
+
+	resume := []struct {
+		name   string
+		last   string
+		replay []string
+		reset  bool
+	}{
+		{"Resume", created.Id, []string{reacted.Id}, false},
+		{"Latest", reacted.Id, []string{}, false},
+		{"Unknown", "gone", []string{}, true},
+	}
+
+	for _, c := range resume {
+		t.Run(c.name, func(t *testing.T) {
+			stream, err := ws.WatchEvents("foobar", c.last)
+			if err != nil {
+				t.Fatalf("Expected nil, got %v", err)
+			}
+			defer stream.Close()
+			ids := []string{}
+			for _, e := range stream.Replay {
+				ids = append(ids, e.Id)
+			}
+			if !reflect.DeepEqual(ids, c.replay) || stream.Reset != c.reset {
+				t.Errorf("Expected replay %v reset %v, got %v %v", c.replay, c.reset, ids, stream.Reset)
+			}
+		})
+	}
+
+	// a stream that falls behind is closed, to resume from where it was
+	slow, _ := ws.WatchEvents("foobar", "")
+	for i := 0; i < 100; i++ {
+		if _, err := ws.LogWear(api.NewWearRequest{User: "foobar", Outfit: "o1"}); err != nil {
+			t.Fatalf("Expected nil, got %v", err)
+		}
+	}
+	got := 0
+	for range slow.Events {
+		got++
+	}
+	if got == 0 || got == 100 {
+		t.Errorf("Expected the stream closed part way, got %d events", got)
+	}
+	slow.Close()
+}
+
+func TestEventStreamIdle(t *testing.T) {
+
+	wardRepo := newMemWardRepo()
+	for _, user := range []string{"foobar", "barfoo"} {
+		wardRepo.Add(user, &api.WardrobeCloset{
+			User:      user,
+			Wardrobes: []api.Wardrobe{{Identifier: "a", Description: "Shirt"}, {Identifier: "b", Description: "Jeans"}},
+		})
+	}
+	ws := api.NewTestWardrobeService(wardRepo, newMemUserRepo(), newMemShareRepo(), newMemLinkRepo(), newMemHookRepo(), newMemImageRepo(), api.Quota{})
+
+	now := time.Now()
+	api.SetEventsNow(ws, func() time.Time { return now })
+
+	first, _ := ws.WatchEvents("foobar", "")
+	watched, _ := ws.WatchEvents("barfoo", "")
+	defer watched.Close()
+
+	for _, user := range []string{"foobar", "barfoo"} {
+		if err := ws.AddOutfit(api.NewOutfitRequest{User: user, TopId: "a", BottomId: "b", Description: "Party"}); err != nil {
+			t.Fatalf("Expected nil, got %v", err)
+		}
+	}
+	left, created := <-first.Events, <-watched.Events
+	first.Close()
+
+	// the closet nobody watches is let go of once idle, the watched one kept
+	now = now.Add(2 * time.Hour)
+	stream, _ := ws.WatchEvents("foobar", left.Id)
+	defer stream.Close()
+	if !stream.Reset || len(stream.Replay) != 0 {
+		t.Errorf("Expected an idle closet reset, got %v %v", stream.Reset, stream.Replay)
+	}
+	if again, _ := ws.WatchEvents("barfoo", created.Id); again.Reset {
+		t.Errorf("Expected a watched closet kept")
+	} else {
+		again.Close()
+	}
+}
+
+func TestLabelJobs(t *testing.T) {
+
+	t0 := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	sent := func(attempts int) api.LabelJob {
+		return api.LabelJob{State: api.LabelSent, Attempts: attempts, Queued: t0, Sent: t0}
+	}
+
+	wardRepo := newMemWardRepo()
+	wardRepo.Add("foobar", &api.WardrobeCloset{
+		User: "foobar",
+		Wardrobes: []api.Wardrobe{
+			{Identifier: "a", LabelFile: "label-a", Label: sent(1)},
+			{Identifier: "b", LabelFile: "label-b", Label: sent(3)},
+			{Identifier: "c", LabelFile: "label-c", Label: api.LabelJob{State: api.LabelPending, Attempts: 1, Error: "redis down", Queued: t0}},
+			{Identifier: "d", LabelFile: "label-d", Label: api.LabelJob{State: api.LabelPending, Attempts: 2, Queued: t0}},
+			{Identifier: "e", LabelFile: "label-e", LabelText: "Cotton", Label: api.LabelJob{State: api.LabelCompleted, Attempts: 1, Queued: t0, Sent: t0, Finished: t0}},
+			{Identifier: "f", LabelFile: "label-f", LabelText: "Wool"},
+		},
+	})
+	imageRepo := newMemImageRepo()
+	for _, id := range []string{"a", "c", "d"} {
+		imageRepo.AddFile("label-"+id, []byte("label "+id))
+	}
+
+	var mu sync.Mutex
+	sends := map[string]string{}
+	send := func(user, id, image string) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if id == "d" {
+			return errors.New("redis down")
+		}
+		sends[id] = image
+		return nil
+	}
+
+	ws := api.NewTestWardrobeService(wardRepo, newMemUserRepo(), newMemShareRepo(), newMemLinkRepo(), newMemHookRepo(), imageRepo, api.Quota{})
+	ws = api.WithLabelJobs(ws, api.LabelJobs{Timeout: time.Minute, MaxAttempts: 3}, send)
+
+	stream, _ := ws.WatchEvents("foobar", "")
+	defer stream.Close()
+
+	// nothing is due before the timeout but the pending jobs
+	if err := api.CheckLabelJobs(ws, t0.Add(30*time.Second)); err != nil {
+		t.Fatalf("Expected nil, got %v", err)
+	}
+	if _, ok := sends["a"]; ok || sends["c"] != "bGFiZWwgYw==" {
+		t.Errorf("Expected only c sent again, got %v", sends)
+	}
+
+	if err := api.CheckLabelJobs(ws, t0.Add(time.Minute)); err != nil {
+		t.Fatalf("Expected nil, got %v", err)
+	}
+
+	expected := []struct {
+		id       string
+		state    string
+		attempts int
+	}{
+		{"a", api.LabelSent, 2},
+		{"b", api.LabelTimedOut, 3},
+		{"c", api.LabelSent, 2},
+		{"d", api.LabelFailed, 3},
+		{"e", api.LabelCompleted, 1},
+	}
+
+	for _, c := range expected {
+		t.Run(c.id, func(t *testing.T) {
+			item, err := ws.GetWardrobe("foobar", c.id)
+			if err != nil || item.LabelJob == nil {
+				t.Fatalf("Expected a label job, got %v %v", item, err)
+			}
+			if item.LabelJob.State != c.state || item.LabelJob.Attempts != c.attempts {
+				t.Errorf("Expected %s after %d attempts, got %+v", c.state, c.attempts, item.LabelJob)
+			}
+		})
+	}
+
+	if item, _ := ws.GetWardrobe("foobar", "f"); item.LabelJob != nil || item.LabelText != "Wool" {
+		t.Errorf("Expected no job for an item from before jobs, got %+v", item)
+	}
+
+	failed := map[string]bool{}
+	for len(failed) < 2 {
+		e := <-stream.Events
+		if e.Type != api.EventLabelFailed {
+			t.Fatalf("Expected label failures, got %+v", e)
+		}
+		failed[e.Data.(*api.GetWardrobeResponse).Id] = true
+	}
+	if !failed["b"] || !failed["d"] {
+		t.Errorf("Expected b and d to fail, got %v", failed)
+	}
+
+	page, err := ws.GetAllWardrobe("foobar", api.ListOptions{Filter: map[string]string{"label-state": api.LabelTimedOut}})
+	if err != nil || len(page.Items) != 1 || page.Items[0].Id != "b" {
+		t.Errorf("Expected b timed out, got %v %v", page, err)
+	}
+
+	// answers complete or fail a job, a late one too
+	answers := []api.LabelToTextResponse{
+		{User: "foobar", Id: "a", Text: "Linen"},
+		{User: "foobar", Id: "b", Text: "Silk"},
+		{User: "foobar", Id: "c", Error: "unreadable"},
+	}
+	for _, answer := range answers {
+		if err := api.ReceiveLabelText(ws, answer); err != nil {
+			t.Fatalf("Expected nil, got %v", err)
+		}
+	}
+	for id, text := range map[string]string{"a": "Linen", "b": "Silk"} {
+		item, _ := ws.GetWardrobe("foobar", id)
+		if item.LabelText != text || item.LabelJob.State != api.LabelCompleted || item.LabelJob.Finished == nil {
+			t.Errorf("Expected %s completed, got %+v %+v", id, item, item.LabelJob)
+		}
+	}
+	if item, _ := ws.GetWardrobe("foobar", "c"); item.LabelJob.State != api.LabelFailed || item.LabelJob.Error != "unreadable" {
+		t.Errorf("Expected c failed, got %+v", item.LabelJob)
+	}
+	if err := api.ReceiveLabelText(ws, api.LabelToTextResponse{User: "foobar", Id: "x", Text: "?"}); !tsErrorAs(err, &api.ItemNotFound{}) {
+		t.Errorf("Expected ItemNotFound, got %v", err)
+	}
+
+	// a new item is sent right away, with the label as uploaded
+	err = ws.AddWardrobe(api.NewWardrobeRequest{
+		User:           "foobar",
+		Description:    "Leggings",
+		MainImageMime:  tsFileHeader(t, "main-image", []byte{0xAA, 0xBB, 0xCC}),
+		LabelImageMime: tsFileHeader(t, "label-image", []byte{0xDD, 0xEE, 0xFF}),
+	})
+	if err != nil {
+		t.Fatalf("Expected nil, got %v", err)
+	}
+	page, _ = ws.GetAllWardrobe("foobar", api.ListOptions{Filter: map[string]string{"description": "Leggings"}})
+	if len(page.Items) != 1 || page.Items[0].LabelJob.State != api.LabelSent || page.Items[0].LabelJob.Attempts != 1 {
+		t.Errorf("Expected the new item sent, got %+v", page.Items)
+	}
+	if sent := sends[page.Items[0].Id]; sent != "3e7/" {
+		t.Errorf("Expected the label sent, got %q", sent)
+	}
 }
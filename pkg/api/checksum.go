@@ -0,0 +1,109 @@
+//
+// checksum.go
+//
+
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+)
+
+// Image states recorded on a wardrobe by the scrubber
+const (
+	ImageOk        = ""
+	ImageMissing   = "missing"
+	ImageTruncated = "truncated"
+	ImageCorrupted = "corrupted"
+)
+
+// imageSum counts and hashes an image as it is read
+type imageSum struct {
+	rd   io.Reader
+	h    hash.Hash
+	size int64
+}
+
+func newImageSum(rd io.Reader) *imageSum {
+	return &imageSum{
+		rd: rd,
+		h:  sha256.New(),
+	}
+}
+
+func (s *imageSum) Read(p []byte) (int, error) {
+	n, err := s.rd.Read(p)
+	s.h.Write(p[:n])
+	s.size += int64(n)
+	return n, err
+}
+
+func (s *imageSum) sum() string {
+	return hex.EncodeToString(s.h.Sum(nil))
+}
+
+// checkImage compares the image at path against its recorded size and
+// checksum and returns the resulting image state along with the checksum
+// actually found. An image without a recorded checksum is always ok.
+func checkImage(path string, size int64, sum string) (string, string, error) {
+
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ImageMissing, "", nil
+		}
+		return ImageOk, "", fmt.Errorf("Error opening file %s : %w", path, err)
+	}
+	defer f.Close()
+
+	s := newImageSum(f)
+	if _, err := io.Copy(io.Discard, s); err != nil {
+		return ImageOk, "", fmt.Errorf("Error reading file %s : %w", path, err)
+	}
+
+	switch {
+	case sum == "":
+		return ImageOk, s.sum(), nil
+	case s.size < size:
+		return ImageTruncated, s.sum(), nil
+	case s.size != size || s.sum() != sum:
+		return ImageCorrupted, s.sum(), nil
+	}
+
+	return ImageOk, s.sum(), nil
+}
+
+// damagedImage is an error of an image repository that found an image
+// damaged while reading it, such as an encrypted one failing authentication
+type damagedImage interface {
+	ImageState() string
+}
+
+// damagedImageState returns the state of an image err found damaged
+func damagedImageState(err error) (string, bool) {
+	var d damagedImage
+	if errors.As(err, &d) {
+		return d.ImageState(), true
+	}
+	return "", false
+}
+
+// worseImageState returns whichever state needs more attention
+func worseImageState(a, b string) string {
+	rank := map[string]int{
+		ImageOk:        0,
+		ImageCorrupted: 1,
+		ImageTruncated: 2,
+		ImageMissing:   3,
+	}
+
+	if rank[b] > rank[a] {
+		return b
+	}
+	return a
+}
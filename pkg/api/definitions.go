@@ -7,14 +7,18 @@
 package api
 
 import (
+	"io"
 	"mime/multipart"
+	"time"
 )
 
 const Version = "1.0"
 
 type NewWardrobeRequest struct {
 	User           string
-	Description    string `form:"description" binding:"required"`
+	Description    string   `form:"description" binding:"required"`
+	Brand          string   `form:"brand"`
+	Tags           []string `form:"tags"`
 	MainImage      []byte
 	LabelImage     []byte
 	MainImageMime  *multipart.FileHeader `form:"main-image" binding:"required"`
@@ -22,36 +26,333 @@ type NewWardrobeRequest struct {
 }
 
 type Wardrobe struct {
-	Identifier  string `bson:"id"`
-	MainFile    string `bson:"main-file"`
-	LabelFile   string `bson:"label-file"`
-	Description string `bson:"description"`
-	LabelText   string `bson:"label-text"`
+	Identifier  string    `bson:"id"`
+	MainFile    string    `bson:"main-file"`
+	LabelFile   string    `bson:"label-file"`
+	MainSize    int64     `bson:"main-size"`
+	LabelSize   int64     `bson:"label-size"`
+	MainSum     string    `bson:"main-sha256"`
+	LabelSum    string    `bson:"label-sha256"`
+	ImageState  string    `bson:"image-state"`
+	Description string    `bson:"description"`
+	LabelText   string    `bson:"label-text"`
+	Label       LabelJob  `bson:"label"`
+	Brand       string    `bson:"brand"`
+	Tags        []string  `bson:"tags"`
+	Created     time.Time `bson:"created"`
+	LastWorn    time.Time `bson:"last-worn"`
+}
+
+// LabelJob is where the label to text of an item is at. Sent is when the
+// label last went to the worker, Finished when the worker answered or the
+// job was given up on.
+type LabelJob struct {
+	State    string    `bson:"state"`
+	Attempts int       `bson:"attempts"`
+	Error    string    `bson:"error"`
+	Queued   time.Time `bson:"queued"`
+	Sent     time.Time `bson:"sent"`
+	Finished time.Time `bson:"finished"`
+}
+
+// User is an account, closets and images are keyed by Identifier. Neither
+// changes, credentials are issued for the Username.
+type User struct {
+	Identifier  string            `bson:"id"`
+	Username    string            `bson:"username"`
+	DisplayName string            `bson:"display-name"`
+	Preferences map[string]string `bson:"preferences"`
+	Created     time.Time         `bson:"created"`
+}
+
+type NewUserRequest struct {
+	Username    string            `json:"username" binding:"required"`
+	DisplayName string            `json:"display-name"`
+	Preferences map[string]string `json:"preferences"`
+}
+
+// UpdateUserRequest leaves fields that are not set unchanged, Preferences
+// are merged and a preference set to "" is removed. Username may only be
+// the current one.
+type UpdateUserRequest struct {
+	Username    string            `json:"username"`
+	DisplayName *string           `json:"display-name"`
+	Preferences map[string]string `json:"preferences"`
+}
+
+type GetUserResponse struct {
+	Id          string            `json:"id"`
+	Username    string            `json:"username"`
+	DisplayName string            `json:"display-name"`
+	Preferences map[string]string `json:"preferences"`
+	Created     time.Time         `json:"created"`
+}
+
+// Role is what a user may do in a closet shared with them, each role
+// includes the ones before it
+type Role string
+
+const (
+	RoleNone        Role = ""
+	RoleViewer      Role = "viewer"
+	RoleContributor Role = "contributor"
+	RoleManager     Role = "manager"
+	RoleOwner       Role = "owner"
+)
+
+// Share grants User a Role in the closet of Owner, both are user ids. It
+// has no effect until User accepted it.
+type Share struct {
+	Owner    string    `bson:"owner"`
+	User     string    `bson:"user"`
+	Role     Role      `bson:"role"`
+	Accepted bool      `bson:"accepted"`
+	Created  time.Time `bson:"created"`
+}
+
+type NewShareRequest struct {
+	User string `json:"user" binding:"required"`
+	Role Role   `json:"role" binding:"required"`
+}
+
+type GetShareResponse struct {
+	Owner    string    `json:"owner"`
+	User     string    `json:"user"`
+	Role     Role      `json:"role"`
+	Accepted bool      `json:"accepted"`
+	Created  time.Time `json:"created"`
+}
+
+// ShareLink lets anyone holding its token see an outfit or a set of items
+// of Owner, a user id. Only the SHA-256 of the token is kept.
+type ShareLink struct {
+	Identifier string    `bson:"id"`
+	TokenSum   string    `bson:"token-sha256"`
+	Owner      string    `bson:"owner"`
+	Outfit     string    `bson:"outfit"`
+	Items      []string  `bson:"items"`
+	Expires    time.Time `bson:"expires"`
+	Created    time.Time `bson:"created"`
+}
+
+// NewShareLinkRequest shares an outfit, items or both. Without Expires the
+// link lasts until it is revoked.
+type NewShareLinkRequest struct {
+	Outfit  string     `json:"outfit"`
+	Items   []string   `json:"items"`
+	Expires *time.Time `json:"expires"`
+}
+
+// GetShareLinkResponse carries the token only when the link is created
+type GetShareLinkResponse struct {
+	Id      string     `json:"id"`
+	Token   string     `json:"token,omitempty"`
+	Outfit  string     `json:"outfit,omitempty"`
+	Items   []string   `json:"items"`
+	Expires *time.Time `json:"expires,omitempty"`
+	Created time.Time  `json:"created"`
+}
+
+// GetLookResponse is the public view of a share link
+type GetLookResponse struct {
+	Outfit  *GetOutfitResponse     `json:"outfit,omitempty"`
+	Items   []*GetWardrobeResponse `json:"items"`
+	Expires *time.Time             `json:"expires,omitempty"`
+}
+
+// EventType names something that happened in a closet
+type EventType string
+
+const (
+	EventItemCreated   EventType = "item.created"
+	EventItemDeleted   EventType = "item.deleted"
+	EventLabelText     EventType = "item.label-text"
+	EventLabelFailed   EventType = "item.label-failed"
+	EventOutfitCreated EventType = "outfit.created"
+	EventOutfitDeleted EventType = "outfit.deleted"
+	EventOutfitReacted EventType = "outfit.reacted"
+	EventWearLogged    EventType = "wear.logged"
+)
+
+// EventStreamReset tells an event stream the events it asked to resume
+// from are no longer kept, it is not sent to webhooks
+const EventStreamReset EventType = "stream.reset"
+
+// EventTypes are all events webhooks can subscribe to
+var EventTypes = []EventType{EventItemCreated, EventItemDeleted, EventLabelText, EventLabelFailed, EventOutfitCreated, EventOutfitDeleted, EventOutfitReacted, EventWearLogged}
+
+// Event is what webhooks and event streams are sent, Data is the item,
+// outfit or wear it is about
+type Event struct {
+	Id      string      `json:"id"`
+	Type    EventType   `json:"type"`
+	User    string      `json:"user"`
+	Data    interface{} `json:"data"`
+	Created time.Time   `json:"created"`
+}
+
+// Webhook posts the events of Types in the closet of Owner, a user id, to
+// URL. Deliveries are signed with Secret.
+type Webhook struct {
+	Identifier string      `bson:"id"`
+	Owner      string      `bson:"owner"`
+	URL        string      `bson:"url"`
+	Secret     string      `bson:"secret"`
+	Types      []EventType `bson:"types"`
+	Created    time.Time   `bson:"created"`
+}
+
+// NewWebhookRequest subscribes URL to events, to all of them when Events
+// is empty
+type NewWebhookRequest struct {
+	URL    string      `json:"url" binding:"required"`
+	Events []EventType `json:"events"`
+}
+
+// GetWebhookResponse carries the secret only when the webhook is created
+type GetWebhookResponse struct {
+	Id      string      `json:"id"`
+	URL     string      `json:"url"`
+	Secret  string      `json:"secret,omitempty"`
+	Events  []EventType `json:"events"`
+	Created time.Time   `json:"created"`
+}
+
+// DeliveryState is where a delivery is in its attempts
+type DeliveryState string
+
+const (
+	DeliveryPending   DeliveryState = "pending"
+	DeliveryDelivered DeliveryState = "delivered"
+	DeliveryFailed    DeliveryState = "failed"
+)
+
+// Delivery is an event sent, or to be sent, to a webhook. Pending ones are
+// attempted at Next.
+type Delivery struct {
+	Identifier string        `bson:"id"`
+	Webhook    string        `bson:"webhook"`
+	Owner      string        `bson:"owner"`
+	Event      string        `bson:"event"`
+	Type       EventType     `bson:"type"`
+	Payload    []byte        `bson:"payload"`
+	State      DeliveryState `bson:"state"`
+	Attempts   int           `bson:"attempts"`
+	Status     int           `bson:"status"`
+	Error      string        `bson:"error"`
+	Next       time.Time     `bson:"next"`
+	Created    time.Time     `bson:"created"`
+	Updated    time.Time     `bson:"updated"`
+}
+
+// GetDeliveryResponse is an entry of the delivery log of a webhook, Status
+// is the http status of the last attempt
+type GetDeliveryResponse struct {
+	Id       string        `json:"id"`
+	Event    string        `json:"event"`
+	Type     EventType     `json:"type"`
+	State    DeliveryState `json:"state"`
+	Attempts int           `json:"attempts"`
+	Status   int           `json:"status,omitempty"`
+	Error    string        `json:"error,omitempty"`
+	Next     *time.Time    `json:"next,omitempty"`
+	Created  time.Time     `json:"created"`
+}
+
+// Reaction is what a user thinks of an outfit
+type Reaction string
+
+const (
+	ReactionLike    Reaction = "like"
+	ReactionDislike Reaction = "dislike"
+)
+
+type ReactRequest struct {
+	Reaction Reaction `json:"reaction" binding:"required"`
+}
+
+// OutfitReaction is the data of an outfit.reacted event
+type OutfitReaction struct {
+	Outfit   *GetOutfitResponse `json:"outfit"`
+	Reaction Reaction           `json:"reaction"`
 }
 
 type WardrobeCloset struct {
 	User      string `bson:"user"`
 	Wardrobes []Wardrobe
 	Outfits   []Outfit
+	Wears     []Wear `bson:"wears"`
+}
+
+// Wear logs that an outfit or a set of items was worn, Items includes the
+// items of Outfit
+type Wear struct {
+	Identifier string    `bson:"id"`
+	Outfit     string    `bson:"outfit"`
+	Items      []string  `bson:"items"`
+	Worn       time.Time `bson:"worn"`
+	Created    time.Time `bson:"created"`
+}
+
+// NewWearRequest logs an outfit, items or both as worn at Worn, now when
+// it is not set
+type NewWearRequest struct {
+	User   string
+	Outfit string     `json:"outfit"`
+	Items  []string   `json:"items"`
+	Worn   *time.Time `json:"worn"`
+}
+
+type GetWearResponse struct {
+	Id     string    `json:"id"`
+	Outfit string    `json:"outfit,omitempty"`
+	Items  []string  `json:"items"`
+	Worn   time.Time `json:"worn"`
 }
 
 type LabelToTextRequest struct {
-	User     string `json:"user" binding="required"`
-	Id       string `json:"id" binding="required"`
-	RawImage string `json:"raw-image" binding="required"`
+	User     string `json:"user" binding:"required"`
+	Id       string `json:"id" binding:"required"`
+	RawImage string `json:"raw-image" binding:"required"`
 }
 
+// LabelToTextResponse is the answer of the worker, Error is set when it
+// could not read the label
 type LabelToTextResponse struct {
-	User string `json:"user" binding="required"`
-	Id   string `json:"id" binding="required"`
-	Text string `json:"text" binding="required"`
+	User  string `json:"user" binding:"required"`
+	Id    string `json:"id" binding:"required"`
+	Text  string `json:"text"`
+	Error string `json:"error,omitempty"`
 }
 
 type GetWardrobeResponse struct {
-	Id          string `json:"id" binding="required"`
-	Description string `json:"description" binding:"required"`
-	MainImage   string `json:"main-image-uri" binding:"required"`
-	LabelImage  string `json:"label-image-uri" binding:"required"`
+	Id          string               `json:"id" binding:"required"`
+	Description string               `json:"description" binding:"required"`
+	MainImage   string               `json:"main-image-uri" binding:"required"`
+	LabelImage  string               `json:"label-image-uri" binding:"required"`
+	ImageState  string               `json:"image-state,omitempty"`
+	LabelText   string               `json:"label-text,omitempty"`
+	LabelJob    *GetLabelJobResponse `json:"label-job,omitempty"`
+	Brand       string               `json:"brand,omitempty"`
+	Tags        []string             `json:"tags,omitempty"`
+	Created     *time.Time           `json:"created,omitempty"`
+	LastWorn    *time.Time           `json:"last-worn,omitempty"`
+}
+
+type GetLabelJobResponse struct {
+	State    string     `json:"state"`
+	Attempts int        `json:"attempts"`
+	Error    string     `json:"error,omitempty"`
+	Queued   *time.Time `json:"queued,omitempty"`
+	Sent     *time.Time `json:"sent,omitempty"`
+	Finished *time.Time `json:"finished,omitempty"`
+}
+
+// SearchHit is an item found by a search, Fields are where it matched
+type SearchHit struct {
+	Item   *GetWardrobeResponse `json:"item"`
+	Score  float64              `json:"score"`
+	Fields []string             `json:"fields"`
 }
 
 type NewOutfitRequest struct {
@@ -62,26 +363,130 @@ type NewOutfitRequest struct {
 }
 
 type Outfit struct {
-	Identifier   string `bson:"id"`
-	TopId        string `bson:"top-id"`
-	BottomId     string `bson:"bottom-id"`
-	Description  string `bson:"description"`
-	LikeCount    int    `bson:"like-count"`
-	DislikeCount int    `bson:"dislike-count"`
+	Identifier   string    `bson:"id"`
+	TopId        string    `bson:"top-id"`
+	BottomId     string    `bson:"bottom-id"`
+	Description  string    `bson:"description"`
+	LikeCount    int       `bson:"like-count"`
+	DislikeCount int       `bson:"dislike-count"`
+	Created      time.Time `bson:"created"`
+	LastWorn     time.Time `bson:"last-worn"`
 }
 
 type GetOutfitResponse struct {
-	Id           string `json:"id" binding="required"`
-	TopId        string `json:"top-id" binding="required"`
-	BottomId     string `json:"bottom-id" binding="required"`
-	Description  string `json:"description" binding:"required"`
-	LikeCount    int    `json:"like-count" binding:"required"`
-	DislikeCount int    `json:"dislike-count" binding:"required"`
+	Id           string     `json:"id" binding:"required"`
+	TopId        string     `json:"top-id" binding:"required"`
+	BottomId     string     `json:"bottom-id" binding:"required"`
+	Description  string     `json:"description" binding:"required"`
+	LikeCount    int        `json:"like-count" binding:"required"`
+	DislikeCount int        `json:"dislike-count" binding:"required"`
+	Created      *time.Time `json:"created,omitempty"`
+	LastWorn     *time.Time `json:"last-worn,omitempty"`
+}
+
+// ListOptions pages, orders and filters a listing. Sort is one of created,
+// last-worn, likes or description, a leading "-" reverses it. Cursor is
+// the Next of the previous page, it only continues the same Sort.
+type ListOptions struct {
+	Limit  int
+	Cursor string
+	Sort   string
+	Filter map[string]string
+}
+
+// GetWardrobePage is a page of items, Next is empty on the last page
+type GetWardrobePage struct {
+	Items []*GetWardrobeResponse `json:"items"`
+	Next  string                 `json:"next,omitempty"`
+}
+
+type GetOutfitPage struct {
+	Outfits []*GetOutfitResponse `json:"outfits"`
+	Next    string               `json:"next,omitempty"`
+}
+
+type ImageInfo struct {
+	Name    string
+	Size    int64
+	ModTime time.Time
+}
+
+// ErrorResponse is the body of every failed request, Code names the error
+// for programs and Error describes it for people
+type ErrorResponse struct {
+	Code  string `json:"code" binding:"required"`
+	Error string `json:"error" binding:"required"`
+}
+
+// Image garbage collection
+type DanglingImage struct {
+	User string `json:"user"`
+	Id   string `json:"id"`
+	File string `json:"file"`
+}
+
+type ImageGCReport struct {
+	Scanned  int             `json:"scanned"`
+	Orphans  []string        `json:"orphans"`
+	Skipped  []string        `json:"skipped"`
+	Deleted  []string        `json:"deleted"`
+	Dangling []DanglingImage `json:"dangling"`
+	DryRun   bool            `json:"dry-run"`
+}
+
+// Quota limits a single user, a zero limit means unlimited
+type Quota struct {
+	MaxItems      int
+	MaxImageBytes int64
+}
+
+// LabelJobs is how long to wait on the label to text worker. A label not
+// answered within Timeout is sent again, up to MaxAttempts in all, then
+// marked timed out. Jobs are checked every Interval, 0 never checks them.
+type LabelJobs struct {
+	Timeout     time.Duration
+	MaxAttempts int
+	Interval    time.Duration
+}
+
+type GetUsageResponse struct {
+	Items         int   `json:"items"`
+	MaxItems      int   `json:"max-items"`
+	ImageBytes    int64 `json:"image-bytes"`
+	MaxImageBytes int64 `json:"max-image-bytes"`
+}
+
+// Image scrubbing
+type DamagedImage struct {
+	User  string `json:"user"`
+	Id    string `json:"id"`
+	File  string `json:"file"`
+	State string `json:"state"`
+}
+
+type ImageScrubReport struct {
+	Scanned    int            `json:"scanned"`
+	Unverified int            `json:"unverified"`
+	Marked     int            `json:"marked"`
+	Damaged    []DamagedImage `json:"damaged"`
+}
+
+// ImageMeta describes an image being served. Sum is the SHA-256 of the
+// content, Pinned is set when Sum matched the checksum recorded on the
+// wardrobe, so the content behind the name can never change.
+type ImageMeta struct {
+	Name    string
+	Size    int64
+	Sum     string
+	Pinned  bool
+	ModTime time.Time
 }
 
 // Functions
 type HandleFile func(filename string) error
 
+type HandleImage func(content io.ReadSeeker, meta ImageMeta) error
+
 // Error
 type UserNotFound struct {
 	User string
@@ -98,3 +503,59 @@ type ResourceUnavailable struct {
 type DuplicateFile struct {
 	File string
 }
+
+type ChecksumMismatch struct {
+	File  string
+	State string
+}
+
+type DuplicateUser struct {
+	User string
+}
+
+type ShareNotFound struct {
+	Owner string
+	User  string
+}
+
+type LinkNotFound struct {
+	Link string
+}
+
+type WebhookNotFound struct {
+	Webhook string
+}
+
+type DeliveryNotFound struct {
+	Delivery string
+}
+
+type Forbidden struct {
+	User  string
+	Owner string
+	Role  Role
+}
+
+type ItemNotFound struct {
+	User string
+	Id   string
+}
+
+type OutfitNotFound struct {
+	User string
+	Id   string
+}
+
+// InvalidRequest rejects a request for what is in it, Field names the
+// offending part
+type InvalidRequest struct {
+	Field  string
+	Reason string
+}
+
+type QuotaExceeded struct {
+	User     string
+	Resource string
+	Limit    int64
+	Used     int64
+}
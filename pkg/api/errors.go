@@ -0,0 +1,94 @@
+//
+// errors.go
+//
+
+package api
+
+import (
+	"errors"
+)
+
+// ErrorKind is the class of an error, what a caller can do about it
+type ErrorKind string
+
+const (
+	KindNotFound    ErrorKind = "not-found"
+	KindConflict    ErrorKind = "conflict"
+	KindValidation  ErrorKind = "validation"
+	KindUnavailable ErrorKind = "unavailable"
+	KindForbidden   ErrorKind = "forbidden"
+	KindInternal    ErrorKind = "internal"
+)
+
+// KindError is implemented by the errors of the service. Code is a stable,
+// machine readable name of the error within its kind.
+type KindError interface {
+	error
+	Kind() ErrorKind
+	Code() string
+}
+
+// ErrorKindOf is the kind of the first KindError err wraps, anything else
+// is internal
+func ErrorKindOf(err error) ErrorKind {
+	var ke KindError
+	if errors.As(err, &ke) {
+		return ke.Kind()
+	}
+	return KindInternal
+}
+
+// ErrorCodeOf is the code of the first KindError err wraps
+func ErrorCodeOf(err error) string {
+	var ke KindError
+	if errors.As(err, &ke) {
+		return ke.Code()
+	}
+	return "internal-error"
+}
+
+func (e UserNotFound) Kind() ErrorKind { return KindNotFound }
+func (e UserNotFound) Code() string    { return "user-not-found" }
+
+func (e ItemNotFound) Kind() ErrorKind { return KindNotFound }
+func (e ItemNotFound) Code() string    { return "item-not-found" }
+
+func (e OutfitNotFound) Kind() ErrorKind { return KindNotFound }
+func (e OutfitNotFound) Code() string    { return "outfit-not-found" }
+
+func (e NoSuchFileOrDirectory) Kind() ErrorKind { return KindNotFound }
+func (e NoSuchFileOrDirectory) Code() string    { return "image-not-found" }
+
+func (e ShareNotFound) Kind() ErrorKind { return KindNotFound }
+func (e ShareNotFound) Code() string    { return "share-not-found" }
+
+func (e LinkNotFound) Kind() ErrorKind { return KindNotFound }
+func (e LinkNotFound) Code() string    { return "link-not-found" }
+
+func (e WebhookNotFound) Kind() ErrorKind { return KindNotFound }
+func (e WebhookNotFound) Code() string    { return "webhook-not-found" }
+
+func (e DeliveryNotFound) Kind() ErrorKind { return KindNotFound }
+func (e DeliveryNotFound) Code() string    { return "delivery-not-found" }
+
+func (e DuplicateUser) Kind() ErrorKind { return KindConflict }
+func (e DuplicateUser) Code() string    { return "duplicate-user" }
+
+func (e DuplicateFile) Kind() ErrorKind { return KindConflict }
+func (e DuplicateFile) Code() string    { return "duplicate-file" }
+
+func (e InvalidRequest) Kind() ErrorKind { return KindValidation }
+func (e InvalidRequest) Code() string    { return "invalid-" + e.Field }
+
+func (e ResourceUnavailable) Kind() ErrorKind { return KindUnavailable }
+func (e ResourceUnavailable) Code() string    { return "unavailable" }
+
+func (e Forbidden) Kind() ErrorKind { return KindForbidden }
+func (e Forbidden) Code() string    { return "forbidden" }
+
+func (e QuotaExceeded) Kind() ErrorKind { return KindForbidden }
+func (e QuotaExceeded) Code() string    { return "quota-exceeded" }
+
+// a damaged image is nothing the caller can fix
+func (e ChecksumMismatch) Kind() ErrorKind { return KindInternal }
+func (e ChecksumMismatch) Code() string    { return "image-damaged" }
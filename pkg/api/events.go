@@ -0,0 +1,205 @@
+//
+// events.go
+//
+
+package api
+
+import (
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+const (
+	// eventHistory is how many events of a closet are kept to resume from
+	eventHistory = 256
+	// eventBuffer is how far a stream may fall behind before it is dropped
+	eventBuffer = 64
+	// eventIdle is how long the events of a closet nobody watches or
+	// changes are kept
+	eventIdle = time.Hour
+)
+
+// EventStream is a live view of the events of a closet. Replay holds the
+// events missed since the last event id it was opened with, Events the ones
+// that follow. Events is closed when the stream falls behind or the closet
+// goes away; clients resume with the id of the last event they got. Reset
+// is set when that id is no longer kept, the client has missed events it
+// cannot be sent and should load the closet again.
+type EventStream struct {
+	Replay []*Event
+	Reset  bool
+	Events <-chan *Event
+
+	events chan *Event
+	owner  string
+	hub    *eventHub
+}
+
+// Close stops the stream
+func (s *EventStream) Close() {
+	if s.hub != nil {
+		s.hub.unwatch(s)
+	}
+}
+
+// eventHub fans the events of a closet out to the streams watching it, and
+// keeps the last few so a stream can resume. It lives in the process, a
+// stream only sees the events of the server it is connected to. What it
+// keeps of a closet goes once the closet has been idle for idle.
+type eventHub struct {
+	mu      sync.Mutex
+	history int
+	idle    time.Duration
+	now     func() time.Time
+	swept   time.Time
+	recent  map[string]*closetEvents
+	streams map[string]map[*EventStream]bool
+}
+
+// closetEvents are the events kept of a closet, with when it was last
+// watched or changed
+type closetEvents struct {
+	events  []*Event
+	touched time.Time
+}
+
+func newEventHub(history int, idle time.Duration) *eventHub {
+	return &eventHub{
+		history: history,
+		idle:    idle,
+		now:     time.Now,
+		recent:  make(map[string]*closetEvents),
+		streams: make(map[string]map[*EventStream]bool),
+	}
+}
+
+// watch opens a stream of the events of owner. An empty lastEventId starts
+// with what comes next, an id that is no longer kept resets the stream.
+func (h *eventHub) watch(owner string, lastEventId string) *EventStream {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := h.now()
+	h.sweep(now)
+
+	events := make(chan *Event, eventBuffer)
+	stream := &EventStream{Events: events, events: events, owner: owner, hub: h}
+
+	recent := h.recent[owner]
+	if recent != nil {
+		recent.touched = now
+	}
+
+	if lastEventId != "" {
+		stream.Reset = true
+		if recent != nil {
+			for i, e := range recent.events {
+				if e.Id == lastEventId {
+					stream.Replay = append([]*Event{}, recent.events[i+1:]...)
+					stream.Reset = false
+					break
+				}
+			}
+		}
+	}
+
+	if h.streams[owner] == nil {
+		h.streams[owner] = make(map[*EventStream]bool)
+	}
+	h.streams[owner][stream] = true
+
+	return stream
+}
+
+func (h *eventHub) unwatch(stream *EventStream) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.drop(stream)
+}
+
+// drop closes a stream, the hub lock is held
+func (h *eventHub) drop(stream *EventStream) {
+	streams := h.streams[stream.owner]
+	if !streams[stream] {
+		return
+	}
+	delete(streams, stream)
+	if len(streams) == 0 {
+		delete(h.streams, stream.owner)
+		// the closet is idle from when the last stream went
+		if recent := h.recent[stream.owner]; recent != nil {
+			recent.touched = h.now()
+		}
+	}
+	close(stream.events)
+}
+
+func (h *eventHub) publish(owner string, event *Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := h.now()
+	h.sweep(now)
+
+	recent := h.recent[owner]
+	if recent == nil {
+		recent = &closetEvents{}
+		h.recent[owner] = recent
+	}
+	recent.touched = now
+	recent.events = append(recent.events, event)
+	if len(recent.events) > h.history {
+		recent.events = append([]*Event{}, recent.events[len(recent.events)-h.history:]...)
+	}
+
+	for stream := range h.streams[owner] {
+		select {
+		case stream.events <- event:
+		default:
+			glog.Warningf("event stream fell behind {owner=%s}, {event=%s}", owner, event.Id)
+			h.drop(stream)
+		}
+	}
+}
+
+// sweep lets go of the events of closets idle for longer than h.idle and
+// watched by none, at most once every h.idle. The hub lock is held.
+func (h *eventHub) sweep(now time.Time) {
+	if now.Sub(h.swept) < h.idle {
+		return
+	}
+	h.swept = now
+
+	for owner, recent := range h.recent {
+		if len(h.streams[owner]) == 0 && now.Sub(recent.touched) >= h.idle {
+			delete(h.recent, owner)
+		}
+	}
+}
+
+// forget closes the streams of a deleted closet and what it kept of it
+func (h *eventHub) forget(owner string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for stream := range h.streams[owner] {
+		h.drop(stream)
+	}
+	delete(h.recent, owner)
+}
+
+// WatchEvents opens a stream of the events of the closet of user, resuming
+// after lastEventId when it is set
+func (w *wardrobeService) WatchEvents(user string, lastEventId string) (*EventStream, error) {
+
+	uid, err := w.userId(user)
+	if err != nil {
+		return nil, err
+	}
+
+	glog.Infof("watching events {user=%s}, {last-event-id=%s}", user, lastEventId)
+
+	return w.events.watch(uid, lastEventId), nil
+}
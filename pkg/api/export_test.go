@@ -0,0 +1,56 @@
+//
+// export_test.go
+//
+
+package api
+
+import "time"
+
+// NewTestWardrobeService builds a service without the redis label to text
+// endpoint, for tests that never reach the point of sending a label
+func NewTestWardrobeService(dbIn WardrobeRepository, userDbIn UserRepository, shareDbIn ShareRepository, linkDbIn LinkRepository, hookDbIn WebhookRepository, imageDbIn ImageRepository, quota Quota) WardrobeService {
+	return &wardrobeService{
+		db:      dbIn,
+		userDb:  userDbIn,
+		shareDb: shareDbIn,
+		linkDb:  linkDbIn,
+		hookDb:  hookDbIn,
+		imageDb: imageDbIn,
+		events:  newEventHub(eventHistory, eventIdle),
+		quota:   quota,
+	}
+}
+
+// labelSendFunc stands in for the redis label to text endpoint
+type labelSendFunc func(user, id, image string) error
+
+func (f labelSendFunc) sendLabel(user, id, image string) error {
+	return f(user, id, image)
+}
+
+// WithLabelJobs has ws send labels with send, and wait on them as labels
+// says
+func WithLabelJobs(ws WardrobeService, labels LabelJobs, send func(user, id, image string) error) WardrobeService {
+	w := ws.(*wardrobeService)
+	w.l = labelSendFunc(send)
+	w.labels = labels
+	return w
+}
+
+// CheckLabelJobs runs a single check of the label jobs as of now
+func CheckLabelJobs(ws WardrobeService, now time.Time) error {
+	return ws.(*wardrobeService).checkLabelJobs(now)
+}
+
+// SetEventsNow replaces the clock the event hub lets go of idle closets by
+func SetEventsNow(ws WardrobeService, now func() time.Time) {
+	w := ws.(*wardrobeService)
+	w.events.mu.Lock()
+	defer w.events.mu.Unlock()
+	w.events.now = now
+}
+
+// ReceiveLabelText takes an answer of the label to text worker
+func ReceiveLabelText(ws WardrobeService, resp LabelToTextResponse) error {
+	return ws.(*wardrobeService).updateWardrobeLabelText(resp.User, resp.Id, resp.Text, resp.Error)
+}
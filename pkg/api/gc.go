@@ -0,0 +1,129 @@
+//
+// gc.go
+//
+
+package api
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// ImageCollector cross checks the image repository against every wardrobe
+// closet. Images nobody references are orphans, references to images that
+// are gone are dangling.
+type ImageCollector struct {
+	db      WardrobeRepository
+	imageDb ImageRepository
+
+	// images younger than minAge are never collected, so an AddWardrobe
+	// that has written its files but not yet its closet is left alone
+	minAge time.Duration
+}
+
+func NewImageCollector(dbIn WardrobeRepository, imageDbIn ImageRepository, minAge time.Duration) *ImageCollector {
+	return &ImageCollector{
+		db:      dbIn,
+		imageDb: imageDbIn,
+		minAge:  minAge,
+	}
+}
+
+// Collect runs a single pass. With dryRun set orphans are only reported.
+func (g *ImageCollector) Collect(dryRun bool) (*ImageGCReport, error) {
+
+	glog.Infof("image gc started {dry-run=%t}", dryRun)
+
+	images, err := g.imageDb.ListFiles()
+	if err != nil {
+		return nil, fmt.Errorf("Error listing image repository : %w", err)
+	}
+
+	closets, err := g.db.GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("Error listing wardrobe closets : %w", err)
+	}
+
+	stored := make(map[string]bool, len(images))
+	for _, image := range images {
+		stored[image.Name] = true
+	}
+
+	report := &ImageGCReport{
+		Scanned:  len(images),
+		Orphans:  make([]string, 0),
+		Skipped:  make([]string, 0),
+		Deleted:  make([]string, 0),
+		Dangling: make([]DanglingImage, 0),
+		DryRun:   dryRun,
+	}
+
+	referenced := make(map[string]bool)
+	for _, wc := range closets {
+		for _, ward := range wc.Wardrobes {
+			for _, file := range []string{ward.MainFile, ward.LabelFile} {
+				if file == "" {
+					continue
+				}
+
+				referenced[file] = true
+				if !stored[file] {
+					report.Dangling = append(report.Dangling, DanglingImage{
+						User: wc.User,
+						Id:   ward.Identifier,
+						File: file,
+					})
+				}
+			}
+		}
+	}
+
+	cutoff := time.Now().Add(-g.minAge)
+	for _, image := range images {
+		if referenced[image.Name] {
+			continue
+		}
+
+		if image.ModTime.After(cutoff) {
+			report.Skipped = append(report.Skipped, image.Name)
+			continue
+		}
+
+		report.Orphans = append(report.Orphans, image.Name)
+		if dryRun {
+			continue
+		}
+
+		err := g.imageDb.DeleteFile(image.Name)
+		if err != nil {
+			glog.Warningf("image gc failed to delete orphan {file=%s}, {err=%v}", image.Name, err)
+			continue
+		}
+		report.Deleted = append(report.Deleted, image.Name)
+	}
+
+	glog.Infof("image gc done {scanned=%d}, {orphans=%d}, {deleted=%d}, {dangling=%d}",
+		report.Scanned, len(report.Orphans), len(report.Deleted), len(report.Dangling))
+
+	return report, nil
+}
+
+// Run collects every interval until stop is closed
+func (g *ImageCollector) Run(interval time.Duration, dryRun bool, stop <-chan struct{}) {
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if _, err := g.Collect(dryRun); err != nil {
+				glog.Errorf("image gc failed {err=%v}", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,194 @@
+//
+// labels.go
+//
+
+package api
+
+import (
+	"encoding/base64"
+	"fmt"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// Label job states recorded on a wardrobe, items from before they were
+// tracked have none
+const (
+	LabelPending   = "pending"
+	LabelSent      = "sent"
+	LabelCompleted = "completed"
+	LabelFailed    = "failed"
+	LabelTimedOut  = "timed-out"
+)
+
+// labelSender hands a label image to the label to text worker
+type labelSender interface {
+	sendLabel(user, id, image string) error
+}
+
+// sendLabelJob sends the label of ward and records the attempt on its job,
+// the caller writes the closet back. A job that could not be sent stays
+// pending until it runs out of attempts.
+func (w *wardrobeService) sendLabelJob(uid string, ward *Wardrobe, image []byte, now time.Time) {
+
+	job := &ward.Label
+	job.Attempts++
+
+	err := w.l.sendLabel(uid, ward.Identifier, base64.StdEncoding.EncodeToString(image))
+	switch {
+	case err == nil:
+		job.State = LabelSent
+		job.Sent = now
+		job.Error = ""
+	case job.Attempts >= w.labelAttempts():
+		glog.Warningf("failure while trying to send label to label to text, giving up {user=%s}, {id=%s}, {err=%v}", uid, ward.Identifier, err)
+		job.State = LabelFailed
+		job.Error = err.Error()
+		job.Finished = now
+	default:
+		glog.Warningf("failure while trying to send label to label to text {user=%s}, {id=%s}, {err=%v}", uid, ward.Identifier, err)
+		job.State = LabelPending
+		job.Error = err.Error()
+	}
+}
+
+func (w *wardrobeService) labelAttempts() int {
+	if w.labels.MaxAttempts < 1 {
+		return 1
+	}
+	return w.labels.MaxAttempts
+}
+
+// labelDue tells whether a job needs sending again or giving up on by now
+func (w *wardrobeService) labelDue(job *LabelJob, now time.Time) bool {
+	switch job.State {
+	case LabelPending:
+		return true
+	case LabelSent:
+		return w.labels.Timeout > 0 && now.Sub(job.Sent) >= w.labels.Timeout
+	}
+	return false
+}
+
+// checkLabelJobs sends the labels that were never sent or not answered in
+// time again, and marks the jobs out of attempts as failed or timed out
+func (w *wardrobeService) checkLabelJobs(now time.Time) error {
+
+	// sent jobs are never due again without a timeout
+	sentBefore := time.Time{}
+	if w.labels.Timeout > 0 {
+		sentBefore = now.Add(-w.labels.Timeout)
+	}
+
+	users, err := w.db.ListLabelsDue(sentBefore)
+	if err != nil {
+		return fmt.Errorf("Error listing wardrobe closets with labels due : %w", err)
+	}
+
+	for _, user := range users {
+		if err := w.checkClosetLabels(user, now); err != nil {
+			glog.Errorf("Error checking label jobs {user=%s} : {err=%v}", user, err)
+		}
+	}
+
+	return nil
+}
+
+func (w *wardrobeService) checkClosetLabels(uid string, now time.Time) error {
+
+	w.mu.Lock()
+	defer w.unlock()
+
+	// read again under the lock, the label may have come in since
+	wc, err := w.db.Get(uid)
+	switch err := err.(type) {
+	case nil:
+	case *UserNotFound:
+		return nil
+	case *ResourceUnavailable:
+		return fmt.Errorf("Wardrobe db is unavailable : %w", err)
+	default:
+		return fmt.Errorf("Unknown error : %w", err)
+	}
+
+	failed := make([]*Wardrobe, 0)
+	changed := false
+	for i := range wc.Wardrobes {
+		ward := &wc.Wardrobes[i]
+		job := &ward.Label
+		if !w.labelDue(job, now) {
+			continue
+		}
+		changed = true
+
+		if job.Attempts >= w.labelAttempts() {
+			glog.Warningf("label to text gave no answer {user=%s}, {id=%s}, {attempts=%d}", uid, ward.Identifier, job.Attempts)
+			job.State = LabelTimedOut
+			if job.Error == "" {
+				job.Error = "no answer from label to text"
+			}
+			job.Finished = now
+			failed = append(failed, ward)
+			continue
+		}
+
+		image, err := w.userImages(uid).GetFile(ward.LabelFile)
+		if err != nil {
+			job.State = LabelFailed
+			job.Error = fmt.Sprintf("label image unreadable : %v", err)
+			job.Finished = now
+			failed = append(failed, ward)
+			continue
+		}
+
+		w.sendLabelJob(uid, ward, image, now)
+		if job.State == LabelFailed {
+			failed = append(failed, ward)
+		}
+	}
+
+	if !changed {
+		return nil
+	}
+
+	err = w.db.Update(uid, wc)
+	if err != nil {
+		return fmt.Errorf("Database access failure : %w", err)
+	}
+
+	for _, ward := range failed {
+		w.publish(uid, EventLabelFailed, wardrobeResponse(ward))
+	}
+
+	return nil
+}
+
+// watchLabels checks the label jobs every interval
+func (w *wardrobeService) watchLabels(interval time.Duration) {
+
+	glog.Infof("Watching label to text jobs {interval=%v}, {timeout=%v}, {max-attempts=%d}", interval, w.labels.Timeout, w.labelAttempts())
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := w.checkLabelJobs(time.Now().UTC()); err != nil {
+			glog.Errorf("label job check failed {err=%v}", err)
+		}
+	}
+}
+
+func labelJobResponse(job *LabelJob) *GetLabelJobResponse {
+	if job.State == "" {
+		return nil
+	}
+	return &GetLabelJobResponse{
+		State:    job.State,
+		Attempts: job.Attempts,
+		Error:    job.Error,
+		Queued:   optionalTime(job.Queued),
+		Sent:     optionalTime(job.Sent),
+		Finished: optionalTime(job.Finished),
+	}
+}
@@ -0,0 +1,299 @@
+//
+// links.go
+//
+
+package api
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/google/uuid"
+)
+
+const linkTokenBytes = 32
+
+// CreateShareLink shares an outfit and/or items of user with whoever gets
+// the token. The token is only ever returned here.
+func (w *wardrobeService) CreateShareLink(user string, newLink NewShareLinkRequest) (*GetShareLinkResponse, error) {
+
+	glog.Infof("creating share link {user=%s}, {outfit=%s}, {items=%d}", user, newLink.Outfit, len(newLink.Items))
+
+	if newLink.Outfit == "" && len(newLink.Items) == 0 {
+		return nil, &InvalidRequest{Field: "items", Reason: "nothing to share"}
+	}
+
+	if newLink.Expires != nil && !newLink.Expires.After(time.Now()) {
+		return nil, &InvalidRequest{Field: "expires", Reason: "link would expire at once"}
+	}
+
+	oid, err := w.userId(user)
+	if err != nil {
+		return nil, err
+	}
+
+	wc, err := w.db.Get(oid)
+	switch err := err.(type) {
+	case nil:
+		break
+	case *UserNotFound:
+		return nil, fmt.Errorf("User not found %s : %w", user, err)
+	case *ResourceUnavailable:
+		return nil, fmt.Errorf("Wardrobe db is unavailable : %w", err)
+	default:
+		return nil, fmt.Errorf("Unknown error : %w", err)
+	}
+
+	if newLink.Outfit != "" && findOutfit(wc, newLink.Outfit) == nil {
+		return nil, &InvalidRequest{Field: "outfit", Reason: fmt.Sprintf("no outfit %s", newLink.Outfit)}
+	}
+	for _, id := range newLink.Items {
+		if findWardrobe(wc, id) == nil {
+			return nil, &InvalidRequest{Field: "items", Reason: fmt.Sprintf("no item %s", id)}
+		}
+	}
+
+	raw := make([]byte, linkTokenBytes)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, fmt.Errorf("Error generating link token : %w", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+
+	link := &ShareLink{
+		Identifier: uuid.New().String(),
+		TokenSum:   tokenSum(token),
+		Owner:      oid,
+		Outfit:     newLink.Outfit,
+		Items:      append([]string{}, newLink.Items...),
+		Created:    time.Now().UTC(),
+	}
+	if newLink.Expires != nil {
+		link.Expires = newLink.Expires.UTC()
+	}
+
+	err = w.linkDb.Add(link)
+	if err != nil {
+		return nil, fmt.Errorf("Database access failure : %w", err)
+	}
+
+	resp := linkResponse(link)
+	resp.Token = token
+
+	glog.Infof("done creating share link {user=%s}, {link=%s}", user, link.Identifier)
+
+	return resp, nil
+}
+
+func (w *wardrobeService) GetShareLinks(user string) ([]*GetShareLinkResponse, error) {
+
+	oid, err := w.userId(user)
+	if err != nil {
+		return nil, err
+	}
+
+	links, err := w.linkDb.ListByOwner(oid)
+	if err != nil {
+		return nil, fmt.Errorf("Database access failure : %w", err)
+	}
+
+	resps := make([]*GetShareLinkResponse, 0, len(links))
+	for _, link := range links {
+		resps = append(resps, linkResponse(link))
+	}
+
+	return resps, nil
+}
+
+func (w *wardrobeService) RevokeShareLink(user string, id string) error {
+
+	glog.Infof("revoking share link {user=%s}, {link=%s}", user, id)
+
+	oid, err := w.userId(user)
+	if err != nil {
+		return err
+	}
+
+	link, err := w.linkDb.Get(id)
+	switch err := err.(type) {
+	case nil:
+	case *LinkNotFound:
+		return err
+	case *ResourceUnavailable:
+		return fmt.Errorf("Link db is unavailable : %w", err)
+	default:
+		return fmt.Errorf("Unknown error : %w", err)
+	}
+
+	// links of other users do not exist as far as user is concerned
+	if link.Owner != oid {
+		return &LinkNotFound{Link: id}
+	}
+
+	err = w.linkDb.Delete(id)
+	if err != nil {
+		return fmt.Errorf("Database access failure : %w", err)
+	}
+
+	return nil
+}
+
+// GetLook is what the holder of token gets to see. Items deleted since the
+// link was created are left out.
+func (w *wardrobeService) GetLook(token string) (*GetLookResponse, error) {
+
+	link, wc, err := w.look(token)
+	if err != nil {
+		return nil, err
+	}
+
+	look := &GetLookResponse{
+		Items:   make([]*GetWardrobeResponse, 0),
+		Expires: optionalTime(link.Expires),
+	}
+
+	if ot := findOutfit(wc, link.Outfit); ot != nil {
+		look.Outfit = &GetOutfitResponse{
+			Id:           ot.Identifier,
+			TopId:        ot.TopId,
+			BottomId:     ot.BottomId,
+			Description:  ot.Description,
+			LikeCount:    ot.LikeCount,
+			DislikeCount: ot.DislikeCount,
+		}
+	}
+
+	for _, ward := range lookItems(wc, link) {
+		look.Items = append(look.Items, &GetWardrobeResponse{
+			Id:          ward.Identifier,
+			Description: ward.Description,
+			MainImage:   ward.MainFile,
+			LabelImage:  ward.LabelFile,
+		})
+	}
+
+	return look, nil
+}
+
+// GetLookImage serves an image of an item in the look of token only
+func (w *wardrobeService) GetLookImage(token string, filename string, cb HandleImage) error {
+
+	link, wc, err := w.look(token)
+	if err != nil {
+		return err
+	}
+
+	for _, ward := range lookItems(wc, link) {
+		if filename == ward.MainFile || filename == ward.LabelFile {
+			return w.serveImage(ward, filename, cb)
+		}
+	}
+
+	return &NoSuchFileOrDirectory{File: filename}
+}
+
+// look finds the link of token along with the closet it shares. Expired
+// links and links whose owner is gone are not found.
+func (w *wardrobeService) look(token string) (*ShareLink, *WardrobeCloset, error) {
+
+	link, err := w.linkDb.GetByToken(tokenSum(token))
+	switch err := err.(type) {
+	case nil:
+	case *LinkNotFound:
+		return nil, nil, &LinkNotFound{}
+	case *ResourceUnavailable:
+		return nil, nil, fmt.Errorf("Link db is unavailable : %w", err)
+	default:
+		return nil, nil, fmt.Errorf("Unknown error : %w", err)
+	}
+
+	if !link.Expires.IsZero() && time.Now().After(link.Expires) {
+		return nil, nil, &LinkNotFound{Link: link.Identifier}
+	}
+
+	wc, err := w.db.Get(link.Owner)
+	switch err := err.(type) {
+	case nil:
+	case *UserNotFound:
+		return nil, nil, &LinkNotFound{Link: link.Identifier}
+	case *ResourceUnavailable:
+		return nil, nil, fmt.Errorf("Wardrobe db is unavailable : %w", err)
+	default:
+		return nil, nil, fmt.Errorf("Unknown error : %w", err)
+	}
+
+	return link, wc, nil
+}
+
+// lookItems are the items link shares, those of its outfit included
+func lookItems(wc *WardrobeCloset, link *ShareLink) []*Wardrobe {
+
+	ids := append([]string{}, link.Items...)
+	if ot := findOutfit(wc, link.Outfit); ot != nil {
+		ids = append(ids, ot.TopId, ot.BottomId)
+	}
+
+	seen := make(map[string]bool)
+	wards := make([]*Wardrobe, 0, len(ids))
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		if ward := findWardrobe(wc, id); ward != nil {
+			wards = append(wards, ward)
+		}
+	}
+
+	return wards
+}
+
+func findWardrobe(wc *WardrobeCloset, id string) *Wardrobe {
+	for i := range wc.Wardrobes {
+		if wc.Wardrobes[i].Identifier == id {
+			return &wc.Wardrobes[i]
+		}
+	}
+	return nil
+}
+
+func findOutfit(wc *WardrobeCloset, id string) *Outfit {
+	if id == "" {
+		return nil
+	}
+	for i := range wc.Outfits {
+		if wc.Outfits[i].Identifier == id {
+			return &wc.Outfits[i]
+		}
+	}
+	return nil
+}
+
+func tokenSum(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// optionalTime is nil for the zero time, a link that never expires or an
+// item never worn
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+func linkResponse(link *ShareLink) *GetShareLinkResponse {
+	return &GetShareLinkResponse{
+		Id:      link.Identifier,
+		Outfit:  link.Outfit,
+		Items:   link.Items,
+		Expires: optionalTime(link.Expires),
+		Created: link.Created,
+	}
+}
@@ -0,0 +1,294 @@
+//
+// listing.go
+//
+
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultListLimit = 50
+	MaxListLimit     = 200
+)
+
+var (
+	wardrobeFilters = []string{"description", "image-state", "label-text", "label-state"}
+	outfitFilters   = []string{"description", "top-id", "bottom-id", "item"}
+)
+
+// listSort is a parsed ListOptions.Sort
+type listSort struct {
+	field string
+	desc  bool
+}
+
+// listEntry is an element of a listing reduced to what orders it, key
+// compares as a string in the order of the sort field and id breaks ties
+type listEntry struct {
+	key   string
+	id    string
+	index int
+}
+
+func parseSort(s string) (listSort, error) {
+	ls := listSort{
+		field: strings.TrimPrefix(s, "-"),
+		desc:  strings.HasPrefix(s, "-"),
+	}
+	if ls.field == "" {
+		ls.field = "created"
+	}
+
+	switch ls.field {
+	case "created", "last-worn", "likes", "description":
+		return ls, nil
+	}
+	return ls, &InvalidRequest{Field: "sort", Reason: fmt.Sprintf("cannot sort by %q", s)}
+}
+
+func (ls listSort) String() string {
+	if ls.desc {
+		return "-" + ls.field
+	}
+	return ls.field
+}
+
+// less orders by key then id, a descending sort is the exact reverse
+func (ls listSort) less(a, b listEntry) bool {
+	if ls.desc {
+		a, b = b, a
+	}
+	if a.key != b.key {
+		return a.key < b.key
+	}
+	return a.id < b.id
+}
+
+// sortKey is the key of an element for field, times are formatted to a
+// fixed width so they compare as strings
+func sortKey(field string, created, lastWorn time.Time, likes int, description string) string {
+	switch field {
+	case "last-worn":
+		return lastWorn.UTC().Format("2006-01-02T15:04:05.000000000")
+	case "likes":
+		return fmt.Sprintf("%020d", likes)
+	case "description":
+		return strings.ToLower(description)
+	}
+	return created.UTC().Format("2006-01-02T15:04:05.000000000")
+}
+
+func checkFilter(filter map[string]string, allowed []string) error {
+	for field := range filter {
+		found := false
+		for _, a := range allowed {
+			found = found || a == field
+		}
+		if !found {
+			return &InvalidRequest{Field: "filter", Reason: fmt.Sprintf("cannot filter by %q", field)}
+		}
+	}
+	return nil
+}
+
+// contains matches text case insensitively
+func contains(text string, substr string) bool {
+	return strings.Contains(strings.ToLower(text), strings.ToLower(substr))
+}
+
+func matchWardrobe(ward *Wardrobe, filter map[string]string) bool {
+	for field, value := range filter {
+		switch field {
+		case "description":
+			if !contains(ward.Description, value) {
+				return false
+			}
+		case "image-state":
+			if ward.ImageState != value {
+				return false
+			}
+		case "label-text":
+			if !contains(ward.LabelText, value) {
+				return false
+			}
+		case "label-state":
+			if ward.Label.State != value {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func matchOutfit(ot *Outfit, filter map[string]string) bool {
+	for field, value := range filter {
+		switch field {
+		case "description":
+			if !contains(ot.Description, value) {
+				return false
+			}
+		case "top-id":
+			if ot.TopId != value {
+				return false
+			}
+		case "bottom-id":
+			if ot.BottomId != value {
+				return false
+			}
+		case "item":
+			if ot.TopId != value && ot.BottomId != value {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// itemLikes are the likes of the outfits each item is part of
+func itemLikes(wc *WardrobeCloset) map[string]int {
+	likes := make(map[string]int)
+	for _, ot := range wc.Outfits {
+		likes[ot.TopId] += ot.LikeCount
+		if ot.BottomId != ot.TopId {
+			likes[ot.BottomId] += ot.LikeCount
+		}
+	}
+	return likes
+}
+
+// listWardrobes is the page of the items of wc selected by opts and the
+// cursor of the page after it
+func listWardrobes(wc *WardrobeCloset, opts ListOptions) ([]*Wardrobe, string, error) {
+
+	ls, err := parseSort(opts.Sort)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := checkFilter(opts.Filter, wardrobeFilters); err != nil {
+		return nil, "", err
+	}
+
+	likes := itemLikes(wc)
+	entries := make([]listEntry, 0, len(wc.Wardrobes))
+	for i := range wc.Wardrobes {
+		ward := &wc.Wardrobes[i]
+		if !matchWardrobe(ward, opts.Filter) {
+			continue
+		}
+		entries = append(entries, listEntry{
+			key:   sortKey(ls.field, ward.Created, ward.LastWorn, likes[ward.Identifier], ward.Description),
+			id:    ward.Identifier,
+			index: i,
+		})
+	}
+
+	entries, next, err := pageEntries(entries, ls, opts)
+	if err != nil {
+		return nil, "", err
+	}
+
+	wards := make([]*Wardrobe, 0, len(entries))
+	for _, e := range entries {
+		wards = append(wards, &wc.Wardrobes[e.index])
+	}
+	return wards, next, nil
+}
+
+func listOutfits(wc *WardrobeCloset, opts ListOptions) ([]*Outfit, string, error) {
+
+	ls, err := parseSort(opts.Sort)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := checkFilter(opts.Filter, outfitFilters); err != nil {
+		return nil, "", err
+	}
+
+	entries := make([]listEntry, 0, len(wc.Outfits))
+	for i := range wc.Outfits {
+		ot := &wc.Outfits[i]
+		if !matchOutfit(ot, opts.Filter) {
+			continue
+		}
+		entries = append(entries, listEntry{
+			key:   sortKey(ls.field, ot.Created, ot.LastWorn, ot.LikeCount, ot.Description),
+			id:    ot.Identifier,
+			index: i,
+		})
+	}
+
+	entries, next, err := pageEntries(entries, ls, opts)
+	if err != nil {
+		return nil, "", err
+	}
+
+	ots := make([]*Outfit, 0, len(entries))
+	for _, e := range entries {
+		ots = append(ots, &wc.Outfits[e.index])
+	}
+	return ots, next, nil
+}
+
+// pageEntries orders entries and cuts the page starting after the cursor.
+// The cursor holds the position of the last entry rather than an offset,
+// so pages do not shift when elements are added or removed in between.
+func pageEntries(entries []listEntry, ls listSort, opts ListOptions) ([]listEntry, string, error) {
+
+	limit := opts.Limit
+	if limit == 0 {
+		limit = DefaultListLimit
+	}
+	if limit < 0 || limit > MaxListLimit {
+		return nil, "", &InvalidRequest{Field: "limit", Reason: fmt.Sprintf("must be between 1 and %d", MaxListLimit)}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return ls.less(entries[i], entries[j])
+	})
+
+	start := 0
+	if opts.Cursor != "" {
+		after, err := decodeCursor(opts.Cursor, ls)
+		if err != nil {
+			return nil, "", err
+		}
+		start = sort.Search(len(entries), func(i int) bool {
+			return ls.less(after, entries[i])
+		})
+	}
+
+	end := start + limit
+	if end >= len(entries) {
+		return entries[start:], "", nil
+	}
+	return entries[start:end], encodeCursor(entries[end-1], ls), nil
+}
+
+func encodeCursor(e listEntry, ls listSort) string {
+	raw, _ := json.Marshal([]string{ls.String(), e.key, e.id})
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeCursor(cursor string, ls listSort) (listEntry, error) {
+	var fields []string
+
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err == nil {
+		err = json.Unmarshal(raw, &fields)
+	}
+	if err != nil || len(fields) != 3 {
+		return listEntry{}, &InvalidRequest{Field: "cursor", Reason: "malformed"}
+	}
+	if fields[0] != ls.String() {
+		return listEntry{}, &InvalidRequest{Field: "cursor", Reason: "made for another sort order"}
+	}
+
+	return listEntry{key: fields[1], id: fields[2]}, nil
+}
@@ -0,0 +1,128 @@
+//
+// scrub.go
+//
+
+package api
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/golang/glog"
+)
+
+// ImageScrubber reads back every image referenced by a wardrobe and checks
+// it against the size and checksum recorded when it was written
+type ImageScrubber struct {
+	db      WardrobeRepository
+	imageDb ImageRepository
+}
+
+func NewImageScrubber(dbIn WardrobeRepository, imageDbIn ImageRepository) *ImageScrubber {
+	return &ImageScrubber{
+		db:      dbIn,
+		imageDb: imageDbIn,
+	}
+}
+
+// Scrub runs a single pass. With mark set, the image state of every damaged
+// or recovered wardrobe is written back to it alone, the scrubber runs next
+// to the server and must not write back closets it read a while ago.
+func (s *ImageScrubber) Scrub(mark bool) (*ImageScrubReport, error) {
+
+	glog.Infof("image scrub started {mark=%t}", mark)
+
+	closets, err := s.db.GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("Error listing wardrobe closets : %w", err)
+	}
+
+	report := &ImageScrubReport{
+		Damaged: make([]DamagedImage, 0),
+	}
+
+	for _, wc := range closets {
+		for i := range wc.Wardrobes {
+			ward := &wc.Wardrobes[i]
+
+			state := ImageOk
+			refs := []struct {
+				file string
+				size int64
+				sum  string
+			}{
+				{ward.MainFile, ward.MainSize, ward.MainSum},
+				{ward.LabelFile, ward.LabelSize, ward.LabelSum},
+			}
+
+			for _, ref := range refs {
+				if ref.file == "" {
+					continue
+				}
+				if ref.sum == "" {
+					report.Unverified++
+					continue
+				}
+
+				fileState, err := s.check(ref.file, ref.size, ref.sum)
+				if err != nil {
+					return nil, err
+				}
+				report.Scanned++
+
+				if fileState != ImageOk {
+					report.Damaged = append(report.Damaged, DamagedImage{
+						User:  wc.User,
+						Id:    ward.Identifier,
+						File:  ref.file,
+						State: fileState,
+					})
+				}
+				state = worseImageState(state, fileState)
+			}
+
+			if ward.ImageState == state || !mark {
+				continue
+			}
+
+			err := s.db.SetImageState(wc.User, ward.Identifier, state)
+			switch err.(type) {
+			case nil:
+				report.Marked++
+			case *ItemNotFound:
+				// deleted since the closets were read
+			default:
+				return nil, fmt.Errorf("Error marking wardrobe %s of user %s : %w", ward.Identifier, wc.User, err)
+			}
+		}
+	}
+
+	glog.Infof("image scrub done {scanned=%d}, {damaged=%d}, {unverified=%d}",
+		report.Scanned, len(report.Damaged), report.Unverified)
+
+	return report, nil
+}
+
+func (s *ImageScrubber) check(file string, size int64, sum string) (string, error) {
+
+	state := ImageOk
+	err := s.imageDb.GetFileWithHandler(file, func(path string) error {
+		var err error
+		state, _, err = checkImage(path, size, sum)
+		return err
+	})
+
+	var nf *NoSuchFileOrDirectory
+	if errors.As(err, &nf) {
+		return ImageMissing, nil
+	}
+	if damaged, ok := damagedImageState(err); ok {
+		glog.Warningf("image damaged {file=%s}, {err=%v}", file, err)
+		return damaged, nil
+	}
+	if err != nil {
+		return ImageOk, fmt.Errorf("Error scrubbing file %s : %w", file, err)
+	}
+
+	return state, nil
+}
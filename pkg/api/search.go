@@ -0,0 +1,280 @@
+//
+// search.go
+//
+
+package api
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// BM25 parameters, k1 saturates repeated words and b normalizes for the
+// length of a field
+const (
+	searchK1 = 1.2
+	searchB  = 0.75
+)
+
+// searchFields are the indexed fields of an item, a match in the
+// description counts more than one in the label text
+var searchFields = []struct {
+	name   string
+	weight float64
+}{
+	{"description", 3},
+	{"brand", 2},
+	{"tags", 2},
+	{"label-text", 1},
+}
+
+var stopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "at": true, "for": true, "in": true,
+	"of": true, "on": true, "or": true, "the": true, "to": true, "with": true,
+}
+
+// posting are the positions of a term in a field of an item
+type posting struct {
+	doc       int
+	field     int
+	positions []int
+}
+
+// searchIndex is an inverted index of the items of a closet
+type searchIndex struct {
+	postings map[string][]*posting
+	lengths  [][]int
+	average  []float64
+}
+
+type searchMatch struct {
+	doc    int
+	score  float64
+	fields []string
+}
+
+// tokenize lowercases text and splits it into words. Plurals are folded
+// so "jeans" finds "jean" and the other way round.
+func tokenize(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	for i, word := range words {
+		if len(word) > 3 && strings.HasSuffix(word, "s") && !strings.HasSuffix(word, "ss") {
+			words[i] = strings.TrimSuffix(word, "s")
+		}
+	}
+	return words
+}
+
+// queryTerms are the words of query to look for, stop words are dropped
+// unless there is nothing else
+func queryTerms(query string) []string {
+	words := tokenize(query)
+
+	terms := make([]string, 0, len(words))
+	for _, word := range words {
+		if !stopWords[word] {
+			terms = append(terms, word)
+		}
+	}
+	if len(terms) == 0 {
+		return words
+	}
+	return terms
+}
+
+func fieldText(ward *Wardrobe, field int) string {
+	switch searchFields[field].name {
+	case "description":
+		return ward.Description
+	case "brand":
+		return ward.Brand
+	case "tags":
+		return strings.Join(ward.Tags, " ")
+	}
+	return ward.LabelText
+}
+
+func newSearchIndex(wards []Wardrobe) *searchIndex {
+	ix := &searchIndex{
+		postings: make(map[string][]*posting),
+		lengths:  make([][]int, len(wards)),
+		average:  make([]float64, len(searchFields)),
+	}
+
+	for doc := range wards {
+		ix.lengths[doc] = make([]int, len(searchFields))
+
+		for field := range searchFields {
+			words := tokenize(fieldText(&wards[doc], field))
+			ix.lengths[doc][field] = len(words)
+			ix.average[field] += float64(len(words)) / float64(len(wards))
+
+			seen := make(map[string]*posting)
+			for pos, word := range words {
+				p := seen[word]
+				if p == nil {
+					p = &posting{doc: doc, field: field}
+					seen[word] = p
+					ix.postings[word] = append(ix.postings[word], p)
+				}
+				p.positions = append(p.positions, pos)
+			}
+		}
+	}
+
+	return ix
+}
+
+// search scores the items holding every term with BM25, summed over the
+// fields by their weight. Every field holding the terms as a phrase adds a
+// tenth of its weight to the score.
+func (ix *searchIndex) search(terms []string) []*searchMatch {
+
+	docs := len(ix.lengths)
+	scores := make(map[int]float64)
+	hits := make(map[int]int)
+	fields := make(map[int]map[int]bool)
+
+	unique := uniqueTerms(terms)
+	for term := range unique {
+		df := make(map[int]bool)
+		for _, p := range ix.postings[term] {
+			df[p.doc] = true
+		}
+		idf := math.Log(1 + (float64(docs)-float64(len(df))+0.5)/(float64(len(df))+0.5))
+
+		for _, p := range ix.postings[term] {
+			tf := float64(len(p.positions))
+			norm := 1 - searchB + searchB*float64(ix.lengths[p.doc][p.field])/ix.average[p.field]
+			scores[p.doc] += idf * searchFields[p.field].weight * tf * (searchK1 + 1) / (tf + searchK1*norm)
+
+			if fields[p.doc] == nil {
+				fields[p.doc] = make(map[int]bool)
+			}
+			fields[p.doc][p.field] = true
+		}
+		for doc := range df {
+			hits[doc]++
+		}
+	}
+
+	matches := make([]*searchMatch, 0)
+	for doc, score := range scores {
+		if hits[doc] < len(unique) {
+			continue
+		}
+
+		m := &searchMatch{doc: doc, score: score}
+		for field := range searchFields {
+			if !fields[doc][field] {
+				continue
+			}
+			m.fields = append(m.fields, searchFields[field].name)
+			if len(terms) > 1 && ix.phrase(doc, field, terms) {
+				m.score += m.score * searchFields[field].weight / 10
+			}
+		}
+		matches = append(matches, m)
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].score != matches[j].score {
+			return matches[i].score > matches[j].score
+		}
+		return matches[i].doc < matches[j].doc
+	})
+
+	return matches
+}
+
+// phrase is set when terms follow each other in field of doc
+func (ix *searchIndex) phrase(doc int, field int, terms []string) bool {
+
+	positions := make([]map[int]bool, len(terms))
+	for i, term := range terms {
+		positions[i] = make(map[int]bool)
+		for _, p := range ix.postings[term] {
+			if p.doc == doc && p.field == field {
+				for _, pos := range p.positions {
+					positions[i][pos] = true
+				}
+			}
+		}
+	}
+
+	for start := range positions[0] {
+		found := true
+		for i := 1; i < len(terms) && found; i++ {
+			found = positions[i][start+i]
+		}
+		if found {
+			return true
+		}
+	}
+	return false
+}
+
+func uniqueTerms(terms []string) map[string]bool {
+	unique := make(map[string]bool)
+	for _, term := range terms {
+		unique[term] = true
+	}
+	return unique
+}
+
+// Search finds the items of user holding every word of query, best match
+// first. The index is built from the closet for each search, a closet is a
+// single document and small enough for that.
+func (w *wardrobeService) Search(user string, query string, limit int) ([]*SearchHit, error) {
+
+	terms := queryTerms(query)
+	if len(terms) == 0 {
+		return nil, &InvalidRequest{Field: "q", Reason: "no words to search for"}
+	}
+
+	if limit == 0 {
+		limit = DefaultListLimit
+	}
+	if limit < 0 || limit > MaxListLimit {
+		return nil, &InvalidRequest{Field: "limit", Reason: fmt.Sprintf("must be between 1 and %d", MaxListLimit)}
+	}
+
+	uid, err := w.userId(user)
+	if err != nil {
+		return nil, err
+	}
+
+	wc, err := w.db.Get(uid)
+	switch err := err.(type) {
+	case nil:
+		break
+	case *UserNotFound:
+		return nil, fmt.Errorf("User not found %s : %w", user, err)
+	case *ResourceUnavailable:
+		return nil, fmt.Errorf("Wardrobe db is unavailable : %w", err)
+	default:
+		return nil, fmt.Errorf("Unknown error : %w", err)
+	}
+
+	matches := newSearchIndex(wc.Wardrobes).search(terms)
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+
+	hits := make([]*SearchHit, 0, len(matches))
+	for _, m := range matches {
+		hits = append(hits, &SearchHit{
+			Item:   wardrobeResponse(&wc.Wardrobes[m.doc]),
+			Score:  math.Round(m.score*1000) / 1000,
+			Fields: m.fields,
+		})
+	}
+
+	return hits, nil
+}
@@ -0,0 +1,278 @@
+//
+// sharing.go
+//
+
+package api
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+var roleRank = map[Role]int{
+	RoleNone:        0,
+	RoleViewer:      1,
+	RoleContributor: 2,
+	RoleManager:     3,
+	RoleOwner:       4,
+}
+
+// Allows reports whether r includes need
+func (r Role) Allows(need Role) bool {
+	return roleRank[r] >= roleRank[need]
+}
+
+// Access is the role caller has in the closet of user. Unknown users have
+// no access to anything.
+func (w *wardrobeService) Access(caller string, user string) (Role, error) {
+
+	if caller == user {
+		return RoleOwner, nil
+	}
+
+	cid, err := w.userId(caller)
+	switch err.(type) {
+	case nil:
+	case *UserNotFound:
+		return RoleNone, nil
+	default:
+		return RoleNone, err
+	}
+
+	oid, err := w.userId(user)
+	switch err.(type) {
+	case nil:
+	case *UserNotFound:
+		return RoleNone, nil
+	default:
+		return RoleNone, err
+	}
+
+	return w.role(cid, oid)
+}
+
+// role is Access by user id
+func (w *wardrobeService) role(cid string, oid string) (Role, error) {
+
+	if cid == oid {
+		return RoleOwner, nil
+	}
+
+	share, err := w.shareDb.Get(oid, cid)
+	switch err := err.(type) {
+	case nil:
+	case *ShareNotFound:
+		return RoleNone, nil
+	case *ResourceUnavailable:
+		return RoleNone, fmt.Errorf("Share db is unavailable : %w", err)
+	default:
+		return RoleNone, fmt.Errorf("Unknown error : %w", err)
+	}
+
+	if !share.Accepted {
+		return RoleNone, nil
+	}
+
+	return share.Role, nil
+}
+
+// ShareCloset invites another user into the closet of user. Inviting a user
+// again changes the role, an accepted share stays accepted.
+func (w *wardrobeService) ShareCloset(user string, newShare NewShareRequest) (*GetShareResponse, error) {
+
+	glog.Infof("sharing closet {user=%s}, {with=%s}, {role=%s}", user, newShare.User, newShare.Role)
+
+	switch newShare.Role {
+	case RoleViewer, RoleContributor, RoleManager:
+	default:
+		return nil, &InvalidRequest{Field: "role", Reason: fmt.Sprintf("%q is not a role", newShare.Role)}
+	}
+
+	oid, err := w.userId(user)
+	if err != nil {
+		return nil, err
+	}
+
+	gid, err := w.userId(newShare.User)
+	if err != nil {
+		return nil, err
+	}
+
+	if oid == gid {
+		return nil, &InvalidRequest{Field: "user", Reason: fmt.Sprintf("%s already owns the closet", newShare.User)}
+	}
+
+	share, err := w.shareDb.Get(oid, gid)
+	switch e := err.(type) {
+	case nil:
+		share.Role = newShare.Role
+		err = w.shareDb.Update(share)
+	case *ShareNotFound:
+		share = &Share{
+			Owner:   oid,
+			User:    gid,
+			Role:    newShare.Role,
+			Created: time.Now().UTC(),
+		}
+		err = w.shareDb.Add(share)
+	case *ResourceUnavailable:
+		return nil, fmt.Errorf("Share db is unavailable : %w", e)
+	default:
+		return nil, fmt.Errorf("Unknown error : %w", e)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Database access failure : %w", err)
+	}
+
+	return w.shareResponse(share), nil
+}
+
+// AcceptShare accepts the invitation of user into the closet of owner
+func (w *wardrobeService) AcceptShare(user string, owner string) error {
+
+	glog.Infof("accepting share {user=%s}, {owner=%s}", user, owner)
+
+	share, err := w.share(owner, user)
+	if err != nil {
+		return err
+	}
+
+	share.Accepted = true
+
+	err = w.shareDb.Update(share)
+	if err != nil {
+		return fmt.Errorf("Database access failure : %w", err)
+	}
+
+	return nil
+}
+
+// RevokeShare takes grantee's access to the closet of user, whether it was
+// accepted or not
+func (w *wardrobeService) RevokeShare(user string, grantee string) error {
+
+	glog.Infof("revoking share {user=%s}, {with=%s}", user, grantee)
+
+	share, err := w.share(user, grantee)
+	if err != nil {
+		return err
+	}
+
+	err = w.shareDb.Delete(share.Owner, share.User)
+	if err != nil {
+		return fmt.Errorf("Database access failure : %w", err)
+	}
+
+	return nil
+}
+
+// GetShares lists who the closet of user is shared with
+func (w *wardrobeService) GetShares(user string) ([]*GetShareResponse, error) {
+
+	oid, err := w.userId(user)
+	if err != nil {
+		return nil, err
+	}
+
+	shares, err := w.shareDb.ListByOwner(oid)
+	if err != nil {
+		return nil, fmt.Errorf("Database access failure : %w", err)
+	}
+
+	return w.shareResponses(shares), nil
+}
+
+// GetSharedWithMe lists the closets shared with user, including invitations
+// that still need accepting
+func (w *wardrobeService) GetSharedWithMe(user string) ([]*GetShareResponse, error) {
+
+	uid, err := w.userId(user)
+	if err != nil {
+		return nil, err
+	}
+
+	shares, err := w.shareDb.ListByUser(uid)
+	if err != nil {
+		return nil, fmt.Errorf("Database access failure : %w", err)
+	}
+
+	return w.shareResponses(shares), nil
+}
+
+func (w *wardrobeService) share(owner string, user string) (*Share, error) {
+
+	oid, err := w.userId(owner)
+	if err != nil {
+		return nil, err
+	}
+
+	uid, err := w.userId(user)
+	if err != nil {
+		return nil, err
+	}
+
+	share, err := w.shareDb.Get(oid, uid)
+	switch err := err.(type) {
+	case nil:
+		return share, nil
+	case *ShareNotFound:
+		return nil, &ShareNotFound{Owner: owner, User: user}
+	case *ResourceUnavailable:
+		return nil, fmt.Errorf("Share db is unavailable : %w", err)
+	default:
+		return nil, fmt.Errorf("Unknown error : %w", err)
+	}
+}
+
+// removeShares drops every share from and to the user with id uid
+func (w *wardrobeService) removeShares(uid string) error {
+
+	owned, err := w.shareDb.ListByOwner(uid)
+	if err != nil {
+		return fmt.Errorf("Database access failure : %w", err)
+	}
+
+	granted, err := w.shareDb.ListByUser(uid)
+	if err != nil {
+		return fmt.Errorf("Database access failure : %w", err)
+	}
+
+	for _, share := range append(owned, granted...) {
+		err = w.shareDb.Delete(share.Owner, share.User)
+		if err != nil {
+			return fmt.Errorf("Database access failure : %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (w *wardrobeService) shareResponses(shares []*Share) []*GetShareResponse {
+	resps := make([]*GetShareResponse, 0, len(shares))
+	for _, share := range shares {
+		resps = append(resps, w.shareResponse(share))
+	}
+	return resps
+}
+
+// shareResponse names both sides of share by their current username
+func (w *wardrobeService) shareResponse(share *Share) *GetShareResponse {
+	return &GetShareResponse{
+		Owner:    w.username(share.Owner),
+		User:     w.username(share.User),
+		Role:     share.Role,
+		Accepted: share.Accepted,
+		Created:  share.Created,
+	}
+}
+
+func (w *wardrobeService) username(uid string) string {
+	u, err := w.userDb.Get(uid)
+	if err != nil {
+		glog.Warningf("Error looking up user {id=%s} : {err=%v}", uid, err)
+		return uid
+	}
+	return u.Username
+}
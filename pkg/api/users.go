@@ -0,0 +1,330 @@
+//
+// users.go
+//
+
+package api
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/google/uuid"
+)
+
+const maxUsernameLen = 128
+
+func (w *wardrobeService) RegisterUser(newUser NewUserRequest) (*GetUserResponse, error) {
+
+	glog.Infof("registering user {user=%s}", newUser.Username)
+
+	if !validUsername(newUser.Username) {
+		return nil, &InvalidRequest{Field: "username", Reason: fmt.Sprintf("%q is not a valid username", newUser.Username)}
+	}
+
+	w.umu.Lock()
+	defer w.umu.Unlock()
+
+	_, err := w.userDb.GetByUsername(newUser.Username)
+	switch err := err.(type) {
+	case nil:
+		return nil, &DuplicateUser{User: newUser.Username}
+	case *UserNotFound:
+	case *ResourceUnavailable:
+		return nil, fmt.Errorf("User db is unavailable : %w", err)
+	default:
+		return nil, fmt.Errorf("Unknown error : %w", err)
+	}
+
+	// a closet left from before user accounts becomes the new user's
+	id := uuid.New().String()
+	legacy, err := w.legacyCloset(newUser.Username)
+	if err != nil {
+		return nil, err
+	}
+	if legacy {
+		id = newUser.Username
+	}
+
+	u := &User{
+		Identifier:  id,
+		Username:    newUser.Username,
+		DisplayName: newUser.DisplayName,
+		Preferences: mergePreferences(nil, newUser.Preferences),
+		Created:     time.Now().UTC(),
+	}
+
+	err = w.userDb.Add(u)
+	switch err.(type) {
+	case nil:
+	case *DuplicateUser:
+		return nil, err
+	default:
+		return nil, fmt.Errorf("Database access failure : %w", err)
+	}
+
+	glog.Infof("done registering user {user=%s}, {id=%s}", u.Username, u.Identifier)
+
+	return userResponse(u), nil
+}
+
+func (w *wardrobeService) GetUser(user string) (*GetUserResponse, error) {
+
+	u, err := w.user(user)
+	if err != nil {
+		return nil, err
+	}
+
+	return userResponse(u), nil
+}
+
+// UpdateUser changes the profile of user. The username cannot be changed,
+// api keys and tokens name the user they were issued for, so a renamed user
+// would be locked out and whoever took the old name would be let in.
+func (w *wardrobeService) UpdateUser(user string, update UpdateUserRequest) (*GetUserResponse, error) {
+
+	glog.Infof("updating user {user=%s}", user)
+
+	u, err := w.user(user)
+	if err != nil {
+		return nil, err
+	}
+
+	w.umu.Lock()
+	defer w.umu.Unlock()
+
+	if update.Username != "" && update.Username != u.Username {
+		return nil, &InvalidRequest{Field: "username", Reason: "usernames cannot be changed"}
+	}
+
+	if update.DisplayName != nil {
+		u.DisplayName = *update.DisplayName
+	}
+	u.Preferences = mergePreferences(u.Preferences, update.Preferences)
+
+	err = w.userDb.Update(u)
+	if err != nil {
+		return nil, fmt.Errorf("Database access failure : %w", err)
+	}
+
+	return userResponse(u), nil
+}
+
+// DeleteUser removes user along with the closet, its images, shares,
+// share links and webhooks
+func (w *wardrobeService) DeleteUser(user string) error {
+
+	glog.Infof("deleting user {user=%s}", user)
+
+	u, err := w.user(user)
+	if err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	wc, err := w.db.Get(u.Identifier)
+	switch err := err.(type) {
+	case nil:
+		userImageDb := w.userImages(u.Identifier)
+		for _, ward := range wc.Wardrobes {
+			w.removeFiles(userImageDb, ward.MainFile, ward.LabelFile)
+		}
+
+		err = w.db.DeleteAll(u.Identifier)
+		if err != nil {
+			return fmt.Errorf("Database access failure : %w", err)
+		}
+	case *UserNotFound:
+		// nothing stored yet
+	case *ResourceUnavailable:
+		return fmt.Errorf("Wardrobe db is unavailable : %w", err)
+	default:
+		return fmt.Errorf("Unknown error : %w", err)
+	}
+
+	err = w.removeShares(u.Identifier)
+	if err != nil {
+		return err
+	}
+
+	links, err := w.linkDb.ListByOwner(u.Identifier)
+	if err != nil {
+		return fmt.Errorf("Database access failure : %w", err)
+	}
+	for _, link := range links {
+		err = w.linkDb.Delete(link.Identifier)
+		if err != nil {
+			return fmt.Errorf("Database access failure : %w", err)
+		}
+	}
+
+	err = w.removeWebhooks(u.Identifier)
+	if err != nil {
+		return err
+	}
+
+	w.events.forget(u.Identifier)
+
+	err = w.userDb.Delete(u.Identifier)
+	if err != nil {
+		return fmt.Errorf("Database access failure : %w", err)
+	}
+
+	glog.Infof("done deleting user {user=%s}, {id=%s}", user, u.Identifier)
+
+	return nil
+}
+
+// user looks up the account of username, adopting a closet from before
+// user accounts existed
+func (w *wardrobeService) user(username string) (*User, error) {
+
+	uid, err := w.userId(username)
+	if err != nil {
+		return nil, err
+	}
+
+	u, err := w.userDb.Get(uid)
+	switch err := err.(type) {
+	case nil:
+		return u, nil
+	case *UserNotFound:
+		return nil, err
+	case *ResourceUnavailable:
+		return nil, fmt.Errorf("User db is unavailable : %w", err)
+	default:
+		return nil, fmt.Errorf("Unknown error : %w", err)
+	}
+}
+
+// userId resolves username to the stable id closets and image names are
+// keyed by. Closets created before user accounts are keyed by the username
+// itself, their owner is registered with that as the id on first use, so
+// nothing has to be moved.
+func (w *wardrobeService) userId(username string) (string, error) {
+
+	u, err := w.userDb.GetByUsername(username)
+	switch err := err.(type) {
+	case nil:
+		return u.Identifier, nil
+	case *UserNotFound:
+	case *ResourceUnavailable:
+		return "", fmt.Errorf("User db is unavailable : %w", err)
+	default:
+		return "", fmt.Errorf("Unknown error : %w", err)
+	}
+
+	w.umu.Lock()
+	defer w.umu.Unlock()
+
+	legacy, err := w.legacyCloset(username)
+	if err != nil {
+		return "", err
+	}
+	if !legacy {
+		return "", &UserNotFound{User: username}
+	}
+
+	glog.Infof("adopting closet of unregistered user {user=%s}", username)
+
+	u = &User{
+		Identifier: username,
+		Username:   username,
+		Created:    time.Now().UTC(),
+	}
+
+	err = w.userDb.Add(u)
+	switch err.(type) {
+	case nil:
+	case *DuplicateUser:
+		// adopted concurrently
+		return username, nil
+	default:
+		return "", fmt.Errorf("Database access failure : %w", err)
+	}
+
+	return u.Identifier, nil
+}
+
+// registeredUserId is userId, registering username when it is unknown
+func (w *wardrobeService) registeredUserId(username string) (string, error) {
+
+	uid, err := w.userId(username)
+	if _, ok := err.(*UserNotFound); !ok {
+		return uid, err
+	}
+
+	u, err := w.RegisterUser(NewUserRequest{Username: username})
+	switch err.(type) {
+	case nil:
+		return u.Id, nil
+	case *DuplicateUser:
+		return w.userId(username)
+	default:
+		return "", err
+	}
+}
+
+// legacyCloset reports whether a closet is keyed by username while no user
+// owns it. Must be called with umu held.
+func (w *wardrobeService) legacyCloset(username string) (bool, error) {
+
+	_, err := w.db.Get(username)
+	switch err := err.(type) {
+	case nil:
+	case *UserNotFound:
+		return false, nil
+	case *ResourceUnavailable:
+		return false, fmt.Errorf("Wardrobe db is unavailable : %w", err)
+	default:
+		return false, fmt.Errorf("Unknown error : %w", err)
+	}
+
+	// a user renamed away from its original name still owns the closet
+	_, err = w.userDb.Get(username)
+	switch err := err.(type) {
+	case nil:
+		return false, nil
+	case *UserNotFound:
+		return true, nil
+	case *ResourceUnavailable:
+		return false, fmt.Errorf("User db is unavailable : %w", err)
+	default:
+		return false, fmt.Errorf("Unknown error : %w", err)
+	}
+}
+
+func validUsername(username string) bool {
+	return username != "" && len(username) <= maxUsernameLen &&
+		!strings.ContainsAny(username, "/\\?#%") && strings.TrimSpace(username) == username
+}
+
+// mergePreferences applies update to prefs, a preference set to "" is
+// removed
+func mergePreferences(prefs, update map[string]string) map[string]string {
+	merged := make(map[string]string)
+	for k, v := range prefs {
+		merged[k] = v
+	}
+	for k, v := range update {
+		if v == "" {
+			delete(merged, k)
+		} else {
+			merged[k] = v
+		}
+	}
+	return merged
+}
+
+func userResponse(u *User) *GetUserResponse {
+	return &GetUserResponse{
+		Id:          u.Identifier,
+		Username:    u.Username,
+		DisplayName: u.DisplayName,
+		Preferences: u.Preferences,
+		Created:     u.Created,
+	}
+}
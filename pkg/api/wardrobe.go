@@ -8,12 +8,14 @@ package api
 
 import (
 	"crypto/md5"
-	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
+	"os"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/golang/glog"
 	"github.com/gomodule/redigo/redis"
@@ -24,22 +26,102 @@ type WardrobeService interface {
 	AddWardrobe(new NewWardrobeRequest) error
 	DeleteWardrobe(user string, id string) error
 	GetWardrobe(user string, id string) (*GetWardrobeResponse, error)
-	GetAllWardrobe(user string) ([]*GetWardrobeResponse, error)
+	GetWardrobes(user string, ids []string) ([]*GetWardrobeResponse, error)
+	GetAllWardrobe(user string, opts ListOptions) (*GetWardrobePage, error)
 	GetFile(filename string, cbHandler HandleFile) error
+	GetImage(user string, id string, filename string, cbHandler HandleImage) error
+	GetUsage(user string) (*GetUsageResponse, error)
+	Search(user string, query string, limit int) ([]*SearchHit, error)
+
+	RegisterUser(new NewUserRequest) (*GetUserResponse, error)
+	GetUser(user string) (*GetUserResponse, error)
+	UpdateUser(user string, update UpdateUserRequest) (*GetUserResponse, error)
+	DeleteUser(user string) error
+
+	As(caller string) WardrobeService
+	Access(caller string, user string) (Role, error)
+	ShareCloset(user string, share NewShareRequest) (*GetShareResponse, error)
+	AcceptShare(user string, owner string) error
+	RevokeShare(user string, grantee string) error
+	GetShares(user string) ([]*GetShareResponse, error)
+	GetSharedWithMe(user string) ([]*GetShareResponse, error)
+
+	CreateShareLink(user string, link NewShareLinkRequest) (*GetShareLinkResponse, error)
+	GetShareLinks(user string) ([]*GetShareLinkResponse, error)
+	RevokeShareLink(user string, id string) error
+	GetLook(token string) (*GetLookResponse, error)
+	GetLookImage(token string, filename string, cbHandler HandleImage) error
 
 	AddOutfit(new NewOutfitRequest) error
 	DeleteOutfit(user string, id string) error
 	GetOutfit(user string, id string) (*GetOutfitResponse, error)
-	GetAllOutfits(user string) ([]*GetOutfitResponse, error)
+	GetOutfits(user string, ids []string) ([]*GetOutfitResponse, error)
+	GetAllOutfits(user string, opts ListOptions) (*GetOutfitPage, error)
+	ReactOutfit(user string, id string, reaction Reaction) (*GetOutfitResponse, error)
+
+	LogWear(new NewWearRequest) (*GetWearResponse, error)
+	GetWears(user string, limit int) ([]*GetWearResponse, error)
+
+	CreateWebhook(user string, hook NewWebhookRequest) (*GetWebhookResponse, error)
+	GetWebhooks(user string) ([]*GetWebhookResponse, error)
+	DeleteWebhook(user string, id string) error
+	GetDeliveries(user string, id string, limit int) ([]*GetDeliveryResponse, error)
+	Redeliver(user string, id string, delivery string) (*GetDeliveryResponse, error)
+
+	WatchEvents(user string, lastEventId string) (*EventStream, error)
 }
 
 type WardrobeRepository interface {
 	Add(user string, wardrobes *WardrobeCloset) error
 	Get(user string) (*WardrobeCloset, error)
+	GetAll() ([]*WardrobeCloset, error)
+	FindByImage(file string) (*WardrobeCloset, error)
 	Update(user string, wardrobes *WardrobeCloset) error
+	SetImageState(user string, id string, state string) error
+	ListLabelsDue(sentBefore time.Time) ([]string, error)
 	DeleteAll(user string) error
 }
 
+type UserRepository interface {
+	Add(user *User) error
+	Get(id string) (*User, error)
+	GetByUsername(username string) (*User, error)
+	Update(user *User) error
+	Delete(id string) error
+}
+
+type ShareRepository interface {
+	Add(share *Share) error
+	Get(owner string, user string) (*Share, error)
+	ListByOwner(owner string) ([]*Share, error)
+	ListByUser(user string) ([]*Share, error)
+	Update(share *Share) error
+	Delete(owner string, user string) error
+}
+
+type LinkRepository interface {
+	Add(link *ShareLink) error
+	Get(id string) (*ShareLink, error)
+	GetByToken(tokenSum string) (*ShareLink, error)
+	ListByOwner(owner string) ([]*ShareLink, error)
+	Delete(id string) error
+}
+
+// WebhookRepository keeps webhooks and the log of their deliveries
+type WebhookRepository interface {
+	Add(hook *Webhook) error
+	Get(id string) (*Webhook, error)
+	ListByOwner(owner string) ([]*Webhook, error)
+	Delete(id string) error
+
+	AddDelivery(delivery *Delivery) error
+	GetDelivery(id string) (*Delivery, error)
+	UpdateDelivery(delivery *Delivery) error
+	ListDeliveries(webhook string, limit int) ([]*Delivery, error)
+	ClaimDue(now time.Time, lease time.Duration, limit int) ([]*Delivery, error)
+	DeleteDeliveries(webhook string) error
+}
+
 type ImageRepository interface {
 	AddFile(name string, file []byte) error
 	GetFile(name string) ([]byte, error)
@@ -47,32 +129,85 @@ type ImageRepository interface {
 	DeleteFile(name string) error
 	AddFileFromFile(name string, rd io.Reader) error
 	GetFileWithHandler(filename string, fileHandler HandleFile) error
+	ListFiles() ([]ImageInfo, error)
+}
+
+// UserImageRepository is implemented by image repositories that keep per
+// user state, such as per user encryption keys
+type UserImageRepository interface {
+	ForUser(user string) ImageRepository
+}
+
+// ImageStatRepository is implemented by image repositories that can tell
+// whether a file exists without reading it
+type ImageStatRepository interface {
+	HasFile(name string) (bool, error)
+}
+
+// ImageExists looks name up in repo, reading the file only when repo has
+// no cheaper way
+func ImageExists(repo ImageRepository, name string) (bool, error) {
+	if sr, ok := repo.(ImageStatRepository); ok {
+		return sr.HasFile(name)
+	}
+
+	_, err := repo.GetFile(name)
+	switch err.(type) {
+	case nil:
+		return true, nil
+	case *NoSuchFileOrDirectory:
+		return false, nil
+	default:
+		return false, err
+	}
 }
 
 type wardrobeService struct {
 	mu      sync.Mutex
+	umu     sync.Mutex
+	omu     sync.Mutex
+	outbox  []*queuedEvent
+	sending bool
 	db      WardrobeRepository
+	userDb  UserRepository
+	shareDb ShareRepository
+	linkDb  LinkRepository
+	hookDb  WebhookRepository
 	imageDb ImageRepository
-	l       *wardrobeLabelToText
+	events  *eventHub
+	l       labelSender
+	labels  LabelJobs
+	quota   Quota
 }
 
-func NewWardrobeService(dbIn WardrobeRepository, imageDbIn ImageRepository, rds, rx, tx string) (WardrobeService, error) {
+func NewWardrobeService(dbIn WardrobeRepository, userDbIn UserRepository, shareDbIn ShareRepository, linkDbIn LinkRepository, hookDbIn WebhookRepository, imageDbIn ImageRepository, quota Quota, labels LabelJobs, rds, rx, tx string) (WardrobeService, error) {
 
-	glog.Infof("Creating Wardrobe Service")
+	glog.Infof("Creating Wardrobe Service {max-items=%d}, {max-image-bytes=%d}", quota.MaxItems, quota.MaxImageBytes)
 
 	service := &wardrobeService{
 		db:      dbIn,
+		userDb:  userDbIn,
+		shareDb: shareDbIn,
+		linkDb:  linkDbIn,
+		hookDb:  hookDbIn,
 		imageDb: imageDbIn,
+		events:  newEventHub(eventHistory, eventIdle),
+		labels:  labels,
+		quota:   quota,
 	}
 
-	var err error
-	service.l, err = newWardrobeLabelToText(rds, rx, tx, service)
+	l, err := newWardrobeLabelToText(rds, rx, tx, service)
 	if err != nil {
 		glog.Errorf("error initializing label to text service endpoint : {err=%v}", err)
 		return nil, err
 	}
+	service.l = l
 
-	go service.l.receiveLoop()
+	go l.receiveLoop()
+
+	if labels.Interval > 0 {
+		go service.watchLabels(labels.Interval)
+	}
 
 	return service, nil
 }
@@ -86,16 +221,23 @@ func (w *wardrobeService) AddWardrobe(newWd NewWardrobeRequest) error {
 
 	glog.Infof("adding wardrobe {user=%s}, {id=%s}", newWd.User, id)
 
+	// adding the first item still registers the user, as it did before
+	// there were user accounts
+	uid, err := w.registeredUserId(newWd.User)
+	if err != nil {
+		return err
+	}
+
 	w.mu.Lock()
-	defer w.mu.Unlock()
+	defer w.unlock()
 
-	wc, err := w.db.Get(newWd.User)
+	wc, err := w.db.Get(uid)
 	switch err := err.(type) {
 	case nil:
 	case *UserNotFound:
 		addUser = true
 		wc = &WardrobeCloset{
-			User:      newWd.User,
+			User:      uid,
 			Wardrobes: make([]Wardrobe, 0),
 			Outfits:   make([]Outfit, 0),
 		}
@@ -105,23 +247,29 @@ func (w *wardrobeService) AddWardrobe(newWd NewWardrobeRequest) error {
 		return fmt.Errorf("Unknown error : %w", err)
 	}
 
+	err = w.checkQuota(wc, newWd.MainImageMime.Size+newWd.LabelImageMime.Size)
+	if err != nil {
+		return err
+	}
+
 	//Store image to file
-	imageFile := genUniqImageFileName(newWd.User, id)
-	labelFile := genUniqLabelFileName(newWd.User, id)
+	imageFile := genUniqImageFileName(uid, id)
+	labelFile := genUniqLabelFileName(uid, id)
+
+	// item creation is all or nothing, anything stored before a failure
+	// is removed again from the same store
+	userImageDb := w.userImages(uid)
 
 	for _, file := range []string{imageFile, labelFile} {
-		_, err := w.imageDb.GetFile(file)
-		switch err := err.(type) {
-		case NoSuchFileOrDirectory:
-			// this is good
-			break
-		case nil:
+		found, err := ImageExists(userImageDb, file)
+		if err != nil {
+			return fmt.Errorf("File system access error : %w", err)
+		}
+		if found {
 			// file with same name found
 			return &DuplicateFile{
 				File: file,
 			}
-		default:
-			return fmt.Errorf("File system access error : %w", err)
 		}
 	}
 
@@ -138,13 +286,16 @@ func (w *wardrobeService) AddWardrobe(newWd NewWardrobeRequest) error {
 	}
 	defer mimeLabelFile.Close()
 
-	err = w.imageDb.AddFileFromFile(imageFile, mimeMainFile)
+	mainSum := newImageSum(mimeMainFile)
+	err = userImageDb.AddFileFromFile(imageFile, mainSum)
 	if err != nil {
 		return fmt.Errorf("Error saving image to file system : %w", err)
 	}
 
-	err = w.imageDb.AddFileFromFile(labelFile, mimeLabelFile)
+	labelSum := newImageSum(mimeLabelFile)
+	err = userImageDb.AddFileFromFile(labelFile, labelSum)
 	if err != nil {
+		w.removeFiles(userImageDb, imageFile)
 		return fmt.Errorf("Error saving image to file system : %w", err)
 	}
 
@@ -153,26 +304,46 @@ func (w *wardrobeService) AddWardrobe(newWd NewWardrobeRequest) error {
 		Identifier:  id,
 		MainFile:    imageFile,
 		LabelFile:   labelFile,
+		MainSize:    mainSum.size,
+		LabelSize:   labelSum.size,
+		MainSum:     mainSum.sum(),
+		LabelSum:    labelSum.sum(),
+		Created:     time.Now().UTC(),
+		Label:       LabelJob{State: LabelPending, Queued: time.Now().UTC()},
 		Description: newWd.Description,
+		Brand:       strings.TrimSpace(newWd.Brand),
+		Tags:        normalizeTags(newWd.Tags),
 	})
 	if addUser == true {
-		err = w.db.Add(newWd.User, wc)
+		err = w.db.Add(uid, wc)
 	} else {
-		err = w.db.Update(newWd.User, wc)
+		err = w.db.Update(uid, wc)
 	}
 	switch err := err.(type) {
 	case nil:
 	default:
+		w.removeFiles(userImageDb, imageFile, labelFile)
 		return fmt.Errorf("Database access failure : %w", err)
 	}
 
-	//label to text
-	sEnc := base64.StdEncoding.EncodeToString(newWd.LabelImage)
-	err = w.l.sendLabel(newWd.User, id, sEnc)
+	//label to text, the item is there already whatever becomes of it. The
+	//label is sent as stored, a label that cannot be read back is left
+	//pending for the label job watcher to send.
+	ward := findWardrobe(wc, id)
+	label, err := userImageDb.GetFile(labelFile)
+	if err != nil {
+		glog.Warningf("failure while trying to read label for label to text {user=%s}, {id=%s}, {err=%v}", newWd.User, id, err)
+		ward.Label.Error = fmt.Sprintf("label image unreadable : %v", err)
+	} else {
+		w.sendLabelJob(uid, ward, label, time.Now().UTC())
+	}
+	err = w.db.Update(uid, wc)
 	if err != nil {
-		glog.Warningf("failure while trying to send lable from label to text {err=%v}", err)
+		glog.Errorf("Error recording label job {user=%s}, {id=%s} : {err=%v}", newWd.User, id, err)
 	}
 
+	w.publish(uid, EventItemCreated, wardrobeResponse(findWardrobe(wc, id)))
+
 	glog.Infof("done adding wardrobe {user=%s}, {id=%s}", newWd.User, id)
 
 	return nil
@@ -180,12 +351,17 @@ func (w *wardrobeService) AddWardrobe(newWd NewWardrobeRequest) error {
 
 func (w *wardrobeService) DeleteWardrobe(user string, id string) error {
 
+	uid, err := w.userId(user)
+	if err != nil {
+		return err
+	}
+
 	glog.Infof("deleting wardrobe {user=%s}, {id=%s}", user, id)
 
 	w.mu.Lock()
-	defer w.mu.Unlock()
+	defer w.unlock()
 
-	wc, err := w.db.Get(user)
+	wc, err := w.db.Get(uid)
 	switch err := err.(type) {
 	case nil:
 		break
@@ -197,21 +373,25 @@ func (w *wardrobeService) DeleteWardrobe(user string, id string) error {
 		return fmt.Errorf("Unknown error : %w", err)
 	}
 
-	if len(wc.Wardrobes) == 0 {
-		return fmt.Errorf("Empty closet")
+	deleted := findWardrobe(wc, id)
+	if deleted == nil {
+		return &ItemNotFound{User: user, Id: id}
 	}
+	event := wardrobeResponse(deleted)
 
+	userImageDb := w.userImages(uid)
 	tmp := wc.Wardrobes[:0]
 	for _, ward := range wc.Wardrobes {
 		if ward.Identifier == id {
-			err = w.imageDb.DeleteFile(ward.MainFile)
+			// a file left behind here is picked up by the image gc
+			err = userImageDb.DeleteFile(ward.MainFile)
 			if err != nil {
-				fmt.Printf("Error deleting image file : %w", err)
+				glog.Warningf("Error deleting image file {file=%s} : {err=%v}", ward.MainFile, err)
 			}
 
-			err = w.imageDb.DeleteFile(ward.LabelFile)
+			err = userImageDb.DeleteFile(ward.LabelFile)
 			if err != nil {
-				fmt.Printf("Error deleting label file : %w", err)
+				glog.Warningf("Error deleting label file {file=%s} : {err=%v}", ward.LabelFile, err)
 			}
 		} else {
 			tmp = append(tmp, ward)
@@ -219,13 +399,15 @@ func (w *wardrobeService) DeleteWardrobe(user string, id string) error {
 	}
 	wc.Wardrobes = tmp
 
-	err = w.db.Update(user, wc)
+	err = w.db.Update(uid, wc)
 	switch err := err.(type) {
 	case nil:
 	default:
 		return fmt.Errorf("Database access failure : %w", err)
 	}
 
+	w.publish(uid, EventItemDeleted, event)
+
 	glog.Infof("done deleting wardrobe {user=%s}, {id=%s}", user, id)
 
 	return nil
@@ -233,7 +415,12 @@ func (w *wardrobeService) DeleteWardrobe(user string, id string) error {
 
 func (w *wardrobeService) GetWardrobe(user string, id string) (*GetWardrobeResponse, error) {
 
-	wc, err := w.db.Get(user)
+	uid, err := w.userId(user)
+	if err != nil {
+		return nil, err
+	}
+
+	wc, err := w.db.Get(uid)
 	switch err := err.(type) {
 	case nil:
 		break
@@ -245,29 +432,56 @@ func (w *wardrobeService) GetWardrobe(user string, id string) (*GetWardrobeRespo
 		return nil, fmt.Errorf("Unknown error : %w", err)
 	}
 
-	if len(wc.Wardrobes) == 0 {
-		return nil, fmt.Errorf("Empty closet")
+	for i := range wc.Wardrobes {
+		if wc.Wardrobes[i].Identifier == id {
+			return wardrobeResponse(&wc.Wardrobes[i]), nil
+		}
 	}
 
-	for _, ward := range wc.Wardrobes {
-		if ward.Identifier == id {
-			wardReq := &GetWardrobeResponse{
-				Id:          ward.Identifier,
-				Description: ward.Description,
-				MainImage:   ward.MainFile,
-				LabelImage:  ward.LabelFile,
-			}
+	return nil, &ItemNotFound{User: user, Id: id}
+}
 
-			return wardReq, nil
+// GetWardrobes gets the items ids of user with a single read of the closet.
+// The items are in the order of ids, nil where there is no such item.
+func (w *wardrobeService) GetWardrobes(user string, ids []string) ([]*GetWardrobeResponse, error) {
+
+	uid, err := w.userId(user)
+	if err != nil {
+		return nil, err
+	}
+
+	wc, err := w.db.Get(uid)
+	switch err := err.(type) {
+	case nil:
+		break
+	case *UserNotFound:
+		return nil, fmt.Errorf("User not found %s : %w", user, err)
+	case *ResourceUnavailable:
+		return nil, fmt.Errorf("Wardrobe db is unavailable : %w", err)
+	default:
+		return nil, fmt.Errorf("Unknown error : %w", err)
+	}
+
+	items := make([]*GetWardrobeResponse, len(ids))
+	for i, id := range ids {
+		if ward := findWardrobe(wc, id); ward != nil {
+			items[i] = wardrobeResponse(ward)
 		}
 	}
 
-	return nil, UserNotFound{User: user}
+	return items, nil
 }
 
-func (w *wardrobeService) GetAllWardrobe(user string) ([]*GetWardrobeResponse, error) {
+// GetAllWardrobe lists a page of the items of user, an empty closet is an
+// empty page
+func (w *wardrobeService) GetAllWardrobe(user string, opts ListOptions) (*GetWardrobePage, error) {
 
-	wc, err := w.db.Get(user)
+	uid, err := w.userId(user)
+	if err != nil {
+		return nil, err
+	}
+
+	wc, err := w.db.Get(uid)
 	switch err := err.(type) {
 	case nil:
 		break
@@ -279,28 +493,245 @@ func (w *wardrobeService) GetAllWardrobe(user string) ([]*GetWardrobeResponse, e
 		return nil, fmt.Errorf("Unknown error : %w", err)
 	}
 
-	if len(wc.Wardrobes) == 0 {
-		return nil, fmt.Errorf("Empty closet")
+	page, next, err := listWardrobes(wc, opts)
+	if err != nil {
+		return nil, err
 	}
 
-	wardReqs := make([]*GetWardrobeResponse, 0)
-	for _, ward := range wc.Wardrobes {
-		wardReq := &GetWardrobeResponse{
-			Id:          ward.Identifier,
-			Description: ward.Description,
-			MainImage:   ward.MainFile,
-			LabelImage:  ward.LabelFile,
+	wardPage := &GetWardrobePage{
+		Items: make([]*GetWardrobeResponse, 0, len(page)),
+		Next:  next,
+	}
+	for _, ward := range page {
+		wardPage.Items = append(wardPage.Items, wardrobeResponse(ward))
+	}
+
+	return wardPage, nil
+}
+
+// GetFile verifies the image against the size and checksum stored on its
+// wardrobe before handing it to cb. Images written before checksums were
+// recorded are passed through.
+func (w *wardrobeService) GetFile(filename string, cb HandleFile) error {
+
+	var ref *ImageMeta
+
+	wc, err := w.db.FindByImage(filename)
+	switch err := err.(type) {
+	case nil:
+		for i := range wc.Wardrobes {
+			if r := imageRef(&wc.Wardrobes[i], filename); r != nil {
+				ref = r
+			}
+		}
+	case *UserNotFound:
+		// not referenced by any wardrobe, nothing to verify against
+	case *ResourceUnavailable:
+		return fmt.Errorf("Wardrobe db is unavailable : %w", err)
+	default:
+		return fmt.Errorf("Unknown error : %w", err)
+	}
+
+	return w.verifyFile(filename, ref, func(path string, meta ImageMeta) error {
+		if cb == nil {
+			return nil
 		}
+		return cb(path)
+	})
+}
+
+// GetImage verifies an image of user's item id like GetFile and hands cb the
+// content along with what a client needs to cache it. Images that are not
+// referenced by that item are reported as not found.
+func (w *wardrobeService) GetImage(user string, id string, filename string, cb HandleImage) error {
+
+	uid, err := w.userId(user)
+	switch err.(type) {
+	case nil:
+	case *UserNotFound:
+		return &NoSuchFileOrDirectory{File: filename}
+	default:
+		return err
+	}
 
-		wardReqs = append(wardReqs, wardReq)
+	wc, err := w.db.Get(uid)
+	switch err := err.(type) {
+	case nil:
+		break
+	case *UserNotFound:
+		return &NoSuchFileOrDirectory{File: filename}
+	case *ResourceUnavailable:
+		return fmt.Errorf("Wardrobe db is unavailable : %w", err)
+	default:
+		return fmt.Errorf("Unknown error : %w", err)
 	}
 
-	return wardReqs, nil
+	var ward *Wardrobe
+	for i := range wc.Wardrobes {
+		if wc.Wardrobes[i].Identifier == id {
+			ward = &wc.Wardrobes[i]
+		}
+	}
+
+	if ward == nil {
+		return &NoSuchFileOrDirectory{File: filename}
+	}
+
+	return w.serveImage(ward, filename, cb)
 }
 
-func (w *wardrobeService) GetFile(filename string, cb HandleFile) error {
+// serveImage hands cb an image of ward once it passed verification
+func (w *wardrobeService) serveImage(ward *Wardrobe, filename string, cb HandleImage) error {
+
+	ref := imageRef(ward, filename)
+	if ref == nil || filename == "" {
+		return &NoSuchFileOrDirectory{File: filename}
+	}
+
+	return w.verifyFile(filename, ref, func(path string, meta ImageMeta) error {
+		f, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("Error opening file %s : %w", path, err)
+		}
+		defer f.Close()
+
+		if cb == nil {
+			return nil
+		}
+		return cb(f, meta)
+	})
+}
+
+func wardrobeResponse(ward *Wardrobe) *GetWardrobeResponse {
+	return &GetWardrobeResponse{
+		Id:          ward.Identifier,
+		Description: ward.Description,
+		MainImage:   ward.MainFile,
+		LabelImage:  ward.LabelFile,
+		ImageState:  ward.ImageState,
+		LabelText:   ward.LabelText,
+		LabelJob:    labelJobResponse(&ward.Label),
+		Brand:       ward.Brand,
+		Tags:        ward.Tags,
+		Created:     optionalTime(ward.Created),
+		LastWorn:    optionalTime(ward.LastWorn),
+	}
+}
 
-	return w.imageDb.GetFileWithHandler(filename, cb)
+// normalizeTags splits comma separated tags, a form sends them either way
+func normalizeTags(values []string) []string {
+	tags := make([]string, 0, len(values))
+	for _, value := range values {
+		for _, tag := range strings.Split(value, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				tags = append(tags, tag)
+			}
+		}
+	}
+	return tags
+}
+
+func outfitResponse(ot *Outfit) *GetOutfitResponse {
+	return &GetOutfitResponse{
+		Id:           ot.Identifier,
+		TopId:        ot.TopId,
+		BottomId:     ot.BottomId,
+		Description:  ot.Description,
+		LikeCount:    ot.LikeCount,
+		DislikeCount: ot.DislikeCount,
+		Created:      optionalTime(ot.Created),
+		LastWorn:     optionalTime(ot.LastWorn),
+	}
+}
+
+// imageRef is what is recorded about filename on ward, nil if ward does not
+// reference it
+func imageRef(ward *Wardrobe, filename string) *ImageMeta {
+	switch filename {
+	case ward.MainFile:
+		return &ImageMeta{Name: filename, Size: ward.MainSize, Sum: ward.MainSum, ModTime: ward.Created}
+	case ward.LabelFile:
+		return &ImageMeta{Name: filename, Size: ward.LabelSize, Sum: ward.LabelSum, ModTime: ward.Created}
+	}
+	return nil
+}
+
+func (w *wardrobeService) verifyFile(filename string, ref *ImageMeta, cb func(path string, meta ImageMeta) error) error {
+
+	meta := ImageMeta{
+		Name: filename,
+	}
+	var sum string
+	if ref != nil {
+		meta, sum = *ref, ref.Sum
+	}
+
+	err := w.imageDb.GetFileWithHandler(filename, func(path string) error {
+		state, actual, err := checkImage(path, meta.Size, sum)
+		if err != nil {
+			return err
+		}
+		switch state {
+		case ImageOk:
+		case ImageMissing:
+			return &NoSuchFileOrDirectory{File: filename}
+		default:
+			glog.Errorf("image failed verification {file=%s}, {state=%s}", filename, state)
+			return &ChecksumMismatch{
+				File:  filename,
+				State: state,
+			}
+		}
+
+		meta.Sum = actual
+		meta.Pinned = sum != ""
+
+		return cb(path, meta)
+	})
+	if state, ok := damagedImageState(err); ok {
+		glog.Errorf("image failed verification {file=%s}, {state=%s}, {err=%v}", filename, state, err)
+		return &ChecksumMismatch{
+			File:  filename,
+			State: state,
+		}
+	}
+
+	return err
+}
+
+func (w *wardrobeService) GetUsage(user string) (*GetUsageResponse, error) {
+
+	usage := &GetUsageResponse{
+		MaxItems:      w.quota.MaxItems,
+		MaxImageBytes: w.quota.MaxImageBytes,
+	}
+
+	uid, err := w.userId(user)
+	switch err.(type) {
+	case nil:
+	case *UserNotFound:
+		// nothing stored yet
+		return usage, nil
+	default:
+		return nil, err
+	}
+
+	wc, err := w.db.Get(uid)
+	switch err := err.(type) {
+	case nil:
+		break
+	case *UserNotFound:
+		// nothing stored yet
+		return usage, nil
+	case *ResourceUnavailable:
+		return nil, fmt.Errorf("Wardrobe db is unavailable : %w", err)
+	default:
+		return nil, fmt.Errorf("Unknown error : %w", err)
+	}
+
+	usage.Items, usage.ImageBytes = closetUsage(wc)
+
+	return usage, nil
 }
 
 func (w *wardrobeService) AddOutfit(newOt NewOutfitRequest) error {
@@ -310,10 +741,15 @@ func (w *wardrobeService) AddOutfit(newOt NewOutfitRequest) error {
 
 	glog.Infof("adding outfit {user=%s}, {id=%s}", newOt.User, id)
 
+	uid, err := w.userId(newOt.User)
+	if err != nil {
+		return err
+	}
+
 	w.mu.Lock()
-	defer w.mu.Unlock()
+	defer w.unlock()
 
-	wc, err := w.db.Get(newOt.User)
+	wc, err := w.db.Get(uid)
 	switch err := err.(type) {
 	case nil:
 	case *UserNotFound:
@@ -332,15 +768,18 @@ func (w *wardrobeService) AddOutfit(newOt NewOutfitRequest) error {
 		Description:  newOt.Description,
 		LikeCount:    0,
 		DislikeCount: 0,
+		Created:      time.Now().UTC(),
 	})
 
-	err = w.db.Update(newOt.User, wc)
+	err = w.db.Update(uid, wc)
 	switch err := err.(type) {
 	case nil:
 	default:
 		return fmt.Errorf("Database access failure : %w", err)
 	}
 
+	w.publish(uid, EventOutfitCreated, outfitResponse(findOutfit(wc, id)))
+
 	glog.Infof("done adding outfit {user=%s}, {id=%s}", newOt.User, id)
 
 	return nil
@@ -348,12 +787,17 @@ func (w *wardrobeService) AddOutfit(newOt NewOutfitRequest) error {
 
 func (w *wardrobeService) DeleteOutfit(user string, id string) error {
 
+	uid, err := w.userId(user)
+	if err != nil {
+		return err
+	}
+
 	glog.Infof("deleting outfit {user=%s}, {id=%s}", user, id)
 
 	w.mu.Lock()
-	defer w.mu.Unlock()
+	defer w.unlock()
 
-	wc, err := w.db.Get(user)
+	wc, err := w.db.Get(uid)
 	switch err := err.(type) {
 	case nil:
 		break
@@ -365,9 +809,11 @@ func (w *wardrobeService) DeleteOutfit(user string, id string) error {
 		return fmt.Errorf("Unknown error : %w", err)
 	}
 
-	if len(wc.Outfits) == 0 {
-		return fmt.Errorf("Empty outfits")
+	ot := findOutfit(wc, id)
+	if ot == nil {
+		return &OutfitNotFound{User: user, Id: id}
 	}
+	deleted := outfitResponse(ot)
 
 	tmp := wc.Outfits[:0]
 	for _, ot := range wc.Outfits {
@@ -377,13 +823,15 @@ func (w *wardrobeService) DeleteOutfit(user string, id string) error {
 	}
 	wc.Outfits = tmp
 
-	err = w.db.Update(user, wc)
+	err = w.db.Update(uid, wc)
 	switch err := err.(type) {
 	case nil:
 	default:
 		return fmt.Errorf("Database access failure : %w", err)
 	}
 
+	w.publish(uid, EventOutfitDeleted, deleted)
+
 	glog.Infof("done deleting outfit {user=%s}, {id=%s}", user, id)
 
 	return nil
@@ -391,7 +839,12 @@ func (w *wardrobeService) DeleteOutfit(user string, id string) error {
 
 func (w *wardrobeService) GetOutfit(user string, id string) (*GetOutfitResponse, error) {
 
-	wc, err := w.db.Get(user)
+	uid, err := w.userId(user)
+	if err != nil {
+		return nil, err
+	}
+
+	wc, err := w.db.Get(uid)
 	switch err := err.(type) {
 	case nil:
 		break
@@ -403,31 +856,55 @@ func (w *wardrobeService) GetOutfit(user string, id string) (*GetOutfitResponse,
 		return nil, fmt.Errorf("Unknown error : %w", err)
 	}
 
-	if len(wc.Outfits) == 0 {
-		return nil, fmt.Errorf("Empty closet")
+	for i := range wc.Outfits {
+		if wc.Outfits[i].Identifier == id {
+			return outfitResponse(&wc.Outfits[i]), nil
+		}
 	}
 
-	for _, ot := range wc.Outfits {
-		if ot.Identifier == id {
-			otReq := &GetOutfitResponse{
-				Id:           ot.Identifier,
-				TopId:        ot.TopId,
-				BottomId:     ot.BottomId,
-				Description:  ot.Description,
-				LikeCount:    ot.LikeCount,
-				DislikeCount: ot.DislikeCount,
-			}
+	return nil, &OutfitNotFound{User: user, Id: id}
+}
+
+// GetOutfits gets the outfits ids of user with a single read of the closet.
+// The outfits are in the order of ids, nil where there is no such outfit.
+func (w *wardrobeService) GetOutfits(user string, ids []string) ([]*GetOutfitResponse, error) {
+
+	uid, err := w.userId(user)
+	if err != nil {
+		return nil, err
+	}
 
-			return otReq, nil
+	wc, err := w.db.Get(uid)
+	switch err := err.(type) {
+	case nil:
+		break
+	case *UserNotFound:
+		return nil, fmt.Errorf("User not found %s : %w", user, err)
+	case *ResourceUnavailable:
+		return nil, fmt.Errorf("Wardrobe db is unavailable : %w", err)
+	default:
+		return nil, fmt.Errorf("Unknown error : %w", err)
+	}
+
+	outfits := make([]*GetOutfitResponse, len(ids))
+	for i, id := range ids {
+		if ot := findOutfit(wc, id); ot != nil {
+			outfits[i] = outfitResponse(ot)
 		}
 	}
 
-	return nil, UserNotFound{User: user}
+	return outfits, nil
 }
 
-func (w *wardrobeService) GetAllOutfits(user string) ([]*GetOutfitResponse, error) {
+// GetAllOutfits lists a page of the outfits of user
+func (w *wardrobeService) GetAllOutfits(user string, opts ListOptions) (*GetOutfitPage, error) {
 
-	wc, err := w.db.Get(user)
+	uid, err := w.userId(user)
+	if err != nil {
+		return nil, err
+	}
+
+	wc, err := w.db.Get(uid)
 	switch err := err.(type) {
 	case nil:
 		break
@@ -439,34 +916,78 @@ func (w *wardrobeService) GetAllOutfits(user string) ([]*GetOutfitResponse, erro
 		return nil, fmt.Errorf("Unknown error : %w", err)
 	}
 
-	if len(wc.Outfits) == 0 {
-		return nil, fmt.Errorf("No outfits")
+	page, next, err := listOutfits(wc, opts)
+	if err != nil {
+		return nil, err
 	}
 
-	otReqs := make([]*GetOutfitResponse, 0)
-	for _, ot := range wc.Outfits {
-		otReq := &GetOutfitResponse{
-			Id:           ot.Identifier,
-			TopId:        ot.TopId,
-			BottomId:     ot.BottomId,
-			Description:  ot.Description,
-			LikeCount:    ot.LikeCount,
-			DislikeCount: ot.DislikeCount,
-		}
+	otPage := &GetOutfitPage{
+		Outfits: make([]*GetOutfitResponse, 0, len(page)),
+		Next:    next,
+	}
+	for _, ot := range page {
+		otPage.Outfits = append(otPage.Outfits, outfitResponse(ot))
+	}
+
+	return otPage, nil
+}
 
-		otReqs = append(otReqs, otReq)
+// ReactOutfit counts a like or dislike of an outfit
+func (w *wardrobeService) ReactOutfit(user string, id string, reaction Reaction) (*GetOutfitResponse, error) {
+
+	if reaction != ReactionLike && reaction != ReactionDislike {
+		return nil, &InvalidRequest{Field: "reaction", Reason: "like or dislike"}
 	}
 
-	return otReqs, nil
+	uid, err := w.userId(user)
+	if err != nil {
+		return nil, err
+	}
+
+	w.mu.Lock()
+	defer w.unlock()
+
+	wc, err := w.db.Get(uid)
+	switch err := err.(type) {
+	case nil:
+	case *UserNotFound:
+		return nil, fmt.Errorf("User not found %s : %w", user, err)
+	case *ResourceUnavailable:
+		return nil, fmt.Errorf("Wardrobe db is unavailable : %w", err)
+	default:
+		return nil, fmt.Errorf("Unknown error : %w", err)
+	}
+
+	ot := findOutfit(wc, id)
+	if ot == nil {
+		return nil, &OutfitNotFound{User: user, Id: id}
+	}
+	if reaction == ReactionLike {
+		ot.LikeCount++
+	} else {
+		ot.DislikeCount++
+	}
+
+	err = w.db.Update(uid, wc)
+	switch err := err.(type) {
+	case nil:
+	default:
+		return nil, fmt.Errorf("Database access failure : %w", err)
+	}
+
+	resp := outfitResponse(ot)
+	w.publish(uid, EventOutfitReacted, &OutfitReaction{Outfit: resp, Reaction: reaction})
+
+	return resp, nil
 }
 
 //private functions
-func (w *wardrobeService) updateWardrobeLabelText(user, id, text string) error {
+func (w *wardrobeService) updateWardrobeLabelText(user, id, text, failure string) error {
 
-	glog.Infof("Received text {user=%s}, {id=%s}, {text=%s}", user, id, text)
+	glog.Infof("Received text {user=%s}, {id=%s}, {text=%s}, {error=%s}", user, id, text, failure)
 
 	w.mu.Lock()
-	defer w.mu.Unlock()
+	defer w.unlock()
 
 	wc, err := w.db.Get(user)
 	switch err := err.(type) {
@@ -476,39 +997,100 @@ func (w *wardrobeService) updateWardrobeLabelText(user, id, text string) error {
 		glog.Errorf("User not found {user=%s}, {err=%v}", user, err)
 		return fmt.Errorf("User not found %s : %w", user, err)
 	case *ResourceUnavailable:
-		glog.Errorf("Wardrobe db is unavailable : %w", err)
+		glog.Errorf("Wardrobe db is unavailable : {err=%v}", err)
 		return fmt.Errorf("Wardrobe db is unavailable : %w", err)
 	default:
-		glog.Errorf("Unknown error : %w", err)
+		glog.Errorf("Unknown error : {err=%v}", err)
 		return fmt.Errorf("Unknown error : %w", err)
 	}
 
-	if len(wc.Wardrobes) == 0 {
-		glog.Errorf("Empty closet")
-		return fmt.Errorf("Empty closet")
+	if findWardrobe(wc, id) == nil {
+		glog.Errorf("No item {user=%s}, {id=%s}", user, id)
+		return &ItemNotFound{User: user, Id: id}
 	}
 
-	tmp := wc.Wardrobes[:0]
-	for _, ward := range wc.Wardrobes {
-		if ward.Identifier == id {
-			ward.LabelText = text
-		}
-
-		tmp = append(tmp, ward)
+	// a late answer still counts, even for a job given up on
+	ward := findWardrobe(wc, id)
+	ward.Label.Finished = time.Now().UTC()
+	if failure != "" {
+		ward.Label.State = LabelFailed
+		ward.Label.Error = failure
+	} else {
+		ward.LabelText = text
+		ward.Label.State = LabelCompleted
+		ward.Label.Error = ""
 	}
-	wc.Wardrobes = tmp
 
 	err = w.db.Update(user, wc)
 	switch err := err.(type) {
 	case nil:
 	default:
-		glog.Errorf("Database access failure : %w", err)
+		glog.Errorf("Database access failure : {err=%v}", err)
 		return fmt.Errorf("Database access failure : %w", err)
 	}
 
+	if failure != "" {
+		w.publish(user, EventLabelFailed, wardrobeResponse(ward))
+	} else {
+		w.publish(user, EventLabelText, wardrobeResponse(ward))
+	}
+
+	return nil
+}
+
+func (w *wardrobeService) userImages(user string) ImageRepository {
+	if ur, ok := w.imageDb.(UserImageRepository); ok {
+		return ur.ForUser(user)
+	}
+	return w.imageDb
+}
+
+// checkQuota fails when adding one more item of newBytes would take the
+// closet over its limits
+func (w *wardrobeService) checkQuota(wc *WardrobeCloset, newBytes int64) error {
+
+	items, imageBytes := closetUsage(wc)
+
+	if w.quota.MaxItems > 0 && items+1 > w.quota.MaxItems {
+		return &QuotaExceeded{
+			User:     wc.User,
+			Resource: "items",
+			Limit:    int64(w.quota.MaxItems),
+			Used:     int64(items),
+		}
+	}
+
+	if w.quota.MaxImageBytes > 0 && imageBytes+newBytes > w.quota.MaxImageBytes {
+		return &QuotaExceeded{
+			User:     wc.User,
+			Resource: "image-bytes",
+			Limit:    w.quota.MaxImageBytes,
+			Used:     imageBytes,
+		}
+	}
+
 	return nil
 }
 
+func closetUsage(wc *WardrobeCloset) (int, int64) {
+	var imageBytes int64
+	for _, ward := range wc.Wardrobes {
+		imageBytes += ward.MainSize + ward.LabelSize
+	}
+	return len(wc.Wardrobes), imageBytes
+}
+
+// removeFiles compensates for a failed write to imageDb, whatever cannot be
+// removed is left for the image gc
+func (w *wardrobeService) removeFiles(imageDb ImageRepository, files ...string) {
+	for _, file := range files {
+		err := imageDb.DeleteFile(file)
+		if err != nil {
+			glog.Warningf("Error rolling back image file {file=%s} : {err=%v}", file, err)
+		}
+	}
+}
+
 //label to text service
 type wardrobeLabelToText struct {
 	conn      redis.Conn
@@ -585,13 +1167,13 @@ func (s *wardrobeLabelToText) onMessageReceive(channel string, data []byte) erro
 	var resp LabelToTextResponse
 	err1 := json.Unmarshal(data, &resp)
 	if err1 != nil {
-		glog.Error("error unmarshaling received label to text json response {err=%v}", err1)
+		glog.Errorf("error unmarshaling received label to text json response {err=%v}", err1)
 		return err1
 	}
 
-	err2 := s.s.updateWardrobeLabelText(resp.User, resp.Id, resp.Text)
+	err2 := s.s.updateWardrobeLabelText(resp.User, resp.Id, resp.Text, resp.Error)
 	if err2 != nil {
-		glog.Error("error updating wardrobe label text  {err=%v}", err2)
+		glog.Errorf("error updating wardrobe label text  {err=%v}", err2)
 		return err2
 	}
 
@@ -608,7 +1190,7 @@ func (s *wardrobeLabelToText) sendLabel(user, id, image string) error {
 
 	jsonReq, err3 := json.Marshal(req)
 	if err3 != nil {
-		glog.Error("error marshaling text json output {err=%v}", err3)
+		glog.Errorf("error marshaling text json output {err=%v}", err3)
 		return err3
 	}
 
@@ -636,6 +1218,53 @@ func (e DuplicateFile) Error() string {
 	return fmt.Sprintf("Duplicate file name %s", e.File)
 }
 
+func (e ChecksumMismatch) Error() string {
+	return fmt.Sprintf("File %s failed verification, %s", e.File, e.State)
+}
+
+func (e DuplicateUser) Error() string {
+	return fmt.Sprintf("User %s already exists", e.User)
+}
+
+func (e ShareNotFound) Error() string {
+	return fmt.Sprintf("Closet of %s is not shared with %s", e.Owner, e.User)
+}
+
+func (e LinkNotFound) Error() string {
+	if e.Link == "" {
+		return "Link not found"
+	}
+	return fmt.Sprintf("Link %s not found", e.Link)
+}
+
+func (e WebhookNotFound) Error() string {
+	return fmt.Sprintf("Webhook %s not found", e.Webhook)
+}
+
+func (e DeliveryNotFound) Error() string {
+	return fmt.Sprintf("Delivery %s not found", e.Delivery)
+}
+
+func (e Forbidden) Error() string {
+	return fmt.Sprintf("User %s needs %s access to %s", e.User, e.Role, e.Owner)
+}
+
+func (e ItemNotFound) Error() string {
+	return fmt.Sprintf("User %s has no item %s", e.User, e.Id)
+}
+
+func (e OutfitNotFound) Error() string {
+	return fmt.Sprintf("User %s has no outfit %s", e.User, e.Id)
+}
+
+func (e InvalidRequest) Error() string {
+	return fmt.Sprintf("Invalid %s, %s", e.Field, e.Reason)
+}
+
+func (e QuotaExceeded) Error() string {
+	return fmt.Sprintf("User %s quota exceeded for %s, %d used of %d", e.User, e.Resource, e.Used, e.Limit)
+}
+
 /*
 func (e DuplicateFile) Is(target error) bool {
 	switch target.(type) {
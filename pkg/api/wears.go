@@ -0,0 +1,154 @@
+//
+// wears.go
+//
+
+package api
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/google/uuid"
+)
+
+// LogWear records that an outfit or items were worn and moves their last
+// worn time forward. The items of the outfit are logged with it.
+func (w *wardrobeService) LogWear(newWear NewWearRequest) (*GetWearResponse, error) {
+
+	if newWear.Outfit == "" && len(newWear.Items) == 0 {
+		return nil, &InvalidRequest{Field: "body", Reason: "an outfit or items are required"}
+	}
+
+	worn := time.Now().UTC()
+	if newWear.Worn != nil {
+		worn = newWear.Worn.UTC()
+	}
+
+	uid, err := w.userId(newWear.User)
+	if err != nil {
+		return nil, err
+	}
+
+	w.mu.Lock()
+	defer w.unlock()
+
+	wc, err := w.db.Get(uid)
+	switch err := err.(type) {
+	case nil:
+	case *UserNotFound:
+		return nil, fmt.Errorf("User not found  : %w", err)
+	case *ResourceUnavailable:
+		return nil, fmt.Errorf("Wardrobe db is unavailable : %w", err)
+	default:
+		return nil, fmt.Errorf("Unknown error : %w", err)
+	}
+
+	wear := Wear{
+		Identifier: uuid.New().String(),
+		Outfit:     newWear.Outfit,
+		Worn:       worn,
+		Created:    time.Now().UTC(),
+	}
+
+	items := newWear.Items
+	var ot *Outfit
+	if newWear.Outfit != "" {
+		ot = findOutfit(wc, newWear.Outfit)
+		if ot == nil {
+			return nil, &OutfitNotFound{User: newWear.User, Id: newWear.Outfit}
+		}
+		items = append([]string{ot.TopId, ot.BottomId}, items...)
+	}
+
+	//every item is checked before any is changed
+	var wards []*Wardrobe
+	seen := make(map[string]bool)
+	for _, id := range items {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		ward := findWardrobe(wc, id)
+		if ward == nil {
+			return nil, &ItemNotFound{User: newWear.User, Id: id}
+		}
+		wards = append(wards, ward)
+		wear.Items = append(wear.Items, id)
+	}
+
+	if ot != nil && ot.LastWorn.Before(wear.Worn) {
+		ot.LastWorn = wear.Worn
+	}
+	for _, ward := range wards {
+		if ward.LastWorn.Before(wear.Worn) {
+			ward.LastWorn = wear.Worn
+		}
+	}
+
+	wc.Wears = append(wc.Wears, wear)
+
+	err = w.db.Update(uid, wc)
+	switch err := err.(type) {
+	case nil:
+	default:
+		return nil, fmt.Errorf("Database access failure : %w", err)
+	}
+
+	resp := wearResponse(&wear)
+	w.publish(uid, EventWearLogged, resp)
+
+	glog.Infof("logged wear {user=%s}, {id=%s}, {outfit=%s}, {items=%d}", newWear.User, wear.Identifier, wear.Outfit, len(wear.Items))
+
+	return resp, nil
+}
+
+// GetWears lists the wear log of user, last worn first. A limit of 0 lists
+// all of it.
+func (w *wardrobeService) GetWears(user string, limit int) ([]*GetWearResponse, error) {
+
+	uid, err := w.userId(user)
+	if err != nil {
+		return nil, err
+	}
+
+	wc, err := w.db.Get(uid)
+	switch err := err.(type) {
+	case nil:
+		break
+	case *UserNotFound:
+		return nil, fmt.Errorf("User not found %s : %w", user, err)
+	case *ResourceUnavailable:
+		return nil, fmt.Errorf("Wardrobe db is unavailable : %w", err)
+	default:
+		return nil, fmt.Errorf("Unknown error : %w", err)
+	}
+
+	wears := make([]*GetWearResponse, 0, len(wc.Wears))
+	for i := range wc.Wears {
+		wears = append(wears, wearResponse(&wc.Wears[i]))
+	}
+	sort.SliceStable(wears, func(i, j int) bool {
+		return wears[i].Worn.After(wears[j].Worn)
+	})
+
+	if limit > 0 && len(wears) > limit {
+		wears = wears[:limit]
+	}
+	return wears, nil
+}
+
+func wearResponse(wear *Wear) *GetWearResponse {
+	items := wear.Items
+	if items == nil {
+		items = []string{}
+	}
+	return &GetWearResponse{
+		Id:     wear.Identifier,
+		Outfit: wear.Outfit,
+		Items:  items,
+		Worn:   wear.Worn,
+	}
+}
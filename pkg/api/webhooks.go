@@ -0,0 +1,625 @@
+//
+// webhooks.go
+//
+
+package api
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/google/uuid"
+)
+
+const webhookSecretBytes = 32
+
+// nonPublicNets are the addresses webhooks may not be delivered to, anyone
+// who can add a webhook could otherwise make the server post into the
+// network it runs in
+var nonPublicNets = parseCIDRs(
+	"0.0.0.0/8", "10.0.0.0/8", "100.64.0.0/10", "127.0.0.0/8", "169.254.0.0/16",
+	"172.16.0.0/12", "192.0.0.0/24", "192.168.0.0/16", "198.18.0.0/15", "224.0.0.0/3",
+	"::/128", "::1/128", "fc00::/7", "fe80::/10", "ff00::/8",
+)
+
+// CreateWebhook subscribes a url to events in the closet of user. The
+// secret deliveries are signed with is only ever returned here.
+func (w *wardrobeService) CreateWebhook(user string, newHook NewWebhookRequest) (*GetWebhookResponse, error) {
+
+	glog.Infof("creating webhook {user=%s}, {url=%s}, {events=%v}", user, newHook.URL, newHook.Events)
+
+	u, err := url.Parse(newHook.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, &InvalidRequest{Field: "url", Reason: "not an http or https url"}
+	}
+
+	types := newHook.Events
+	if len(types) == 0 {
+		types = EventTypes
+	}
+	for _, typ := range types {
+		if !knownEventType(typ) {
+			return nil, &InvalidRequest{Field: "events", Reason: fmt.Sprintf("no event %s", typ)}
+		}
+	}
+
+	oid, err := w.userId(user)
+	if err != nil {
+		return nil, err
+	}
+
+	raw := make([]byte, webhookSecretBytes)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, fmt.Errorf("Error generating webhook secret : %w", err)
+	}
+
+	hook := &Webhook{
+		Identifier: uuid.New().String(),
+		Owner:      oid,
+		URL:        newHook.URL,
+		Secret:     base64.RawURLEncoding.EncodeToString(raw),
+		Types:      append([]EventType{}, types...),
+		Created:    time.Now().UTC(),
+	}
+
+	err = w.hookDb.Add(hook)
+	if err != nil {
+		return nil, fmt.Errorf("Database access failure : %w", err)
+	}
+
+	resp := webhookResponse(hook)
+	resp.Secret = hook.Secret
+
+	return resp, nil
+}
+
+func (w *wardrobeService) GetWebhooks(user string) ([]*GetWebhookResponse, error) {
+
+	oid, err := w.userId(user)
+	if err != nil {
+		return nil, err
+	}
+
+	hooks, err := w.hookDb.ListByOwner(oid)
+	if err != nil {
+		return nil, fmt.Errorf("Database access failure : %w", err)
+	}
+
+	resps := make([]*GetWebhookResponse, 0, len(hooks))
+	for _, hook := range hooks {
+		resps = append(resps, webhookResponse(hook))
+	}
+
+	return resps, nil
+}
+
+// DeleteWebhook removes the webhook along with its delivery log
+func (w *wardrobeService) DeleteWebhook(user string, id string) error {
+
+	glog.Infof("deleting webhook {user=%s}, {webhook=%s}", user, id)
+
+	hook, err := w.webhook(user, id)
+	if err != nil {
+		return err
+	}
+
+	err = w.hookDb.Delete(hook.Identifier)
+	if err != nil {
+		return fmt.Errorf("Database access failure : %w", err)
+	}
+
+	err = w.hookDb.DeleteDeliveries(hook.Identifier)
+	if err != nil {
+		return fmt.Errorf("Database access failure : %w", err)
+	}
+
+	return nil
+}
+
+// GetDeliveries lists the delivery log of a webhook, newest first. A limit
+// of 0 lists all of it.
+func (w *wardrobeService) GetDeliveries(user string, id string, limit int) ([]*GetDeliveryResponse, error) {
+
+	hook, err := w.webhook(user, id)
+	if err != nil {
+		return nil, err
+	}
+
+	deliveries, err := w.hookDb.ListDeliveries(hook.Identifier, limit)
+	if err != nil {
+		return nil, fmt.Errorf("Database access failure : %w", err)
+	}
+
+	resps := make([]*GetDeliveryResponse, 0, len(deliveries))
+	for _, delivery := range deliveries {
+		resps = append(resps, deliveryResponse(delivery))
+	}
+
+	return resps, nil
+}
+
+// Redeliver sends the event of a logged delivery again, as a new delivery
+// with attempts of its own
+func (w *wardrobeService) Redeliver(user string, id string, deliveryId string) (*GetDeliveryResponse, error) {
+
+	glog.Infof("redelivering {user=%s}, {webhook=%s}, {delivery=%s}", user, id, deliveryId)
+
+	hook, err := w.webhook(user, id)
+	if err != nil {
+		return nil, err
+	}
+
+	old, err := w.hookDb.GetDelivery(deliveryId)
+	switch err := err.(type) {
+	case nil:
+	case *DeliveryNotFound:
+		return nil, err
+	case *ResourceUnavailable:
+		return nil, fmt.Errorf("Webhook db is unavailable : %w", err)
+	default:
+		return nil, fmt.Errorf("Unknown error : %w", err)
+	}
+
+	if old.Webhook != hook.Identifier {
+		return nil, &DeliveryNotFound{Delivery: deliveryId}
+	}
+
+	now := time.Now().UTC()
+	delivery := &Delivery{
+		Identifier: uuid.New().String(),
+		Webhook:    hook.Identifier,
+		Owner:      hook.Owner,
+		Event:      old.Event,
+		Type:       old.Type,
+		Payload:    old.Payload,
+		State:      DeliveryPending,
+		Next:       now,
+		Created:    now,
+		Updated:    now,
+	}
+
+	err = w.hookDb.AddDelivery(delivery)
+	if err != nil {
+		return nil, fmt.Errorf("Database access failure : %w", err)
+	}
+
+	return deliveryResponse(delivery), nil
+}
+
+// webhook looks up webhook id of user, webhooks of other users do not
+// exist as far as user is concerned
+func (w *wardrobeService) webhook(user string, id string) (*Webhook, error) {
+
+	oid, err := w.userId(user)
+	if err != nil {
+		return nil, err
+	}
+
+	hook, err := w.hookDb.Get(id)
+	switch err := err.(type) {
+	case nil:
+	case *WebhookNotFound:
+		return nil, err
+	case *ResourceUnavailable:
+		return nil, fmt.Errorf("Webhook db is unavailable : %w", err)
+	default:
+		return nil, fmt.Errorf("Unknown error : %w", err)
+	}
+
+	if hook.Owner != oid {
+		return nil, &WebhookNotFound{Webhook: id}
+	}
+
+	return hook, nil
+}
+
+// removeWebhooks removes the webhooks of a deleted user
+func (w *wardrobeService) removeWebhooks(uid string) error {
+
+	hooks, err := w.hookDb.ListByOwner(uid)
+	if err != nil {
+		return fmt.Errorf("Database access failure : %w", err)
+	}
+
+	for _, hook := range hooks {
+		if err := w.hookDb.Delete(hook.Identifier); err != nil {
+			return fmt.Errorf("Database access failure : %w", err)
+		}
+		if err := w.hookDb.DeleteDeliveries(hook.Identifier); err != nil {
+			return fmt.Errorf("Database access failure : %w", err)
+		}
+	}
+
+	return nil
+}
+
+// queuedEvent is an event published while w.mu was held
+type queuedEvent struct {
+	owner string
+	event *Event
+}
+
+// publish queues event typ in the closet of owner, it is called with w.mu
+// held. Looking up whom to send it to takes storage round trips, so it is
+// left to sendEvents once the lock is released.
+func (w *wardrobeService) publish(owner string, typ EventType, data interface{}) {
+
+	w.omu.Lock()
+	defer w.omu.Unlock()
+
+	w.outbox = append(w.outbox, &queuedEvent{
+		owner: owner,
+		event: &Event{
+			Id:      uuid.New().String(),
+			Type:    typ,
+			Data:    data,
+			Created: time.Now().UTC(),
+		},
+	})
+}
+
+// unlock releases w.mu and sends the events published while it was held
+func (w *wardrobeService) unlock() {
+	w.mu.Unlock()
+	w.sendEvents()
+}
+
+// sendEvents sends the queued events in the order they were published. One
+// caller sends at a time, the others leave their events to it and return.
+func (w *wardrobeService) sendEvents() {
+
+	w.omu.Lock()
+	if w.sending {
+		w.omu.Unlock()
+		return
+	}
+	w.sending = true
+
+	for len(w.outbox) > 0 {
+		queued := w.outbox
+		w.outbox = nil
+		w.omu.Unlock()
+
+		for _, q := range queued {
+			w.sendEvent(q.owner, q.event)
+		}
+
+		w.omu.Lock()
+	}
+
+	w.sending = false
+	w.omu.Unlock()
+}
+
+// sendEvent sends event to the streams watching the closet of owner and
+// queues a delivery to every webhook of owner that subscribed to it. What
+// the event reports has happened already, so a failure is only logged.
+func (w *wardrobeService) sendEvent(owner string, event *Event) {
+
+	typ, now := event.Type, event.Created
+	event.User = w.username(owner)
+
+	w.events.publish(owner, event)
+
+	hooks, err := w.hookDb.ListByOwner(owner)
+	if err != nil {
+		glog.Errorf("Error listing webhooks {owner=%s}, {event=%s} : {err=%v}", owner, typ, err)
+		return
+	}
+
+	subscribed := make([]*Webhook, 0, len(hooks))
+	for _, hook := range hooks {
+		for _, t := range hook.Types {
+			if t == typ {
+				subscribed = append(subscribed, hook)
+				break
+			}
+		}
+	}
+	if len(subscribed) == 0 {
+		return
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		glog.Errorf("Error encoding event {owner=%s}, {event=%s} : {err=%v}", owner, typ, err)
+		return
+	}
+
+	for _, hook := range subscribed {
+		err := w.hookDb.AddDelivery(&Delivery{
+			Identifier: uuid.New().String(),
+			Webhook:    hook.Identifier,
+			Owner:      owner,
+			Event:      event.Id,
+			Type:       typ,
+			Payload:    payload,
+			State:      DeliveryPending,
+			Next:       now,
+			Created:    now,
+			Updated:    now,
+		})
+		if err != nil {
+			glog.Errorf("Error queueing delivery {webhook=%s}, {event=%s} : {err=%v}", hook.Identifier, event.Id, err)
+		}
+	}
+}
+
+func knownEventType(typ EventType) bool {
+	for _, t := range EventTypes {
+		if t == typ {
+			return true
+		}
+	}
+	return false
+}
+
+func webhookResponse(hook *Webhook) *GetWebhookResponse {
+	return &GetWebhookResponse{
+		Id:      hook.Identifier,
+		URL:     hook.URL,
+		Events:  hook.Types,
+		Created: hook.Created,
+	}
+}
+
+func deliveryResponse(delivery *Delivery) *GetDeliveryResponse {
+	resp := &GetDeliveryResponse{
+		Id:       delivery.Identifier,
+		Event:    delivery.Event,
+		Type:     delivery.Type,
+		State:    delivery.State,
+		Attempts: delivery.Attempts,
+		Status:   delivery.Status,
+		Error:    delivery.Error,
+		Created:  delivery.Created,
+	}
+	if delivery.State == DeliveryPending {
+		resp.Next = optionalTime(delivery.Next)
+	}
+	return resp
+}
+
+// WebhookSignature is the X-Wardrobe-Signature header of body sent at t,
+// the hex HMAC-SHA256 of "<unix seconds>.<body>" keyed with the secret of
+// the webhook. Receivers compute it the same way to check a delivery.
+func WebhookSignature(secret string, t time.Time, body []byte) string {
+	ts := strconv.FormatInt(t.Unix(), 10)
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	io.WriteString(mac, ts+".")
+	mac.Write(body)
+
+	return "t=" + ts + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+const (
+	dispatchBatch   = 100
+	dispatchWorkers = 8
+	maxRetryDelay   = time.Hour
+
+	// dispatchLease is how long a claimed delivery is left to the server
+	// that claimed it, at least twice the delivery timeout
+	dispatchLease = 5 * time.Minute
+)
+
+// WebhookDispatcher sends the deliveries that are due. A failed attempt is
+// retried after backoff, doubling with every attempt up to an hour, until
+// maxAttempts have failed.
+type WebhookDispatcher struct {
+	hookDb      WebhookRepository
+	client      *http.Client
+	backoff     time.Duration
+	maxAttempts int
+}
+
+func NewWebhookDispatcher(hookDbIn WebhookRepository, client *http.Client, backoff time.Duration, maxAttempts int) *WebhookDispatcher {
+	return &WebhookDispatcher{
+		hookDb:      hookDbIn,
+		client:      client,
+		backoff:     backoff,
+		maxAttempts: maxAttempts,
+	}
+}
+
+// Dispatch runs a single pass over the deliveries due, a few at a time.
+// Deliveries are claimed first, so servers dispatching next to each other
+// never send the same one.
+func (d *WebhookDispatcher) Dispatch() error {
+
+	lease := dispatchLease
+	if 2*d.client.Timeout > lease {
+		lease = 2 * d.client.Timeout
+	}
+
+	due, err := d.hookDb.ClaimDue(time.Now().UTC(), lease, dispatchBatch)
+	if err != nil {
+		return fmt.Errorf("Error claiming due deliveries : %w", err)
+	}
+
+	var wg sync.WaitGroup
+	workers := make(chan struct{}, dispatchWorkers)
+	for _, delivery := range due {
+		delivery := delivery
+		wg.Add(1)
+		workers <- struct{}{}
+		go func() {
+			defer wg.Done()
+			d.deliver(delivery)
+			<-workers
+		}()
+	}
+	wg.Wait()
+
+	return nil
+}
+
+func (d *WebhookDispatcher) Run(interval time.Duration, stop <-chan struct{}) {
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := d.Dispatch(); err != nil {
+				glog.Errorf("webhook dispatch failed {err=%v}", err)
+			}
+		}
+	}
+}
+
+func (d *WebhookDispatcher) deliver(delivery *Delivery) {
+
+	retry := true
+
+	hook, err := d.hookDb.Get(delivery.Webhook)
+	switch err.(type) {
+	case nil:
+		delivery.Attempts++
+		delivery.Status, err = d.post(hook, delivery)
+		retry = delivery.Attempts < d.maxAttempts
+	case *WebhookNotFound:
+		// deleted while the delivery was pending
+		retry = false
+	default:
+		glog.Errorf("Error getting webhook {webhook=%s} : {err=%v}", delivery.Webhook, err)
+		return
+	}
+
+	delivery.Updated = time.Now().UTC()
+
+	switch {
+	case err == nil:
+		delivery.State = DeliveryDelivered
+		delivery.Error = ""
+	case retry:
+		delivery.Error = err.Error()
+		delivery.Next = delivery.Updated.Add(d.retryDelay(delivery.Attempts))
+	default:
+		delivery.State = DeliveryFailed
+		delivery.Error = err.Error()
+	}
+
+	glog.Infof("webhook delivery {webhook=%s}, {delivery=%s}, {attempt=%d}, {state=%s}, {status=%d}",
+		delivery.Webhook, delivery.Identifier, delivery.Attempts, delivery.State, delivery.Status)
+
+	if err := d.hookDb.UpdateDelivery(delivery); err != nil {
+		glog.Errorf("Error updating delivery {delivery=%s} : {err=%v}", delivery.Identifier, err)
+	}
+}
+
+// post sends the delivery, any answer but a 2xx is a failure
+func (d *WebhookDispatcher) post(hook *Webhook, delivery *Delivery) (int, error) {
+
+	req, err := http.NewRequest(http.MethodPost, hook.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "WardrobeManager-Webhook/"+Version)
+	req.Header.Set("X-Wardrobe-Event", string(delivery.Type))
+	req.Header.Set("X-Wardrobe-Delivery", delivery.Identifier)
+	req.Header.Set("X-Wardrobe-Signature", WebhookSignature(hook.Secret, time.Now(), delivery.Payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("receiver answered %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// NewWebhookClient returns the client to send deliveries with. Redirects are
+// not followed and, unless allowPrivate is set, connections to loopback,
+// private, link-local and other non-public addresses are refused. The
+// check is made on the address dialed, after the name is resolved.
+func NewWebhookClient(timeout time.Duration, allowPrivate bool) *http.Client {
+
+	dialer := &net.Dialer{Timeout: timeout}
+	if !allowPrivate {
+		dialer.Control = refuseNonPublic
+	}
+
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: timeout,
+			MaxIdleConnsPerHost: dispatchWorkers,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+func refuseNonPublic(network, address string, c syscall.RawConn) error {
+
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return fmt.Errorf("webhook address %s is not an ip", host)
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+
+	for _, n := range nonPublicNets {
+		if n.Contains(ip) {
+			return fmt.Errorf("webhook address %s is not public", ip)
+		}
+	}
+
+	return nil
+}
+
+func parseCIDRs(cidrs ...string) []*net.IPNet {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		nets = append(nets, n)
+	}
+	return nets
+}
+
+func (d *WebhookDispatcher) retryDelay(attempts int) time.Duration {
+	delay := d.backoff
+	for i := 1; i < attempts && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+	return delay
+}
@@ -0,0 +1,970 @@
+//
+// app_test.go
+//
+
+package app_test
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"WardrobeManagerMS/pkg/api"
+	"WardrobeManagerMS/pkg/app"
+	"WardrobeManagerMS/pkg/rpc"
+)
+
+// stubService holds a single item of user foobar with a single image,
+// every other call panics on the nil embedded interface
+type stubService struct {
+	api.WardrobeService
+	image []byte
+	added map[string][]byte
+}
+
+// AddWardrobe keeps the description and image contents of the upload
+func (s *stubService) AddWardrobe(new api.NewWardrobeRequest) error {
+	s.added = map[string][]byte{"description": []byte(new.Description)}
+	for field, header := range map[string]*multipart.FileHeader{"main": new.MainImageMime, "label": new.LabelImageMime} {
+		f, err := header.Open()
+		if err != nil {
+			return err
+		}
+		s.added[field], _ = ioutil.ReadAll(f)
+		f.Close()
+	}
+	return nil
+}
+
+func (s *stubService) GetWardrobe(user string, id string) (*api.GetWardrobeResponse, error) {
+	return &api.GetWardrobeResponse{
+		Id:          id,
+		Description: "Leggings",
+		MainImage:   "image",
+		LabelImage:  "label",
+	}, nil
+}
+
+// GetAllWardrobe pages through the single item, the next cursor is
+// handed out when a page of one is asked for
+func (s *stubService) GetAllWardrobe(user string, opts api.ListOptions) (*api.GetWardrobePage, error) {
+	if opts.Cursor != "" {
+		return &api.GetWardrobePage{Items: []*api.GetWardrobeResponse{}}, nil
+	}
+
+	ward, _ := s.GetWardrobe(user, "item")
+	page := &api.GetWardrobePage{Items: []*api.GetWardrobeResponse{ward}}
+	if opts.Limit == 1 {
+		page.Next = "next"
+	}
+	return page, nil
+}
+
+func (s *stubService) GetAllOutfits(user string, opts api.ListOptions) (*api.GetOutfitPage, error) {
+	return &api.GetOutfitPage{Outfits: []*api.GetOutfitResponse{}}, nil
+}
+
+func (s *stubService) GetImage(user string, id string, filename string, cb api.HandleImage) error {
+	if user != "foobar" || id != "item" || filename != "image" {
+		return &api.NoSuchFileOrDirectory{File: filename}
+	}
+
+	sum := sha256.Sum256(s.image)
+	return cb(bytes.NewReader(s.image), api.ImageMeta{
+		Name:    filename,
+		Size:    int64(len(s.image)),
+		Sum:     hex.EncodeToString(sum[:]),
+		Pinned:  true,
+		ModTime: time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC),
+	})
+}
+
+func (s *stubService) Search(user string, query string, limit int) ([]*api.SearchHit, error) {
+	if query == "" {
+		return nil, &api.InvalidRequest{Field: "q", Reason: "no words to search for"}
+	}
+	ward, _ := s.GetWardrobe(user, "item")
+	return []*api.SearchHit{{Item: ward, Score: 1, Fields: []string{"description"}}}, nil
+}
+
+// As keeps the stub as is, Access shares the closet of household with
+// everyone
+func (s *stubService) As(caller string) api.WardrobeService {
+	return s
+}
+
+func (s *stubService) Access(caller string, user string) (api.Role, error) {
+	if user == "household" {
+		return api.RoleViewer, nil
+	}
+	return api.RoleNone, nil
+}
+
+// newTestRouter serves ws open to anyone unless auth is given
+func newTestRouter(ws api.WardrobeService, signer *app.URLSigner, auth ...app.Authenticator) *gin.Engine {
+	if len(auth) == 0 {
+		auth = []app.Authenticator{app.InsecureNoAuth()}
+	}
+	gin.SetMode(gin.TestMode)
+	return app.NewWardrobeServer(gin.New(), ws, signer, auth...).Routes()
+}
+
+func newTestSigner() *app.URLSigner {
+	return app.NewURLSigner([]byte("secret"), 15*time.Minute)
+}
+
+func serve(router *gin.Engine, req *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestGetFileCaching(t *testing.T) {
+
+	image := []byte("0123456789abcdef")
+	signer := newTestSigner()
+	router := newTestRouter(&stubService{image: image}, signer)
+	url := signer.Sign("foobar", "item", "image")
+
+	w := serve(router, httptest.NewRequest("GET", url, nil))
+	if w.Code != http.StatusOK || !bytes.Equal(w.Body.Bytes(), image) {
+		t.Fatalf("Expected image, got %d %q", w.Code, w.Body.String())
+	}
+
+	etag := w.Header().Get("ETag")
+	sum := sha256.Sum256(image)
+	if etag != "\""+hex.EncodeToString(sum[:])+"\"" {
+		t.Errorf("Expected content hash ETag, got %s", etag)
+	}
+	if w.Header().Get("Last-Modified") != "Thu, 01 Oct 2026 00:00:00 GMT" {
+		t.Errorf("Unexpected Last-Modified %s", w.Header().Get("Last-Modified"))
+	}
+	if w.Header().Get("Cache-Control") != "private, max-age=31536000, immutable" {
+		t.Errorf("Unexpected Cache-Control %s", w.Header().Get("Cache-Control"))
+	}
+
+	req := httptest.NewRequest("GET", url, nil)
+	req.Header.Set("If-None-Match", etag)
+	if w := serve(router, req); w.Code != http.StatusNotModified {
+		t.Errorf("Expected 304, got %d", w.Code)
+	}
+
+	req = httptest.NewRequest("GET", url, nil)
+	req.Header.Set("Range", "bytes=4-7")
+	w = serve(router, req)
+	if w.Code != http.StatusPartialContent || w.Body.String() != "4567" {
+		t.Errorf("Expected partial content 4567, got %d %q", w.Code, w.Body.String())
+	}
+	if w.Header().Get("Content-Range") != "bytes 4-7/16" {
+		t.Errorf("Unexpected Content-Range %s", w.Header().Get("Content-Range"))
+	}
+
+	// a resumed download only continues while the image is unchanged
+	req = httptest.NewRequest("GET", url, nil)
+	req.Header.Set("Range", "bytes=4-7")
+	req.Header.Set("If-Range", "\"stale\"")
+	w = serve(router, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected full image for stale If-Range, got %d", w.Code)
+	}
+
+	other := signer.Sign("foobar", "item", "other")
+	if w := serve(router, httptest.NewRequest("GET", other, nil)); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404, got %d", w.Code)
+	}
+}
+
+func TestGetFileSignedUrls(t *testing.T) {
+
+	signer := newTestSigner()
+	router := newTestRouter(&stubService{image: []byte("image")}, signer)
+
+	w := serve(router, httptest.NewRequest("GET", "/users/foobar/wardrobes/item", nil))
+	var ward api.GetWardrobeResponse
+	json.Unmarshal(w.Body.Bytes(), &ward)
+	if !strings.HasPrefix(ward.MainImage, "/users/foobar/wardrobes/item/images/image?") {
+		t.Fatalf("Expected signed main image url, got %s", ward.MainImage)
+	}
+	if w := serve(router, httptest.NewRequest("GET", ward.MainImage, nil)); w.Code != http.StatusOK {
+		t.Errorf("Expected 200 for signed url, got %d", w.Code)
+	}
+
+	signed := signer.Sign("foobar", "item", "image")
+	query := signed[strings.Index(signed, "?"):]
+
+	cases := []struct {
+		name     string
+		url      string
+		expected int
+	}{
+		{"Unsigned", "/users/foobar/wardrobes/item/images/image", http.StatusForbidden},
+		{"OtherUser", "/users/mallory/wardrobes/item/images/image" + query, http.StatusForbidden},
+		{"OtherItem", "/users/foobar/wardrobes/other/images/image" + query, http.StatusForbidden},
+		{"Tampered", strings.Replace(signed, "expires=", "expires=9", 1), http.StatusForbidden},
+		{"Traversal", "/users/foobar/wardrobes/item/images/.." + query, http.StatusBadRequest},
+		{"EncodedTraversal", "/users/foobar/wardrobes/item/images/..%2f..%2fetc%2fpasswd" + query, http.StatusNotFound},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if w := serve(router, httptest.NewRequest("GET", c.url, nil)); w.Code != c.expected {
+				t.Errorf("Expected %d, got %d", c.expected, w.Code)
+			}
+		})
+	}
+
+	// a signature covers exactly the fields it was issued for
+	shifted, _ := url.Parse(signer.Sign("foobar\nitem", "image", "image"))
+	err := signer.Verify("foobar", "item\nimage", "image", shifted.Query().Get("expires"), shifted.Query().Get("signature"))
+	if err == nil {
+		t.Errorf("Expected a signature not to carry over to other fields")
+	}
+
+	signer.SetNow(func() time.Time { return time.Now().Add(time.Hour) })
+	if w := serve(router, httptest.NewRequest("GET", signed, nil)); w.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for expired url, got %d", w.Code)
+	}
+}
+
+// tsToken signs claims as an RS256 jwt
+func tsToken(t *testing.T, key *rsa.PrivateKey, kid string, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatalf("Error signing token : %v", err)
+	}
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func TestWebUI(t *testing.T) {
+
+	router := newTestRouter(&stubService{}, newTestSigner())
+
+	cases := []struct {
+		name     string
+		path     string
+		contains []string
+	}{
+		{"Closet", "/ui/users/foobar", []string{"Leggings", "/users/foobar/wardrobes/item/images/image?expires=", "No outfits yet"}},
+		{"Item", "/ui/users/foobar/items/item", []string{"Leggings", "/users/foobar/wardrobes/item/images/label?expires="}},
+		{"Compose", "/ui/users/foobar/outfits/new", []string{`name="top-id" value="item"`, `name="bottom-id" value="item"`}},
+		{"Upload", "/ui/users/foobar/items/new", []string{`enctype="multipart/form-data"`, `name="label-image"`}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			w := serve(router, httptest.NewRequest("GET", c.path, nil))
+			if w.Code != http.StatusOK {
+				t.Fatalf("Expected 200, got %d %s", w.Code, w.Body.String())
+			}
+			if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+				t.Errorf("Expected html, got %s", ct)
+			}
+			for _, s := range c.contains {
+				if !strings.Contains(w.Body.String(), s) {
+					t.Errorf("Expected page to contain %q", s)
+				}
+			}
+		})
+	}
+}
+
+// failingService fails every outfit lookup with err
+type failingService struct {
+	stubService
+	err error
+}
+
+func (s *failingService) GetOutfit(user string, id string) (*api.GetOutfitResponse, error) {
+	return nil, s.err
+}
+
+func TestErrorStatus(t *testing.T) {
+
+	cases := []struct {
+		name   string
+		err    error
+		status int
+		code   string
+	}{
+		{"NotFound", &api.OutfitNotFound{User: "foobar", Id: "outfit"}, http.StatusNotFound, "outfit-not-found"},
+		{"Wrapped", fmt.Errorf("get outfit : %w", &api.UserNotFound{User: "foobar"}), http.StatusNotFound, "user-not-found"},
+		{"Validation", &api.InvalidRequest{Field: "id", Reason: "empty"}, http.StatusBadRequest, "invalid-id"},
+		{"Conflict", &api.DuplicateFile{}, http.StatusConflict, "duplicate-file"},
+		{"Unavailable", &api.ResourceUnavailable{Server: "mongodb"}, http.StatusServiceUnavailable, "unavailable"},
+		{"Forbidden", &api.Forbidden{User: "mallory", Owner: "foobar"}, http.StatusForbidden, "forbidden"},
+		{"Internal", errors.New("connection reset by peer"), http.StatusInternalServerError, "internal-error"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			router := newTestRouter(&failingService{err: c.err}, newTestSigner())
+
+			w := serve(router, httptest.NewRequest("GET", "/users/foobar/outfits/outfit", nil))
+			if w.Code != c.status {
+				t.Fatalf("Expected %d, got %d %s", c.status, w.Code, w.Body.String())
+			}
+
+			var body struct {
+				Code  string `json:"code"`
+				Error string `json:"error"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("Expected json error body, got %s", w.Body.String())
+			}
+			if body.Code != c.code {
+				t.Errorf("Expected code %s, got %s", c.code, body.Code)
+			}
+			if c.status == http.StatusInternalServerError && strings.Contains(body.Error, "connection") {
+				t.Errorf("Expected internal error text to be hidden, got %s", body.Error)
+			}
+		})
+	}
+
+	t.Run("EmptyList", func(t *testing.T) {
+		router := newTestRouter(&stubService{}, newTestSigner())
+
+		w := serve(router, httptest.NewRequest("GET", "/users/foobar/outfits", nil))
+		if w.Code != http.StatusOK || strings.TrimSpace(w.Body.String()) != "[]" {
+			t.Errorf("Expected 200 [], got %d %s", w.Code, w.Body.String())
+		}
+	})
+}
+
+func TestListPaging(t *testing.T) {
+
+	router := newTestRouter(&stubService{}, newTestSigner())
+
+	w := serve(router, httptest.NewRequest("GET", "/v1/users/foobar/wardrobes?limit=1&sort=-likes&filter[description]=leg", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d %s", w.Code, w.Body.String())
+	}
+	link := w.Header().Get("Link")
+	if !strings.Contains(link, "cursor=next") || !strings.Contains(link, "sort=-likes") || !strings.HasSuffix(link, `; rel="next"`) {
+		t.Errorf("Unexpected Link %s", link)
+	}
+
+	w = serve(router, httptest.NewRequest("GET", "/v1/users/foobar/wardrobes?cursor=next", nil))
+	if w.Code != http.StatusOK || strings.TrimSpace(w.Body.String()) != "[]" || w.Header().Get("Link") != "" {
+		t.Errorf("Expected a last empty page, got %d %s %s", w.Code, w.Body.String(), w.Header().Get("Link"))
+	}
+
+	w = serve(router, httptest.NewRequest("GET", "/v1/users/foobar/wardrobes?limit=many", nil))
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "invalid-limit") {
+		t.Errorf("Expected 400 invalid-limit, got %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestSearch(t *testing.T) {
+
+	router := newTestRouter(&stubService{}, newTestSigner())
+
+	w := serve(router, httptest.NewRequest("GET", "/users/foobar/search?q=leggings", nil))
+	var hits []api.SearchHit
+	json.Unmarshal(w.Body.Bytes(), &hits)
+	if w.Code != http.StatusOK || len(hits) != 1 || !strings.HasPrefix(hits[0].Item.MainImage, "/users/foobar/wardrobes/item/images/image?") {
+		t.Errorf("Expected a hit with signed image urls, got %d %s", w.Code, w.Body.String())
+	}
+
+	w = serve(router, httptest.NewRequest("GET", "/users/foobar/search", nil))
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "invalid-q") {
+		t.Errorf("Expected 400 invalid-q, got %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestAuthentication(t *testing.T) {
+
+	dir := t.TempDir()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Error generating key : %v", err)
+	}
+	jwks, _ := json.Marshal(map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "k1",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}},
+	})
+	jwksPath := filepath.Join(dir, "jwks.json")
+	ioutil.WriteFile(jwksPath, jwks, 0600)
+
+	apiKeySum := sha256.Sum256([]byte("s3cret"))
+	apiKeys, _ := json.Marshal([]map[string]interface{}{
+		{"sha256": hex.EncodeToString(apiKeySum[:]), "user": "service", "admin": true},
+	})
+	apiKeysPath := filepath.Join(dir, "apikeys.json")
+	ioutil.WriteFile(apiKeysPath, apiKeys, 0600)
+
+	jwtAuth, err := app.NewJWKSAuthenticator(jwksPath, "https://issuer", "wardrobe", "sub")
+	if err != nil {
+		t.Fatalf("Expected nil, got %v", err)
+	}
+	keyAuth, err := app.NewAPIKeyAuthenticator(apiKeysPath)
+	if err != nil {
+		t.Fatalf("Expected nil, got %v", err)
+	}
+
+	router := newTestRouter(&stubService{}, newTestSigner(), jwtAuth, keyAuth)
+
+	claims := func(overrides map[string]interface{}) map[string]interface{} {
+		c := map[string]interface{}{
+			"sub": "foobar",
+			"iss": "https://issuer",
+			"aud": "wardrobe",
+			"exp": time.Now().Add(time.Hour).Unix(),
+		}
+		for k, v := range overrides {
+			c[k] = v
+		}
+		return c
+	}
+
+	otherKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+	cases := []struct {
+		name     string
+		user     string
+		header   string
+		value    string
+		expected int
+	}{
+		{"NoCredentials", "foobar", "", "", http.StatusUnauthorized},
+		{"Bearer", "foobar", "Authorization", "Bearer " + tsToken(t, key, "k1", claims(nil)), http.StatusOK},
+		{"BearerOtherUser", "mallory", "Authorization", "Bearer " + tsToken(t, key, "k1", claims(nil)), http.StatusForbidden},
+		{"BearerSharedCloset", "household", "Authorization", "Bearer " + tsToken(t, key, "k1", claims(nil)), http.StatusOK},
+		{"BearerAdmin", "mallory", "Authorization", "Bearer " + tsToken(t, key, "k1", claims(map[string]interface{}{"scope": "openid wardrobe:admin"})), http.StatusOK},
+		{"BearerExpired", "foobar", "Authorization", "Bearer " + tsToken(t, key, "k1", claims(map[string]interface{}{"exp": time.Now().Add(-time.Minute).Unix()})), http.StatusUnauthorized},
+		{"BearerWrongAudience", "foobar", "Authorization", "Bearer " + tsToken(t, key, "k1", claims(map[string]interface{}{"aud": "other"})), http.StatusUnauthorized},
+		{"BearerWrongKey", "foobar", "Authorization", "Bearer " + tsToken(t, otherKey, "k1", claims(nil)), http.StatusUnauthorized},
+		{"BearerUnknownKid", "foobar", "Authorization", "Bearer " + tsToken(t, key, "k2", claims(nil)), http.StatusUnauthorized},
+		{"ApiKey", "anyone", "X-API-Key", "s3cret", http.StatusOK},
+		{"ApiKeyWrong", "anyone", "Authorization", "ApiKey wrong", http.StatusUnauthorized},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/users/"+c.user+"/wardrobes/item", nil)
+			if c.header != "" {
+				req.Header.Set(c.header, c.value)
+			}
+			if w := serve(router, req); w.Code != c.expected {
+				t.Errorf("Expected %d, got %d %s", c.expected, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestJWKSReload(t *testing.T) {
+
+	jwk := func(kid string, key *rsa.PrivateKey) map[string]string {
+		return map[string]string{
+			"kty": "RSA",
+			"kid": kid,
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}
+	}
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Error generating key : %v", err)
+	}
+	jwksPath := filepath.Join(t.TempDir(), "jwks.json")
+	writeKeys := func(keys ...map[string]string) {
+		jwks, _ := json.Marshal(map[string]interface{}{"keys": keys})
+		ioutil.WriteFile(jwksPath, jwks, 0600)
+	}
+
+	writeKeys(jwk("k1", key))
+	jwtAuth, err := app.NewJWKSAuthenticator(jwksPath, "", "", "sub")
+	if err != nil {
+		t.Fatalf("Expected nil, got %v", err)
+	}
+	now := time.Now()
+	app.SetJWKSNow(jwtAuth, func() time.Time { return now })
+	router := newTestRouter(&stubService{}, newTestSigner(), jwtAuth)
+
+	get := func(kid string) int {
+		req := httptest.NewRequest("GET", "/v1/users/foobar/wardrobes/item", nil)
+		token := tsToken(t, key, kid, map[string]interface{}{"sub": "foobar", "exp": now.Add(time.Hour).Unix()})
+		req.Header.Set("Authorization", "Bearer "+token)
+		return serve(router, req).Code
+	}
+
+	// a rotated key is only picked up once a reload is due
+	writeKeys(jwk("k1", key), jwk("k2", key))
+	if code := get("k2"); code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 before a reload is due, got %d", code)
+	}
+	now = now.Add(time.Minute)
+	if code := get("k2"); code != http.StatusOK {
+		t.Errorf("Expected 200 once reloaded, got %d", code)
+	}
+
+	// the file is not read again for every unknown key id
+	writeKeys(jwk("k3", key))
+	if code := get("k3"); code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 right after a reload, got %d", code)
+	}
+	if code := get("k2"); code != http.StatusOK {
+		t.Errorf("Expected 200 for a key read before, got %d", code)
+	}
+
+	// a file that cannot be read keeps the keys there were
+	now = now.Add(time.Minute)
+	ioutil.WriteFile(jwksPath, []byte("{"), 0600)
+	if code := get("k3"); code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for a broken file, got %d", code)
+	}
+	if code := get("k1"); code != http.StatusOK {
+		t.Errorf("Expected 200 for a key read before, got %d", code)
+	}
+}
+
+func TestNoAuthenticators(t *testing.T) {
+
+	gin.SetMode(gin.TestMode)
+	server := app.NewWardrobeServer(gin.New(), &stubService{}, newTestSigner())
+
+	w := serve(server.Routes(), httptest.NewRequest("GET", "/v1/users/foobar/wardrobes/item", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without authenticators, got %d", w.Code)
+	}
+
+	lis := bufconn.Listen(1 << 20)
+	grpcServer := server.GRPCServer()
+	go grpcServer.Serve(lis)
+	defer grpcServer.Stop()
+
+	conn, err := grpc.Dial("bufnet", grpc.WithInsecure(), grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+		return lis.Dial()
+	}))
+	if err != nil {
+		t.Fatalf("Expected nil, got %v", err)
+	}
+	defer conn.Close()
+
+	_, err = rpc.NewWardrobeClient(conn).GetWardrobe(context.Background(), &rpc.ItemRequest{User: "foobar", Id: "item"})
+	if status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Expected unauthenticated without authenticators, got %v", err)
+	}
+}
+
+func TestVersioning(t *testing.T) {
+
+	router := newTestRouter(&stubService{}, newTestSigner())
+
+	w := serve(router, httptest.NewRequest("GET", "/v1/users/foobar/wardrobes/item", nil))
+	var ward api.GetWardrobeResponse
+	json.Unmarshal(w.Body.Bytes(), &ward)
+	if w.Code != http.StatusOK || w.Header().Get("API-Version") != api.Version {
+		t.Fatalf("Expected 200 with API-Version, got %d %v", w.Code, w.Header())
+	}
+	if w.Header().Get("Deprecation") != "" {
+		t.Errorf("Expected v1 not to be deprecated, got %s", w.Header().Get("Deprecation"))
+	}
+	if !strings.HasPrefix(ward.MainImage, "/v1/users/foobar/wardrobes/item/images/image?") {
+		t.Errorf("Expected a v1 image url, got %s", ward.MainImage)
+	}
+	if w := serve(router, httptest.NewRequest("GET", ward.MainImage, nil)); w.Code != http.StatusOK {
+		t.Errorf("Expected 200 for the v1 image url, got %d", w.Code)
+	}
+
+	// the legacy paths still answer, pointing at their successor
+	w = serve(router, httptest.NewRequest("GET", "/users/foobar/wardrobes?limit=1", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", w.Code)
+	}
+	if !strings.HasPrefix(w.Header().Get("Deprecation"), "@") || w.Header().Get("Sunset") == "" {
+		t.Errorf("Expected Deprecation and Sunset headers, got %v", w.Header())
+	}
+	links := strings.Join(w.Header().Values("Link"), ", ")
+	if !strings.Contains(links, `</v1/users/foobar/wardrobes>; rel="successor-version"`) || !strings.Contains(links, `rel="next"`) {
+		t.Errorf("Expected successor and next links, got %s", links)
+	}
+}
+
+// TestOpenAPIRoutes keeps the served spec in line with the registered
+// routes, both ways
+func TestOpenAPIRoutes(t *testing.T) {
+
+	router := newTestRouter(&stubService{}, newTestSigner())
+
+	w := serve(router, httptest.NewRequest("GET", "/openapi.json", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", w.Code)
+	}
+
+	var spec struct {
+		Paths      map[string]map[string]json.RawMessage `json:"paths"`
+		Components struct {
+			Schemas map[string]json.RawMessage `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &spec); err != nil {
+		t.Fatalf("Error decoding spec : %v", err)
+	}
+
+	documented := make(map[string]bool)
+	for path, ops := range spec.Paths {
+		for method := range ops {
+			documented[strings.ToUpper(method)+" "+path] = true
+		}
+	}
+
+	routed := make(map[string]bool)
+	for _, route := range router.Routes() {
+		parts := strings.Split(route.Path, "/")
+		for i, part := range parts {
+			if strings.HasPrefix(part, ":") {
+				parts[i] = "{" + part[1:] + "}"
+			}
+		}
+		key := route.Method + " " + strings.Join(parts, "/")
+
+		// unversioned legacy paths are documented by their successor
+		if !documented[key] && !documented[route.Method+" /v1"+strings.Join(parts, "/")] {
+			t.Errorf("Route %s is not in the spec", key)
+		}
+		routed[key] = true
+	}
+	for key := range documented {
+		if !routed[key] {
+			t.Errorf("Spec documents %s, which is not routed", key)
+		}
+	}
+
+	for _, ref := range regexp.MustCompile(`"#/components/schemas/([^"]+)"`).FindAllStringSubmatch(w.Body.String(), -1) {
+		if _, ok := spec.Components.Schemas[ref[1]]; !ok {
+			t.Errorf("Schema %s is referenced but not defined", ref[1])
+		}
+	}
+
+	w = serve(router, httptest.NewRequest("GET", "/docs", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `id="GetWardrobeResponse"`) {
+		t.Errorf("Expected docs page, got %d", w.Code)
+	}
+}
+
+func TestGRPC(t *testing.T) {
+
+	image := bytes.Repeat([]byte("0123456789abcdef"), 10000)
+	ws := &stubService{image: image}
+
+	apiKeySum := sha256.Sum256([]byte("s3cret"))
+	apiKeys, _ := json.Marshal([]map[string]interface{}{
+		{"sha256": hex.EncodeToString(apiKeySum[:]), "user": "foobar"},
+	})
+	apiKeysPath := filepath.Join(t.TempDir(), "apikeys.json")
+	ioutil.WriteFile(apiKeysPath, apiKeys, 0600)
+	keyAuth, err := app.NewAPIKeyAuthenticator(apiKeysPath)
+	if err != nil {
+		t.Fatalf("Expected nil, got %v", err)
+	}
+
+	lis := bufconn.Listen(1 << 20)
+	server := app.NewWardrobeServer(gin.New(), ws, newTestSigner(), keyAuth).GRPCServer()
+	go server.Serve(lis)
+	defer server.Stop()
+
+	conn, err := grpc.Dial("bufnet", grpc.WithInsecure(), grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+		return lis.Dial()
+	}))
+	if err != nil {
+		t.Fatalf("Expected nil, got %v", err)
+	}
+	defer conn.Close()
+	client := rpc.NewWardrobeClient(conn)
+
+	_, err = client.GetWardrobe(context.Background(), &rpc.ItemRequest{User: "foobar", Id: "item"})
+	if status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Expected unauthenticated, got %v", err)
+	}
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "x-api-key", "s3cret")
+
+	item, err := client.GetWardrobe(ctx, &rpc.ItemRequest{User: "foobar", Id: "item"})
+	if err != nil || item.Description != "Leggings" || item.MainImage != "image" {
+		t.Errorf("Expected item, got %v, %v", item, err)
+	}
+
+	stream, err := client.GetImage(ctx, &rpc.ImageRequest{User: "foobar", Id: "item", Filename: "image"})
+	if err != nil {
+		t.Fatalf("Expected nil, got %v", err)
+	}
+	var info *rpc.ImageInfo
+	var content []byte
+	for {
+		chunk, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Expected nil, got %v", err)
+		}
+		if chunk.GetInfo() != nil {
+			info = chunk.GetInfo()
+		}
+		content = append(content, chunk.GetData()...)
+	}
+	if info == nil || info.Size != int64(len(image)) || !bytes.Equal(content, image) {
+		t.Errorf("Expected the image, got %v and %d bytes", info, len(content))
+	}
+
+	stream, err = client.GetImage(ctx, &rpc.ImageRequest{User: "foobar", Id: "item", Filename: "other"})
+	if err == nil {
+		_, err = stream.Recv()
+	}
+	st, _ := status.FromError(err)
+	if st.Code() != codes.NotFound || len(st.Details()) != 1 || st.Details()[0].(*errdetails.ErrorInfo).Reason != "image-not-found" {
+		t.Errorf("Expected image-not-found, got %v", err)
+	}
+
+	upload, err := client.AddWardrobe(ctx)
+	if err != nil {
+		t.Fatalf("Expected nil, got %v", err)
+	}
+	messages := []*rpc.AddWardrobeRequest{
+		{Part: &rpc.AddWardrobeRequest_Item{Item: &rpc.NewItem{User: "foobar", Description: "Jeans"}}},
+		{Part: &rpc.AddWardrobeRequest_Main{Main: image[:1000]}},
+		{Part: &rpc.AddWardrobeRequest_Main{Main: image[1000:]}},
+		{Part: &rpc.AddWardrobeRequest_Label{Label: []byte("label")}},
+	}
+	for _, msg := range messages {
+		if err := upload.Send(msg); err != nil {
+			t.Fatalf("Expected nil, got %v", err)
+		}
+	}
+	if _, err := upload.CloseAndRecv(); err != nil {
+		t.Fatalf("Expected nil, got %v", err)
+	}
+	if string(ws.added["description"]) != "Jeans" || !bytes.Equal(ws.added["main"], image) || string(ws.added["label"]) != "label" {
+		t.Errorf("Unexpected upload %q", ws.added["description"])
+	}
+
+	upload, _ = client.AddWardrobe(ctx)
+	upload.Send(&rpc.AddWardrobeRequest{Part: &rpc.AddWardrobeRequest_Item{Item: &rpc.NewItem{User: "foobar", Description: "Jeans"}}})
+	upload.Send(&rpc.AddWardrobeRequest{Part: &rpc.AddWardrobeRequest_Label{Label: []byte("label")}})
+	if _, err := upload.CloseAndRecv(); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected invalid argument without a photo, got %v", err)
+	}
+}
+
+// closetService has outfits over items of the stub and a wear log, and
+// counts the batched item reads
+type closetService struct {
+	stubService
+	batches [][]string
+}
+
+func (s *closetService) GetUser(user string) (*api.GetUserResponse, error) {
+	return &api.GetUserResponse{Id: "id-" + user, Username: user}, nil
+}
+
+func (s *closetService) GetWardrobes(user string, ids []string) ([]*api.GetWardrobeResponse, error) {
+	s.batches = append(s.batches, ids)
+	items := make([]*api.GetWardrobeResponse, len(ids))
+	for i, id := range ids {
+		if id != "missing" {
+			items[i], _ = s.GetWardrobe(user, id)
+		}
+	}
+	return items, nil
+}
+
+// GetAllOutfits pairs top1, top2 and top3 with the same bottom, the last
+// one a deleted item
+func (s *closetService) GetAllOutfits(user string, opts api.ListOptions) (*api.GetOutfitPage, error) {
+	return &api.GetOutfitPage{Outfits: []*api.GetOutfitResponse{
+		{Id: "o1", TopId: "top1", BottomId: "bottom", Description: "Office"},
+		{Id: "o2", TopId: "top2", BottomId: "bottom", Description: "Party"},
+		{Id: "o3", TopId: "top3", BottomId: "missing", Description: "Beach"},
+	}}, nil
+}
+
+func (s *closetService) GetOutfits(user string, ids []string) ([]*api.GetOutfitResponse, error) {
+	return nil, errors.New("outfits are primed by the listing")
+}
+
+func (s *closetService) GetWears(user string, limit int) ([]*api.GetWearResponse, error) {
+	return []*api.GetWearResponse{{Id: "w1", Outfit: "o2", Items: []string{"top2", "bottom", "scarf"}}}, nil
+}
+
+func TestGraphQL(t *testing.T) {
+
+	ws := &closetService{}
+	router := newTestRouter(ws, newTestSigner())
+
+	query := `query closet($user: String!) {
+		user(username: $user) {
+			username
+			outfits { outfits { id top { id mainImage { uri } } bottom { id } items { id } } }
+			wears { outfit { description } items { id } }
+		}
+	}`
+	body, _ := json.Marshal(map[string]interface{}{"query": query, "variables": map[string]interface{}{"user": "foobar"}})
+	req := httptest.NewRequest("POST", "/graphql", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	w := serve(router, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d %s", w.Code, w.Body.String())
+	}
+
+	type item struct {
+		Id        string
+		MainImage *struct{ Uri string }
+	}
+	var result struct {
+		Data struct {
+			User struct {
+				Username string
+				Outfits  struct {
+					Outfits []struct {
+						Id     string
+						Top    *item
+						Bottom *item
+						Items  []*item
+					}
+				}
+				Wears []struct {
+					Outfit struct{ Description string }
+					Items  []item
+				}
+			}
+		}
+		Errors []json.RawMessage
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil || len(result.Errors) != 0 {
+		t.Fatalf("Expected data without errors, got %s", w.Body.String())
+	}
+
+	// every item of every outfit and wear is read in one batch, once
+	if len(ws.batches) != 1 || len(ws.batches[0]) != 6 {
+		t.Errorf("Expected a single batch of 6 items, got %v", ws.batches)
+	}
+
+	user := result.Data.User
+	if user.Username != "foobar" || len(user.Outfits.Outfits) != 3 || len(user.Wears) != 1 {
+		t.Fatalf("Unexpected user %+v", user)
+	}
+	top := user.Outfits.Outfits[0].Top
+	if top == nil || top.Id != "top1" || top.MainImage == nil || !strings.HasPrefix(top.MainImage.Uri, "/v1/users/foobar/wardrobes/top1/images/image?expires=") {
+		t.Errorf("Expected top1 with a signed v1 image url, got %+v", top)
+	}
+	if o3 := user.Outfits.Outfits[2]; o3.Bottom != nil || len(o3.Items) != 2 || o3.Items[1] != nil {
+		t.Errorf("Expected the deleted bottom to be null, got %+v", o3)
+	}
+	if wear := user.Wears[0]; wear.Outfit.Description != "Party" || len(wear.Items) != 3 || wear.Items[2].Id != "scarf" {
+		t.Errorf("Unexpected wear %+v", wear)
+	}
+
+	// api errors come with their code, queries also work over GET
+	w = serve(router, httptest.NewRequest("GET", `/graphql?query=query($q:String!){search(username:"foobar",q:$q){score}}&variables={"q":""}`, nil))
+	var failed struct {
+		Errors []struct {
+			Message    string
+			Extensions struct{ Code string }
+		}
+	}
+	json.Unmarshal(w.Body.Bytes(), &failed)
+	if w.Code != http.StatusOK || len(failed.Errors) != 1 || failed.Errors[0].Extensions.Code != "invalid-q" {
+		t.Errorf("Expected an invalid-q error, got %d %s", w.Code, w.Body.String())
+	}
+
+	if w := serve(router, httptest.NewRequest("GET", "/graphql", nil)); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 without a query, got %d", w.Code)
+	}
+}
+
+// eventService replays the events after the last event id, then ends the
+// stream as if it fell behind. The last event id "gone" resets the stream.
+type eventService struct {
+	stubService
+	last string
+}
+
+func (s *eventService) WatchEvents(user string, lastEventId string) (*api.EventStream, error) {
+	if user != "foobar" {
+		return nil, &api.UserNotFound{User: user}
+	}
+	s.last = lastEventId
+	events := make(chan *api.Event)
+	close(events)
+	if lastEventId == "gone" {
+		return &api.EventStream{Reset: true, Events: events}, nil
+	}
+	return &api.EventStream{
+		Replay: []*api.Event{{Id: "e2", Type: api.EventLabelText, User: "foobar", Data: map[string]string{"id": "item"}}},
+		Events: events,
+	}, nil
+}
+
+func TestStreamEvents(t *testing.T) {
+
+	ws := &eventService{}
+	router := newTestRouter(ws, newTestSigner())
+
+	req := httptest.NewRequest("GET", "/v1/users/foobar/events", nil)
+	req.Header.Set("Last-Event-ID", "e1")
+	w := serve(router, req)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("Expected an event stream, got %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	if ws.last != "e1" {
+		t.Errorf("Expected to resume after e1, got %q", ws.last)
+	}
+	if !strings.HasPrefix(w.Body.String(), "id: e2\nevent: item.label-text\ndata: {\"id\":\"e2\",\"type\":\"item.label-text\"") || !strings.HasSuffix(w.Body.String(), "}\n\n") {
+		t.Errorf("Unexpected event %q", w.Body.String())
+	}
+
+	serve(router, httptest.NewRequest("GET", "/v1/users/foobar/events?lastEventId=e0", nil))
+	if ws.last != "e0" {
+		t.Errorf("Expected to resume after e0, got %q", ws.last)
+	}
+
+	w = serve(router, httptest.NewRequest("GET", "/v1/users/foobar/events?lastEventId=gone", nil))
+	if !strings.HasPrefix(w.Body.String(), "id: \nevent: stream.reset\ndata: {\"id\":\"\",\"type\":\"stream.reset\",\"user\":\"foobar\"") {
+		t.Errorf("Expected a reset event, got %q", w.Body.String())
+	}
+
+	if w := serve(router, httptest.NewRequest("GET", "/v1/users/nobody/events", nil)); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404, got %d", w.Code)
+	}
+}
@@ -0,0 +1,491 @@
+//
+// auth.go
+//
+
+package app
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/glog"
+
+	"WardrobeManagerMS/pkg/api"
+)
+
+const principalKey = "principal"
+
+// adminScope lets a principal act on every user
+const adminScope = "wardrobe:admin"
+
+var errNoCredentials = errors.New("no credentials")
+
+// Principal is who a request was authenticated as
+type Principal struct {
+	User   string
+	Admin  bool
+	Method string
+}
+
+// MayActOn reports whether the principal may read or change user's closet
+func (p *Principal) MayActOn(user string) bool {
+	return p.Admin || p.User == user
+}
+
+// Authenticator checks the credentials of a request. It returns
+// errNoCredentials when the request carries none it understands, so the
+// next one can be tried.
+type Authenticator interface {
+	Authenticate(r *http.Request) (*Principal, error)
+}
+
+// insecureNoAuth accepts every request without a principal, which acts on
+// every user
+type insecureNoAuth struct{}
+
+// InsecureNoAuth opens the api to anyone. Without it, a server with no
+// authenticators refuses every request.
+func InsecureNoAuth() Authenticator {
+	return insecureNoAuth{}
+}
+
+func (insecureNoAuth) Authenticate(r *http.Request) (*Principal, error) {
+	return nil, nil
+}
+
+// authenticate rejects requests no authenticator accepts, all of them when
+// there are no authenticators
+func (s *Server) authenticate(c *gin.Context) {
+
+	for _, auth := range s.auth {
+		p, err := auth.Authenticate(c.Request)
+		if err == errNoCredentials {
+			continue
+		}
+		if err != nil {
+			glog.Errorf("Authentication failed {path=%s}, {err=%v}", c.Request.URL.Path, err)
+			c.Header("WWW-Authenticate", "Bearer error=\"invalid_token\"")
+			respondStatus(c, http.StatusUnauthorized, "unauthenticated", "invalid credentials")
+			return
+		}
+
+		if p != nil {
+			c.Set(principalKey, p)
+		}
+		return
+	}
+
+	c.Header("WWW-Authenticate", "Bearer")
+	respondStatus(c, http.StatusUnauthorized, "unauthenticated", "authentication required")
+}
+
+// authorizeUser only lets a principal through to its own :username or one
+// that shares a closet with it, the service checks the role each call
+// needs. Routes without a :username are left to the service.
+func (s *Server) authorizeUser(c *gin.Context) {
+
+	p := principal(c)
+	username := c.Params.ByName("username")
+	if p == nil || username == "" || p.MayActOn(username) {
+		return
+	}
+
+	role, err := s.ws.Access(p.User, username)
+	if err != nil {
+		glog.Errorf("Error checking access {principal=%s}, {user=%s}, {err=%v}", p.User, username, err)
+		respondStatus(c, http.StatusServiceUnavailable, "unavailable", "access check failed")
+		return
+	}
+
+	if role == api.RoleNone {
+		glog.Errorf("Forbidden {principal=%s}, {user=%s}", p.User, username)
+		respondStatus(c, http.StatusForbidden, "forbidden", "not allowed to act on this user")
+		return
+	}
+}
+
+// service is the WardrobeService acting on behalf of the principal, admins
+// and requests without authentication see everything
+func (s *Server) service(c *gin.Context) api.WardrobeService {
+	p := principal(c)
+	if p == nil || p.Admin {
+		return s.ws
+	}
+	return s.ws.As(p.User)
+}
+
+// principal returns who the request was authenticated as, nil when the
+// api is open
+func principal(c *gin.Context) *Principal {
+	v, ok := c.Get(principalKey)
+	if !ok {
+		return nil
+	}
+	return v.(*Principal)
+}
+
+// apiKeyAuth accepts static keys sent as "Authorization: ApiKey <key>" or
+// in the X-API-Key header. Only the SHA-256 of each key is kept on disk.
+type apiKeyAuth struct {
+	keys map[string]apiKey
+}
+
+type apiKey struct {
+	Sha256 string `json:"sha256"`
+	User   string `json:"user"`
+	Admin  bool   `json:"admin"`
+}
+
+// NewAPIKeyAuthenticator loads a JSON list of {"sha256", "user", "admin"}
+func NewAPIKeyAuthenticator(path string) (Authenticator, error) {
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading api key file %s : %w", path, err)
+	}
+
+	var keys []apiKey
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("Error decoding api key file %s : %w", path, err)
+	}
+
+	auth := &apiKeyAuth{
+		keys: make(map[string]apiKey),
+	}
+	for _, key := range keys {
+		auth.keys[strings.ToLower(key.Sha256)] = key
+	}
+
+	return auth, nil
+}
+
+func (a *apiKeyAuth) Authenticate(r *http.Request) (*Principal, error) {
+
+	key := r.Header.Get("X-API-Key")
+	if h := r.Header.Get("Authorization"); strings.HasPrefix(h, "ApiKey ") {
+		key = strings.TrimPrefix(h, "ApiKey ")
+	}
+	if key == "" {
+		return nil, errNoCredentials
+	}
+
+	sum := sha256.Sum256([]byte(key))
+	found, ok := a.keys[hex.EncodeToString(sum[:])]
+	if !ok {
+		return nil, errors.New("unknown api key")
+	}
+
+	return &Principal{
+		User:   found.User,
+		Admin:  found.Admin,
+		Method: "api-key",
+	}, nil
+}
+
+// jwksReload is how often a token with an unknown key id may have the JWKS
+// file read again, in between such tokens are refused from what was read
+const jwksReload = 30 * time.Second
+
+// jwtAuth accepts RS256/384/512 and ES256/384 bearer tokens signed by a key
+// in a local JWKS file
+type jwtAuth struct {
+	mu        sync.Mutex
+	path      string
+	keys      map[string]crypto.PublicKey
+	loaded    time.Time
+	issuer    string
+	audience  string
+	userClaim string
+	now       func() time.Time
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// NewJWKSAuthenticator verifies tokens against the JWKS file at path. An
+// empty issuer or audience is not checked, the user is taken from
+// userClaim.
+func NewJWKSAuthenticator(path, issuer, audience, userClaim string) (Authenticator, error) {
+
+	auth := &jwtAuth{
+		path:      path,
+		issuer:    issuer,
+		audience:  audience,
+		userClaim: userClaim,
+		now:       time.Now,
+	}
+
+	if err := auth.load(); err != nil {
+		return nil, err
+	}
+
+	return auth, nil
+}
+
+// load reads the JWKS file, a file that cannot be read keeps the keys read
+// before
+func (a *jwtAuth) load() error {
+
+	a.loaded = a.now()
+
+	data, err := ioutil.ReadFile(a.path)
+	if err != nil {
+		return fmt.Errorf("Error reading jwks file %s : %w", a.path, err)
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return fmt.Errorf("Error decoding jwks file %s : %w", a.path, err)
+	}
+
+	keys := make(map[string]crypto.PublicKey)
+	for _, k := range set.Keys {
+		pub, err := k.publicKey()
+		if err != nil {
+			return fmt.Errorf("Error decoding jwk %s : %w", k.Kid, err)
+		}
+		keys[k.Kid] = pub
+	}
+
+	a.keys = keys
+	return nil
+}
+
+func (a *jwtAuth) key(kid string) (crypto.PublicKey, error) {
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if key, ok := a.keys[kid]; ok {
+		return key, nil
+	}
+
+	// the key may have been rotated in since we last looked, anyone can
+	// send an unknown key id so the file is not read for each of them
+	if a.now().Sub(a.loaded) < jwksReload {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+	if err := a.load(); err != nil {
+		return nil, err
+	}
+
+	key, ok := a.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+	return key, nil
+}
+
+func (a *jwtAuth) Authenticate(r *http.Request) (*Principal, error) {
+
+	h := r.Header.Get("Authorization")
+	if !strings.HasPrefix(h, "Bearer ") {
+		return nil, errNoCredentials
+	}
+
+	parts := strings.Split(strings.TrimPrefix(h, "Bearer "), ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("malformed token header : %w", err)
+	}
+
+	key, err := a.key(header.Kid)
+	if err != nil {
+		return nil, err
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("malformed token signature : %w", err)
+	}
+
+	err = verifySignature(header.Alg, key, []byte(parts[0]+"."+parts[1]), sig)
+	if err != nil {
+		return nil, err
+	}
+
+	var claims map[string]interface{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("malformed token claims : %w", err)
+	}
+
+	now := float64(a.now().Unix())
+	exp, ok := claims["exp"].(float64)
+	if !ok || now >= exp {
+		return nil, errors.New("token expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now < nbf {
+		return nil, errors.New("token not yet valid")
+	}
+	if a.issuer != "" && claims["iss"] != a.issuer {
+		return nil, errors.New("unexpected token issuer")
+	}
+	if a.audience != "" && !hasAudience(claims["aud"], a.audience) {
+		return nil, errors.New("unexpected token audience")
+	}
+
+	user, _ := claims[a.userClaim].(string)
+	if user == "" {
+		return nil, fmt.Errorf("token has no %s claim", a.userClaim)
+	}
+
+	scope, _ := claims["scope"].(string)
+
+	return &Principal{
+		User:   user,
+		Admin:  hasScope(scope, adminScope),
+		Method: "jwt",
+	}, nil
+}
+
+func verifySignature(alg string, key crypto.PublicKey, signed, sig []byte) error {
+
+	hashes := map[string]crypto.Hash{
+		"RS256": crypto.SHA256, "RS384": crypto.SHA384, "RS512": crypto.SHA512,
+		"ES256": crypto.SHA256, "ES384": crypto.SHA384,
+	}
+
+	h, ok := hashes[alg]
+	if !ok {
+		return fmt.Errorf("unsupported token algorithm %q", alg)
+	}
+
+	hasher := h.New()
+	hasher.Write(signed)
+	digest := hasher.Sum(nil)
+
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		if alg[0] != 'R' {
+			return fmt.Errorf("algorithm %s does not match rsa key", alg)
+		}
+		if err := rsa.VerifyPKCS1v15(key, h, digest, sig); err != nil {
+			return errors.New("bad token signature")
+		}
+	case *ecdsa.PublicKey:
+		size := (key.Curve.Params().BitSize + 7) / 8
+		if alg[0] != 'E' || len(sig) != 2*size {
+			return fmt.Errorf("algorithm %s does not match ec key", alg)
+		}
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		if !ecdsa.Verify(key, digest, r, s) {
+			return errors.New("bad token signature")
+		}
+	default:
+		return errors.New("unsupported key type")
+	}
+
+	return nil
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+
+	case "EC":
+		curves := map[string]elliptic.Curve{
+			"P-256": elliptic.P256(),
+			"P-384": elliptic.P384(),
+		}
+		curve, ok := curves[k.Crv]
+		if !ok {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("point is not on curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+func decodeSegment(seg string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+func hasAudience(aud interface{}, expected string) bool {
+	switch aud := aud.(type) {
+	case string:
+		return aud == expected
+	case []interface{}:
+		for _, a := range aud {
+			if a == expected {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func hasScope(scope, expected string) bool {
+	for _, s := range strings.Fields(scope) {
+		if s == expected {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,45 @@
+//
+// errors.go
+//
+
+package app
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"WardrobeManagerMS/pkg/api"
+)
+
+var kindStatus = map[api.ErrorKind]int{
+	api.KindNotFound:    http.StatusNotFound,
+	api.KindConflict:    http.StatusConflict,
+	api.KindValidation:  http.StatusBadRequest,
+	api.KindUnavailable: http.StatusServiceUnavailable,
+	api.KindForbidden:   http.StatusForbidden,
+	api.KindInternal:    http.StatusInternalServerError,
+}
+
+// errorStatus is the http status of err by its kind
+func errorStatus(err error) int {
+	return kindStatus[api.ErrorKindOf(err)]
+}
+
+// respondError answers with the status and code of err. Internal errors
+// are logged by the caller, their text is not sent to the client.
+func respondError(c *gin.Context, err error) {
+	status := errorStatus(err)
+
+	message := err.Error()
+	if status == http.StatusInternalServerError {
+		message = "internal error"
+	}
+
+	respondStatus(c, status, api.ErrorCodeOf(err), message)
+}
+
+// respondStatus answers with an error body of code and message
+func respondStatus(c *gin.Context, status int, code string, message string) {
+	c.AbortWithStatusJSON(status, &api.ErrorResponse{Code: code, Error: message})
+}
@@ -0,0 +1,21 @@
+//
+// export_test.go
+//
+
+package app
+
+import "time"
+
+// SetNow replaces the clock used to issue and check url expiry
+func (s *URLSigner) SetNow(now func() time.Time) {
+	s.now = now
+}
+
+// SetJWKSNow replaces the clock of a JWKS authenticator, used to check
+// tokens and to space out reloads of its file
+func SetJWKSNow(auth Authenticator, now func() time.Time) {
+	a := auth.(*jwtAuth)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.now = now
+}
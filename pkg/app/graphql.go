@@ -0,0 +1,550 @@
+//
+// graphql.go
+//
+
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/glog"
+	"github.com/graphql-go/graphql"
+
+	"WardrobeManagerMS/pkg/api"
+)
+
+// graphqlRequest is a query sent as JSON, or as query parameters with the
+// variables JSON encoded
+type graphqlRequest struct {
+	Query         string                 `json:"query" form:"query" binding:"required"`
+	OperationName string                 `json:"operationName,omitempty" form:"operationName"`
+	Variables     map[string]interface{} `json:"variables,omitempty" form:"-"`
+}
+
+// graphqlSchema is the read side of the api, built once
+var graphqlSchema = newGraphQLSchema()
+
+type graphqlKey struct{}
+
+// graphqlScope is what the resolvers of a request share, the service acting
+// for the principal and the loaders batching its reads
+type graphqlScope struct {
+	s       *Server
+	ws      api.WardrobeService
+	prefix  string
+	items   *loader
+	outfits *loader
+}
+
+func scopeOf(p graphql.ResolveParams) *graphqlScope {
+	return p.Context.Value(graphqlKey{}).(*graphqlScope)
+}
+
+// the sources of the object types, items, outfits and wears carry the user
+// whose closet they are in
+type (
+	gqlItem struct {
+		user string
+		*api.GetWardrobeResponse
+	}
+	gqlOutfit struct {
+		user string
+		*api.GetOutfitResponse
+	}
+	gqlWear struct {
+		user string
+		*api.GetWearResponse
+	}
+)
+
+// loader batches the reads of a request. Load queues an id and returns a
+// thunk, graphql-go runs the thunks of a level of the query after resolving
+// all of it, so the first one reads every id queued so far with one call per
+// user. Execution is serial, a loader is not safe for concurrent use.
+type loader struct {
+	batch   func(ws api.WardrobeService, user string, ids []string) ([]interface{}, error)
+	ws      api.WardrobeService
+	pending map[string][]string
+	queued  map[string]bool
+	loaded  map[string]interface{}
+	errs    map[string]error
+}
+
+func newLoader(ws api.WardrobeService, batch func(ws api.WardrobeService, user string, ids []string) ([]interface{}, error)) *loader {
+	return &loader{
+		batch:   batch,
+		ws:      ws,
+		pending: make(map[string][]string),
+		queued:  make(map[string]bool),
+		loaded:  make(map[string]interface{}),
+		errs:    make(map[string]error),
+	}
+}
+
+// Load returns a thunk of the value of id in the closet of user, nil when
+// there is no such id
+func (l *loader) Load(user string, id string) func() (interface{}, error) {
+	key := user + "/" + id
+	if !l.queued[key] {
+		l.queued[key] = true
+		l.pending[user] = append(l.pending[user], id)
+	}
+
+	return func() (interface{}, error) {
+		l.flush()
+		if err := l.errs[user]; err != nil {
+			return nil, graphqlError(err)
+		}
+		return l.loaded[key], nil
+	}
+}
+
+// Prime stores a value read by other means, so it is not read again
+func (l *loader) Prime(user string, id string, value interface{}) {
+	key := user + "/" + id
+	l.queued[key] = true
+	l.loaded[key] = value
+}
+
+func (l *loader) flush() {
+	for user, queued := range l.pending {
+		// sibling fields resolve in any order, an id may be primed after
+		// it was queued
+		ids := make([]string, 0, len(queued))
+		for _, id := range queued {
+			if _, ok := l.loaded[user+"/"+id]; !ok {
+				ids = append(ids, id)
+			}
+		}
+		if len(ids) == 0 {
+			continue
+		}
+		values, err := l.batch(l.ws, user, ids)
+		if err != nil {
+			l.errs[user] = err
+			continue
+		}
+		for i, id := range ids {
+			if values[i] != nil {
+				l.loaded[user+"/"+id] = values[i]
+			}
+		}
+	}
+	l.pending = make(map[string][]string)
+}
+
+func loadItems(ws api.WardrobeService, user string, ids []string) ([]interface{}, error) {
+	items, err := ws.GetWardrobes(user, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]interface{}, len(items))
+	for i, item := range items {
+		if item != nil {
+			values[i] = gqlItem{user, item}
+		}
+	}
+	return values, nil
+}
+
+func loadOutfits(ws api.WardrobeService, user string, ids []string) ([]interface{}, error) {
+	outfits, err := ws.GetOutfits(user, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]interface{}, len(outfits))
+	for i, outfit := range outfits {
+		if outfit != nil {
+			values[i] = gqlOutfit{user, outfit}
+		}
+	}
+	return values, nil
+}
+
+// gqlError is an error of the api as graphql reports it, with its code in
+// the extensions
+type gqlError struct {
+	message string
+	code    string
+}
+
+func (e *gqlError) Error() string {
+	return e.message
+}
+
+func (e *gqlError) Extensions() map[string]interface{} {
+	return map[string]interface{}{"code": e.code}
+}
+
+// graphqlError hides the text of internal errors like respondError does
+func graphqlError(err error) error {
+	message := err.Error()
+	if api.ErrorKindOf(err) == api.KindInternal {
+		glog.Errorf("Error resolving graphql query, {err=%v}", err)
+		message = "internal error"
+	}
+	return &gqlError{message: message, code: api.ErrorCodeOf(err)}
+}
+
+func listArgs() graphql.FieldConfigArgument {
+	return graphql.FieldConfigArgument{
+		"limit":  &graphql.ArgumentConfig{Type: graphql.Int, Description: "Page size, 50 by default and 200 at most"},
+		"cursor": &graphql.ArgumentConfig{Type: graphql.String, Description: "The next of the previous page"},
+		"sort":   &graphql.ArgumentConfig{Type: graphql.String, Description: "created, last-worn, likes or description, prefixed with - to reverse"},
+	}
+}
+
+func listArgOptions(p graphql.ResolveParams) api.ListOptions {
+	opts := api.ListOptions{}
+	opts.Limit, _ = p.Args["limit"].(int)
+	opts.Cursor, _ = p.Args["cursor"].(string)
+	opts.Sort, _ = p.Args["sort"].(string)
+	return opts
+}
+
+func newGraphQLSchema() graphql.Schema {
+
+	image := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Image",
+		Description: "An image of an item",
+		Fields: graphql.Fields{
+			"uri": &graphql.Field{Type: graphql.NewNonNull(graphql.String), Description: "Signed url of the image"},
+		},
+	})
+
+	imageField := func(filename func(item gqlItem) string) *graphql.Field {
+		return &graphql.Field{
+			Type: image,
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				item := p.Source.(gqlItem)
+				name := filename(item)
+				if name == "" {
+					return nil, nil
+				}
+				scope := scopeOf(p)
+				return map[string]interface{}{"uri": scope.prefix + scope.s.signer.Sign(item.user, item.Id, name)}, nil
+			},
+		}
+	}
+
+	item := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Item",
+		Fields: graphql.Fields{
+			"id":          &graphql.Field{Type: graphql.NewNonNull(graphql.ID), Resolve: itemField(func(i gqlItem) interface{} { return i.Id })},
+			"description": &graphql.Field{Type: graphql.String, Resolve: itemField(func(i gqlItem) interface{} { return i.Description })},
+			"brand":       &graphql.Field{Type: graphql.String, Resolve: itemField(func(i gqlItem) interface{} { return i.Brand })},
+			"tags":        &graphql.Field{Type: graphql.NewList(graphql.String), Resolve: itemField(func(i gqlItem) interface{} { return i.Tags })},
+			"labelText":   &graphql.Field{Type: graphql.String, Resolve: itemField(func(i gqlItem) interface{} { return i.LabelText })},
+			"imageState":  &graphql.Field{Type: graphql.String, Resolve: itemField(func(i gqlItem) interface{} { return i.ImageState })},
+			"labelState":  &graphql.Field{Type: graphql.String, Description: "pending, sent, completed, failed or timed-out", Resolve: itemField(func(i gqlItem) interface{} { return labelState(i.GetWardrobeResponse) })},
+			"created":     &graphql.Field{Type: graphql.DateTime, Resolve: itemField(func(i gqlItem) interface{} { return i.Created })},
+			"lastWorn":    &graphql.Field{Type: graphql.DateTime, Resolve: itemField(func(i gqlItem) interface{} { return i.LastWorn })},
+			"mainImage":   imageField(func(i gqlItem) string { return i.MainImage }),
+			"labelImage":  imageField(func(i gqlItem) string { return i.LabelImage }),
+		},
+	})
+
+	outfitItem := func(id func(o gqlOutfit) string) *graphql.Field {
+		return &graphql.Field{
+			Type: item,
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				outfit := p.Source.(gqlOutfit)
+				return scopeOf(p).items.Load(outfit.user, id(outfit)), nil
+			},
+		}
+	}
+
+	outfit := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Outfit",
+		Fields: graphql.Fields{
+			"id":           &graphql.Field{Type: graphql.NewNonNull(graphql.ID), Resolve: outfitField(func(o gqlOutfit) interface{} { return o.Id })},
+			"description":  &graphql.Field{Type: graphql.String, Resolve: outfitField(func(o gqlOutfit) interface{} { return o.Description })},
+			"likeCount":    &graphql.Field{Type: graphql.Int, Resolve: outfitField(func(o gqlOutfit) interface{} { return o.LikeCount })},
+			"dislikeCount": &graphql.Field{Type: graphql.Int, Resolve: outfitField(func(o gqlOutfit) interface{} { return o.DislikeCount })},
+			"created":      &graphql.Field{Type: graphql.DateTime, Resolve: outfitField(func(o gqlOutfit) interface{} { return o.Created })},
+			"lastWorn":     &graphql.Field{Type: graphql.DateTime, Resolve: outfitField(func(o gqlOutfit) interface{} { return o.LastWorn })},
+			"top":          outfitItem(func(o gqlOutfit) string { return o.TopId }),
+			"bottom":       outfitItem(func(o gqlOutfit) string { return o.BottomId }),
+			"items": &graphql.Field{
+				Type:        graphql.NewList(item),
+				Description: "The top and bottom",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					o := p.Source.(gqlOutfit)
+					items := scopeOf(p).items
+					return []interface{}{items.Load(o.user, o.TopId), items.Load(o.user, o.BottomId)}, nil
+				},
+			},
+		},
+	})
+
+	wear := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Wear",
+		Fields: graphql.Fields{
+			"id":   &graphql.Field{Type: graphql.NewNonNull(graphql.ID), Resolve: wearField(func(w gqlWear) interface{} { return w.Id })},
+			"worn": &graphql.Field{Type: graphql.DateTime, Resolve: wearField(func(w gqlWear) interface{} { return w.Worn })},
+			"outfit": &graphql.Field{
+				Type: outfit,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					w := p.Source.(gqlWear)
+					if w.Outfit == "" {
+						return nil, nil
+					}
+					return scopeOf(p).outfits.Load(w.user, w.Outfit), nil
+				},
+			},
+			"items": &graphql.Field{
+				Type: graphql.NewList(item),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					w := p.Source.(gqlWear)
+					items := make([]interface{}, 0, len(w.Items))
+					for _, id := range w.Items {
+						items = append(items, scopeOf(p).items.Load(w.user, id))
+					}
+					return items, nil
+				},
+			},
+		},
+	})
+
+	itemPage := graphql.NewObject(graphql.ObjectConfig{
+		Name: "ItemPage",
+		Fields: graphql.Fields{
+			"items": &graphql.Field{Type: graphql.NewList(item)},
+			"next":  &graphql.Field{Type: graphql.String, Description: "Cursor of the next page, null on the last page"},
+		},
+	})
+
+	outfitPage := graphql.NewObject(graphql.ObjectConfig{
+		Name: "OutfitPage",
+		Fields: graphql.Fields{
+			"outfits": &graphql.Field{Type: graphql.NewList(outfit)},
+			"next":    &graphql.Field{Type: graphql.String, Description: "Cursor of the next page, null on the last page"},
+		},
+	})
+
+	user := graphql.NewObject(graphql.ObjectConfig{
+		Name: "User",
+		Fields: graphql.Fields{
+			"id":          &graphql.Field{Type: graphql.NewNonNull(graphql.ID), Resolve: userField(func(u *api.GetUserResponse) interface{} { return u.Id })},
+			"username":    &graphql.Field{Type: graphql.NewNonNull(graphql.String), Resolve: userField(func(u *api.GetUserResponse) interface{} { return u.Username })},
+			"displayName": &graphql.Field{Type: graphql.String, Resolve: userField(func(u *api.GetUserResponse) interface{} { return u.DisplayName })},
+			"created":     &graphql.Field{Type: graphql.DateTime, Resolve: userField(func(u *api.GetUserResponse) interface{} { return u.Created })},
+			"items": &graphql.Field{
+				Type: itemPage,
+				Args: listArgs(),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					username := p.Source.(*api.GetUserResponse).Username
+					scope := scopeOf(p)
+					page, err := scope.ws.GetAllWardrobe(username, listArgOptions(p))
+					if err != nil {
+						return nil, graphqlError(err)
+					}
+					items := make([]interface{}, 0, len(page.Items))
+					for _, ward := range page.Items {
+						i := gqlItem{username, ward}
+						scope.items.Prime(username, ward.Id, i)
+						items = append(items, i)
+					}
+					return map[string]interface{}{"items": items, "next": nullable(page.Next)}, nil
+				},
+			},
+			"outfits": &graphql.Field{
+				Type: outfitPage,
+				Args: listArgs(),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					username := p.Source.(*api.GetUserResponse).Username
+					scope := scopeOf(p)
+					page, err := scope.ws.GetAllOutfits(username, listArgOptions(p))
+					if err != nil {
+						return nil, graphqlError(err)
+					}
+					outfits := make([]interface{}, 0, len(page.Outfits))
+					for _, ot := range page.Outfits {
+						o := gqlOutfit{username, ot}
+						scope.outfits.Prime(username, ot.Id, o)
+						outfits = append(outfits, o)
+					}
+					return map[string]interface{}{"outfits": outfits, "next": nullable(page.Next)}, nil
+				},
+			},
+			"wears": &graphql.Field{
+				Type:        graphql.NewList(wear),
+				Description: "What was worn, last first",
+				Args: graphql.FieldConfigArgument{
+					"limit": &graphql.ArgumentConfig{Type: graphql.Int, Description: "Number of wears, all of them by default"},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					username := p.Source.(*api.GetUserResponse).Username
+					limit, _ := p.Args["limit"].(int)
+					found, err := scopeOf(p).ws.GetWears(username, limit)
+					if err != nil {
+						return nil, graphqlError(err)
+					}
+					wears := make([]interface{}, 0, len(found))
+					for _, w := range found {
+						wears = append(wears, gqlWear{username, w})
+					}
+					return wears, nil
+				},
+			},
+		},
+	})
+
+	searchHit := graphql.NewObject(graphql.ObjectConfig{
+		Name: "SearchHit",
+		Fields: graphql.Fields{
+			"item":   &graphql.Field{Type: item},
+			"score":  &graphql.Field{Type: graphql.Float},
+			"fields": &graphql.Field{Type: graphql.NewList(graphql.String), Description: "Where the item matched"},
+		},
+	})
+
+	closetArgs := func(args graphql.FieldConfigArgument) graphql.FieldConfigArgument {
+		args["username"] = &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)}
+		return args
+	}
+
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"user": &graphql.Field{
+				Type: user,
+				Args: closetArgs(graphql.FieldConfigArgument{}),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					found, err := scopeOf(p).ws.GetUser(p.Args["username"].(string))
+					if err != nil {
+						return nil, graphqlError(err)
+					}
+					return found, nil
+				},
+			},
+			"item": &graphql.Field{
+				Type: item,
+				Args: closetArgs(graphql.FieldConfigArgument{"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)}}),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return scopeOf(p).items.Load(p.Args["username"].(string), p.Args["id"].(string)), nil
+				},
+			},
+			"outfit": &graphql.Field{
+				Type: outfit,
+				Args: closetArgs(graphql.FieldConfigArgument{"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)}}),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return scopeOf(p).outfits.Load(p.Args["username"].(string), p.Args["id"].(string)), nil
+				},
+			},
+			"search": &graphql.Field{
+				Type:        graphql.NewList(searchHit),
+				Description: "Search items by description, brand, tags and label text",
+				Args: closetArgs(graphql.FieldConfigArgument{
+					"q":     &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String), Description: "Words to look for, all must match"},
+					"limit": &graphql.ArgumentConfig{Type: graphql.Int, Description: "Number of hits, 50 by default and 200 at most"},
+				}),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					username := p.Args["username"].(string)
+					limit, _ := p.Args["limit"].(int)
+					scope := scopeOf(p)
+					found, err := scope.ws.Search(username, p.Args["q"].(string), limit)
+					if err != nil {
+						return nil, graphqlError(err)
+					}
+					hits := make([]interface{}, 0, len(found))
+					for _, hit := range found {
+						i := gqlItem{username, hit.Item}
+						scope.items.Prime(username, hit.Item.Id, i)
+						hits = append(hits, map[string]interface{}{"item": i, "score": hit.Score, "fields": hit.Fields})
+					}
+					return hits, nil
+				},
+			},
+		},
+	})
+
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{Query: query})
+	if err != nil {
+		panic(err)
+	}
+	return schema
+}
+
+func itemField(f func(item gqlItem) interface{}) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (interface{}, error) {
+		return f(p.Source.(gqlItem)), nil
+	}
+}
+
+// labelState is the state of the label to text job of an item, null for
+// items from before jobs were tracked
+func labelState(item *api.GetWardrobeResponse) interface{} {
+	if item.LabelJob == nil {
+		return nil
+	}
+	return item.LabelJob.State
+}
+
+func outfitField(f func(outfit gqlOutfit) interface{}) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (interface{}, error) {
+		return f(p.Source.(gqlOutfit)), nil
+	}
+}
+
+func wearField(f func(wear gqlWear) interface{}) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (interface{}, error) {
+		return f(p.Source.(gqlWear)), nil
+	}
+}
+
+func userField(f func(user *api.GetUserResponse) interface{}) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (interface{}, error) {
+		return f(p.Source.(*api.GetUserResponse)), nil
+	}
+}
+
+func nullable(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// graphqlQuery runs a query against the service of the principal. Like any
+// graphql endpoint it answers 200 with the errors in the body, only a
+// request without a query is a bad one.
+func (s *Server) graphqlQuery(c *gin.Context) {
+
+	var req graphqlRequest
+	err := c.ShouldBind(&req)
+	if err == nil && c.Request.Method == http.MethodGet && c.Query("variables") != "" {
+		err = json.Unmarshal([]byte(c.Query("variables")), &req.Variables)
+	}
+	if err != nil {
+		glog.Errorf("Error decoding graphql request: {err=%v} ", err)
+		respondError(c, &api.InvalidRequest{Field: "body", Reason: err.Error()})
+		return
+	}
+
+	glog.Infof("graphql query {operation=%s}", req.OperationName)
+
+	ws := s.service(c)
+	scope := &graphqlScope{
+		s:       s,
+		ws:      ws,
+		prefix:  apiPrefix(c),
+		items:   newLoader(ws, loadItems),
+		outfits: newLoader(ws, loadOutfits),
+	}
+
+	result := graphql.Do(graphql.Params{
+		Schema:         graphqlSchema,
+		RequestString:  req.Query,
+		VariableValues: req.Variables,
+		OperationName:  req.OperationName,
+		Context:        context.WithValue(c.Request.Context(), graphqlKey{}, scope),
+	})
+
+	c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,573 @@
+//
+// grpc.go
+//
+
+package app
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/textproto"
+
+	"github.com/golang/glog"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	"WardrobeManagerMS/pkg/api"
+	"WardrobeManagerMS/pkg/rpc"
+)
+
+const grpcPort = "57402"
+
+// imageChunkSize is the size of the chunks images are streamed in
+const imageChunkSize = 64 << 10
+
+// uploadMemory is how much of an upload is held in memory, the rest is
+// spooled to temporary files as gin does for forms
+const uploadMemory = 32 << 20
+
+// publicMethods need no credentials, share links are their own
+// authorization
+var publicMethods = map[string]bool{
+	"/wardrobe.v1.Wardrobe/GetLook":      true,
+	"/wardrobe.v1.Wardrobe/GetLookImage": true,
+}
+
+var kindCode = map[api.ErrorKind]codes.Code{
+	api.KindNotFound:    codes.NotFound,
+	api.KindConflict:    codes.AlreadyExists,
+	api.KindValidation:  codes.InvalidArgument,
+	api.KindUnavailable: codes.Unavailable,
+	api.KindForbidden:   codes.PermissionDenied,
+	api.KindInternal:    codes.Internal,
+}
+
+type principalContextKey struct{}
+
+// grpcServer serves the WardrobeService of a Server over gRPC, with the
+// same authenticators
+type grpcServer struct {
+	rpc.UnimplementedWardrobeServer
+	s *Server
+}
+
+// GRPCServer returns a gRPC server of the service and authenticators the
+// REST api is served with
+func (s *Server) GRPCServer(opts ...grpc.ServerOption) *grpc.Server {
+	opts = append(opts,
+		grpc.ChainUnaryInterceptor(s.unaryAuthenticate),
+		grpc.ChainStreamInterceptor(s.streamAuthenticate))
+
+	g := grpc.NewServer(opts...)
+	rpc.RegisterWardrobeServer(g, &grpcServer{s: s})
+	return g
+}
+
+func (s *Server) RunGRPC() error {
+
+	lis, err := net.Listen("tcp", ":"+grpcPort)
+	if err != nil {
+		glog.Errorf("Server - there was an error listening for gRPC: %v", err)
+		return err
+	}
+
+	err = s.GRPCServer().Serve(lis)
+	if err != nil {
+		glog.Errorf("Server - there was an error serving gRPC: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// grpcAuthenticate runs the authenticators on the credentials in the
+// metadata of ctx, they are sent as the http headers would be
+func (s *Server) grpcAuthenticate(ctx context.Context, method string) (context.Context, error) {
+
+	if publicMethods[method] {
+		return ctx, nil
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	r := &http.Request{Header: make(http.Header)}
+	for _, key := range []string{"authorization", "x-api-key"} {
+		for _, value := range md.Get(key) {
+			r.Header.Add(key, value)
+		}
+	}
+
+	for _, auth := range s.auth {
+		p, err := auth.Authenticate(r)
+		if err == errNoCredentials {
+			continue
+		}
+		if err != nil {
+			glog.Errorf("Authentication failed {method=%s}, {err=%v}", method, err)
+			return nil, status.Error(codes.Unauthenticated, "invalid credentials")
+		}
+
+		if p == nil {
+			return ctx, nil
+		}
+		return context.WithValue(ctx, principalContextKey{}, p), nil
+	}
+
+	return nil, status.Error(codes.Unauthenticated, "authentication required")
+}
+
+func (s *Server) unaryAuthenticate(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, err := s.grpcAuthenticate(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (s *Server) streamAuthenticate(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := s.grpcAuthenticate(ss.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	return handler(srv, &authenticatedStream{ServerStream: ss, ctx: ctx})
+}
+
+// authenticatedStream carries the principal in its context
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (a *authenticatedStream) Context() context.Context {
+	return a.ctx
+}
+
+// service is the WardrobeService acting on behalf of the principal of ctx
+func (g *grpcServer) service(ctx context.Context) api.WardrobeService {
+	p, _ := ctx.Value(principalContextKey{}).(*Principal)
+	if p == nil || p.Admin {
+		return g.s.ws
+	}
+	return g.s.ws.As(p.User)
+}
+
+// grpcError is the status of err, with its code as the reason of an
+// ErrorInfo. Internal errors are logged, their text is not sent.
+func grpcError(method string, err error) error {
+	code := kindCode[api.ErrorKindOf(err)]
+
+	message := err.Error()
+	if code == codes.Internal {
+		glog.Errorf("Error in %s, {err=%v}", method, err)
+		message = "internal error"
+	}
+
+	st, derr := status.New(code, message).WithDetails(&errdetails.ErrorInfo{
+		Reason: api.ErrorCodeOf(err),
+		Domain: "wardrobe",
+	})
+	if derr != nil {
+		return status.Error(code, message)
+	}
+	return st.Err()
+}
+
+// AddWardrobe reads the item and its images as a multipart form, the
+// service takes them as uploaded with the REST api
+func (g *grpcServer) AddWardrobe(stream rpc.Wardrobe_AddWardrobeServer) error {
+
+	first, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	item := first.GetItem()
+	if item == nil {
+		return grpcError("AddWardrobe", &api.InvalidRequest{Field: "item", Reason: "the item must be sent first"})
+	}
+
+	pr, pw := io.Pipe()
+	form := multipart.NewWriter(pw)
+	go func() {
+		pw.CloseWithError(writeUpload(stream, form, item))
+	}()
+
+	parts, err := multipart.NewReader(pr, form.Boundary()).ReadForm(uploadMemory)
+	pr.CloseWithError(err)
+	if err != nil {
+		if api.ErrorKindOf(err) == api.KindInternal {
+			err = &api.InvalidRequest{Field: "image", Reason: err.Error()}
+		}
+		return grpcError("AddWardrobe", err)
+	}
+	defer parts.RemoveAll()
+
+	newWd := api.NewWardrobeRequest{
+		User:        item.User,
+		Description: item.Description,
+		Brand:       item.Brand,
+		Tags:        item.Tags,
+	}
+	if files := parts.File["main-image"]; len(files) == 1 {
+		newWd.MainImageMime = files[0]
+	}
+	if files := parts.File["label-image"]; len(files) == 1 {
+		newWd.LabelImageMime = files[0]
+	}
+	if newWd.Description == "" || newWd.MainImageMime == nil || newWd.LabelImageMime == nil {
+		return grpcError("AddWardrobe", &api.InvalidRequest{Field: "item", Reason: "description, photo and label are required"})
+	}
+
+	glog.Infof("add wardrobe over gRPC for {user=%s}", item.User)
+
+	err = g.service(stream.Context()).AddWardrobe(newWd)
+	if err != nil {
+		return grpcError("AddWardrobe", err)
+	}
+
+	return stream.SendAndClose(&emptypb.Empty{})
+}
+
+// writeUpload writes the photo chunks and then the label chunks of stream
+// as the parts of form
+func writeUpload(stream rpc.Wardrobe_AddWardrobeServer, form *multipart.Writer, item *rpc.NewItem) error {
+
+	var part io.Writer
+	current := ""
+
+	for {
+		msg, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		field, header, data := "main-image", item.Main, msg.GetMain()
+		if _, ok := msg.Part.(*rpc.AddWardrobeRequest_Label); ok {
+			field, header, data = "label-image", item.Label, msg.GetLabel()
+		} else if _, ok := msg.Part.(*rpc.AddWardrobeRequest_Main); !ok {
+			return &api.InvalidRequest{Field: "item", Reason: "the item must be sent once"}
+		}
+
+		if field != current {
+			if current == "label-image" {
+				return &api.InvalidRequest{Field: "image", Reason: "the photo must be sent before the label"}
+			}
+			part, err = form.CreatePart(uploadHeader(field, header))
+			if err != nil {
+				return err
+			}
+			current = field
+		}
+
+		if _, err := part.Write(data); err != nil {
+			return err
+		}
+	}
+
+	return form.Close()
+}
+
+func uploadHeader(field string, header *rpc.ImageHeader) textproto.MIMEHeader {
+	filename := field
+	if header.GetFilename() != "" {
+		filename = header.GetFilename()
+	}
+
+	h := make(textproto.MIMEHeader)
+	h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`, field, filename))
+	if header.GetContentType() != "" {
+		h.Set("Content-Type", header.GetContentType())
+	}
+	return h
+}
+
+func (g *grpcServer) GetWardrobe(ctx context.Context, req *rpc.ItemRequest) (*rpc.Item, error) {
+	ward, err := g.service(ctx).GetWardrobe(req.User, req.Id)
+	if err != nil {
+		return nil, grpcError("GetWardrobe", err)
+	}
+	return itemMessage(ward), nil
+}
+
+func (g *grpcServer) GetAllWardrobe(ctx context.Context, req *rpc.ListRequest) (*rpc.ItemPage, error) {
+	page, err := g.service(ctx).GetAllWardrobe(req.User, listRequestOptions(req))
+	if err != nil {
+		return nil, grpcError("GetAllWardrobe", err)
+	}
+
+	resp := &rpc.ItemPage{Next: page.Next}
+	for _, ward := range page.Items {
+		resp.Items = append(resp.Items, itemMessage(ward))
+	}
+	return resp, nil
+}
+
+func (g *grpcServer) DeleteWardrobe(ctx context.Context, req *rpc.ItemRequest) (*emptypb.Empty, error) {
+	err := g.service(ctx).DeleteWardrobe(req.User, req.Id)
+	if err != nil {
+		return nil, grpcError("DeleteWardrobe", err)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (g *grpcServer) GetImage(req *rpc.ImageRequest, stream rpc.Wardrobe_GetImageServer) error {
+	err := g.service(stream.Context()).GetImage(req.User, req.Id, req.Filename, sendImage(stream))
+	if err != nil {
+		return grpcError("GetImage", err)
+	}
+	return nil
+}
+
+// imageStream is a stream of image chunks, of an item or a look
+type imageStream interface {
+	Send(*rpc.ImageChunk) error
+}
+
+// sendImage streams the info of an image and then its content
+func sendImage(stream imageStream) api.HandleImage {
+	return func(content io.ReadSeeker, meta api.ImageMeta) error {
+
+		err := stream.Send(&rpc.ImageChunk{Part: &rpc.ImageChunk_Info{Info: imageInfoMessage(meta)}})
+		if err != nil {
+			return err
+		}
+
+		buf := make([]byte, imageChunkSize)
+		for {
+			n, err := content.Read(buf)
+			if n > 0 {
+				if serr := stream.Send(&rpc.ImageChunk{Part: &rpc.ImageChunk_Data{Data: buf[:n]}}); serr != nil {
+					return serr
+				}
+			}
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (g *grpcServer) GetUsage(ctx context.Context, req *rpc.UserRequest) (*rpc.Usage, error) {
+	usage, err := g.service(ctx).GetUsage(req.User)
+	if err != nil {
+		return nil, grpcError("GetUsage", err)
+	}
+	return &rpc.Usage{
+		Items:         int32(usage.Items),
+		MaxItems:      int32(usage.MaxItems),
+		ImageBytes:    usage.ImageBytes,
+		MaxImageBytes: usage.MaxImageBytes,
+	}, nil
+}
+
+func (g *grpcServer) Search(ctx context.Context, req *rpc.SearchRequest) (*rpc.SearchResponse, error) {
+	hits, err := g.service(ctx).Search(req.User, req.Query, int(req.Limit))
+	if err != nil {
+		return nil, grpcError("Search", err)
+	}
+
+	resp := &rpc.SearchResponse{}
+	for _, hit := range hits {
+		resp.Hits = append(resp.Hits, &rpc.SearchHit{Item: itemMessage(hit.Item), Score: hit.Score, Fields: hit.Fields})
+	}
+	return resp, nil
+}
+
+func (g *grpcServer) RegisterUser(ctx context.Context, req *rpc.NewUserRequest) (*rpc.User, error) {
+	if req.Username == "" {
+		return nil, grpcError("RegisterUser", &api.InvalidRequest{Field: "username", Reason: "username is required"})
+	}
+
+	user, err := g.service(ctx).RegisterUser(api.NewUserRequest{
+		Username:    req.Username,
+		DisplayName: req.DisplayName,
+		Preferences: req.Preferences,
+	})
+	if err != nil {
+		return nil, grpcError("RegisterUser", err)
+	}
+	return userMessage(user), nil
+}
+
+func (g *grpcServer) GetUser(ctx context.Context, req *rpc.UserRequest) (*rpc.User, error) {
+	user, err := g.service(ctx).GetUser(req.User)
+	if err != nil {
+		return nil, grpcError("GetUser", err)
+	}
+	return userMessage(user), nil
+}
+
+func (g *grpcServer) UpdateUser(ctx context.Context, req *rpc.UpdateUserRequest) (*rpc.User, error) {
+	user, err := g.service(ctx).UpdateUser(req.User, api.UpdateUserRequest{
+		Username:    req.Username,
+		DisplayName: req.DisplayName,
+		Preferences: req.Preferences,
+	})
+	if err != nil {
+		return nil, grpcError("UpdateUser", err)
+	}
+	return userMessage(user), nil
+}
+
+func (g *grpcServer) DeleteUser(ctx context.Context, req *rpc.UserRequest) (*emptypb.Empty, error) {
+	err := g.service(ctx).DeleteUser(req.User)
+	if err != nil {
+		return nil, grpcError("DeleteUser", err)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (g *grpcServer) ShareCloset(ctx context.Context, req *rpc.ShareRequest) (*rpc.Share, error) {
+	share, err := g.service(ctx).ShareCloset(req.User, api.NewShareRequest{User: req.Grantee, Role: api.Role(req.Role)})
+	if err != nil {
+		return nil, grpcError("ShareCloset", err)
+	}
+	return shareMessage(share), nil
+}
+
+func (g *grpcServer) AcceptShare(ctx context.Context, req *rpc.ShareOwnerRequest) (*emptypb.Empty, error) {
+	err := g.service(ctx).AcceptShare(req.User, req.Owner)
+	if err != nil {
+		return nil, grpcError("AcceptShare", err)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (g *grpcServer) RevokeShare(ctx context.Context, req *rpc.RevokeShareRequest) (*emptypb.Empty, error) {
+	err := g.service(ctx).RevokeShare(req.User, req.Grantee)
+	if err != nil {
+		return nil, grpcError("RevokeShare", err)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (g *grpcServer) GetShares(ctx context.Context, req *rpc.UserRequest) (*rpc.ShareList, error) {
+	shares, err := g.service(ctx).GetShares(req.User)
+	if err != nil {
+		return nil, grpcError("GetShares", err)
+	}
+	return shareListMessage(shares), nil
+}
+
+func (g *grpcServer) GetSharedWithMe(ctx context.Context, req *rpc.UserRequest) (*rpc.ShareList, error) {
+	shares, err := g.service(ctx).GetSharedWithMe(req.User)
+	if err != nil {
+		return nil, grpcError("GetSharedWithMe", err)
+	}
+	return shareListMessage(shares), nil
+}
+
+func (g *grpcServer) CreateShareLink(ctx context.Context, req *rpc.NewShareLinkRequest) (*rpc.ShareLink, error) {
+	link, err := g.service(ctx).CreateShareLink(req.User, api.NewShareLinkRequest{
+		Outfit:  req.Outfit,
+		Items:   req.Items,
+		Expires: timeOf(req.Expires),
+	})
+	if err != nil {
+		return nil, grpcError("CreateShareLink", err)
+	}
+	return shareLinkMessage(link), nil
+}
+
+func (g *grpcServer) GetShareLinks(ctx context.Context, req *rpc.UserRequest) (*rpc.ShareLinkList, error) {
+	links, err := g.service(ctx).GetShareLinks(req.User)
+	if err != nil {
+		return nil, grpcError("GetShareLinks", err)
+	}
+
+	resp := &rpc.ShareLinkList{}
+	for _, link := range links {
+		resp.Links = append(resp.Links, shareLinkMessage(link))
+	}
+	return resp, nil
+}
+
+func (g *grpcServer) RevokeShareLink(ctx context.Context, req *rpc.LinkRequest) (*emptypb.Empty, error) {
+	err := g.service(ctx).RevokeShareLink(req.User, req.Id)
+	if err != nil {
+		return nil, grpcError("RevokeShareLink", err)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (g *grpcServer) GetLook(ctx context.Context, req *rpc.LookRequest) (*rpc.Look, error) {
+	look, err := g.s.ws.GetLook(req.Token)
+	if err != nil {
+		return nil, grpcError("GetLook", err)
+	}
+
+	resp := &rpc.Look{Expires: timestampOf(look.Expires)}
+	if look.Outfit != nil {
+		resp.Outfit = outfitMessage(look.Outfit)
+	}
+	for _, ward := range look.Items {
+		resp.Items = append(resp.Items, itemMessage(ward))
+	}
+	return resp, nil
+}
+
+func (g *grpcServer) GetLookImage(req *rpc.LookImageRequest, stream rpc.Wardrobe_GetLookImageServer) error {
+	err := g.s.ws.GetLookImage(req.Token, req.Filename, sendImage(stream))
+	if err != nil {
+		return grpcError("GetLookImage", err)
+	}
+	return nil
+}
+
+func (g *grpcServer) AddOutfit(ctx context.Context, req *rpc.NewOutfitRequest) (*emptypb.Empty, error) {
+	if req.TopId == "" || req.BottomId == "" || req.Description == "" {
+		return nil, grpcError("AddOutfit", &api.InvalidRequest{Field: "outfit", Reason: "top, bottom and description are required"})
+	}
+
+	err := g.service(ctx).AddOutfit(api.NewOutfitRequest{
+		User:        req.User,
+		TopId:       req.TopId,
+		BottomId:    req.BottomId,
+		Description: req.Description,
+	})
+	if err != nil {
+		return nil, grpcError("AddOutfit", err)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (g *grpcServer) DeleteOutfit(ctx context.Context, req *rpc.OutfitRequest) (*emptypb.Empty, error) {
+	err := g.service(ctx).DeleteOutfit(req.User, req.Id)
+	if err != nil {
+		return nil, grpcError("DeleteOutfit", err)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (g *grpcServer) GetOutfit(ctx context.Context, req *rpc.OutfitRequest) (*rpc.Outfit, error) {
+	outfit, err := g.service(ctx).GetOutfit(req.User, req.Id)
+	if err != nil {
+		return nil, grpcError("GetOutfit", err)
+	}
+	return outfitMessage(outfit), nil
+}
+
+func (g *grpcServer) GetAllOutfits(ctx context.Context, req *rpc.ListRequest) (*rpc.OutfitPage, error) {
+	page, err := g.service(ctx).GetAllOutfits(req.User, listRequestOptions(req))
+	if err != nil {
+		return nil, grpcError("GetAllOutfits", err)
+	}
+
+	resp := &rpc.OutfitPage{Next: page.Next}
+	for _, outfit := range page.Outfits {
+		resp.Outfits = append(resp.Outfits, outfitMessage(outfit))
+	}
+	return resp, nil
+}
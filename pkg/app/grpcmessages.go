@@ -0,0 +1,115 @@
+//
+// grpcmessages.go
+//
+
+package app
+
+import (
+	"time"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"WardrobeManagerMS/pkg/api"
+	"WardrobeManagerMS/pkg/rpc"
+)
+
+func timestampOf(t *time.Time) *timestamppb.Timestamp {
+	if t == nil {
+		return nil
+	}
+	return timestamppb.New(*t)
+}
+
+func timeOf(ts *timestamppb.Timestamp) *time.Time {
+	if ts == nil {
+		return nil
+	}
+	t := ts.AsTime()
+	return &t
+}
+
+func listRequestOptions(req *rpc.ListRequest) api.ListOptions {
+	return api.ListOptions{
+		Limit:  int(req.Limit),
+		Cursor: req.Cursor,
+		Sort:   req.Sort,
+		Filter: req.Filter,
+	}
+}
+
+// itemMessage carries the file names of the images, GetImage streams them
+func itemMessage(ward *api.GetWardrobeResponse) *rpc.Item {
+	return &rpc.Item{
+		Id:          ward.Id,
+		Description: ward.Description,
+		MainImage:   ward.MainImage,
+		LabelImage:  ward.LabelImage,
+		ImageState:  ward.ImageState,
+		LabelText:   ward.LabelText,
+		Brand:       ward.Brand,
+		Tags:        ward.Tags,
+		Created:     timestampOf(ward.Created),
+		LastWorn:    timestampOf(ward.LastWorn),
+	}
+}
+
+func imageInfoMessage(meta api.ImageMeta) *rpc.ImageInfo {
+	return &rpc.ImageInfo{
+		Name:    meta.Name,
+		Size:    meta.Size,
+		Sha256:  meta.Sum,
+		ModTime: timestamppb.New(meta.ModTime),
+	}
+}
+
+func userMessage(user *api.GetUserResponse) *rpc.User {
+	return &rpc.User{
+		Id:          user.Id,
+		Username:    user.Username,
+		DisplayName: user.DisplayName,
+		Preferences: user.Preferences,
+		Created:     timestamppb.New(user.Created),
+	}
+}
+
+func shareMessage(share *api.GetShareResponse) *rpc.Share {
+	return &rpc.Share{
+		Owner:    share.Owner,
+		User:     share.User,
+		Role:     string(share.Role),
+		Accepted: share.Accepted,
+		Created:  timestamppb.New(share.Created),
+	}
+}
+
+func shareListMessage(shares []*api.GetShareResponse) *rpc.ShareList {
+	list := &rpc.ShareList{}
+	for _, share := range shares {
+		list.Shares = append(list.Shares, shareMessage(share))
+	}
+	return list
+}
+
+func shareLinkMessage(link *api.GetShareLinkResponse) *rpc.ShareLink {
+	return &rpc.ShareLink{
+		Id:      link.Id,
+		Token:   link.Token,
+		Outfit:  link.Outfit,
+		Items:   link.Items,
+		Expires: timestampOf(link.Expires),
+		Created: timestamppb.New(link.Created),
+	}
+}
+
+func outfitMessage(outfit *api.GetOutfitResponse) *rpc.Outfit {
+	return &rpc.Outfit{
+		Id:           outfit.Id,
+		TopId:        outfit.TopId,
+		BottomId:     outfit.BottomId,
+		Description:  outfit.Description,
+		LikeCount:    int32(outfit.LikeCount),
+		DislikeCount: int32(outfit.DislikeCount),
+		Created:      timestampOf(outfit.Created),
+		LastWorn:     timestampOf(outfit.LastWorn),
+	}
+}
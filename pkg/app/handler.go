@@ -9,10 +9,15 @@ package app
 import (
 	"bytes"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang/glog"
@@ -27,19 +32,19 @@ func (s *Server) addWardrobe(c *gin.Context) {
 	glog.Infof("add wardrobe for {user=%s}", username)
 
 	var newWd api.NewWardrobeRequest
-	err := c.Bind(&newWd)
+	err := c.ShouldBind(&newWd)
 	if err != nil {
-		glog.Errorf("Error decoding Form : {err=%v} ", username, err)
-		c.String(http.StatusUnprocessableEntity, fmt.Sprintf("error decoding JSON : %s", err))
+		glog.Errorf("Error decoding Form {users=%s}: {err=%v} ", username, err)
+		respondError(c, &api.InvalidRequest{Field: "body", Reason: err.Error()})
 		return
 	}
 	glog.Infof("done Bind for {user=%s}", username)
 
 	newWd.User = username
-	err = s.ws.AddWardrobe(newWd)
+	err = s.service(c).AddWardrobe(newWd)
 	if err != nil {
 		glog.Errorf("Error adding wardrobe, {err=%v} ", err)
-		c.String(http.StatusUnprocessableEntity, fmt.Sprintf("error adding wardrobe: %s", err))
+		respondError(c, err)
 		return
 	}
 
@@ -53,14 +58,52 @@ func (s *Server) getAllWardrobes(c *gin.Context) {
 
 	glog.Infof("Get all wardrobe for {user=%s}", username)
 
-	wards, err := s.ws.GetAllWardrobe(username)
+	opts, err := listOptions(c)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	page, err := s.service(c).GetAllWardrobe(username, opts)
 	if err != nil {
 		glog.Errorf("Error geting all wardrobe, {err=%v} ", err)
-		c.String(http.StatusUnprocessableEntity, fmt.Sprintf("error: %s", err))
+		respondError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, &wards)
+	for _, ward := range page.Items {
+		s.signImages(c, username, ward)
+	}
+
+	setNextLink(c, page.Next)
+	c.JSON(http.StatusOK, &page.Items)
+}
+
+// search answers with the items matching q, best match first
+func (s *Server) search(c *gin.Context) {
+	username := c.Params.ByName("username")
+	query := c.Query("q")
+
+	glog.Infof("Search {user=%s}, {q=%s}", username, query)
+
+	limit, err := queryLimit(c)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	hits, err := s.service(c).Search(username, query, limit)
+	if err != nil {
+		glog.Errorf("Error searching, {err=%v}", err)
+		respondError(c, err)
+		return
+	}
+
+	for _, hit := range hits {
+		s.signImages(c, username, hit.Item)
+	}
+
+	c.JSON(http.StatusOK, &hits)
 }
 
 func (s *Server) getWardrobe(c *gin.Context) {
@@ -69,13 +112,15 @@ func (s *Server) getWardrobe(c *gin.Context) {
 
 	glog.Infof("Get wardrobe for {user=%s}, {wardrobe-id=%s} ", username, wardId)
 
-	wards, err := s.ws.GetWardrobe(username, wardId)
+	wards, err := s.service(c).GetWardrobe(username, wardId)
 	if err != nil {
 		glog.Errorf("Error get wardrobe,{err=%v}", err)
-		c.String(http.StatusUnprocessableEntity, fmt.Sprintf("error: %s", err))
+		respondError(c, err)
 		return
 	}
 
+	s.signImages(c, username, wards)
+
 	c.JSON(http.StatusOK, &wards)
 }
 
@@ -85,35 +130,361 @@ func (s *Server) deleteWardrobe(c *gin.Context) {
 
 	glog.Infof("Delete wardrobe for {user=%s}, {wardrobe-id=%s} ", username, wardId)
 
-	err := s.ws.DeleteWardrobe(username, wardId)
+	err := s.service(c).DeleteWardrobe(username, wardId)
 	if err != nil {
 		glog.Errorf("Error deleting wardrobe, {err=%s}", err)
-		c.String(http.StatusUnprocessableEntity, fmt.Sprintf("error: %s", err))
+		respondError(c, err)
 		return
 	}
 
 	c.String(http.StatusOK, "deleteWardrobe")
 }
 
+func (s *Server) getUsage(c *gin.Context) {
+	username := c.Params.ByName("username")
+
+	glog.Infof("Get usage for {user=%s}", username)
+
+	usage, err := s.service(c).GetUsage(username)
+	if err != nil {
+		glog.Errorf("Error get usage,{err=%v}", err)
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, &usage)
+}
+
+func (s *Server) registerUser(c *gin.Context) {
+
+	var newUser api.NewUserRequest
+	err := c.ShouldBindJSON(&newUser)
+	if err != nil {
+		glog.Errorf("Error decoding JSON : {err=%v} ", err)
+		respondError(c, &api.InvalidRequest{Field: "body", Reason: err.Error()})
+		return
+	}
+
+	glog.Infof("register {user=%s}", newUser.Username)
+
+	user, err := s.service(c).RegisterUser(newUser)
+	if err != nil {
+		glog.Errorf("Error registering user, {err=%v} ", err)
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, &user)
+}
+
+func (s *Server) getUser(c *gin.Context) {
+	username := c.Params.ByName("username")
+
+	glog.Infof("Get {user=%s}", username)
+
+	user, err := s.service(c).GetUser(username)
+	if err != nil {
+		glog.Errorf("Error get user,{err=%v}", err)
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, &user)
+}
+
+func (s *Server) updateUser(c *gin.Context) {
+	username := c.Params.ByName("username")
+
+	glog.Infof("Update {user=%s}", username)
+
+	var update api.UpdateUserRequest
+	err := c.ShouldBindJSON(&update)
+	if err != nil {
+		glog.Errorf("Error decoding JSON {users=%s}: {err=%v} ", username, err)
+		respondError(c, &api.InvalidRequest{Field: "body", Reason: err.Error()})
+		return
+	}
+
+	user, err := s.service(c).UpdateUser(username, update)
+	if err != nil {
+		glog.Errorf("Error updating user, {err=%v} ", err)
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, &user)
+}
+
+func (s *Server) deleteUser(c *gin.Context) {
+	username := c.Params.ByName("username")
+
+	glog.Infof("Delete {user=%s}", username)
+
+	err := s.service(c).DeleteUser(username)
+	if err != nil {
+		glog.Errorf("Error deleting user, {err=%s}", err)
+		respondError(c, err)
+		return
+	}
+
+	c.String(http.StatusOK, "deleteUser")
+}
+
+func (s *Server) shareCloset(c *gin.Context) {
+	username := c.Params.ByName("username")
+
+	var newShare api.NewShareRequest
+	err := c.ShouldBindJSON(&newShare)
+	if err != nil {
+		glog.Errorf("Error decoding JSON {users=%s}: {err=%v} ", username, err)
+		respondError(c, &api.InvalidRequest{Field: "body", Reason: err.Error()})
+		return
+	}
+
+	glog.Infof("Share closet {user=%s}, {with=%s}, {role=%s}", username, newShare.User, newShare.Role)
+
+	share, err := s.service(c).ShareCloset(username, newShare)
+	if err != nil {
+		glog.Errorf("Error sharing closet, {err=%v} ", err)
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, &share)
+}
+
+func (s *Server) getShares(c *gin.Context) {
+	username := c.Params.ByName("username")
+
+	glog.Infof("Get shares {user=%s}", username)
+
+	shares, err := s.service(c).GetShares(username)
+	if err != nil {
+		glog.Errorf("Error get shares, {err=%v}", err)
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, &shares)
+}
+
+func (s *Server) revokeShare(c *gin.Context) {
+	username := c.Params.ByName("username")
+	grantee := c.Params.ByName("grantee")
+
+	glog.Infof("Revoke share {user=%s}, {with=%s}", username, grantee)
+
+	err := s.service(c).RevokeShare(username, grantee)
+	if err != nil {
+		glog.Errorf("Error revoking share, {err=%v}", err)
+		respondError(c, err)
+		return
+	}
+
+	c.String(http.StatusOK, "revokeShare")
+}
+
+func (s *Server) getSharedWithMe(c *gin.Context) {
+	username := c.Params.ByName("username")
+
+	glog.Infof("Get closets shared with {user=%s}", username)
+
+	shares, err := s.service(c).GetSharedWithMe(username)
+	if err != nil {
+		glog.Errorf("Error get shared closets, {err=%v}", err)
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, &shares)
+}
+
+func (s *Server) acceptShare(c *gin.Context) {
+	username := c.Params.ByName("username")
+	owner := c.Params.ByName("owner")
+
+	glog.Infof("Accept share {user=%s}, {owner=%s}", username, owner)
+
+	err := s.service(c).AcceptShare(username, owner)
+	if err != nil {
+		glog.Errorf("Error accepting share, {err=%v}", err)
+		respondError(c, err)
+		return
+	}
+
+	c.String(http.StatusOK, "acceptShare")
+}
+
+func (s *Server) declineShare(c *gin.Context) {
+	username := c.Params.ByName("username")
+	owner := c.Params.ByName("owner")
+
+	glog.Infof("Decline share {user=%s}, {owner=%s}", username, owner)
+
+	err := s.service(c).RevokeShare(owner, username)
+	if err != nil {
+		glog.Errorf("Error declining share, {err=%v}", err)
+		respondError(c, err)
+		return
+	}
+
+	c.String(http.StatusOK, "declineShare")
+}
+
+// getFile serves an image with a strong ETag from its SHA-256. Ranges and
+// conditional requests are handled by http.ServeContent, whatever the
+// image repository backend. Only signed urls of the owning item are served.
 func (s *Server) getFile(c *gin.Context) {
+	username := c.Params.ByName("username")
+	wardId := c.Params.ByName("id")
 	filename := c.Params.ByName("filename")
 
-	glog.Infof("Get file {filename=%s}", filename)
+	glog.Infof("Get file {user=%s}, {wardrobe-id=%s}, {filename=%s}", username, wardId, filename)
 
-	fileHandler := func(filepath string) error {
+	if !validImageName(filename) {
+		glog.Errorf("Invalid image name {filename=%q}", filename)
+		respondError(c, &api.InvalidRequest{Field: "filename", Reason: "not an image name"})
+		return
+	}
+
+	err := s.signer.Verify(username, wardId, filename, c.Query("expires"), c.Query("signature"))
+	if err != nil {
+		glog.Errorf("Rejected image url {filename=%s}, {err=%v}", filename, err)
+		respondStatus(c, http.StatusForbidden, "invalid-signature", err.Error())
+		return
+	}
+
+	imageHandler := func(content io.ReadSeeker, meta api.ImageMeta) error {
+
+		if meta.Pinned {
+			c.Header("Cache-Control", "private, max-age=31536000, immutable")
+		} else {
+			c.Header("Cache-Control", "private, no-cache")
+		}
 
-		c.File(filepath)
+		serveImage(c, content, meta)
 
 		return nil
 	}
 
-	err := s.ws.GetFile(filename, fileHandler)
+	err = s.ws.GetImage(username, wardId, filename, imageHandler)
 	if err != nil {
 		glog.Errorf("Error retrieving file, {err=%s}", err)
-		c.String(http.StatusInternalServerError, fmt.Sprintf("error: %s", err))
+		respondError(c, err)
+		return
+	}
+
+}
+
+func (s *Server) createShareLink(c *gin.Context) {
+	username := c.Params.ByName("username")
+
+	var newLink api.NewShareLinkRequest
+	err := c.ShouldBindJSON(&newLink)
+	if err != nil {
+		glog.Errorf("Error decoding JSON {users=%s}: {err=%v} ", username, err)
+		respondError(c, &api.InvalidRequest{Field: "body", Reason: err.Error()})
+		return
+	}
+
+	glog.Infof("Create share link {user=%s}", username)
+
+	link, err := s.service(c).CreateShareLink(username, newLink)
+	if err != nil {
+		glog.Errorf("Error creating share link, {err=%v} ", err)
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, &link)
+}
+
+func (s *Server) getShareLinks(c *gin.Context) {
+	username := c.Params.ByName("username")
+
+	glog.Infof("Get share links {user=%s}", username)
+
+	links, err := s.service(c).GetShareLinks(username)
+	if err != nil {
+		glog.Errorf("Error get share links, {err=%v}", err)
+		respondError(c, err)
 		return
 	}
 
+	c.JSON(http.StatusOK, &links)
+}
+
+func (s *Server) revokeShareLink(c *gin.Context) {
+	username := c.Params.ByName("username")
+	linkId := c.Params.ByName("id")
+
+	glog.Infof("Revoke share link {user=%s}, {link=%s}", username, linkId)
+
+	err := s.service(c).RevokeShareLink(username, linkId)
+	if err != nil {
+		glog.Errorf("Error revoking share link, {err=%v}", err)
+		respondError(c, err)
+		return
+	}
+
+	c.String(http.StatusOK, "revokeShareLink")
+}
+
+// getLook is the public view of a share link, the token is never logged
+func (s *Server) getLook(c *gin.Context) {
+	token := c.Params.ByName("token")
+
+	look, err := s.ws.GetLook(token)
+	if err != nil {
+		glog.Errorf("Error get look, {err=%v}", err)
+		respondError(c, err)
+		return
+	}
+
+	for _, ward := range look.Items {
+		ward.MainImage = lookImageURI(apiPrefix(c), token, ward.MainImage)
+		ward.LabelImage = lookImageURI(apiPrefix(c), token, ward.LabelImage)
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, &look)
+}
+
+// getLookImage serves images of a share link, revalidated on every use as
+// the link can be revoked
+func (s *Server) getLookImage(c *gin.Context) {
+	token := c.Params.ByName("token")
+	filename := c.Params.ByName("filename")
+
+	if !validImageName(filename) {
+		respondError(c, &api.InvalidRequest{Field: "filename", Reason: "not an image name"})
+		return
+	}
+
+	err := s.ws.GetLookImage(token, filename, func(content io.ReadSeeker, meta api.ImageMeta) error {
+		c.Header("Cache-Control", "no-cache")
+		serveImage(c, content, meta)
+		return nil
+	})
+	if err != nil {
+		glog.Errorf("Error retrieving look image {filename=%s}, {err=%v}", filename, err)
+		respondError(c, err)
+		return
+	}
+}
+
+// serveImage answers with content, conditional and range requests
+// included, under a strong ETag from its SHA-256
+func serveImage(c *gin.Context, content io.ReadSeeker, meta api.ImageMeta) {
+	c.Header("ETag", "\""+meta.Sum+"\"")
+	http.ServeContent(c.Writer, c.Request, meta.Name, meta.ModTime, content)
+}
+
+func lookImageURI(prefix string, token string, filename string) string {
+	if filename == "" {
+		return ""
+	}
+	return prefix + "/looks/" + url.PathEscape(token) + "/images/" + url.PathEscape(filename)
 }
 
 func (s *Server) addOutfit(c *gin.Context) {
@@ -123,19 +494,19 @@ func (s *Server) addOutfit(c *gin.Context) {
 	glog.Infof("add outfit for {user=%s}", username)
 
 	var newOt api.NewOutfitRequest
-	err := c.BindJSON(&newOt)
+	err := c.ShouldBindJSON(&newOt)
 	if err != nil {
 		glog.Errorf("Error decoding Form {users=%s}: {err=%v} ", username, err)
-		c.String(http.StatusUnprocessableEntity, fmt.Sprintf("error decoding JSON : %s", err))
+		respondError(c, &api.InvalidRequest{Field: "body", Reason: err.Error()})
 		return
 	}
 	glog.Infof("done Bind for {user=%s}", username)
 
 	newOt.User = username
-	err = s.ws.AddOutfit(newOt)
+	err = s.service(c).AddOutfit(newOt)
 	if err != nil {
 		glog.Errorf("Error adding outfit, {err=%v} ", err)
-		c.String(http.StatusUnprocessableEntity, fmt.Sprintf("error adding outfit: %s", err))
+		respondError(c, err)
 		return
 	}
 
@@ -149,14 +520,21 @@ func (s *Server) getAllOutfits(c *gin.Context) {
 
 	glog.Infof("Get all outfits for {user=%s}", username)
 
-	outfits, err := s.ws.GetAllOutfits(username)
+	opts, err := listOptions(c)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	page, err := s.service(c).GetAllOutfits(username, opts)
 	if err != nil {
 		glog.Errorf("Error geting all outfits, {err=%v} ", err)
-		c.String(http.StatusUnprocessableEntity, fmt.Sprintf("error: %s", err))
+		respondError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, &outfits)
+	setNextLink(c, page.Next)
+	c.JSON(http.StatusOK, &page.Outfits)
 }
 
 func (s *Server) getOutfit(c *gin.Context) {
@@ -165,10 +543,10 @@ func (s *Server) getOutfit(c *gin.Context) {
 
 	glog.Infof("Get outfit for {user=%s}, {outfit-id=%s} ", username, otId)
 
-	outfit, err := s.ws.GetOutfit(username, otId)
+	outfit, err := s.service(c).GetOutfit(username, otId)
 	if err != nil {
 		glog.Errorf("Error get outfit,{err=%v}", err)
-		c.String(http.StatusUnprocessableEntity, fmt.Sprintf("error: %s", err))
+		respondError(c, err)
 		return
 	}
 
@@ -179,18 +557,301 @@ func (s *Server) deleteOutfit(c *gin.Context) {
 	username := c.Params.ByName("username")
 	otId := c.Params.ByName("id")
 
-	glog.Infof("Delete wardrobe for {user=%s}, {outfit-id=%s} ", username, otId)
+	glog.Infof("Delete outfit for {user=%s}, {outfit-id=%s} ", username, otId)
 
-	err := s.ws.DeleteWardrobe(username, otId)
+	err := s.service(c).DeleteOutfit(username, otId)
 	if err != nil {
 		glog.Errorf("Error deleting outfit, {err=%s}", err)
-		c.String(http.StatusUnprocessableEntity, fmt.Sprintf("error: %s", err))
+		respondError(c, err)
 		return
 	}
 
 	c.String(http.StatusOK, "deleteOutfit")
 }
 
+func (s *Server) reactOutfit(c *gin.Context) {
+	username := c.Params.ByName("username")
+	otId := c.Params.ByName("id")
+
+	var react api.ReactRequest
+	err := c.ShouldBindJSON(&react)
+	if err != nil {
+		glog.Errorf("Error decoding JSON {users=%s}: {err=%v} ", username, err)
+		respondError(c, &api.InvalidRequest{Field: "body", Reason: err.Error()})
+		return
+	}
+
+	glog.Infof("React to outfit {user=%s}, {outfit-id=%s}, {reaction=%s}", username, otId, react.Reaction)
+
+	outfit, err := s.service(c).ReactOutfit(username, otId, react.Reaction)
+	if err != nil {
+		glog.Errorf("Error reacting to outfit, {err=%v}", err)
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, &outfit)
+}
+
+func (s *Server) logWear(c *gin.Context) {
+	username := c.Params.ByName("username")
+
+	var newWear api.NewWearRequest
+	err := c.ShouldBindJSON(&newWear)
+	if err != nil {
+		glog.Errorf("Error decoding JSON {users=%s}: {err=%v} ", username, err)
+		respondError(c, &api.InvalidRequest{Field: "body", Reason: err.Error()})
+		return
+	}
+
+	glog.Infof("Log wear {user=%s}, {outfit=%s}", username, newWear.Outfit)
+
+	newWear.User = username
+	wear, err := s.service(c).LogWear(newWear)
+	if err != nil {
+		glog.Errorf("Error logging wear, {err=%v} ", err)
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, &wear)
+}
+
+func (s *Server) getWears(c *gin.Context) {
+	username := c.Params.ByName("username")
+
+	glog.Infof("Get wears {user=%s}", username)
+
+	limit, err := queryLimit(c)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	wears, err := s.service(c).GetWears(username, limit)
+	if err != nil {
+		glog.Errorf("Error get wears, {err=%v}", err)
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, &wears)
+}
+
+func (s *Server) createWebhook(c *gin.Context) {
+	username := c.Params.ByName("username")
+
+	var newHook api.NewWebhookRequest
+	err := c.ShouldBindJSON(&newHook)
+	if err != nil {
+		glog.Errorf("Error decoding JSON {users=%s}: {err=%v} ", username, err)
+		respondError(c, &api.InvalidRequest{Field: "body", Reason: err.Error()})
+		return
+	}
+
+	glog.Infof("Create webhook {user=%s}", username)
+
+	hook, err := s.service(c).CreateWebhook(username, newHook)
+	if err != nil {
+		glog.Errorf("Error creating webhook, {err=%v} ", err)
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, &hook)
+}
+
+func (s *Server) getWebhooks(c *gin.Context) {
+	username := c.Params.ByName("username")
+
+	glog.Infof("Get webhooks {user=%s}", username)
+
+	hooks, err := s.service(c).GetWebhooks(username)
+	if err != nil {
+		glog.Errorf("Error get webhooks, {err=%v}", err)
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, &hooks)
+}
+
+func (s *Server) deleteWebhook(c *gin.Context) {
+	username := c.Params.ByName("username")
+	hookId := c.Params.ByName("id")
+
+	glog.Infof("Delete webhook {user=%s}, {webhook=%s}", username, hookId)
+
+	err := s.service(c).DeleteWebhook(username, hookId)
+	if err != nil {
+		glog.Errorf("Error deleting webhook, {err=%v}", err)
+		respondError(c, err)
+		return
+	}
+
+	c.String(http.StatusOK, "deleteWebhook")
+}
+
+func (s *Server) getDeliveries(c *gin.Context) {
+	username := c.Params.ByName("username")
+	hookId := c.Params.ByName("id")
+
+	glog.Infof("Get deliveries {user=%s}, {webhook=%s}", username, hookId)
+
+	limit, err := queryLimit(c)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	deliveries, err := s.service(c).GetDeliveries(username, hookId, limit)
+	if err != nil {
+		glog.Errorf("Error get deliveries, {err=%v}", err)
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, &deliveries)
+}
+
+func (s *Server) redeliver(c *gin.Context) {
+	username := c.Params.ByName("username")
+	hookId := c.Params.ByName("id")
+	deliveryId := c.Params.ByName("delivery")
+
+	glog.Infof("Redeliver {user=%s}, {webhook=%s}, {delivery=%s}", username, hookId, deliveryId)
+
+	delivery, err := s.service(c).Redeliver(username, hookId, deliveryId)
+	if err != nil {
+		glog.Errorf("Error redelivering, {err=%v}", err)
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, &delivery)
+}
+
+// eventHeartbeat keeps idle event streams from being cut by proxies
+const eventHeartbeat = 15 * time.Second
+
+// streamEvents sends the events of a closet as server-sent events. Browsers
+// resume with the Last-Event-ID header, other clients may pass lastEventId.
+func (s *Server) streamEvents(c *gin.Context) {
+	username := c.Params.ByName("username")
+
+	lastEventId := c.GetHeader("Last-Event-ID")
+	if lastEventId == "" {
+		lastEventId = c.Query("lastEventId")
+	}
+
+	stream, err := s.service(c).WatchEvents(username, lastEventId)
+	if err != nil {
+		glog.Errorf("Error watching events, {err=%v}", err)
+		respondError(c, err)
+		return
+	}
+	defer stream.Close()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	// without an id, so the client stops resuming from the one it sent
+	if stream.Reset {
+		reset := &api.Event{Type: api.EventStreamReset, User: username, Created: time.Now()}
+		if err := writeEvent(c.Writer, reset); err != nil {
+			return
+		}
+	}
+
+	for _, event := range stream.Replay {
+		if err := writeEvent(c.Writer, event); err != nil {
+			return
+		}
+	}
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(eventHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case event, ok := <-stream.Events:
+			if !ok {
+				return
+			}
+			if err := writeEvent(c.Writer, event); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := io.WriteString(c.Writer, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		}
+		c.Writer.Flush()
+	}
+}
+
+func writeEvent(w io.Writer, event *api.Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", event.Id, event.Type, data)
+	return err
+}
+
+// signImages replaces image names with signed urls, under the api version
+// the request came in on
+func (s *Server) signImages(c *gin.Context, username string, ward *api.GetWardrobeResponse) {
+	ward.MainImage = apiPrefix(c) + s.signer.Sign(username, ward.Id, ward.MainImage)
+	ward.LabelImage = apiPrefix(c) + s.signer.Sign(username, ward.Id, ward.LabelImage)
+}
+
+// listOptions reads limit, cursor, sort and filter[field] from the query
+func listOptions(c *gin.Context) (api.ListOptions, error) {
+	limit, err := queryLimit(c)
+
+	return api.ListOptions{
+		Limit:  limit,
+		Cursor: c.Query("cursor"),
+		Sort:   c.Query("sort"),
+		Filter: c.QueryMap("filter"),
+	}, err
+}
+
+// queryLimit is the limit query parameter, 0 when it is not set
+func queryLimit(c *gin.Context) (int, error) {
+	limit := c.Query("limit")
+	if limit == "" {
+		return 0, nil
+	}
+
+	n, err := strconv.Atoi(limit)
+	if err != nil || n <= 0 {
+		return 0, &api.InvalidRequest{Field: "limit", Reason: "not a positive number"}
+	}
+	return n, nil
+}
+
+// setNextLink points the Link header at the page after this one, the query
+// stays as is but for the cursor
+func setNextLink(c *gin.Context, next string) {
+	if next == "" {
+		return
+	}
+
+	u := *c.Request.URL
+	query := u.Query()
+	query.Set("cursor", next)
+	u.RawQuery = query.Encode()
+
+	c.Writer.Header().Add("Link", "<"+u.RequestURI()+">; rel=\"next\"")
+}
+
 //utility
 func printRequest(c *gin.Context) {
 
@@ -0,0 +1,476 @@
+//
+// openapi.go
+//
+
+package app
+
+import (
+	"html/template"
+	"mime/multipart"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/render"
+	"github.com/graphql-go/graphql"
+
+	"WardrobeManagerMS/pkg/api"
+)
+
+// apiParam is a query parameter of an operation
+type apiParam struct {
+	name        string
+	description string
+}
+
+// apiOperation documents a route of the current api version, unversioned
+// ones are mounted as is. Request and response are values of the types in
+// the body, their schemas are read from the json or form tags. Content is
+// the media type of a response that is not JSON.
+type apiOperation struct {
+	method      string
+	path        string
+	unversioned bool
+	tag         string
+	summary     string
+	public      bool
+	query       []apiParam
+	request     interface{}
+	form        bool
+	response    interface{}
+	status      int
+	content     string
+	paged       bool
+	deprecated  bool
+	description string
+}
+
+var listQuery = []apiParam{
+	{"limit", "Page size, 50 by default and 200 at most"},
+	{"cursor", "The cursor of the next page, from the Link header"},
+	{"sort", "created, last-worn, likes or description, prefixed with - to reverse"},
+	{"filter", "filter[field]=value, by description, image-state, label-text or label-state for items and description, top-id, bottom-id or item for outfits"},
+}
+
+// apiOperations are all routes of the server, a test keeps them in line
+// with what Routes registers
+var apiOperations = []apiOperation{
+	{method: "GET", path: "/openapi.json", unversioned: true, tag: "docs", summary: "This document", public: true, content: "application/json"},
+	{method: "GET", path: "/docs", unversioned: true, tag: "docs", summary: "This document, browsable", public: true, content: "text/html"},
+
+	{method: "GET", path: "/users/:username/wardrobes/:id/images/:filename", tag: "images", summary: "Get an image of an item by its signed url", public: true,
+		query: []apiParam{{"expires", "Expiry of the url in unix seconds"}, {"signature", "Signature of the url"}}, content: "image/*"},
+
+	{method: "GET", path: "/looks/:token", tag: "looks", summary: "Get what a share link shows", public: true, response: api.GetLookResponse{}},
+	{method: "GET", path: "/looks/:token/images/:filename", tag: "looks", summary: "Get an image of a share link", public: true, content: "image/*"},
+
+	{method: "GET", path: "/graphql", unversioned: true, tag: "graphql", summary: "Run a GraphQL query over users, items, outfits and wears",
+		query: []apiParam{{"query", "The query"}, {"operationName", "The operation to run of those in the query"}, {"variables", "The variables, JSON encoded"}}, response: graphql.Result{}},
+	{method: "POST", path: "/graphql", unversioned: true, tag: "graphql", summary: "Run a GraphQL query over users, items, outfits and wears", request: graphqlRequest{}, response: graphql.Result{}},
+
+	{method: "POST", path: "/users", tag: "users", summary: "Register a user", request: api.NewUserRequest{}, response: api.GetUserResponse{}, status: http.StatusCreated},
+	{method: "GET", path: "/users/:username", tag: "users", summary: "Get a user", response: api.GetUserResponse{}},
+	{method: "PUT", path: "/users/:username", tag: "users", summary: "Update a user", request: api.UpdateUserRequest{}, response: api.GetUserResponse{}},
+	{method: "DELETE", path: "/users/:username", tag: "users", summary: "Delete a user with their closet, images, shares and links", content: "text/plain"},
+
+	{method: "POST", path: "/users/:username/shares", tag: "sharing", summary: "Share the closet with another user", request: api.NewShareRequest{}, response: api.GetShareResponse{}},
+	{method: "GET", path: "/users/:username/shares", tag: "sharing", summary: "List who the closet is shared with", response: []api.GetShareResponse{}},
+	{method: "DELETE", path: "/users/:username/shares/:grantee", tag: "sharing", summary: "Stop sharing the closet with grantee", content: "text/plain"},
+	{method: "GET", path: "/users/:username/shared", tag: "sharing", summary: "List the closets shared with the user", response: []api.GetShareResponse{}},
+	{method: "POST", path: "/users/:username/shared/:owner", tag: "sharing", summary: "Accept the closet owner shared", content: "text/plain"},
+	{method: "DELETE", path: "/users/:username/shared/:owner", tag: "sharing", summary: "Decline or leave the closet owner shared", content: "text/plain"},
+
+	{method: "POST", path: "/users/:username/links", tag: "links", summary: "Create a public share link", request: api.NewShareLinkRequest{}, response: api.GetShareLinkResponse{}, status: http.StatusCreated},
+	{method: "GET", path: "/users/:username/links", tag: "links", summary: "List share links", response: []api.GetShareLinkResponse{}},
+	{method: "DELETE", path: "/users/:username/links/:id", tag: "links", summary: "Revoke a share link", content: "text/plain"},
+
+	{method: "GET", path: "/ui/users/:username", unversioned: true, tag: "web ui", summary: "Closet page", content: "text/html"},
+	{method: "GET", path: "/ui/users/:username/items/new", unversioned: true, tag: "web ui", summary: "Upload form", content: "text/html"},
+	{method: "GET", path: "/ui/users/:username/items/:id", unversioned: true, tag: "web ui", summary: "Item page", content: "text/html"},
+	{method: "POST", path: "/ui/users/:username/items", unversioned: true, tag: "web ui", summary: "Upload an item, redirects to the closet", request: api.NewWardrobeRequest{}, form: true, status: http.StatusSeeOther},
+	{method: "GET", path: "/ui/users/:username/outfits/new", unversioned: true, tag: "web ui", summary: "Outfit form", content: "text/html"},
+	{method: "POST", path: "/ui/users/:username/outfits", unversioned: true, tag: "web ui", summary: "Compose an outfit, redirects to the closet", request: api.NewOutfitRequest{}, form: true, status: http.StatusSeeOther},
+
+	{method: "POST", path: "/users/:username/wardrobes", tag: "items", summary: "Add an item with its photo and label", request: api.NewWardrobeRequest{}, form: true, content: "text/plain"},
+	{method: "GET", path: "/users/:username/wardrobes", tag: "items", summary: "List items", query: listQuery, response: []api.GetWardrobeResponse{}, paged: true},
+	{method: "GET", path: "/users/:username/wardrobes/:id", tag: "items", summary: "Get an item", response: api.GetWardrobeResponse{}},
+	{method: "DELETE", path: "/users/:username/wardrobes/:id", tag: "items", summary: "Delete an item", content: "text/plain"},
+	{method: "DELETE", path: "/users/:username/wardrobs/:id", unversioned: true, tag: "items", summary: "Delete an item", content: "text/plain", deprecated: true,
+		description: "Misspelled path kept for clients from before versioning, use /v1/users/{username}/wardrobes/{id}"},
+	{method: "GET", path: "/users/:username/usage", tag: "items", summary: "Get storage usage and quota", response: api.GetUsageResponse{}},
+	{method: "GET", path: "/users/:username/search", tag: "items", summary: "Search items by description, brand, tags and label text",
+		query: []apiParam{{"q", "Words to look for, all must match"}, {"limit", "Number of hits, 50 by default and 200 at most"}}, response: []api.SearchHit{}},
+
+	{method: "POST", path: "/users/:username/outfits", tag: "outfits", summary: "Compose an outfit of two items", request: api.NewOutfitRequest{}, content: "text/plain"},
+	{method: "GET", path: "/users/:username/outfits", tag: "outfits", summary: "List outfits", query: listQuery, response: []api.GetOutfitResponse{}, paged: true},
+	{method: "GET", path: "/users/:username/outfits/:id", tag: "outfits", summary: "Get an outfit", response: api.GetOutfitResponse{}},
+	{method: "DELETE", path: "/users/:username/outfits/:id", tag: "outfits", summary: "Delete an outfit", content: "text/plain"},
+	{method: "POST", path: "/users/:username/outfits/:id/reactions", tag: "outfits", summary: "Like or dislike an outfit", request: api.ReactRequest{}, response: api.GetOutfitResponse{}},
+
+	{method: "POST", path: "/users/:username/wears", tag: "wears", summary: "Log an outfit or items as worn", request: api.NewWearRequest{}, response: api.GetWearResponse{}, status: http.StatusCreated},
+	{method: "GET", path: "/users/:username/wears", tag: "wears", summary: "List what was worn, last first",
+		query: []apiParam{{"limit", "Number of wears, all of them by default"}}, response: []api.GetWearResponse{}},
+
+	{method: "POST", path: "/users/:username/webhooks", tag: "webhooks", summary: "Register a webhook for closet events", request: api.NewWebhookRequest{}, response: api.GetWebhookResponse{}, status: http.StatusCreated,
+		description: "Events are posted as JSON, signed in X-Wardrobe-Signature as t=<unix seconds>,v1=<hex HMAC-SHA256 of \"<t>.<body>\" keyed with the secret>. Failed deliveries are retried with exponential backoff."},
+	{method: "GET", path: "/users/:username/webhooks", tag: "webhooks", summary: "List webhooks", response: []api.GetWebhookResponse{}},
+	{method: "DELETE", path: "/users/:username/webhooks/:id", tag: "webhooks", summary: "Delete a webhook with its delivery log", content: "text/plain"},
+	{method: "GET", path: "/users/:username/webhooks/:id/deliveries", tag: "webhooks", summary: "List the deliveries of a webhook, last first",
+		query: []apiParam{{"limit", "Number of deliveries, all of them by default"}}, response: []api.GetDeliveryResponse{}},
+	{method: "POST", path: "/users/:username/webhooks/:id/deliveries/:delivery/redeliver", tag: "webhooks", summary: "Send the event of a delivery again", response: api.GetDeliveryResponse{}, status: http.StatusAccepted},
+
+	{method: "GET", path: "/users/:username/events", tag: "events", summary: "Stream the events of a closet as server-sent events", content: "text/event-stream",
+		query:       []apiParam{{"lastEventId", "Resume after this event, for clients that cannot set the Last-Event-ID header"}},
+		description: "Each event has the id, type and JSON encoded Event of a closet change: items created or deleted, label text ready, outfits created, deleted or reacted to and wears logged. Reconnect with the Last-Event-ID header to get the events missed, of the last 256 the server keeps. When those are gone the stream starts with a stream.reset event, reload the closet then."},
+}
+
+var (
+	timeType = reflect.TypeOf(time.Time{})
+	fileType = reflect.TypeOf(multipart.FileHeader{})
+	roleType = reflect.TypeOf(api.Role(""))
+)
+
+// schemaGen collects the schemas of named types as it meets them
+type schemaGen struct {
+	schemas map[string]interface{}
+}
+
+// schema describes t, named structs by reference. Form bodies name their
+// fields by the form tag and fall back to the json one.
+func (g *schemaGen) schema(t reflect.Type, form bool) map[string]interface{} {
+
+	switch t {
+	case timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case fileType:
+		return map[string]interface{}{"type": "string", "format": "binary"}
+	case roleType:
+		return map[string]interface{}{"type": "string", "enum": []api.Role{api.RoleViewer, api.RoleContributor, api.RoleManager}}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return g.schema(t.Elem(), form)
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "format": "byte"}
+		}
+		return map[string]interface{}{"type": "array", "items": g.schema(t.Elem(), form)}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": g.schema(t.Elem(), form)}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int32:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Int64:
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Struct:
+		if _, ok := g.schemas[t.Name()]; !ok {
+			g.schemas[t.Name()] = nil
+			g.schemas[t.Name()] = g.object(t, form)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + t.Name()}
+	}
+
+	return map[string]interface{}{}
+}
+
+func (g *schemaGen) object(t reflect.Type, form bool) map[string]interface{} {
+	properties := make(map[string]interface{})
+	required := make([]string, 0)
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+
+		tag := field.Tag.Get("json")
+		if form && field.Tag.Get("form") != "" {
+			tag = field.Tag.Get("form")
+		}
+		name := strings.Split(tag, ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+
+		properties[name] = g.schema(field.Type, form)
+		if strings.Contains(field.Tag.Get("binding"), "required") {
+			required = append(required, name)
+		}
+	}
+
+	object := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		object["required"] = required
+	}
+	return object
+}
+
+// openAPIPath turns the gin path of op into an OpenAPI one and lists its
+// parameters
+func openAPIPath(op apiOperation) (string, []string) {
+	var params []string
+
+	path := op.path
+	if !op.unversioned {
+		path = "/" + currentVersion().name + path
+	}
+
+	parts := strings.Split(path, "/")
+	for i, part := range parts {
+		if strings.HasPrefix(part, ":") {
+			params = append(params, part[1:])
+			parts[i] = "{" + part[1:] + "}"
+		}
+	}
+	return strings.Join(parts, "/"), params
+}
+
+func (g *schemaGen) operation(op apiOperation) map[string]interface{} {
+
+	parameters := make([]interface{}, 0)
+	_, params := openAPIPath(op)
+	for _, name := range params {
+		parameters = append(parameters, map[string]interface{}{
+			"name": name, "in": "path", "required": true, "schema": map[string]interface{}{"type": "string"},
+		})
+	}
+	for _, q := range op.query {
+		param := map[string]interface{}{
+			"name": q.name, "in": "query", "description": q.description, "schema": map[string]interface{}{"type": "string"},
+		}
+		if q.name == "filter" {
+			param["style"] = "deepObject"
+			param["explode"] = true
+			param["schema"] = map[string]interface{}{"type": "object", "additionalProperties": map[string]interface{}{"type": "string"}}
+		}
+		parameters = append(parameters, param)
+	}
+
+	status := op.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	success := map[string]interface{}{"description": http.StatusText(status)}
+	switch {
+	case op.response != nil:
+		success["content"] = map[string]interface{}{
+			"application/json": map[string]interface{}{"schema": g.schema(reflect.TypeOf(op.response), false)},
+		}
+	case op.content != "":
+		success["content"] = map[string]interface{}{op.content: map[string]interface{}{}}
+	}
+	if op.paged {
+		success["headers"] = map[string]interface{}{
+			"Link": map[string]interface{}{
+				"description": "The next page as rel=\"next\", missing on the last page",
+				"schema":      map[string]interface{}{"type": "string"},
+			},
+		}
+	}
+
+	operation := map[string]interface{}{
+		"tags":       []string{op.tag},
+		"summary":    op.summary,
+		"parameters": parameters,
+		"responses": map[string]interface{}{
+			strconv.Itoa(status): success,
+			"default": map[string]interface{}{
+				"description": "Error",
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{"schema": g.schema(reflect.TypeOf(api.ErrorResponse{}), false)},
+				},
+			},
+		},
+	}
+
+	if op.request != nil {
+		media := "application/json"
+		if op.form {
+			media = "multipart/form-data"
+		}
+		operation["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content": map[string]interface{}{
+				media: map[string]interface{}{"schema": g.schema(reflect.TypeOf(op.request), op.form)},
+			},
+		}
+	}
+	if op.public {
+		operation["security"] = []interface{}{}
+	}
+	if op.deprecated {
+		operation["deprecated"] = true
+	}
+	if op.description != "" {
+		operation["description"] = op.description
+	}
+
+	return operation
+}
+
+// openAPIDocument is the OpenAPI 3 description of apiOperations
+func openAPIDocument() map[string]interface{} {
+
+	g := &schemaGen{schemas: make(map[string]interface{})}
+
+	paths := make(map[string]map[string]interface{})
+	for _, op := range apiOperations {
+		path, _ := openAPIPath(op)
+		if paths[path] == nil {
+			paths[path] = make(map[string]interface{})
+		}
+		paths[path][strings.ToLower(op.method)] = g.operation(op)
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "Wardrobe Manager",
+			"version": api.Version,
+			"description": "The api is served under /" + currentVersion().name + ". The same paths without the prefix are " +
+				"deprecated, they answer with Deprecation and Sunset headers until they are removed.",
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": g.schemas,
+			"securitySchemes": map[string]interface{}{
+				"bearer": map[string]interface{}{"type": "http", "scheme": "bearer", "bearerFormat": "JWT"},
+				"apiKey": map[string]interface{}{"type": "apiKey", "in": "header", "name": "X-API-Key"},
+			},
+		},
+		"security": []interface{}{
+			map[string]interface{}{"bearer": []string{}},
+			map[string]interface{}{"apiKey": []string{}},
+		},
+	}
+}
+
+var openAPISpec = openAPIDocument()
+
+func (s *Server) getOpenAPI(c *gin.Context) {
+	c.JSON(http.StatusOK, openAPISpec)
+}
+
+// docsOperation and docsSchema are what the docs page shows of the spec
+type docsOperation struct {
+	Method      string
+	Path        string
+	Summary     string
+	Public      bool
+	Deprecated  bool
+	Query       []string
+	Request     string
+	RequestRef  string
+	Response    string
+	ResponseRef string
+}
+
+type docsField struct {
+	Name     string
+	Type     string
+	Required bool
+}
+
+type docsSchema struct {
+	Name   string
+	Fields []docsField
+}
+
+type docsPage struct {
+	Tags    []string
+	Ops     map[string][]docsOperation
+	Schemas []docsSchema
+}
+
+// schemaLabel is a short name for a generated schema
+func schemaLabel(schema map[string]interface{}) string {
+	if ref, ok := schema["$ref"].(string); ok {
+		return strings.TrimPrefix(ref, "#/components/schemas/")
+	}
+	if items, ok := schema["items"].(map[string]interface{}); ok {
+		return "[]" + schemaLabel(items)
+	}
+	if values, ok := schema["additionalProperties"].(map[string]interface{}); ok {
+		return "map of " + schemaLabel(values)
+	}
+	if format, ok := schema["format"].(string); ok {
+		return format
+	}
+	label, _ := schema["type"].(string)
+	return label
+}
+
+func newDocsPage() *docsPage {
+
+	g := &schemaGen{schemas: make(map[string]interface{})}
+	page := &docsPage{Ops: make(map[string][]docsOperation)}
+
+	for _, op := range apiOperations {
+		path, _ := openAPIPath(op)
+		d := docsOperation{
+			Method:     op.method,
+			Path:       path,
+			Summary:    op.summary,
+			Public:     op.public,
+			Deprecated: op.deprecated,
+			Response:   op.content,
+		}
+		for _, q := range op.query {
+			d.Query = append(d.Query, q.name)
+		}
+		if op.request != nil {
+			d.Request = schemaLabel(g.schema(reflect.TypeOf(op.request), op.form))
+			d.RequestRef = strings.TrimPrefix(d.Request, "[]")
+		}
+		if op.response != nil {
+			d.Response = schemaLabel(g.schema(reflect.TypeOf(op.response), false))
+			d.ResponseRef = strings.TrimPrefix(d.Response, "[]")
+		}
+
+		if _, ok := page.Ops[op.tag]; !ok {
+			page.Tags = append(page.Tags, op.tag)
+		}
+		page.Ops[op.tag] = append(page.Ops[op.tag], d)
+	}
+
+	g.schema(reflect.TypeOf(api.ErrorResponse{}), false)
+	for name, schema := range g.schemas {
+		object := schema.(map[string]interface{})
+		required, _ := object["required"].([]string)
+
+		ds := docsSchema{Name: name}
+		for field, fs := range object["properties"].(map[string]interface{}) {
+			df := docsField{Name: field, Type: schemaLabel(fs.(map[string]interface{}))}
+			for _, r := range required {
+				df.Required = df.Required || r == field
+			}
+			ds.Fields = append(ds.Fields, df)
+		}
+		sort.Slice(ds.Fields, func(i, j int) bool { return ds.Fields[i].Name < ds.Fields[j].Name })
+		page.Schemas = append(page.Schemas, ds)
+	}
+	sort.Slice(page.Schemas, func(i, j int) bool { return page.Schemas[i].Name < page.Schemas[j].Name })
+
+	return page
+}
+
+var (
+	docs         = newDocsPage()
+	docsTemplate = template.Must(template.ParseFS(templateFiles, "templates/docs.html"))
+)
+
+func (s *Server) getDocs(c *gin.Context) {
+	c.Render(http.StatusOK, render.HTML{
+		Template: docsTemplate,
+		Name:     "docs",
+		Data:     docs,
+	})
+}
@@ -11,7 +11,65 @@ import (
 )
 
 func (s *Server) Routes() *gin.Engine {
-	router := s.router
+
+	//the api description, as OpenAPI 3 and browsable
+	s.router.GET("/openapi.json", s.getOpenAPI)
+	s.router.GET("/docs", s.getDocs)
+
+	//web ui, rendered on the server, its images come from the current api
+	current := currentVersion()
+	ui := s.router.Group("/ui", mount("/"+current.name, current), s.authenticate, s.authorizeUser)
+	ui.GET("/users/:username", s.uiCloset)
+	ui.GET("/users/:username/items/new", s.uiUploadForm)
+	ui.GET("/users/:username/items/:id", s.uiItem)
+	ui.POST("/users/:username/items", s.uiUpload)
+	ui.GET("/users/:username/outfits/new", s.uiComposeForm)
+	ui.POST("/users/:username/outfits", s.uiCompose)
+
+	//graphql over the current api, the service checks access to each closet
+	s.router.GET("/graphql", mount("/"+current.name, current), s.authenticate, s.graphqlQuery)
+	s.router.POST("/graphql", mount("/"+current.name, current), s.authenticate, s.graphqlQuery)
+
+	//the api, under /v1 and the unversioned legacy paths
+	s.mountVersions()
+
+	return s.router
+}
+
+func (s *Server) v1Routes(group *gin.RouterGroup) {
+
+	//images carry their own signature, so browsers can load them directly
+	group.GET("/users/:username/wardrobes/:id/images/:filename", s.getFile)
+
+	//share links are their own authorization
+	group.GET("/looks/:token", s.getLook)
+	group.GET("/looks/:token/images/:filename", s.getLookImage)
+
+	//everything else acts on behalf of an authenticated user
+	router := group.Group("/", s.authenticate, s.authorizeUser)
+
+	//register a user
+	router.POST("/users", s.registerUser)
+
+	//get, update and delete a user
+	router.GET("/users/:username", s.getUser)
+	router.PUT("/users/:username", s.updateUser)
+	router.DELETE("/users/:username", s.deleteUser)
+
+	//share a closet, list and revoke who it is shared with
+	router.POST("/users/:username/shares", s.shareCloset)
+	router.GET("/users/:username/shares", s.getShares)
+	router.DELETE("/users/:username/shares/:grantee", s.revokeShare)
+
+	//closets shared with a user, accept or decline an invitation
+	router.GET("/users/:username/shared", s.getSharedWithMe)
+	router.POST("/users/:username/shared/:owner", s.acceptShare)
+	router.DELETE("/users/:username/shared/:owner", s.declineShare)
+
+	//create, list and revoke public share links
+	router.POST("/users/:username/links", s.createShareLink)
+	router.GET("/users/:username/links", s.getShareLinks)
+	router.DELETE("/users/:username/links/:id", s.revokeShareLink)
 
 	//add a wardrobe for a user
 	router.POST("/users/:username/wardrobes", s.addWardrobe)
@@ -23,10 +81,13 @@ func (s *Server) Routes() *gin.Engine {
 	router.GET("/users/:username/wardrobes/:id", s.getWardrobe)
 
 	//delete a wardrobe for a user
-	router.DELETE("/users/:username/wardrobs/:id", s.deleteWardrobe)
+	router.DELETE("/users/:username/wardrobes/:id", s.deleteWardrobe)
 
-	//api to get image
-	router.GET("/images/:filename", s.getFile)
+	//get storage usage and quota for a user
+	router.GET("/users/:username/usage", s.getUsage)
+
+	//search the items of a user
+	router.GET("/users/:username/search", s.search)
 
 	//add a outfit for a user
 	router.POST("/users/:username/outfits", s.addOutfit)
@@ -40,5 +101,20 @@ func (s *Server) Routes() *gin.Engine {
 	//delete a wardrobe for a user
 	router.DELETE("/users/:username/outfits/:id", s.deleteOutfit)
 
-	return router
+	//like or dislike an outfit
+	router.POST("/users/:username/outfits/:id/reactions", s.reactOutfit)
+
+	//log what a user wore, and list it
+	router.POST("/users/:username/wears", s.logWear)
+	router.GET("/users/:username/wears", s.getWears)
+
+	//register, list and delete webhooks, their delivery log and redeliveries
+	router.POST("/users/:username/webhooks", s.createWebhook)
+	router.GET("/users/:username/webhooks", s.getWebhooks)
+	router.DELETE("/users/:username/webhooks/:id", s.deleteWebhook)
+	router.GET("/users/:username/webhooks/:id/deliveries", s.getDeliveries)
+	router.POST("/users/:username/webhooks/:id/deliveries/:delivery/redeliver", s.redeliver)
+
+	//stream closet events as they happen
+	router.GET("/users/:username/events", s.streamEvents)
 }
@@ -18,12 +18,27 @@ const port = "57401"
 type Server struct {
 	router *gin.Engine
 	ws     api.WardrobeService
+	signer *URLSigner
+	auth   []Authenticator
 }
 
-func NewWardrobeServer(router *gin.Engine, ws api.WardrobeService) *Server {
+// NewWardrobeServer serves ws on router. Requests must pass one of auth,
+// without any every request is refused; InsecureNoAuth opens the api.
+func NewWardrobeServer(router *gin.Engine, ws api.WardrobeService, signer *URLSigner, auth ...Authenticator) *Server {
+	if len(auth) == 0 {
+		glog.Warningf("No authenticators configured, every request is refused")
+	}
+	for _, a := range auth {
+		if _, ok := a.(insecureNoAuth); ok {
+			glog.Warningf("Authentication is disabled, the api is open to everyone")
+		}
+	}
+
 	return &Server{
 		router: router,
 		ws:     ws,
+		signer: signer,
+		auth:   auth,
 	}
 
 }
@@ -0,0 +1,94 @@
+//
+// signer.go
+//
+
+package app
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+var (
+	errUnsigned = errors.New("image url is not signed")
+	errExpired  = errors.New("image url has expired")
+	errBadSig   = errors.New("image url signature does not match")
+)
+
+// image names are generated by the service, anything else is refused
+// before it gets near a repository
+var imageNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,128}$`)
+
+// URLSigner issues and checks time limited image URLs bound to the user and
+// item owning the image
+type URLSigner struct {
+	secret []byte
+	ttl    time.Duration
+	now    func() time.Time
+}
+
+func NewURLSigner(secret []byte, ttl time.Duration) *URLSigner {
+	return &URLSigner{
+		secret: secret,
+		ttl:    ttl,
+		now:    time.Now,
+	}
+}
+
+// Sign returns the URL of filename on user's item id. Expiry is rounded up
+// so the URL, and any copy a client cached under it, stays stable for at
+// least one ttl.
+func (s *URLSigner) Sign(user, id, filename string) string {
+
+	expires := s.now().Truncate(s.ttl).Add(2 * s.ttl).Unix()
+
+	query := url.Values{}
+	query.Set("expires", strconv.FormatInt(expires, 10))
+	query.Set("signature", s.signature(user, id, filename, expires))
+
+	return fmt.Sprintf("/users/%s/wardrobes/%s/images/%s?%s",
+		url.PathEscape(user), url.PathEscape(id), url.PathEscape(filename), query.Encode())
+}
+
+func (s *URLSigner) Verify(user, id, filename, expires, signature string) error {
+
+	if expires == "" || signature == "" {
+		return errUnsigned
+	}
+
+	exp, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return errUnsigned
+	}
+
+	if !hmac.Equal([]byte(signature), []byte(s.signature(user, id, filename, exp))) {
+		return errBadSig
+	}
+
+	if s.now().Unix() > exp {
+		return errExpired
+	}
+
+	return nil
+}
+
+func (s *URLSigner) signature(user, id, filename string, expires int64) string {
+
+	// fields are length prefixed, no user, id or filename can run into the
+	// next field whatever it contains
+	mac := hmac.New(sha256.New, s.secret)
+	fmt.Fprintf(mac, "%d:%s%d:%s%d:%s%d", len(user), user, len(id), id, len(filename), filename, expires)
+
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func validImageName(filename string) bool {
+	return imageNamePattern.MatchString(filename)
+}
@@ -0,0 +1,229 @@
+//
+// ui.go
+//
+
+package app
+
+import (
+	"embed"
+	"errors"
+	"html/template"
+	"net/http"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/render"
+	"github.com/golang/glog"
+
+	"WardrobeManagerMS/pkg/api"
+)
+
+//go:embed templates/*.html
+var templateFiles embed.FS
+
+// uiPages are parsed once, each page along with the shared layout
+var uiPages = parsePages("closet", "item", "compose", "upload", "error")
+
+func parsePages(names ...string) map[string]*template.Template {
+	pages := make(map[string]*template.Template)
+	for _, name := range names {
+		pages[name] = template.Must(template.ParseFS(templateFiles, "templates/layout.html", "templates/"+name+".html"))
+	}
+	return pages
+}
+
+type uiPage struct {
+	Title   string
+	User    string
+	Items   []*api.GetWardrobeResponse
+	Outfits []*api.GetOutfitResponse
+	Item    *api.GetWardrobeResponse
+	Error   string
+}
+
+// renderPage writes page, the layout fills in the navigation for page.User
+func renderPage(c *gin.Context, code int, name string, page *uiPage) {
+	c.Render(code, render.HTML{
+		Template: uiPages[name],
+		Name:     "layout",
+		Data:     page,
+	})
+}
+
+func renderError(c *gin.Context, username string, err error) {
+	code := errorStatus(err)
+
+	message := err.Error()
+	if code == http.StatusInternalServerError {
+		message = "internal error"
+	}
+
+	renderPage(c, code, "error", &uiPage{
+		Title: "Error",
+		User:  username,
+		Error: message,
+	})
+}
+
+// uiItems lists all items of username with signed image urls, a user
+// without a closet yet has none
+func (s *Server) uiItems(c *gin.Context, username string) ([]*api.GetWardrobeResponse, error) {
+
+	var wards []*api.GetWardrobeResponse
+
+	opts := api.ListOptions{Limit: api.MaxListLimit}
+	for {
+		page, err := s.service(c).GetAllWardrobe(username, opts)
+		if errors.As(err, new(*api.UserNotFound)) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		wards = append(wards, page.Items...)
+		if page.Next == "" {
+			break
+		}
+		opts.Cursor = page.Next
+	}
+
+	for _, ward := range wards {
+		s.signImages(c, username, ward)
+	}
+
+	return wards, nil
+}
+
+func (s *Server) uiOutfits(c *gin.Context, username string) ([]*api.GetOutfitResponse, error) {
+
+	var outfits []*api.GetOutfitResponse
+
+	opts := api.ListOptions{Limit: api.MaxListLimit}
+	for {
+		page, err := s.service(c).GetAllOutfits(username, opts)
+		if errors.As(err, new(*api.UserNotFound)) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		outfits = append(outfits, page.Outfits...)
+		if page.Next == "" {
+			return outfits, nil
+		}
+		opts.Cursor = page.Next
+	}
+}
+
+func (s *Server) uiCloset(c *gin.Context) {
+	username := c.Params.ByName("username")
+
+	items, err := s.uiItems(c, username)
+	if err != nil {
+		glog.Errorf("Error rendering closet {user=%s}, {err=%v}", username, err)
+		renderError(c, username, err)
+		return
+	}
+
+	outfits, err := s.uiOutfits(c, username)
+	if err != nil {
+		glog.Errorf("Error rendering closet {user=%s}, {err=%v}", username, err)
+		renderError(c, username, err)
+		return
+	}
+
+	renderPage(c, http.StatusOK, "closet", &uiPage{
+		Title:   "Closet",
+		User:    username,
+		Items:   items,
+		Outfits: outfits,
+	})
+}
+
+func (s *Server) uiItem(c *gin.Context) {
+	username := c.Params.ByName("username")
+	wardId := c.Params.ByName("id")
+
+	ward, err := s.service(c).GetWardrobe(username, wardId)
+	if err != nil {
+		glog.Errorf("Error rendering item {user=%s}, {wardrobe-id=%s}, {err=%v}", username, wardId, err)
+		renderError(c, username, err)
+		return
+	}
+
+	s.signImages(c, username, ward)
+
+	renderPage(c, http.StatusOK, "item", &uiPage{
+		Title: ward.Description,
+		User:  username,
+		Item:  ward,
+	})
+}
+
+func (s *Server) uiUploadForm(c *gin.Context) {
+	username := c.Params.ByName("username")
+
+	renderPage(c, http.StatusOK, "upload", &uiPage{
+		Title: "Add item",
+		User:  username,
+	})
+}
+
+func (s *Server) uiUpload(c *gin.Context) {
+	username := c.Params.ByName("username")
+
+	var newWd api.NewWardrobeRequest
+	err := c.ShouldBind(&newWd)
+	if err != nil {
+		glog.Errorf("Error decoding upload form {user=%s}, {err=%v}", username, err)
+		renderError(c, username, &api.InvalidRequest{Field: "form", Reason: err.Error()})
+		return
+	}
+
+	newWd.User = username
+	err = s.service(c).AddWardrobe(newWd)
+	if err != nil {
+		glog.Errorf("Error adding wardrobe from ui {user=%s}, {err=%v}", username, err)
+		renderError(c, username, err)
+		return
+	}
+
+	c.Redirect(http.StatusSeeOther, "/ui/users/"+url.PathEscape(username))
+}
+
+func (s *Server) uiComposeForm(c *gin.Context) {
+	username := c.Params.ByName("username")
+
+	items, err := s.uiItems(c, username)
+	if err != nil {
+		glog.Errorf("Error rendering outfit form {user=%s}, {err=%v}", username, err)
+		renderError(c, username, err)
+		return
+	}
+
+	renderPage(c, http.StatusOK, "compose", &uiPage{
+		Title: "Compose outfit",
+		User:  username,
+		Items: items,
+	})
+}
+
+func (s *Server) uiCompose(c *gin.Context) {
+	username := c.Params.ByName("username")
+
+	err := s.service(c).AddOutfit(api.NewOutfitRequest{
+		User:        username,
+		TopId:       c.PostForm("top-id"),
+		BottomId:    c.PostForm("bottom-id"),
+		Description: c.PostForm("description"),
+	})
+	if err != nil {
+		glog.Errorf("Error adding outfit from ui {user=%s}, {err=%v}", username, err)
+		renderError(c, username, err)
+		return
+	}
+
+	c.Redirect(http.StatusSeeOther, "/ui/users/"+url.PathEscape(username))
+}
@@ -0,0 +1,96 @@
+//
+// version.go
+//
+
+package app
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"WardrobeManagerMS/pkg/api"
+)
+
+const prefixKey = "api-prefix"
+
+// apiVersion is a version of the api mounted under /name. Versions are
+// served side by side, one with a deprecation date announces it on every
+// response and is removed at its sunset.
+type apiVersion struct {
+	name       string
+	release    string
+	routes     func(s *Server, router *gin.RouterGroup)
+	deprecated time.Time
+	sunset     time.Time
+}
+
+// apiVersions are the mounted versions, the last one is current
+var apiVersions = []apiVersion{
+	{name: "v1", release: api.Version, routes: (*Server).v1Routes},
+}
+
+// The unversioned paths serve the current version for clients from before
+// versioning, until their sunset
+var (
+	legacyDeprecated = time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)
+	legacySunset     = time.Date(2027, 10, 19, 0, 0, 0, 0, time.UTC)
+)
+
+func currentVersion() apiVersion {
+	return apiVersions[len(apiVersions)-1]
+}
+
+// mount records where the api is mounted for the urls handed out in
+// responses, and advertises the version
+func mount(prefix string, v apiVersion) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(prefixKey, prefix)
+		c.Header("API-Version", v.release)
+	}
+}
+
+// apiPrefix is where the api serving c is mounted
+func apiPrefix(c *gin.Context) string {
+	return c.GetString(prefixKey)
+}
+
+// deprecate announces the deprecation and sunset of what the request
+// reached, successor is the path of its replacement if any
+func deprecate(deprecated, sunset time.Time, successor func(path string) string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Deprecation", "@"+strconv.FormatInt(deprecated.Unix(), 10))
+		c.Header("Sunset", sunset.UTC().Format(http.TimeFormat))
+		if successor != nil {
+			c.Writer.Header().Add("Link", "<"+successor(c.Request.URL.Path)+">; rel=\"successor-version\"")
+		}
+	}
+}
+
+// mountVersions serves every version under its name, and the current one
+// on the unversioned paths as well
+func (s *Server) mountVersions() {
+
+	current := currentVersion()
+	for _, v := range apiVersions {
+		v := v
+		group := s.router.Group("/"+v.name, mount("/"+v.name, v))
+		if !v.deprecated.IsZero() {
+			group.Use(deprecate(v.deprecated, v.sunset, func(path string) string {
+				return "/" + current.name + strings.TrimPrefix(path, "/"+v.name)
+			}))
+		}
+		v.routes(s, group)
+	}
+
+	legacy := s.router.Group("/", mount("", current), deprecate(legacyDeprecated, legacySunset, func(path string) string {
+		return "/" + current.name + path
+	}))
+	current.routes(s, legacy)
+
+	//delete a wardrobe for a user, misspelled before versioning
+	legacy.DELETE("/users/:username/wardrobs/:id", s.authenticate, s.authorizeUser, s.deleteWardrobe)
+}
@@ -0,0 +1,273 @@
+//
+// client.go
+//
+
+// Package client calls the wardrobe api over http
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"WardrobeManagerMS/pkg/api"
+)
+
+// Options configure a Client, the zero value talks to the server without
+// credentials and retries twice
+type Options struct {
+	HTTPClient *http.Client
+
+	// Token is sent as a bearer token, APIKey in the X-API-Key header
+	Token  string
+	APIKey string
+
+	// Retries of idempotent requests failing with a network error or a
+	// temporary status, waiting Backoff doubled on every attempt. A
+	// negative Retries disables them.
+	Retries    int
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+// Client is a client of one server, it is safe for concurrent use
+type Client struct {
+	base    *url.URL
+	prefix  string
+	options Options
+}
+
+// request is a call of the api. Body is called for every attempt, so a
+// retried request is sent in full again.
+type request struct {
+	method      string
+	uri         string
+	body        func() (io.Reader, error)
+	contentType string
+}
+
+// New returns a client of the server at baseURL, such as
+// http://localhost:57401
+func New(baseURL string, options Options) (*Client, error) {
+
+	base, err := url.Parse(strings.TrimSuffix(baseURL, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("Invalid base url %s : %w", baseURL, err)
+	}
+
+	if options.HTTPClient == nil {
+		options.HTTPClient = http.DefaultClient
+	}
+	if options.Retries == 0 {
+		options.Retries = 2
+	}
+	if options.Backoff == 0 {
+		options.Backoff = 200 * time.Millisecond
+	}
+	if options.MaxBackoff == 0 {
+		options.MaxBackoff = 5 * time.Second
+	}
+
+	return &Client{
+		base:    base,
+		prefix:  "/v1",
+		options: options,
+	}, nil
+}
+
+// path joins the escaped segments under the api prefix
+func (c *Client) path(segments ...string) string {
+	var b strings.Builder
+	b.WriteString(c.prefix)
+	for _, s := range segments {
+		b.WriteString("/")
+		b.WriteString(url.PathEscape(s))
+	}
+	return b.String()
+}
+
+func jsonBody(v interface{}) (func() (io.Reader, error), error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("Error encoding request : %w", err)
+	}
+	return func() (io.Reader, error) {
+		return bytes.NewReader(raw), nil
+	}, nil
+}
+
+// idempotent requests can be sent again when their outcome is unknown
+func idempotent(method string) bool {
+	return method != http.MethodPost
+}
+
+// temporary statuses are worth another try
+func temporary(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// do sends r and returns the successful response, its body is for the
+// caller to close. Failures are returned as *Error.
+func (c *Client) do(ctx context.Context, r request) (*http.Response, error) {
+
+	retries := c.options.Retries
+	if !idempotent(r.method) || retries < 0 {
+		retries = 0
+	}
+
+	for attempt := 0; ; attempt++ {
+
+		resp, err := c.send(ctx, r)
+		if err == nil && resp.StatusCode < 300 {
+			return resp, nil
+		}
+
+		var wait time.Duration
+		if err == nil {
+			err = responseError(resp)
+			wait = retryAfter(resp)
+			if !temporary(resp.StatusCode) {
+				return nil, err
+			}
+		} else if ctx.Err() != nil {
+			return nil, err
+		}
+
+		if attempt >= retries {
+			return nil, err
+		}
+
+		if wait == 0 {
+			wait = c.backoff(attempt)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+func (c *Client) send(ctx context.Context, r request) (*http.Response, error) {
+
+	var body io.Reader
+	if r.body != nil {
+		b, err := r.body()
+		if err != nil {
+			return nil, err
+		}
+		body = b
+	}
+
+	target, err := c.base.Parse(r.uri)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid uri %s : %w", r.uri, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, r.method, target.String(), body)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("User-Agent", "wardrobe-client/"+api.Version)
+	if r.contentType != "" {
+		req.Header.Set("Content-Type", r.contentType)
+	}
+	if c.options.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.options.Token)
+	}
+	if c.options.APIKey != "" {
+		req.Header.Set("X-API-Key", c.options.APIKey)
+	}
+
+	resp, err := c.options.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("Error calling %s %s : %w", r.method, r.uri, err)
+	}
+	return resp, nil
+}
+
+// backoff doubles with every attempt, with jitter so clients failing
+// together do not retry together
+func (c *Client) backoff(attempt int) time.Duration {
+	wait := c.options.Backoff << uint(attempt)
+	if wait <= 0 || wait > c.options.MaxBackoff {
+		wait = c.options.MaxBackoff
+	}
+	return wait/2 + time.Duration(rand.Int63n(int64(wait/2)+1))
+}
+
+// retryAfter is the wait the server asked for in seconds, 0 if none
+func retryAfter(resp *http.Response) time.Duration {
+	seconds, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || seconds < 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// call sends r and decodes a JSON answer into out, a nil out discards it
+func (c *Client) call(ctx context.Context, r request, out interface{}) error {
+
+	resp, err := c.do(ctx, r)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return decode(resp, out)
+}
+
+func decode(resp *http.Response, out interface{}) error {
+	if out == nil {
+		io.Copy(ioutil.Discard, resp.Body)
+		return nil
+	}
+
+	err := json.NewDecoder(resp.Body).Decode(out)
+	if err != nil {
+		return fmt.Errorf("Error decoding response of %s %s : %w", resp.Request.Method, resp.Request.URL.Path, err)
+	}
+	return nil
+}
+
+// nextCursor is the cursor of the rel="next" Link of a listing
+func nextCursor(resp *http.Response) string {
+	for _, header := range resp.Header.Values("Link") {
+		for _, link := range strings.Split(header, ",") {
+			parts := strings.Split(link, ";")
+			if len(parts) < 2 || strings.TrimSpace(parts[1]) != `rel="next"` {
+				continue
+			}
+
+			target, err := url.Parse(strings.Trim(strings.TrimSpace(parts[0]), "<>"))
+			if err == nil {
+				return target.Query().Get("cursor")
+			}
+		}
+	}
+	return ""
+}
+
+// callJSON sends in as a JSON body and decodes the answer into out
+func (c *Client) callJSON(ctx context.Context, method string, uri string, in interface{}, out interface{}) error {
+	body, err := jsonBody(in)
+	if err != nil {
+		return err
+	}
+
+	return c.call(ctx, request{method: method, uri: uri, body: body, contentType: "application/json"}, out)
+}
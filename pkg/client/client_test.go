@@ -0,0 +1,380 @@
+//
+// client_test.go
+//
+
+package client_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http/httptest"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"WardrobeManagerMS/pkg/api"
+	"WardrobeManagerMS/pkg/app"
+	"WardrobeManagerMS/pkg/client"
+)
+
+// fakeService keeps the items of every user in memory, the next failures
+// calls fail as unavailable
+type fakeService struct {
+	api.WardrobeService
+
+	mu       sync.Mutex
+	items    map[string]*api.GetWardrobeResponse
+	images   map[string][]byte
+	failures int
+	calls    int
+}
+
+func newFakeService() *fakeService {
+	return &fakeService{
+		items:  make(map[string]*api.GetWardrobeResponse),
+		images: make(map[string][]byte),
+	}
+}
+
+func (s *fakeService) fail() error {
+	s.calls++
+	if s.failures > 0 {
+		s.failures--
+		return &api.ResourceUnavailable{Server: "fake"}
+	}
+	return nil
+}
+
+func (s *fakeService) AddWardrobe(new api.NewWardrobeRequest) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.fail(); err != nil {
+		return err
+	}
+
+	id := fmt.Sprintf("item-%d", len(s.items)+1)
+	main, err := readForm(new.MainImageMime.Open)
+	if err != nil {
+		return err
+	}
+	label, err := readForm(new.LabelImageMime.Open)
+	if err != nil {
+		return err
+	}
+	s.images[id+"/main"] = main
+	s.images[id+"/label"] = label
+
+	s.items[new.User+"/"+id] = &api.GetWardrobeResponse{
+		Id:          id,
+		Description: new.Description,
+		Brand:       new.Brand,
+		Tags:        new.Tags,
+		MainImage:   "main",
+		LabelImage:  "label",
+	}
+	return nil
+}
+
+func readForm(open func() (multipart.File, error)) ([]byte, error) {
+	f, err := open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ioutil.ReadAll(f)
+}
+
+func (s *fakeService) GetWardrobe(user string, id string) (*api.GetWardrobeResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.fail(); err != nil {
+		return nil, err
+	}
+
+	ward, ok := s.items[user+"/"+id]
+	if !ok {
+		return nil, &api.ItemNotFound{User: user, Id: id}
+	}
+	copy := *ward
+	return &copy, nil
+}
+
+// GetAllWardrobe pages through the items by id, the cursor is the last id
+// of the page before
+func (s *fakeService) GetAllWardrobe(user string, opts api.ListOptions) (*api.GetWardrobePage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var ids []string
+	for key, ward := range s.items {
+		if strings.HasPrefix(key, user+"/") && ward.Id > opts.Cursor {
+			ids = append(ids, ward.Id)
+		}
+	}
+	sort.Strings(ids)
+
+	page := &api.GetWardrobePage{Items: []*api.GetWardrobeResponse{}}
+	for _, id := range ids {
+		if opts.Limit > 0 && len(page.Items) == opts.Limit {
+			page.Next = page.Items[len(page.Items)-1].Id
+			break
+		}
+		copy := *s.items[user+"/"+id]
+		page.Items = append(page.Items, &copy)
+	}
+	return page, nil
+}
+
+func (s *fakeService) DeleteWardrobe(user string, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.items[user+"/"+id]; !ok {
+		return &api.ItemNotFound{User: user, Id: id}
+	}
+	delete(s.items, user+"/"+id)
+	return nil
+}
+
+func (s *fakeService) GetImage(user string, id string, filename string, cb api.HandleImage) error {
+	s.mu.Lock()
+	image, ok := s.images[id+"/"+filename]
+	s.mu.Unlock()
+	if !ok {
+		return &api.NoSuchFileOrDirectory{File: filename}
+	}
+
+	sum := sha256.Sum256(image)
+	return cb(bytes.NewReader(image), api.ImageMeta{
+		Name:    filename,
+		Size:    int64(len(image)),
+		Sum:     hex.EncodeToString(sum[:]),
+		ModTime: time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC),
+	})
+}
+
+func (s *fakeService) As(caller string) api.WardrobeService {
+	return s
+}
+
+func (s *fakeService) Access(caller string, user string) (api.Role, error) {
+	return api.RoleNone, nil
+}
+
+// newTestServer runs the real router over ws, open to everyone unless auth
+// is given
+func newTestServer(t *testing.T, ws api.WardrobeService, auth ...app.Authenticator) *httptest.Server {
+	gin.SetMode(gin.TestMode)
+	if len(auth) == 0 {
+		auth = []app.Authenticator{app.InsecureNoAuth()}
+	}
+	signer := app.NewURLSigner([]byte("secret"), 15*time.Minute)
+	server := httptest.NewServer(app.NewWardrobeServer(gin.New(), ws, signer, auth...).Routes())
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newTestClient(t *testing.T, server *httptest.Server, options client.Options) *client.Client {
+	if options.Backoff == 0 {
+		options.Backoff = time.Millisecond
+	}
+	c, err := client.New(server.URL, options)
+	if err != nil {
+		t.Fatalf("Expected nil, got %v", err)
+	}
+	return c
+}
+
+func TestClientItems(t *testing.T) {
+
+	ctx := context.Background()
+	ws := newFakeService()
+	c := newTestClient(t, newTestServer(t, ws), client.Options{})
+
+	for i, description := range []string{"Leggings", "Jeans", "Shirt"} {
+		err := c.AddWardrobe(ctx, "foobar", client.NewItem{
+			Description: description,
+			Brand:       "Acme",
+			Tags:        []string{"blue", "summer"},
+			Main:        client.Upload{Name: "main.jpg", ContentType: "image/jpeg", Content: strings.NewReader(fmt.Sprint("main ", i))},
+			Label:       client.Upload{Name: "label.jpg", ContentType: "image/jpeg", Content: strings.NewReader(fmt.Sprint("label ", i))},
+		})
+		if err != nil {
+			t.Fatalf("Expected nil, got %v", err)
+		}
+	}
+
+	ward, err := c.GetWardrobe(ctx, "foobar", "item-1")
+	if err != nil {
+		t.Fatalf("Expected nil, got %v", err)
+	}
+	if ward.Description != "Leggings" || ward.Brand != "Acme" || len(ward.Tags) != 2 {
+		t.Errorf("Unexpected item %+v", ward)
+	}
+
+	var ids []string
+	opts := api.ListOptions{Limit: 2}
+	for pages := 0; ; pages++ {
+		page, err := c.GetAllWardrobe(ctx, "foobar", opts)
+		if err != nil {
+			t.Fatalf("Expected nil, got %v", err)
+		}
+		for _, item := range page.Items {
+			ids = append(ids, item.Id)
+		}
+		if page.Next == "" {
+			break
+		}
+		if pages > 3 {
+			t.Fatalf("Expected the listing to end, got %v", ids)
+		}
+		opts.Cursor = page.Next
+	}
+	if strings.Join(ids, ",") != "item-1,item-2,item-3" {
+		t.Errorf("Unexpected listing %v", ids)
+	}
+
+	image, err := c.OpenImage(ctx, ward.LabelImage)
+	if err != nil {
+		t.Fatalf("Expected nil, got %v", err)
+	}
+	content, err := ioutil.ReadAll(image)
+	image.Close()
+	if err != nil || string(content) != "label 0" {
+		t.Errorf("Expected label image, got %q, %v", content, err)
+	}
+	if image.Size != int64(len(content)) || image.ETag == "" || image.ModTime.IsZero() {
+		t.Errorf("Unexpected image meta %+v", image)
+	}
+
+	err = c.DeleteWardrobe(ctx, "foobar", "item-1")
+	if err != nil {
+		t.Fatalf("Expected nil, got %v", err)
+	}
+
+	_, err = c.GetWardrobe(ctx, "foobar", "item-1")
+	if api.ErrorKindOf(err) != api.KindNotFound || api.ErrorCodeOf(err) != "item-not-found" {
+		t.Errorf("Expected item-not-found, got %v", err)
+	}
+}
+
+func TestClientUploadFile(t *testing.T) {
+
+	ctx := context.Background()
+	ws := newFakeService()
+	c := newTestClient(t, newTestServer(t, ws), client.Options{})
+
+	path := filepath.Join(t.TempDir(), "main.jpg")
+	if err := ioutil.WriteFile(path, []byte("from disk"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	main, f, err := client.OpenFile(path, "image/jpeg")
+	if err != nil {
+		t.Fatalf("Expected nil, got %v", err)
+	}
+	defer f.Close()
+
+	err = c.AddWardrobe(ctx, "foobar", client.NewItem{
+		Description: "Leggings",
+		Main:        main,
+		Label:       client.Upload{Name: "label.jpg", Content: strings.NewReader("label")},
+	})
+	if err != nil {
+		t.Fatalf("Expected nil, got %v", err)
+	}
+	if string(ws.images["item-1/main"]) != "from disk" {
+		t.Errorf("Unexpected upload %q", ws.images["item-1/main"])
+	}
+
+	err = c.AddWardrobe(ctx, "foobar", client.NewItem{Main: main, Label: main})
+	if api.ErrorKindOf(err) != api.KindValidation || api.ErrorCodeOf(err) != "invalid-body" {
+		t.Errorf("Expected invalid-body, got %v", err)
+	}
+}
+
+func TestClientRetries(t *testing.T) {
+
+	ctx := context.Background()
+	ws := newFakeService()
+	c := newTestClient(t, newTestServer(t, ws), client.Options{Retries: 2})
+
+	ws.items["foobar/item-1"] = &api.GetWardrobeResponse{Id: "item-1"}
+
+	ws.failures = 2
+	_, err := c.GetWardrobe(ctx, "foobar", "item-1")
+	if err != nil || ws.calls != 3 {
+		t.Errorf("Expected success on the third call, got %d calls, %v", ws.calls, err)
+	}
+
+	ws.failures, ws.calls = 3, 0
+	_, err = c.GetWardrobe(ctx, "foobar", "item-1")
+	if api.ErrorKindOf(err) != api.KindUnavailable || ws.calls != 3 {
+		t.Errorf("Expected unavailable after 3 calls, got %d calls, %v", ws.calls, err)
+	}
+
+	ws.failures, ws.calls = 1, 0
+	err = c.AddWardrobe(ctx, "foobar", client.NewItem{
+		Description: "Leggings",
+		Main:        client.Upload{Name: "main.jpg", Content: strings.NewReader("main")},
+		Label:       client.Upload{Name: "label.jpg", Content: strings.NewReader("label")},
+	})
+	if api.ErrorKindOf(err) != api.KindUnavailable || ws.calls != 1 {
+		t.Errorf("Expected uploads not to be retried, got %d calls, %v", ws.calls, err)
+	}
+
+	none := newTestClient(t, newTestServer(t, ws), client.Options{Retries: -1})
+	ws.failures, ws.calls = 1, 0
+	_, err = none.GetWardrobe(ctx, "foobar", "item-1")
+	if err == nil || ws.calls != 1 {
+		t.Errorf("Expected no retries, got %d calls, %v", ws.calls, err)
+	}
+}
+
+func TestClientAPIKey(t *testing.T) {
+
+	ctx := context.Background()
+	ws := newFakeService()
+	ws.items["foobar/item-1"] = &api.GetWardrobeResponse{Id: "item-1"}
+
+	sum := sha256.Sum256([]byte("key"))
+	path := filepath.Join(t.TempDir(), "keys.json")
+	keys := fmt.Sprintf(`[{"sha256": "%s", "user": "foobar"}]`, hex.EncodeToString(sum[:]))
+	if err := ioutil.WriteFile(path, []byte(keys), 0600); err != nil {
+		t.Fatal(err)
+	}
+	auth, err := app.NewAPIKeyAuthenticator(path)
+	if err != nil {
+		t.Fatalf("Expected nil, got %v", err)
+	}
+	server := newTestServer(t, ws, auth)
+
+	_, err = newTestClient(t, server, client.Options{}).GetWardrobe(ctx, "foobar", "item-1")
+	var e *client.Error
+	if !errors.As(err, &e) || e.Status != 401 || e.Code() != "unauthenticated" {
+		t.Errorf("Expected unauthenticated, got %v", err)
+	}
+
+	c := newTestClient(t, server, client.Options{APIKey: "key"})
+	if _, err := c.GetWardrobe(ctx, "foobar", "item-1"); err != nil {
+		t.Errorf("Expected nil, got %v", err)
+	}
+
+	_, err = c.GetWardrobe(ctx, "someone", "item-1")
+	if api.ErrorKindOf(err) != api.KindForbidden || api.ErrorCodeOf(err) != "forbidden" {
+		t.Errorf("Expected forbidden, got %v", err)
+	}
+}
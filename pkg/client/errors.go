@@ -0,0 +1,68 @@
+//
+// errors.go
+//
+
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"WardrobeManagerMS/pkg/api"
+)
+
+// Error is a request the server turned down. It carries the code of the
+// server's error and maps its status back to the kind, so api.ErrorKindOf
+// and api.ErrorCodeOf work on it as on errors of the service.
+type Error struct {
+	Status  int
+	Message string
+	code    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s (%d %s)", e.Message, e.Status, e.code)
+}
+
+// Code is the code of the server's error, http-<status> when the server
+// did not send one
+func (e *Error) Code() string { return e.code }
+
+func (e *Error) Kind() api.ErrorKind {
+	switch e.Status {
+	case http.StatusNotFound:
+		return api.KindNotFound
+	case http.StatusConflict:
+		return api.KindConflict
+	case http.StatusBadRequest:
+		return api.KindValidation
+	case http.StatusServiceUnavailable, http.StatusBadGateway, http.StatusGatewayTimeout, http.StatusTooManyRequests:
+		return api.KindUnavailable
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return api.KindForbidden
+	}
+	return api.KindInternal
+}
+
+// responseError reads the error body of resp, a body that is not an
+// api.ErrorResponse is described by the status alone
+func responseError(resp *http.Response) error {
+	defer resp.Body.Close()
+
+	e := &Error{Status: resp.StatusCode}
+
+	var body api.ErrorResponse
+	raw, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if json.Unmarshal(raw, &body) == nil && body.Code != "" {
+		e.code = body.Code
+		e.Message = body.Error
+	} else {
+		e.code = "http-" + fmt.Sprint(resp.StatusCode)
+		e.Message = http.StatusText(resp.StatusCode)
+	}
+
+	return e
+}
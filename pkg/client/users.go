@@ -0,0 +1,115 @@
+//
+// users.go
+//
+
+package client
+
+import (
+	"context"
+	"net/http"
+
+	"WardrobeManagerMS/pkg/api"
+)
+
+func (c *Client) RegisterUser(ctx context.Context, new api.NewUserRequest) (*api.GetUserResponse, error) {
+	var user api.GetUserResponse
+	err := c.callJSON(ctx, http.MethodPost, c.path("users"), &new, &user)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (c *Client) GetUser(ctx context.Context, user string) (*api.GetUserResponse, error) {
+	var got api.GetUserResponse
+	err := c.call(ctx, request{method: http.MethodGet, uri: c.path("users", user)}, &got)
+	if err != nil {
+		return nil, err
+	}
+	return &got, nil
+}
+
+func (c *Client) UpdateUser(ctx context.Context, user string, update api.UpdateUserRequest) (*api.GetUserResponse, error) {
+	var got api.GetUserResponse
+	err := c.callJSON(ctx, http.MethodPut, c.path("users", user), &update, &got)
+	if err != nil {
+		return nil, err
+	}
+	return &got, nil
+}
+
+func (c *Client) DeleteUser(ctx context.Context, user string) error {
+	return c.call(ctx, request{method: http.MethodDelete, uri: c.path("users", user)}, nil)
+}
+
+func (c *Client) ShareCloset(ctx context.Context, user string, share api.NewShareRequest) (*api.GetShareResponse, error) {
+	var got api.GetShareResponse
+	err := c.callJSON(ctx, http.MethodPost, c.path("users", user, "shares"), &share, &got)
+	if err != nil {
+		return nil, err
+	}
+	return &got, nil
+}
+
+func (c *Client) GetShares(ctx context.Context, user string) ([]*api.GetShareResponse, error) {
+	var shares []*api.GetShareResponse
+	err := c.call(ctx, request{method: http.MethodGet, uri: c.path("users", user, "shares")}, &shares)
+	if err != nil {
+		return nil, err
+	}
+	return shares, nil
+}
+
+func (c *Client) RevokeShare(ctx context.Context, user string, grantee string) error {
+	return c.call(ctx, request{method: http.MethodDelete, uri: c.path("users", user, "shares", grantee)}, nil)
+}
+
+func (c *Client) GetSharedWithMe(ctx context.Context, user string) ([]*api.GetShareResponse, error) {
+	var shares []*api.GetShareResponse
+	err := c.call(ctx, request{method: http.MethodGet, uri: c.path("users", user, "shared")}, &shares)
+	if err != nil {
+		return nil, err
+	}
+	return shares, nil
+}
+
+func (c *Client) AcceptShare(ctx context.Context, user string, owner string) error {
+	return c.call(ctx, request{method: http.MethodPost, uri: c.path("users", user, "shared", owner)}, nil)
+}
+
+func (c *Client) DeclineShare(ctx context.Context, user string, owner string) error {
+	return c.call(ctx, request{method: http.MethodDelete, uri: c.path("users", user, "shared", owner)}, nil)
+}
+
+// CreateShareLink returns the only copy of the token of the link
+func (c *Client) CreateShareLink(ctx context.Context, user string, link api.NewShareLinkRequest) (*api.GetShareLinkResponse, error) {
+	var got api.GetShareLinkResponse
+	err := c.callJSON(ctx, http.MethodPost, c.path("users", user, "links"), &link, &got)
+	if err != nil {
+		return nil, err
+	}
+	return &got, nil
+}
+
+func (c *Client) GetShareLinks(ctx context.Context, user string) ([]*api.GetShareLinkResponse, error) {
+	var links []*api.GetShareLinkResponse
+	err := c.call(ctx, request{method: http.MethodGet, uri: c.path("users", user, "links")}, &links)
+	if err != nil {
+		return nil, err
+	}
+	return links, nil
+}
+
+func (c *Client) RevokeShareLink(ctx context.Context, user string, id string) error {
+	return c.call(ctx, request{method: http.MethodDelete, uri: c.path("users", user, "links", id)}, nil)
+}
+
+// GetLook needs no credentials, the token is the authorization
+func (c *Client) GetLook(ctx context.Context, token string) (*api.GetLookResponse, error) {
+	var look api.GetLookResponse
+	err := c.call(ctx, request{method: http.MethodGet, uri: c.path("looks", token)}, &look)
+	if err != nil {
+		return nil, err
+	}
+	return &look, nil
+}
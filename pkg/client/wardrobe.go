@@ -0,0 +1,259 @@
+//
+// wardrobe.go
+//
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"WardrobeManagerMS/pkg/api"
+)
+
+// Upload is an image to upload, Content is read once while the request
+// is sent
+type Upload struct {
+	Name        string
+	ContentType string
+	Content     io.Reader
+}
+
+// NewItem is an item to add with its photo and label
+type NewItem struct {
+	Description string
+	Brand       string
+	Tags        []string
+	Main        Upload
+	Label       Upload
+}
+
+// Image is a downloaded image, its content is streamed from the server and
+// must be closed
+type Image struct {
+	io.ReadCloser
+	ContentType string
+	Size        int64
+	ETag        string
+	ModTime     time.Time
+}
+
+// OpenFile opens the file at path for upload, the caller closes it once
+// the upload is done
+func OpenFile(path string, contentType string) (Upload, *os.File, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Upload{}, nil, err
+	}
+	return Upload{Name: filepath.Base(path), ContentType: contentType, Content: f}, f, nil
+}
+
+// multipartItem streams item as a multipart form, the images are never
+// held in memory as a whole
+func multipartItem(item NewItem) (func() (io.Reader, error), string) {
+
+	pr, pw := io.Pipe()
+	form := multipart.NewWriter(pw)
+
+	write := func() error {
+		fields := [][2]string{{"description", item.Description}, {"brand", item.Brand}}
+		for _, tag := range item.Tags {
+			fields = append(fields, [2]string{"tags", tag})
+		}
+		for _, f := range fields {
+			if err := form.WriteField(f[0], f[1]); err != nil {
+				return err
+			}
+		}
+
+		for _, f := range []struct {
+			field  string
+			upload Upload
+		}{{"main-image", item.Main}, {"label-image", item.Label}} {
+			header := make(textproto.MIMEHeader)
+			header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`, f.field, f.upload.Name))
+			if f.upload.ContentType != "" {
+				header.Set("Content-Type", f.upload.ContentType)
+			}
+
+			part, err := form.CreatePart(header)
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(part, f.upload.Content); err != nil {
+				return err
+			}
+		}
+
+		return form.Close()
+	}
+
+	sent := false
+	body := func() (io.Reader, error) {
+		if sent {
+			return nil, fmt.Errorf("Upload of %s cannot be sent twice", item.Description)
+		}
+		sent = true
+
+		go func() {
+			pw.CloseWithError(write())
+		}()
+		return pr, nil
+	}
+
+	return body, form.FormDataContentType()
+}
+
+// AddWardrobe uploads a new item of user, uploads are never retried
+func (c *Client) AddWardrobe(ctx context.Context, user string, item NewItem) error {
+	body, contentType := multipartItem(item)
+
+	return c.call(ctx, request{
+		method:      http.MethodPost,
+		uri:         c.path("users", user, "wardrobes"),
+		body:        body,
+		contentType: contentType,
+	}, nil)
+}
+
+func (c *Client) GetWardrobe(ctx context.Context, user string, id string) (*api.GetWardrobeResponse, error) {
+	var ward api.GetWardrobeResponse
+	err := c.call(ctx, request{method: http.MethodGet, uri: c.path("users", user, "wardrobes", id)}, &ward)
+	if err != nil {
+		return nil, err
+	}
+	return &ward, nil
+}
+
+// GetAllWardrobe lists a page of the items of user, Next of the page is
+// the cursor of the page after it
+func (c *Client) GetAllWardrobe(ctx context.Context, user string, opts api.ListOptions) (*api.GetWardrobePage, error) {
+	page := &api.GetWardrobePage{}
+
+	next, err := c.list(ctx, c.path("users", user, "wardrobes"), opts, &page.Items)
+	if err != nil {
+		return nil, err
+	}
+	page.Next = next
+
+	return page, nil
+}
+
+func (c *Client) DeleteWardrobe(ctx context.Context, user string, id string) error {
+	return c.call(ctx, request{method: http.MethodDelete, uri: c.path("users", user, "wardrobes", id)}, nil)
+}
+
+func (c *Client) GetUsage(ctx context.Context, user string) (*api.GetUsageResponse, error) {
+	var usage api.GetUsageResponse
+	err := c.call(ctx, request{method: http.MethodGet, uri: c.path("users", user, "usage")}, &usage)
+	if err != nil {
+		return nil, err
+	}
+	return &usage, nil
+}
+
+func (c *Client) Search(ctx context.Context, user string, query string, limit int) ([]*api.SearchHit, error) {
+	q := url.Values{"q": {query}}
+	if limit > 0 {
+		q.Set("limit", strconv.Itoa(limit))
+	}
+
+	var hits []*api.SearchHit
+	err := c.call(ctx, request{method: http.MethodGet, uri: c.path("users", user, "search") + "?" + q.Encode()}, &hits)
+	if err != nil {
+		return nil, err
+	}
+	return hits, nil
+}
+
+func (c *Client) AddOutfit(ctx context.Context, user string, outfit api.NewOutfitRequest) error {
+	return c.callJSON(ctx, http.MethodPost, c.path("users", user, "outfits"), &outfit, nil)
+}
+
+func (c *Client) GetOutfit(ctx context.Context, user string, id string) (*api.GetOutfitResponse, error) {
+	var outfit api.GetOutfitResponse
+	err := c.call(ctx, request{method: http.MethodGet, uri: c.path("users", user, "outfits", id)}, &outfit)
+	if err != nil {
+		return nil, err
+	}
+	return &outfit, nil
+}
+
+func (c *Client) GetAllOutfits(ctx context.Context, user string, opts api.ListOptions) (*api.GetOutfitPage, error) {
+	page := &api.GetOutfitPage{}
+
+	next, err := c.list(ctx, c.path("users", user, "outfits"), opts, &page.Outfits)
+	if err != nil {
+		return nil, err
+	}
+	page.Next = next
+
+	return page, nil
+}
+
+func (c *Client) DeleteOutfit(ctx context.Context, user string, id string) error {
+	return c.call(ctx, request{method: http.MethodDelete, uri: c.path("users", user, "outfits", id)}, nil)
+}
+
+// OpenImage streams the image at uri, one of the image urls of an item or
+// a look as the server handed it out
+func (c *Client) OpenImage(ctx context.Context, uri string) (*Image, error) {
+
+	resp, err := c.do(ctx, request{method: http.MethodGet, uri: uri})
+	if err != nil {
+		return nil, err
+	}
+
+	modTime, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+	return &Image{
+		ReadCloser:  resp.Body,
+		ContentType: resp.Header.Get("Content-Type"),
+		Size:        resp.ContentLength,
+		ETag:        resp.Header.Get("ETag"),
+		ModTime:     modTime,
+	}, nil
+}
+
+// list gets a page of the listing at path into out and returns the cursor
+// of the next page
+func (c *Client) list(ctx context.Context, path string, opts api.ListOptions, out interface{}) (string, error) {
+	q := url.Values{}
+	if opts.Limit > 0 {
+		q.Set("limit", strconv.Itoa(opts.Limit))
+	}
+	if opts.Cursor != "" {
+		q.Set("cursor", opts.Cursor)
+	}
+	if opts.Sort != "" {
+		q.Set("sort", opts.Sort)
+	}
+	for field, value := range opts.Filter {
+		q.Set("filter["+field+"]", value)
+	}
+
+	uri := path
+	if len(q) > 0 {
+		uri += "?" + q.Encode()
+	}
+
+	resp, err := c.do(ctx, request{method: http.MethodGet, uri: uri})
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	err = decode(resp, out)
+	if err != nil {
+		return "", err
+	}
+	return nextCursor(resp), nil
+}
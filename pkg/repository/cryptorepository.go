@@ -0,0 +1,422 @@
+//
+// cryptorepository.go
+//
+
+package repository
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/golang/glog"
+
+	"WardrobeManagerMS/pkg/api"
+)
+
+// Encrypted images start with a header naming the data key, followed by the
+// image split in AES-GCM sealed segments. The nonce of every segment is the
+// random prefix from the header, the segment counter and a last segment
+// flag, so segments cannot be reordered or the image truncated.
+const (
+	encMagic       = "WMENC1"
+	encPrefixSize  = 7
+	encSegmentSize = 64 * 1024
+	encTagSize     = 16
+)
+
+var errNotEncrypted = errors.New("image is not encrypted")
+
+// ImageCorrupted is returned for an encrypted image that cannot be read back
+// as it was written, a cut off header or a segment failing authentication
+type ImageCorrupted struct {
+	File string
+	Err  error
+}
+
+func (e *ImageCorrupted) Error() string {
+	return fmt.Sprintf("Encrypted file %s is corrupted : %v", e.File, e.Err)
+}
+
+func (e *ImageCorrupted) Unwrap() error {
+	return e.Err
+}
+
+// ImageState tells the scrubber and image reads how the image is damaged
+func (e *ImageCorrupted) ImageState() string {
+	return api.ImageCorrupted
+}
+
+// encryptedImageRepo encrypts images on their way into the wrapped
+// repository and decrypts them on the way out
+type encryptedImageRepo struct {
+	inner api.ImageRepository
+	keys  *KeyRing
+	user  string
+}
+
+func NewEncryptedImageRepository(inner api.ImageRepository, keys *KeyRing) api.ImageRepository {
+	return &encryptedImageRepo{
+		inner: inner,
+		keys:  keys,
+	}
+}
+
+// ForUser returns a view that encrypts new images with user's data key
+func (m *encryptedImageRepo) ForUser(user string) api.ImageRepository {
+	return &encryptedImageRepo{
+		inner: m.inner,
+		keys:  m.keys,
+		user:  user,
+	}
+}
+
+func (m *encryptedImageRepo) AddFile(name string, file []byte) error {
+	return m.AddFileFromFile(name, bytes.NewReader(file))
+}
+
+func (m *encryptedImageRepo) GetFile(name string) ([]byte, error) {
+
+	data, err := m.inner.GetFile(name)
+	if err != nil {
+		return data, err
+	}
+
+	rd, err := m.decrypter(bytes.NewReader(data), name)
+	if err != nil {
+		return nil, err
+	}
+
+	plain, err := ioutil.ReadAll(rd)
+	if err != nil {
+		return nil, fmt.Errorf("Error decrypting file %s : %w", name, err)
+	}
+
+	return plain, nil
+}
+
+func (m *encryptedImageRepo) UpdateFile(name string, file []byte) error {
+
+	var sealed bytes.Buffer
+	err := m.encrypt(&sealed, bytes.NewReader(file))
+	if err != nil {
+		return fmt.Errorf("Error encrypting file %s : %w", name, err)
+	}
+
+	return m.inner.UpdateFile(name, sealed.Bytes())
+}
+
+// HasFile needs no key, whether the file is there is up to the wrapped
+// repository
+func (m *encryptedImageRepo) HasFile(name string) (bool, error) {
+	return api.ImageExists(m.inner, name)
+}
+
+func (m *encryptedImageRepo) DeleteFile(name string) error {
+	return m.inner.DeleteFile(name)
+}
+
+// AddFileFromFile encrypts rd segment by segment while the wrapped
+// repository stores it
+func (m *encryptedImageRepo) AddFileFromFile(name string, rd io.Reader) error {
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(m.encrypt(pw, rd))
+	}()
+
+	err := m.inner.AddFileFromFile(name, pr)
+	pr.Close()
+	if err != nil {
+		return fmt.Errorf("Error storing encrypted file %s : %w", name, err)
+	}
+
+	return nil
+}
+
+// GetFileWithHandler decrypts into a temporary file, since the handler works
+// on a path, and removes it once the handler returns
+func (m *encryptedImageRepo) GetFileWithHandler(filename string, fileHandler api.HandleFile) error {
+
+	if fileHandler == nil {
+		return nil
+	}
+
+	return m.inner.GetFileWithHandler(filename, func(path string) error {
+
+		f, err := os.Open(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return &api.NoSuchFileOrDirectory{
+					File: filename,
+				}
+			}
+			return fmt.Errorf("Error opening file %s : %w", path, err)
+		}
+		defer f.Close()
+
+		rd, err := m.decrypter(f, filename)
+		if err != nil {
+			return err
+		}
+
+		tmp, err := ioutil.TempFile("", "decrypted-image-")
+		if err != nil {
+			return fmt.Errorf("Error creating temp file for %s : %w", filename, err)
+		}
+		defer os.Remove(tmp.Name())
+
+		_, err = io.Copy(tmp, rd)
+		tmp.Close()
+		if err != nil {
+			return fmt.Errorf("Error decrypting file %s : %w", filename, err)
+		}
+
+		return fileHandler(tmp.Name())
+	})
+}
+
+func (m *encryptedImageRepo) ListFiles() ([]api.ImageInfo, error) {
+	return m.inner.ListFiles()
+}
+
+// ReEncrypt moves every image in the wrapped repository that is stored in
+// plain text, under a retired data key or under a key of no user onto its
+// owner's current key. Images without a user are owned by the closet that
+// references them, those no closet references are left for the image gc.
+func ReEncrypt(inner api.ImageRepository, keys *KeyRing, db api.WardrobeRepository) (int, error) {
+
+	images, err := inner.ListFiles()
+	if err != nil {
+		return 0, fmt.Errorf("Error listing image repository : %w", err)
+	}
+
+	count := 0
+	for _, image := range images {
+
+		data, err := inner.GetFile(image.Name)
+		if err != nil {
+			return count, err
+		}
+
+		user := ""
+		id, err := readHeaderKeyId(bufio.NewReader(bytes.NewReader(data)))
+		switch err {
+		case nil:
+			retired, owner := keys.IsRetired(id)
+			if !retired && owner != "" {
+				continue
+			}
+			user = owner
+		case errNotEncrypted:
+		default:
+			return count, fmt.Errorf("Error reading header of %s : %w", image.Name, err)
+		}
+
+		if user == "" {
+			wc, err := db.FindByImage(image.Name)
+			switch err.(type) {
+			case nil:
+				user = wc.User
+			case *api.UserNotFound:
+				glog.Warningf("not re-encrypting image no closet references {file=%s}", image.Name)
+				continue
+			default:
+				return count, fmt.Errorf("Error looking up the owner of %s : %w", image.Name, err)
+			}
+		}
+
+		repo := &encryptedImageRepo{inner: inner, keys: keys, user: user}
+
+		plain, err := repo.GetFile(image.Name)
+		if err != nil {
+			return count, err
+		}
+
+		err = repo.UpdateFile(image.Name, plain)
+		if err != nil {
+			return count, err
+		}
+
+		glog.Infof("re-encrypted {file=%s}", image.Name)
+		count++
+	}
+
+	return count, nil
+}
+
+func (m *encryptedImageRepo) encrypt(dst io.Writer, src io.Reader) error {
+
+	id, key, err := m.keys.UserKey(m.user)
+	if err != nil {
+		return err
+	}
+
+	aead, err := newGCM(key)
+	if err != nil {
+		return err
+	}
+
+	prefix, err := randomBytes(encPrefixSize)
+	if err != nil {
+		return err
+	}
+
+	header := make([]byte, 0, len(encMagic)+1+len(id)+encPrefixSize)
+	header = append(header, encMagic...)
+	header = append(header, byte(len(id)))
+	header = append(header, id...)
+	header = append(header, prefix...)
+	if _, err := dst.Write(header); err != nil {
+		return err
+	}
+
+	brd := bufio.NewReaderSize(src, encSegmentSize)
+	plain := make([]byte, encSegmentSize)
+	sealed := make([]byte, 0, encSegmentSize+encTagSize)
+
+	for counter := uint32(0); ; counter++ {
+		n, err := io.ReadFull(brd, plain)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return err
+		}
+
+		last := err != nil
+		if !last {
+			if _, err := brd.Peek(1); err == io.EOF {
+				last = true
+			}
+		}
+
+		sealed = aead.Seal(sealed[:0], segmentNonce(prefix, counter, last), plain[:n], nil)
+		if _, err := dst.Write(sealed); err != nil {
+			return err
+		}
+
+		if last {
+			return nil
+		}
+	}
+}
+
+// decrypter returns a reader of the plain image in src. Images written before
+// encryption was turned on are passed through until re-encrypted.
+func (m *encryptedImageRepo) decrypter(src io.Reader, name string) (io.Reader, error) {
+
+	brd := bufio.NewReaderSize(src, encSegmentSize+encTagSize)
+
+	id, err := readHeaderKeyId(brd)
+	if err == errNotEncrypted {
+		glog.Warningf("serving unencrypted image {file=%s}", name)
+		return brd, nil
+	}
+	if err != nil {
+		return nil, &ImageCorrupted{File: name, Err: fmt.Errorf("reading header : %w", err)}
+	}
+
+	key, err := m.keys.DataKey(id)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := make([]byte, encPrefixSize)
+	if _, err := io.ReadFull(brd, prefix); err != nil {
+		return nil, &ImageCorrupted{File: name, Err: fmt.Errorf("reading header : %w", err)}
+	}
+
+	return &decryptReader{
+		name:   name,
+		src:    brd,
+		aead:   aead,
+		prefix: prefix,
+		sealed: make([]byte, encSegmentSize+encTagSize),
+	}, nil
+}
+
+func readHeaderKeyId(brd *bufio.Reader) (string, error) {
+
+	magic, err := brd.Peek(len(encMagic))
+	if err != nil || string(magic) != encMagic {
+		return "", errNotEncrypted
+	}
+	brd.Discard(len(encMagic))
+
+	n, err := brd.ReadByte()
+	if err != nil {
+		return "", err
+	}
+
+	id := make([]byte, n)
+	if _, err := io.ReadFull(brd, id); err != nil {
+		return "", err
+	}
+
+	return string(id), nil
+}
+
+type decryptReader struct {
+	name    string
+	src     *bufio.Reader
+	aead    cipher.AEAD
+	prefix  []byte
+	counter uint32
+	sealed  []byte
+	plain   []byte
+	done    bool
+}
+
+func (d *decryptReader) Read(p []byte) (int, error) {
+
+	for len(d.plain) == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+
+		n, err := io.ReadFull(d.src, d.sealed)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return 0, err
+		}
+
+		last := err != nil
+		if !last {
+			if _, err := d.src.Peek(1); err == io.EOF {
+				last = true
+			}
+		}
+
+		d.plain, err = d.aead.Open(d.sealed[:0], segmentNonce(d.prefix, d.counter, last), d.sealed[:n], nil)
+		if err != nil {
+			return 0, &ImageCorrupted{File: d.name, Err: fmt.Errorf("segment %d failed authentication : %w", d.counter, err)}
+		}
+
+		d.counter++
+		d.done = last
+	}
+
+	n := copy(p, d.plain)
+	d.plain = d.plain[n:]
+	return n, nil
+}
+
+func segmentNonce(prefix []byte, counter uint32, last bool) []byte {
+
+	nonce := make([]byte, encPrefixSize+5)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[encPrefixSize:], counter)
+	if last {
+		nonce[encPrefixSize+4] = 1
+	}
+
+	return nonce
+}
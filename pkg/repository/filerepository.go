@@ -8,15 +8,21 @@ package repository
 
 import (
 	"bufio"
+	"bytes"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
+	"strings"
 
 	"path/filepath"
 
 	"WardrobeManagerMS/pkg/api"
 )
 
+// in-progress writes are hidden behind this prefix until renamed into place
+const tempFilePrefix = ".tmp-"
+
 type fileImageRepo struct {
 	Dir string
 }
@@ -35,30 +41,18 @@ func NewFileImageRepository(path string) (api.ImageRepository, error) {
 }
 
 func (m *fileImageRepo) AddFile(name string, file []byte) error {
-
-	path := filepath.Join(m.Dir, name)
-
-	f, err := os.Create(path)
-	if err != nil {
-		return fmt.Errorf("Error create file %s : %w", path, err)
-	}
-	defer f.Close()
-
-	_, err = f.Write(file)
-
-	if err != nil {
-		return fmt.Errorf("Error writing to file %s : %w", path, err)
-	}
-
-	return nil
+	return m.AddFileFromFile(name, bytes.NewReader(file))
 }
 
 func (m *fileImageRepo) GetFile(name string) ([]byte, error) {
 
-	filename := filepath.Join(m.Dir, name)
+	filename, err := m.path(name)
+	if err != nil {
+		return nil, err
+	}
 
 	if _, err := os.Stat(filename); os.IsNotExist(err) {
-		return []byte{}, api.NoSuchFileOrDirectory{
+		return []byte{}, &api.NoSuchFileOrDirectory{
 			File: filename,
 		}
 	}
@@ -87,20 +81,41 @@ func (m *fileImageRepo) GetFile(name string) ([]byte, error) {
 
 }
 
+func (m *fileImageRepo) HasFile(name string) (bool, error) {
+
+	filename, err := m.path(name)
+	if err != nil {
+		return false, err
+	}
+
+	_, err = os.Stat(filename)
+	switch {
+	case err == nil:
+		return true, nil
+	case os.IsNotExist(err):
+		return false, nil
+	default:
+		return false, fmt.Errorf("Error getting stats for file %s : %w", filename, err)
+	}
+}
+
 func (m *fileImageRepo) UpdateFile(name string, file []byte) error {
-	return nil
+	return m.AddFile(name, file)
 }
 
 func (m *fileImageRepo) DeleteFile(name string) error {
-	filename := filepath.Join(m.Dir, name)
+	filename, err := m.path(name)
+	if err != nil {
+		return err
+	}
 
 	if _, err := os.Stat(filename); os.IsNotExist(err) {
-		return api.NoSuchFileOrDirectory{
+		return &api.NoSuchFileOrDirectory{
 			File: filename,
 		}
 	}
 
-	err := os.Remove(filename)
+	err = os.Remove(filename)
 	if err != nil {
 		return fmt.Errorf("Error removing file %s : %w", filename, err)
 	}
@@ -108,27 +123,48 @@ func (m *fileImageRepo) DeleteFile(name string) error {
 	return nil
 }
 
+// AddFileFromFile writes to a temp file in the same directory and renames it
+// into place, so a crash never leaves a truncated image under its final name
 func (m *fileImageRepo) AddFileFromFile(name string, rd io.Reader) error {
 
-	path := filepath.Join(m.Dir, name)
+	path, err := m.path(name)
+	if err != nil {
+		return err
+	}
 
-	f, err := os.Create(path)
+	f, err := ioutil.TempFile(m.Dir, tempFilePrefix+name+"-")
 	if err != nil {
-		return fmt.Errorf("Error create file %s : %w", path, err)
+		return fmt.Errorf("Error create temp file for %s : %w", path, err)
 	}
-	defer f.Close()
+	tmpPath := f.Name()
 
 	_, err = io.Copy(f, rd)
+	if err == nil {
+		err = f.Sync()
+	}
+	if err1 := f.Close(); err == nil {
+		err = err1
+	}
 	if err != nil {
+		os.Remove(tmpPath)
 		return fmt.Errorf("Error writing to file %s : %w", path, err)
 	}
 
+	err = os.Rename(tmpPath, path)
+	if err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("Error renaming %s to %s : %w", tmpPath, path, err)
+	}
+
 	return nil
 }
 
 func (m *fileImageRepo) GetFileWithHandler(filename string, fileHandler api.HandleFile) error {
 
-	fullpath := filepath.Join(m.Dir, filename)
+	fullpath, err := m.path(filename)
+	if err != nil {
+		return err
+	}
 
 	if fileHandler != nil {
 		err := fileHandler(fullpath)
@@ -139,3 +175,37 @@ func (m *fileImageRepo) GetFileWithHandler(filename string, fileHandler api.Hand
 
 	return nil
 }
+
+// path maps an image name to its file, names that could escape the image
+// directory are rejected
+func (m *fileImageRepo) path(name string) (string, error) {
+
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) || strings.HasPrefix(name, tempFilePrefix) {
+		return "", fmt.Errorf("Invalid image name %q", name)
+	}
+
+	return filepath.Join(m.Dir, name), nil
+}
+
+func (m *fileImageRepo) ListFiles() ([]api.ImageInfo, error) {
+
+	entries, err := ioutil.ReadDir(m.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading directory %s : %w", m.Dir, err)
+	}
+
+	infos := make([]api.ImageInfo, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), tempFilePrefix) {
+			continue
+		}
+
+		infos = append(infos, api.ImageInfo{
+			Name:    entry.Name(),
+			Size:    entry.Size(),
+			ModTime: entry.ModTime(),
+		})
+	}
+
+	return infos, nil
+}
@@ -0,0 +1,234 @@
+//
+// gridfsrepository.go
+//
+
+package repository
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"WardrobeManagerMS/pkg/api"
+)
+
+type gridFSImageRepo struct {
+	bucket *gridfs.Bucket
+}
+
+func NewGridFSImageRepository(server string) (api.ImageRepository, error) {
+
+	fmt.Printf("Initializing GridFS Image Store {server=%s}\n", server)
+	client, err := connectMongo(server)
+	if err != nil {
+		return nil, err
+	}
+
+	bucket, err := gridfs.NewBucket(client.Database(DB), options.GridFSBucket().SetName(IMAGES))
+	if err != nil {
+		return nil, err
+	}
+
+	imageRepo := &gridFSImageRepo{
+		bucket: bucket,
+	}
+
+	return imageRepo, nil
+}
+
+func (m *gridFSImageRepo) AddFile(name string, file []byte) error {
+	return m.AddFileFromFile(name, bytes.NewReader(file))
+}
+
+func (m *gridFSImageRepo) GetFile(name string) ([]byte, error) {
+
+	ds, err := m.bucket.OpenDownloadStreamByName(name)
+	if err != nil {
+		if err == gridfs.ErrFileNotFound {
+			return []byte{}, &api.NoSuchFileOrDirectory{
+				File: name,
+			}
+		}
+		return nil, fmt.Errorf("Error opening gridfs file %s : %w", name, err)
+	}
+	defer ds.Close()
+
+	bytes, err := ioutil.ReadAll(ds)
+	if err != nil {
+		return nil, fmt.Errorf("Error while reading bytes from gridfs file %s : %w", name, err)
+	}
+
+	return bytes, nil
+}
+
+// HasFile looks the file up without downloading it
+func (m *gridFSImageRepo) HasFile(name string) (bool, error) {
+
+	files, err := m.findLimit(bson.M{"filename": name}, 1)
+	if err != nil {
+		return false, err
+	}
+
+	return len(files) > 0, nil
+}
+
+// UpdateFile uploads a new revision and then drops all older ones
+func (m *gridFSImageRepo) UpdateFile(name string, file []byte) error {
+
+	old, err := m.find(bson.M{"filename": name})
+	if err != nil {
+		return err
+	}
+
+	err = m.AddFile(name, file)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range old {
+		if err := m.bucket.Delete(f.ID); err != nil {
+			return fmt.Errorf("Error removing old revision of gridfs file %s : %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+func (m *gridFSImageRepo) DeleteFile(name string) error {
+
+	files, err := m.find(bson.M{"filename": name})
+	if err != nil {
+		return err
+	}
+
+	if len(files) == 0 {
+		return &api.NoSuchFileOrDirectory{
+			File: name,
+		}
+	}
+
+	for _, f := range files {
+		if err := m.bucket.Delete(f.ID); err != nil {
+			return fmt.Errorf("Error removing gridfs file %s : %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// AddFileFromFile streams rd into GridFS chunk by chunk
+func (m *gridFSImageRepo) AddFileFromFile(name string, rd io.Reader) error {
+
+	_, err := m.bucket.UploadFromStream(name, rd)
+	if err != nil {
+		return fmt.Errorf("Error writing to gridfs file %s : %w", name, err)
+	}
+
+	return nil
+}
+
+// GetFileWithHandler streams the file into a temporary file, since the
+// handler works on a path, and removes it once the handler returns
+func (m *gridFSImageRepo) GetFileWithHandler(filename string, fileHandler api.HandleFile) error {
+
+	if fileHandler == nil {
+		return nil
+	}
+
+	ds, err := m.bucket.OpenDownloadStreamByName(filename)
+	if err != nil {
+		if err == gridfs.ErrFileNotFound {
+			return &api.NoSuchFileOrDirectory{
+				File: filename,
+			}
+		}
+		return fmt.Errorf("Error opening gridfs file %s : %w", filename, err)
+	}
+	defer ds.Close()
+
+	tmp, err := ioutil.TempFile("", "gridfs-image-")
+	if err != nil {
+		return fmt.Errorf("Error creating temp file for %s : %w", filename, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = io.Copy(tmp, ds)
+	tmp.Close()
+	if err != nil {
+		return fmt.Errorf("Error copying gridfs file %s : %w", filename, err)
+	}
+
+	err = fileHandler(tmp.Name())
+	if err != nil {
+		return fmt.Errorf("file handler call failed for file %s : %w", filename, err)
+	}
+
+	return nil
+}
+
+// ListFiles reports one entry per file name, using the latest revision
+func (m *gridFSImageRepo) ListFiles() ([]api.ImageInfo, error) {
+
+	files, err := m.find(bson.M{})
+	if err != nil {
+		return nil, err
+	}
+
+	latest := make(map[string]gridfs.File)
+	for _, f := range files {
+		if prev, ok := latest[f.Name]; !ok || f.UploadDate.After(prev.UploadDate) {
+			latest[f.Name] = f
+		}
+	}
+
+	infos := make([]api.ImageInfo, 0, len(latest))
+	for _, f := range latest {
+		infos = append(infos, api.ImageInfo{
+			Name:    f.Name,
+			Size:    f.Length,
+			ModTime: f.UploadDate,
+		})
+	}
+
+	return infos, nil
+}
+
+func (m *gridFSImageRepo) find(filter interface{}) ([]gridfs.File, error) {
+	return m.findLimit(filter, 0)
+}
+
+func (m *gridFSImageRepo) findLimit(filter interface{}, limit int32) ([]gridfs.File, error) {
+
+	opts := options.GridFSFind()
+	if limit > 0 {
+		opts.SetLimit(limit)
+	}
+
+	cursor, err := m.bucket.Find(filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("Error looking up gridfs files : %w", err)
+	}
+	defer cursor.Close(context.TODO())
+
+	files := make([]gridfs.File, 0)
+	for cursor.Next(context.TODO()) {
+		var f gridfs.File
+		if err := cursor.Decode(&f); err != nil {
+			return nil, fmt.Errorf("Error decoding gridfs file : %w", err)
+		}
+		files = append(files, f)
+	}
+
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("Error looking up gridfs files : %w", err)
+	}
+
+	return files, nil
+}
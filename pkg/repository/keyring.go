@@ -0,0 +1,361 @@
+//
+// keyring.go
+//
+
+package repository
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+const keySize = 32
+
+// masterKeys is the key file. Master keys never touch image data, they only
+// wrap the per user data keys.
+type masterKeys struct {
+	Active string            `json:"active"`
+	Keys   map[string][]byte `json:"keys"`
+}
+
+type dataKey struct {
+	User    string `json:"user"`
+	Master  string `json:"master"`
+	Wrapped []byte `json:"wrapped"`
+	Retired bool   `json:"retired"`
+}
+
+// dataKeys holds every data key ever issued, wrapped by a master key, and
+// the key each user currently encrypts with
+type dataKeys struct {
+	Users map[string]string   `json:"users"`
+	Keys  map[string]*dataKey `json:"keys"`
+}
+
+// KeyRing hands out per user AES-256 data keys for envelope encryption
+type KeyRing struct {
+	mu       sync.Mutex
+	dataPath string
+	master   masterKeys
+	data     dataKeys
+	cache    map[string][]byte
+}
+
+func OpenKeyRing(masterPath, dataPath string) (*KeyRing, error) {
+
+	k := &KeyRing{
+		dataPath: dataPath,
+		data: dataKeys{
+			Users: make(map[string]string),
+			Keys:  make(map[string]*dataKey),
+		},
+		cache: make(map[string][]byte),
+	}
+
+	err := readJSON(masterPath, &k.master)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading master key file %s : %w", masterPath, err)
+	}
+
+	if _, ok := k.master.Keys[k.master.Active]; !ok {
+		return nil, fmt.Errorf("Active master key %s not found in %s", k.master.Active, masterPath)
+	}
+
+	err = readJSON(dataPath, &k.data)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("Error reading data key file %s : %w", dataPath, err)
+	}
+
+	return k, nil
+}
+
+// GenerateMasterKey adds a new random master key to the key file, creating
+// it if needed, and makes it the active one
+func GenerateMasterKey(masterPath string) (string, error) {
+
+	var master masterKeys
+	err := readJSON(masterPath, &master)
+	if err != nil && !os.IsNotExist(err) {
+		return "", fmt.Errorf("Error reading master key file %s : %w", masterPath, err)
+	}
+	if master.Keys == nil {
+		master.Keys = make(map[string][]byte)
+	}
+
+	id := uuid.New().String()
+	key, err := randomBytes(keySize)
+	if err != nil {
+		return "", err
+	}
+
+	master.Keys[id] = key
+	master.Active = id
+
+	err = writeJSON(masterPath, &master)
+	if err != nil {
+		return "", fmt.Errorf("Error writing master key file %s : %w", masterPath, err)
+	}
+
+	return id, nil
+}
+
+// UserKey returns the data key user encrypts with, issuing one on first use
+func (k *KeyRing) UserKey(user string) (string, []byte, error) {
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if id, ok := k.data.Users[user]; ok {
+		key, err := k.unwrap(id)
+		return id, key, err
+	}
+
+	return k.issue(user)
+}
+
+// DataKey returns the data key with the given id, retired or not
+func (k *KeyRing) DataKey(id string) ([]byte, error) {
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	return k.unwrap(id)
+}
+
+// IsRetired reports whether id has been replaced, along with its user
+func (k *KeyRing) IsRetired(id string) (bool, string) {
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	dk, ok := k.data.Keys[id]
+	if !ok {
+		return false, ""
+	}
+	return dk.Retired, dk.User
+}
+
+// RotateUserKey issues user a new data key and retires the old one. Images
+// stay readable and move to the new key when re-encrypted.
+func (k *KeyRing) RotateUserKey(user string) (string, error) {
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	old, rotated := k.data.Users[user]
+	if rotated {
+		k.data.Keys[old].Retired = true
+	}
+
+	id, _, err := k.issue(user)
+	if err != nil && rotated {
+		k.data.Keys[old].Retired = false
+	}
+
+	return id, err
+}
+
+// Rewrap wraps every data key with the active master key, so older master
+// keys can be removed from the key file
+func (k *KeyRing) Rewrap() (int, error) {
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	count := 0
+	for id, dk := range k.data.Keys {
+		if dk.Master == k.master.Active {
+			continue
+		}
+
+		key, err := k.unwrap(id)
+		if err != nil {
+			return count, err
+		}
+
+		wrapped, err := seal(k.master.Keys[k.master.Active], key, []byte(id))
+		if err != nil {
+			return count, err
+		}
+
+		dk.Master = k.master.Active
+		dk.Wrapped = wrapped
+		count++
+	}
+
+	if count == 0 {
+		return 0, nil
+	}
+
+	return count, k.save()
+}
+
+func (k *KeyRing) issue(user string) (string, []byte, error) {
+
+	id := uuid.New().String()
+	key, err := randomBytes(keySize)
+	if err != nil {
+		return "", nil, err
+	}
+
+	wrapped, err := seal(k.master.Keys[k.master.Active], key, []byte(id))
+	if err != nil {
+		return "", nil, err
+	}
+
+	// a key that could not be saved is forgotten, user keeps the key it had
+	previous, had := k.data.Users[user]
+
+	k.data.Keys[id] = &dataKey{
+		User:    user,
+		Master:  k.master.Active,
+		Wrapped: wrapped,
+	}
+	k.data.Users[user] = id
+	k.cache[id] = key
+
+	err = k.save()
+	if err != nil {
+		delete(k.data.Keys, id)
+		delete(k.cache, id)
+		if had {
+			k.data.Users[user] = previous
+		} else {
+			delete(k.data.Users, user)
+		}
+		return "", nil, err
+	}
+
+	return id, key, nil
+}
+
+func (k *KeyRing) unwrap(id string) ([]byte, error) {
+
+	if key, ok := k.cache[id]; ok {
+		return key, nil
+	}
+
+	dk, ok := k.data.Keys[id]
+	if !ok {
+		return nil, fmt.Errorf("Data key %s not found", id)
+	}
+
+	master, ok := k.master.Keys[dk.Master]
+	if !ok {
+		return nil, fmt.Errorf("Master key %s for data key %s not found", dk.Master, id)
+	}
+
+	key, err := open(master, dk.Wrapped, []byte(id))
+	if err != nil {
+		return nil, fmt.Errorf("Error unwrapping data key %s : %w", id, err)
+	}
+
+	k.cache[id] = key
+	return key, nil
+}
+
+func (k *KeyRing) save() error {
+	err := writeJSON(k.dataPath, &k.data)
+	if err != nil {
+		return fmt.Errorf("Error writing data key file %s : %w", k.dataPath, err)
+	}
+	return nil
+}
+
+// seal encrypts a small value with AES-GCM, prefixing the random nonce
+func seal(key, plaintext, ad []byte) ([]byte, error) {
+
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce, err := randomBytes(aead.NonceSize())
+	if err != nil {
+		return nil, err
+	}
+
+	return aead.Seal(nonce, nonce, plaintext, ad), nil
+}
+
+func open(key, sealed, ad []byte) ([]byte, error) {
+
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sealed) < aead.NonceSize() {
+		return nil, fmt.Errorf("sealed value too short")
+	}
+
+	return aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], ad)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+func randomBytes(n int) ([]byte, error) {
+
+	b := make([]byte, n)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		return nil, fmt.Errorf("Error reading random bytes : %w", err)
+	}
+
+	return b, nil
+}
+
+func readJSON(path string, v interface{}) error {
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, v)
+}
+
+// writeJSON replaces path atomically, key files are only readable by us
+func writeJSON(path string, v interface{}) error {
+
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(path), tempFilePrefix+filepath.Base(path)+"-")
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if err1 := f.Close(); err == nil {
+		err = err1
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	return os.Rename(f.Name(), path)
+}
@@ -0,0 +1,125 @@
+//
+// linkrepository.go
+//
+
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"WardrobeManagerMS/pkg/api"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const LINKS = "links"
+
+type mongoLinkRepo struct {
+	collection *mongo.Collection
+}
+
+func NewLinkRepository(server string) (api.LinkRepository, error) {
+
+	client, err := connectMongo(server)
+	if err != nil {
+		return nil, err
+	}
+
+	newCollection := client.Database(DB).Collection(LINKS)
+
+	_, err = newCollection.Indexes().CreateMany(
+		context.Background(),
+		[]mongo.IndexModel{
+			{
+				Keys:    bson.D{{Key: "id", Value: 1}},
+				Options: options.Index().SetUnique(true),
+			},
+			{
+				Keys:    bson.D{{Key: "token-sha256", Value: 1}},
+				Options: options.Index().SetUnique(true),
+			},
+			{
+				Keys: bson.D{{Key: "owner", Value: 1}},
+			},
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &mongoLinkRepo{
+		collection: newCollection,
+	}, nil
+}
+
+func (m *mongoLinkRepo) Add(link *api.ShareLink) error {
+	_, err := m.collection.InsertOne(context.TODO(), link)
+	if err != nil {
+		return fmt.Errorf("Error adding link %s : %w", link.Identifier, err)
+	}
+
+	return nil
+}
+
+func (m *mongoLinkRepo) Get(id string) (*api.ShareLink, error) {
+	return m.findOne(bson.M{"id": id}, id)
+}
+
+func (m *mongoLinkRepo) GetByToken(tokenSum string) (*api.ShareLink, error) {
+	return m.findOne(bson.M{"token-sha256": tokenSum}, "")
+}
+
+func (m *mongoLinkRepo) findOne(filter bson.M, id string) (*api.ShareLink, error) {
+
+	var link api.ShareLink
+
+	err := m.collection.FindOne(context.TODO(), filter).Decode(&link)
+	if err != nil {
+
+		if err == mongo.ErrNoDocuments {
+			return nil, &api.LinkNotFound{Link: id}
+		}
+
+		return nil, mongoError(err)
+	}
+
+	return &link, nil
+}
+
+func (m *mongoLinkRepo) ListByOwner(owner string) ([]*api.ShareLink, error) {
+
+	cursor, err := m.collection.Find(context.TODO(), bson.M{"owner": owner})
+	if err != nil {
+		return nil, mongoError(err)
+	}
+	defer cursor.Close(context.TODO())
+
+	links := make([]*api.ShareLink, 0)
+	for cursor.Next(context.TODO()) {
+		var link api.ShareLink
+		if err := cursor.Decode(&link); err != nil {
+			return nil, fmt.Errorf("Error decoding link : %w", err)
+		}
+		links = append(links, &link)
+	}
+
+	if err := cursor.Err(); err != nil {
+		return nil, mongoError(err)
+	}
+
+	return links, nil
+}
+
+func (m *mongoLinkRepo) Delete(id string) error {
+	filter := bson.M{"id": id}
+
+	_, err := m.collection.DeleteOne(context.TODO(), filter)
+	if err != nil {
+		return fmt.Errorf("Error deleting link %s : %w", id, err)
+	}
+
+	return nil
+}
@@ -9,6 +9,7 @@ package repository
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"WardrobeManagerMS/pkg/api"
 
@@ -22,6 +23,7 @@ const Version = "1.0"
 const (
 	DB               = "wardrobemanager"
 	WARDS            = "wardrobe"
+	IMAGES           = "images"
 )
 
 type mongoWardRepo struct {
@@ -31,14 +33,7 @@ type mongoWardRepo struct {
 func NewWardrobeRepository(server string) (api.WardrobeRepository, error) {
 
 	fmt.Printf("Initializing Mongo User Store {server=%s}\n",server)
-	clientOptions := options.Client().ApplyURI("mongodb://" + server)
-
-	client, err := mongo.Connect(context.TODO(), clientOptions)
-	if err != nil {
-		return nil, err
-	}
-
-	err = client.Ping(context.TODO(), nil)
+	client, err := connectMongo(server)
 	if err != nil {
 		return nil, err
 	}
@@ -57,6 +52,17 @@ func NewWardrobeRepository(server string) (api.WardrobeRepository, error) {
 		return nil, err
 	}
 
+	// for the closets with label to text jobs due
+	_, err = newCollection.Indexes().CreateOne(
+		context.Background(),
+		mongo.IndexModel{
+			Keys: bson.D{{Key: "wardrobes.label.state", Value: 1}, {Key: "wardrobes.label.sent", Value: 1}},
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
 	wardRepo := &mongoWardRepo{
 		collection: newCollection,
 	}
@@ -64,6 +70,32 @@ func NewWardrobeRepository(server string) (api.WardrobeRepository, error) {
 	return wardRepo, nil
 }
 
+func connectMongo(server string) (*mongo.Client, error) {
+
+	clientOptions := options.Client().ApplyURI("mongodb://" + server)
+
+	client, err := mongo.Connect(context.TODO(), clientOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	err = client.Ping(context.TODO(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return client, nil
+}
+
+// mongoError tells a server that cannot be reached apart from other
+// failures
+func mongoError(err error) error {
+	if mongo.IsNetworkError(err) || mongo.IsTimeout(err) {
+		return fmt.Errorf("%w : %v", &api.ResourceUnavailable{Server: "mongodb"}, err)
+	}
+	return fmt.Errorf("Internal MongoDB error : %w", err)
+}
+
 func (m *mongoWardRepo) Add(user string, wards *api.WardrobeCloset) error {
 	fmt.Println("FUNC START : Add")
 	_, err := m.collection.InsertOne(context.TODO(), wards)
@@ -86,13 +118,59 @@ func (m *mongoWardRepo) Get(user string) (*api.WardrobeCloset, error) {
 			return nil, &api.UserNotFound{User: user}
 		}
 
-		return nil, fmt.Errorf("Internal MongoDB error : %w", err)
+		return nil, mongoError(err)
 	}
 
 	return &wardCloset, nil
 
 }
 
+func (m *mongoWardRepo) GetAll() ([]*api.WardrobeCloset, error) {
+
+	cursor, err := m.collection.Find(context.TODO(), bson.M{})
+	if err != nil {
+		return nil, mongoError(err)
+	}
+	defer cursor.Close(context.TODO())
+
+	wardClosets := make([]*api.WardrobeCloset, 0)
+	for cursor.Next(context.TODO()) {
+		var wardCloset api.WardrobeCloset
+		if err := cursor.Decode(&wardCloset); err != nil {
+			return nil, fmt.Errorf("Error decoding wardrobe closet : %w", err)
+		}
+		wardClosets = append(wardClosets, &wardCloset)
+	}
+
+	if err := cursor.Err(); err != nil {
+		return nil, mongoError(err)
+	}
+
+	return wardClosets, nil
+}
+
+// FindByImage returns the closet holding a wardrobe that references file
+func (m *mongoWardRepo) FindByImage(file string) (*api.WardrobeCloset, error) {
+	filter := bson.M{"$or": bson.A{
+		bson.M{"wardrobes.main-file": file},
+		bson.M{"wardrobes.label-file": file},
+	}}
+
+	var wardCloset api.WardrobeCloset
+
+	err := m.collection.FindOne(context.TODO(), filter).Decode(&wardCloset)
+	if err != nil {
+
+		if err == mongo.ErrNoDocuments {
+			return nil, &api.UserNotFound{User: file}
+		}
+
+		return nil, mongoError(err)
+	}
+
+	return &wardCloset, nil
+}
+
 func (m *mongoWardRepo) Update(user string, wards *api.WardrobeCloset) error {
 	filter := bson.M{"user": user}
 
@@ -104,6 +182,57 @@ func (m *mongoWardRepo) Update(user string, wards *api.WardrobeCloset) error {
 	return nil
 }
 
+// SetImageState writes the image state of a single wardrobe, leaving the
+// rest of the closet as it is
+func (m *mongoWardRepo) SetImageState(user string, id string, state string) error {
+	filter := bson.M{"user": user, "wardrobes.id": id}
+
+	result, err := m.collection.UpdateOne(context.TODO(), filter, bson.M{"$set": bson.M{"wardrobes.$.image-state": state}})
+	if err != nil {
+		return fmt.Errorf("Error updating image state of wardrobe %s of user %s : %w", id, user, err)
+	}
+	if result.MatchedCount == 0 {
+		return &api.ItemNotFound{User: user, Id: id}
+	}
+
+	return nil
+}
+
+// ListLabelsDue returns the users of the closets with a label to text job
+// pending, or sent at or before sentBefore when it is set
+func (m *mongoWardRepo) ListLabelsDue(sentBefore time.Time) ([]string, error) {
+	due := bson.A{bson.M{"wardrobes.label.state": api.LabelPending}}
+	if !sentBefore.IsZero() {
+		due = append(due, bson.M{"wardrobes": bson.M{"$elemMatch": bson.M{
+			"label.state": api.LabelSent,
+			"label.sent":  bson.M{"$lte": sentBefore},
+		}}})
+	}
+
+	cursor, err := m.collection.Find(context.TODO(), bson.M{"$or": due}, options.Find().SetProjection(bson.M{"user": 1}))
+	if err != nil {
+		return nil, mongoError(err)
+	}
+	defer cursor.Close(context.TODO())
+
+	users := make([]string, 0)
+	for cursor.Next(context.TODO()) {
+		var closet struct {
+			User string `bson:"user"`
+		}
+		if err := cursor.Decode(&closet); err != nil {
+			return nil, fmt.Errorf("Error decoding wardrobe closet : %w", err)
+		}
+		users = append(users, closet.User)
+	}
+
+	if err := cursor.Err(); err != nil {
+		return nil, mongoError(err)
+	}
+
+	return users, nil
+}
+
 func (m *mongoWardRepo) DeleteAll(user string) error {
 	filter := bson.M{"user": user}
 
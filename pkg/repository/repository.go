@@ -0,0 +1,31 @@
+//
+// repository.go
+//
+
+package repository
+
+import (
+	"fmt"
+
+	"WardrobeManagerMS/pkg/api"
+)
+
+// Image repository backends
+const (
+	FileStore   = "file"
+	GridFSStore = "gridfs"
+)
+
+// NewImageRepository opens the image backend named by store. dir is used by
+// the file backend, server by the GridFS backend.
+func NewImageRepository(store, dir, server string) (api.ImageRepository, error) {
+
+	switch store {
+	case FileStore:
+		return NewFileImageRepository(dir)
+	case GridFSStore:
+		return NewGridFSImageRepository(server)
+	default:
+		return nil, fmt.Errorf("unknown image store %s", store)
+	}
+}
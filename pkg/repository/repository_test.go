@@ -0,0 +1,486 @@
+//
+// repository_test.go
+//
+
+package repository_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"WardrobeManagerMS/pkg/api"
+	repo "WardrobeManagerMS/pkg/repository"
+
+	"github.com/google/uuid"
+)
+
+// MongoDB is an external service, tests needing it only run when its
+// address is exported in the environment
+const mongoServerEnv = "WM_TEST_MONGO"
+
+// failingReader returns some bytes and then an error, like a dropped upload
+type failingReader struct {
+	sent bool
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if r.sent {
+		return 0, errors.New("connection reset")
+	}
+	r.sent = true
+	return copy(p, []byte{0xAA, 0xBB}), nil
+}
+
+// closetRepo holds one closet per user, referencing the given images
+type closetRepo map[string][]string
+
+func (m closetRepo) Add(user string, wardrobes *api.WardrobeCloset) error {
+	return nil
+}
+
+func (m closetRepo) Get(user string) (*api.WardrobeCloset, error) {
+	return nil, &api.UserNotFound{User: user}
+}
+
+func (m closetRepo) GetAll() ([]*api.WardrobeCloset, error) {
+	return nil, nil
+}
+
+func (m closetRepo) Update(user string, wardrobes *api.WardrobeCloset) error {
+	return nil
+}
+
+func (m closetRepo) SetImageState(user string, id string, state string) error {
+	return nil
+}
+
+func (m closetRepo) ListLabelsDue(sentBefore time.Time) ([]string, error) {
+	return nil, nil
+}
+
+func (m closetRepo) DeleteAll(user string) error {
+	return nil
+}
+
+func (m closetRepo) FindByImage(file string) (*api.WardrobeCloset, error) {
+	for user, files := range m {
+		for _, f := range files {
+			if f == file {
+				return &api.WardrobeCloset{User: user}, nil
+			}
+		}
+	}
+	return nil, &api.UserNotFound{User: file}
+}
+
+func TestFileImageRepositoryAtomicWrite(t *testing.T) {
+
+	dir := t.TempDir()
+	imageRepo, err := repo.NewFileImageRepository(dir)
+	if err != nil {
+		t.Fatalf("Expected nil, got %v", err)
+	}
+
+	err = imageRepo.AddFileFromFile("good", bytes.NewReader([]byte{0xAA, 0xBB, 0xCC}))
+	if err != nil {
+		t.Fatalf("Expected nil, got %v", err)
+	}
+
+	err = imageRepo.AddFileFromFile("bad", &failingReader{})
+	if err == nil {
+		t.Fatalf("Expected error, got nil")
+	}
+
+	_, err = imageRepo.GetFile("bad")
+	if errors.As(err, new(*api.NoSuchFileOrDirectory)) == false {
+		t.Errorf("Expected NoSuchFileOrDirectory, got %v", err)
+	}
+
+	data, err := imageRepo.GetFile("good")
+	if err != nil || !bytes.Equal(data, []byte{0xAA, 0xBB, 0xCC}) {
+		t.Errorf("Expected good file, got %v, %v", data, err)
+	}
+
+	entries, _ := ioutil.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("Expected only the good file on disk, got %d entries", len(entries))
+	}
+}
+
+func TestFileImageRepositoryHasFile(t *testing.T) {
+
+	imageRepo, err := repo.NewFileImageRepository(t.TempDir())
+	if err != nil {
+		t.Fatalf("Expected nil, got %v", err)
+	}
+	imageRepo.AddFile("image", []byte{0xAA})
+
+	for name, expected := range map[string]bool{"image": true, "missing": false} {
+		if found, err := api.ImageExists(imageRepo, name); err != nil || found != expected {
+			t.Errorf("Expected %s found %t, got %t, %v", name, expected, found, err)
+		}
+	}
+}
+
+func TestWardrobeRepositorySetImageState(t *testing.T) {
+
+	server := os.Getenv(mongoServerEnv)
+	if server == "" {
+		t.Skipf("%s not set, skipping", mongoServerEnv)
+	}
+
+	wardRepo, err := repo.NewWardrobeRepository(server)
+	if err != nil {
+		t.Fatalf("Expected nil, got %v", err)
+	}
+
+	user := "test-" + uuid.New().String()
+	defer wardRepo.DeleteAll(user)
+
+	err = wardRepo.Add(user, &api.WardrobeCloset{
+		User:      user,
+		Wardrobes: []api.Wardrobe{{Identifier: "a", Description: "Shirt"}, {Identifier: "b", Description: "Skirt"}},
+	})
+	if err != nil {
+		t.Fatalf("Expected nil, got %v", err)
+	}
+
+	if err := wardRepo.SetImageState(user, "b", api.ImageCorrupted); err != nil {
+		t.Fatalf("Expected nil, got %v", err)
+	}
+	var nf *api.ItemNotFound
+	if err := wardRepo.SetImageState(user, "c", api.ImageCorrupted); !errors.As(err, &nf) {
+		t.Errorf("Expected ItemNotFound, got %v", err)
+	}
+
+	wc, err := wardRepo.Get(user)
+	if err != nil || len(wc.Wardrobes) != 2 {
+		t.Fatalf("Expected closet of 2, got %+v, %v", wc, err)
+	}
+	if wc.Wardrobes[0].ImageState != "" || wc.Wardrobes[1].ImageState != api.ImageCorrupted || wc.Wardrobes[1].Description != "Skirt" {
+		t.Errorf("Expected only b marked, got %+v", wc.Wardrobes)
+	}
+}
+
+func TestWardrobeRepositoryListLabelsDue(t *testing.T) {
+
+	server := os.Getenv(mongoServerEnv)
+	if server == "" {
+		t.Skipf("%s not set, skipping", mongoServerEnv)
+	}
+
+	wardRepo, err := repo.NewWardrobeRepository(server)
+	if err != nil {
+		t.Fatalf("Expected nil, got %v", err)
+	}
+
+	t0 := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	prefix := "test-" + uuid.New().String()
+	closets := map[string]api.LabelJob{
+		"pending":   {State: api.LabelPending, Queued: t0},
+		"sent":      {State: api.LabelSent, Queued: t0, Sent: t0},
+		"completed": {State: api.LabelCompleted, Queued: t0, Sent: t0, Finished: t0},
+	}
+	for name, job := range closets {
+		user := prefix + "-" + name
+		defer wardRepo.DeleteAll(user)
+		err := wardRepo.Add(user, &api.WardrobeCloset{
+			User:      user,
+			Wardrobes: []api.Wardrobe{{Identifier: "a", Description: "Shirt"}, {Identifier: "b", Description: "Skirt", Label: job}},
+		})
+		if err != nil {
+			t.Fatalf("Expected nil, got %v", err)
+		}
+	}
+
+	cases := []struct {
+		name       string
+		sentBefore time.Time
+		due        []string
+	}{
+		{"No timeout", time.Time{}, []string{"pending"}},
+		{"Before sent", t0.Add(-time.Second), []string{"pending"}},
+		{"After sent", t0, []string{"pending", "sent"}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			users, err := wardRepo.ListLabelsDue(c.sentBefore)
+			if err != nil {
+				t.Fatalf("Expected nil, got %v", err)
+			}
+			due := map[string]bool{}
+			for _, user := range users {
+				if strings.HasPrefix(user, prefix+"-") {
+					due[strings.TrimPrefix(user, prefix+"-")] = true
+				}
+			}
+			if len(due) != len(c.due) {
+				t.Errorf("Expected %v due, got %v", c.due, due)
+			}
+			for _, name := range c.due {
+				if !due[name] {
+					t.Errorf("Expected %s due, got %v", name, due)
+				}
+			}
+		})
+	}
+}
+
+func TestGridFSImageRepository(t *testing.T) {
+
+	server := os.Getenv(mongoServerEnv)
+	if server == "" {
+		t.Skipf("%s not set, skipping", mongoServerEnv)
+	}
+
+	imageRepo, err := repo.NewGridFSImageRepository(server)
+	if err != nil {
+		t.Fatalf("Expected nil, got %v", err)
+	}
+
+	// the database is shared, names are unique to the run
+	name := "test-" + uuid.New().String()
+	missing := name + "-missing"
+	defer imageRepo.DeleteFile(name)
+
+	image := make([]byte, 600*1024)
+	rand.Read(image)
+
+	if err := imageRepo.AddFileFromFile(name, bytes.NewReader(image)); err != nil {
+		t.Fatalf("Expected nil, got %v", err)
+	}
+
+	data, err := imageRepo.GetFile(name)
+	if err != nil || !bytes.Equal(data, image) {
+		t.Fatalf("Expected image, got %d bytes, %v", len(data), err)
+	}
+
+	var served []byte
+	err = imageRepo.GetFileWithHandler(name, func(path string) error {
+		served, err = ioutil.ReadFile(path)
+		return err
+	})
+	if err != nil || !bytes.Equal(served, image) {
+		t.Errorf("Expected image from handler, got %d bytes, %v", len(served), err)
+	}
+
+	for n, expected := range map[string]bool{name: true, missing: false} {
+		if found, err := api.ImageExists(imageRepo, n); err != nil || found != expected {
+			t.Errorf("Expected %s found %t, got %t, %v", n, expected, found, err)
+		}
+	}
+
+	// an update leaves a single revision, the latest
+	if err := imageRepo.UpdateFile(name, []byte("updated")); err != nil {
+		t.Fatalf("Expected nil, got %v", err)
+	}
+	if data, err := imageRepo.GetFile(name); err != nil || string(data) != "updated" {
+		t.Errorf("Expected updated image, got %q, %v", data, err)
+	}
+
+	infos, err := imageRepo.ListFiles()
+	if err != nil {
+		t.Fatalf("Expected nil, got %v", err)
+	}
+	listed := 0
+	for _, info := range infos {
+		if info.Name == name {
+			listed++
+			if info.Size != int64(len("updated")) {
+				t.Errorf("Expected the latest revision listed, got %d bytes", info.Size)
+			}
+		}
+	}
+	if listed != 1 {
+		t.Errorf("Expected %s listed once, got %d", name, listed)
+	}
+
+	if err := imageRepo.DeleteFile(name); err != nil {
+		t.Fatalf("Expected nil, got %v", err)
+	}
+
+	notFound := []struct {
+		name string
+		call func() error
+	}{
+		{"Get", func() error { _, err := imageRepo.GetFile(name); return err }},
+		{"Handler", func() error { return imageRepo.GetFileWithHandler(name, func(string) error { return nil }) }},
+		{"Delete", func() error { return imageRepo.DeleteFile(missing) }},
+	}
+
+	for _, c := range notFound {
+		t.Run(c.name, func(t *testing.T) {
+			if err := c.call(); errors.As(err, new(*api.NoSuchFileOrDirectory)) == false {
+				t.Errorf("Expected NoSuchFileOrDirectory, got %v", err)
+			}
+		})
+	}
+}
+
+func TestKeyRingSaveFailure(t *testing.T) {
+
+	dir := t.TempDir()
+	masterPath := filepath.Join(dir, "master.keys")
+	keysDir := filepath.Join(dir, "keys")
+	dataPath := filepath.Join(keysDir, "data.keys")
+
+	if _, err := repo.GenerateMasterKey(masterPath); err != nil {
+		t.Fatalf("Expected nil, got %v", err)
+	}
+	keys, err := repo.OpenKeyRing(masterPath, dataPath)
+	if err != nil {
+		t.Fatalf("Expected nil, got %v", err)
+	}
+
+	// the directory of the key file is missing, nothing can be saved
+	if _, _, err := keys.UserKey("foobar"); err == nil {
+		t.Fatalf("Expected an error issuing a key that cannot be saved")
+	}
+
+	os.Mkdir(keysDir, 0700)
+	id, key, err := keys.UserKey("foobar")
+	if err != nil || len(key) == 0 {
+		t.Fatalf("Expected a key once the file can be saved, got %v", err)
+	}
+
+	// a failed rotation leaves the user on the key it had
+	os.Rename(keysDir, keysDir+".moved")
+	if _, err := keys.RotateUserKey("foobar"); err == nil {
+		t.Fatalf("Expected an error rotating a key that cannot be saved")
+	}
+	os.Rename(keysDir+".moved", keysDir)
+
+	if current, _, err := keys.UserKey("foobar"); err != nil || current != id {
+		t.Errorf("Expected key %s after a failed rotation, got %s, %v", id, current, err)
+	}
+	if retired, _ := keys.IsRetired(id); retired {
+		t.Errorf("Expected key %s not retired after a failed rotation", id)
+	}
+
+	keys, err = repo.OpenKeyRing(masterPath, dataPath)
+	if err != nil {
+		t.Fatalf("Expected nil, got %v", err)
+	}
+	if current, saved, err := keys.UserKey("foobar"); err != nil || current != id || !bytes.Equal(saved, key) {
+		t.Errorf("Expected key %s saved, got %s, %v", id, current, err)
+	}
+}
+
+func TestEncryptedImageRepository(t *testing.T) {
+
+	dir := t.TempDir()
+	masterPath := filepath.Join(dir, "master.keys")
+	dataPath := filepath.Join(dir, "data.keys")
+
+	if _, err := repo.GenerateMasterKey(masterPath); err != nil {
+		t.Fatalf("Expected nil, got %v", err)
+	}
+	keys, err := repo.OpenKeyRing(masterPath, dataPath)
+	if err != nil {
+		t.Fatalf("Expected nil, got %v", err)
+	}
+
+	plainRepo, _ := repo.NewFileImageRepository(filepath.Join(dir, "images"))
+	encRepo := repo.NewEncryptedImageRepository(plainRepo, keys).(api.UserImageRepository).ForUser("foobar")
+
+	// spans several segments and ends mid segment
+	image := make([]byte, 150*1024)
+	rand.Read(image)
+
+	if err := encRepo.AddFileFromFile("image", bytes.NewReader(image)); err != nil {
+		t.Fatalf("Expected nil, got %v", err)
+	}
+
+	stored, _ := plainRepo.GetFile("image")
+	if bytes.Contains(stored, image[:64]) {
+		t.Errorf("Expected image to be encrypted at rest")
+	}
+
+	data, err := encRepo.GetFile("image")
+	if err != nil || !bytes.Equal(data, image) {
+		t.Fatalf("Expected decrypted image, got %d bytes, %v", len(data), err)
+	}
+
+	var served []byte
+	err = encRepo.GetFileWithHandler("image", func(path string) error {
+		served, err = ioutil.ReadFile(path)
+		return err
+	})
+	if err != nil || !bytes.Equal(served, image) {
+		t.Errorf("Expected decrypted image from handler, got %d bytes, %v", len(served), err)
+	}
+
+	// a flipped bit anywhere must fail authentication
+	tampered := append([]byte{}, stored...)
+	tampered[len(tampered)-100] ^= 0x01
+	plainRepo.UpdateFile("tampered", tampered)
+	var corrupted *repo.ImageCorrupted
+	if _, err := encRepo.GetFile("tampered"); !errors.As(err, &corrupted) {
+		t.Errorf("Expected tampered image to be corrupted, got %v", err)
+	}
+	plainRepo.DeleteFile("tampered")
+
+	// so must a truncated one
+	plainRepo.UpdateFile("truncated", stored[:len(stored)-(len(stored)-64*1024)/2])
+	if _, err := encRepo.GetFile("truncated"); !errors.As(err, &corrupted) {
+		t.Errorf("Expected truncated image to be corrupted, got %v", err)
+	}
+	plainRepo.DeleteFile("truncated")
+
+	// images from before encryption are served and then migrated to the
+	// key of their owner, those nobody owns are left to the image gc
+	plainRepo.AddFile("legacy", []byte("legacy image"))
+	plainRepo.AddFile("orphan", []byte("orphan image"))
+	closets := closetRepo{"foobar": {"image", "legacy"}}
+
+	oldKey, _, _ := keys.UserKey("foobar")
+	if _, err := keys.RotateUserKey("foobar"); err != nil {
+		t.Fatalf("Expected nil, got %v", err)
+	}
+	if _, err := repo.GenerateMasterKey(masterPath); err != nil {
+		t.Fatalf("Expected nil, got %v", err)
+	}
+	keys, _ = repo.OpenKeyRing(masterPath, dataPath)
+	if count, err := keys.Rewrap(); err != nil || count != 2 {
+		t.Errorf("Expected 2 keys rewrapped, got %d, %v", count, err)
+	}
+
+	count, err := repo.ReEncrypt(plainRepo, keys, closets)
+	if err != nil || count != 2 {
+		t.Errorf("Expected 2 images re-encrypted, got %d, %v", count, err)
+	}
+	if count, _ := repo.ReEncrypt(plainRepo, keys, closets); count != 0 {
+		t.Errorf("Expected nothing left to re-encrypt, got %d", count)
+	}
+
+	currentKey, _, _ := keys.UserKey("foobar")
+	if stored, _ := plainRepo.GetFile("legacy"); !bytes.Contains(stored, []byte(currentKey)) {
+		t.Errorf("Expected legacy image under the key of its owner")
+	}
+	if stored, _ := plainRepo.GetFile("orphan"); string(stored) != "orphan image" {
+		t.Errorf("Expected orphan image left alone, got %q", stored)
+	}
+
+	encRepo = repo.NewEncryptedImageRepository(plainRepo, keys)
+	data, err = encRepo.GetFile("image")
+	if err != nil || !bytes.Equal(data, image) {
+		t.Errorf("Expected image after re-encryption, got %v", err)
+	}
+	data, err = encRepo.GetFile("legacy")
+	if err != nil || string(data) != "legacy image" {
+		t.Errorf("Expected legacy image after re-encryption, got %q, %v", data, err)
+	}
+
+	stored, _ = plainRepo.GetFile("image")
+	if bytes.Contains(stored, []byte(oldKey)) {
+		t.Errorf("Expected image to move off the retired key")
+	}
+}
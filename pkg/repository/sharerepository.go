@@ -0,0 +1,135 @@
+//
+// sharerepository.go
+//
+
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"WardrobeManagerMS/pkg/api"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const SHARES = "shares"
+
+type mongoShareRepo struct {
+	collection *mongo.Collection
+}
+
+func NewShareRepository(server string) (api.ShareRepository, error) {
+
+	client, err := connectMongo(server)
+	if err != nil {
+		return nil, err
+	}
+
+	newCollection := client.Database(DB).Collection(SHARES)
+
+	// a closet is shared with a user once, listing by user needs its own
+	// index
+	_, err = newCollection.Indexes().CreateMany(
+		context.Background(),
+		[]mongo.IndexModel{
+			{
+				Keys:    bson.D{{Key: "owner", Value: 1}, {Key: "user", Value: 1}},
+				Options: options.Index().SetUnique(true),
+			},
+			{
+				Keys: bson.D{{Key: "user", Value: 1}},
+			},
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &mongoShareRepo{
+		collection: newCollection,
+	}, nil
+}
+
+func (m *mongoShareRepo) Add(share *api.Share) error {
+	_, err := m.collection.InsertOne(context.TODO(), share)
+	if err != nil {
+		return fmt.Errorf("Error adding share of %s with %s : %w", share.Owner, share.User, err)
+	}
+
+	return nil
+}
+
+func (m *mongoShareRepo) Get(owner string, user string) (*api.Share, error) {
+	filter := bson.M{"owner": owner, "user": user}
+
+	var share api.Share
+
+	err := m.collection.FindOne(context.TODO(), filter).Decode(&share)
+	if err != nil {
+
+		if err == mongo.ErrNoDocuments {
+			return nil, &api.ShareNotFound{Owner: owner, User: user}
+		}
+
+		return nil, mongoError(err)
+	}
+
+	return &share, nil
+}
+
+func (m *mongoShareRepo) ListByOwner(owner string) ([]*api.Share, error) {
+	return m.find(bson.M{"owner": owner})
+}
+
+func (m *mongoShareRepo) ListByUser(user string) ([]*api.Share, error) {
+	return m.find(bson.M{"user": user})
+}
+
+func (m *mongoShareRepo) find(filter bson.M) ([]*api.Share, error) {
+
+	cursor, err := m.collection.Find(context.TODO(), filter)
+	if err != nil {
+		return nil, mongoError(err)
+	}
+	defer cursor.Close(context.TODO())
+
+	shares := make([]*api.Share, 0)
+	for cursor.Next(context.TODO()) {
+		var share api.Share
+		if err := cursor.Decode(&share); err != nil {
+			return nil, fmt.Errorf("Error decoding share : %w", err)
+		}
+		shares = append(shares, &share)
+	}
+
+	if err := cursor.Err(); err != nil {
+		return nil, mongoError(err)
+	}
+
+	return shares, nil
+}
+
+func (m *mongoShareRepo) Update(share *api.Share) error {
+	filter := bson.M{"owner": share.Owner, "user": share.User}
+
+	_, err := m.collection.UpdateOne(context.TODO(), filter, bson.D{{Key: "$set", Value: share}})
+	if err != nil {
+		return fmt.Errorf("Error updating share of %s with %s : %w", share.Owner, share.User, err)
+	}
+
+	return nil
+}
+
+func (m *mongoShareRepo) Delete(owner string, user string) error {
+	filter := bson.M{"owner": owner, "user": user}
+
+	_, err := m.collection.DeleteOne(context.TODO(), filter)
+	if err != nil {
+		return fmt.Errorf("Error deleting share of %s with %s : %w", owner, user, err)
+	}
+
+	return nil
+}
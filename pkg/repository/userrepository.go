@@ -0,0 +1,116 @@
+//
+// userrepository.go
+//
+
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"WardrobeManagerMS/pkg/api"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const USERS = "users"
+
+type mongoUserRepo struct {
+	collection *mongo.Collection
+}
+
+func NewUserRepository(server string) (api.UserRepository, error) {
+
+	client, err := connectMongo(server)
+	if err != nil {
+		return nil, err
+	}
+
+	newCollection := client.Database(DB).Collection(USERS)
+
+	// both the id and the username identify a single user
+	_, err = newCollection.Indexes().CreateMany(
+		context.Background(),
+		[]mongo.IndexModel{
+			{
+				Keys:    bson.D{{Key: "id", Value: 1}},
+				Options: options.Index().SetUnique(true),
+			},
+			{
+				Keys:    bson.D{{Key: "username", Value: 1}},
+				Options: options.Index().SetUnique(true),
+			},
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &mongoUserRepo{
+		collection: newCollection,
+	}, nil
+}
+
+func (m *mongoUserRepo) Add(user *api.User) error {
+	_, err := m.collection.InsertOne(context.TODO(), user)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return &api.DuplicateUser{User: user.Username}
+		}
+		return fmt.Errorf("Error adding user %s : %w", user.Username, err)
+	}
+
+	return nil
+}
+
+func (m *mongoUserRepo) Get(id string) (*api.User, error) {
+	return m.findOne(bson.M{"id": id}, id)
+}
+
+func (m *mongoUserRepo) GetByUsername(username string) (*api.User, error) {
+	return m.findOne(bson.M{"username": username}, username)
+}
+
+func (m *mongoUserRepo) findOne(filter bson.M, user string) (*api.User, error) {
+
+	var u api.User
+
+	err := m.collection.FindOne(context.TODO(), filter).Decode(&u)
+	if err != nil {
+
+		if err == mongo.ErrNoDocuments {
+			return nil, &api.UserNotFound{User: user}
+		}
+
+		return nil, mongoError(err)
+	}
+
+	return &u, nil
+}
+
+func (m *mongoUserRepo) Update(user *api.User) error {
+	filter := bson.M{"id": user.Identifier}
+
+	_, err := m.collection.UpdateOne(context.TODO(), filter, bson.D{{Key: "$set", Value: user}})
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return &api.DuplicateUser{User: user.Username}
+		}
+		return fmt.Errorf("Error updating user %s : %w", user.Identifier, err)
+	}
+
+	return nil
+}
+
+func (m *mongoUserRepo) Delete(id string) error {
+	filter := bson.M{"id": id}
+
+	_, err := m.collection.DeleteOne(context.TODO(), filter)
+	if err != nil {
+		return fmt.Errorf("Error deleting user %s : %w", id, err)
+	}
+
+	return nil
+}
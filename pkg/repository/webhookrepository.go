@@ -0,0 +1,242 @@
+//
+// webhookrepository.go
+//
+
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"WardrobeManagerMS/pkg/api"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const WEBHOOKS = "webhooks"
+const DELIVERIES = "deliveries"
+
+type mongoWebhookRepo struct {
+	hooks      *mongo.Collection
+	deliveries *mongo.Collection
+}
+
+func NewWebhookRepository(server string) (api.WebhookRepository, error) {
+
+	client, err := connectMongo(server)
+	if err != nil {
+		return nil, err
+	}
+
+	hooks := client.Database(DB).Collection(WEBHOOKS)
+	_, err = hooks.Indexes().CreateMany(
+		context.Background(),
+		[]mongo.IndexModel{
+			{
+				Keys:    bson.D{{Key: "id", Value: 1}},
+				Options: options.Index().SetUnique(true),
+			},
+			{
+				Keys: bson.D{{Key: "owner", Value: 1}},
+			},
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	deliveries := client.Database(DB).Collection(DELIVERIES)
+	_, err = deliveries.Indexes().CreateMany(
+		context.Background(),
+		[]mongo.IndexModel{
+			{
+				Keys:    bson.D{{Key: "id", Value: 1}},
+				Options: options.Index().SetUnique(true),
+			},
+			{
+				Keys: bson.D{{Key: "webhook", Value: 1}, {Key: "created", Value: -1}},
+			},
+			{
+				Keys: bson.D{{Key: "state", Value: 1}, {Key: "next", Value: 1}},
+			},
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &mongoWebhookRepo{
+		hooks:      hooks,
+		deliveries: deliveries,
+	}, nil
+}
+
+func (m *mongoWebhookRepo) Add(hook *api.Webhook) error {
+	_, err := m.hooks.InsertOne(context.TODO(), hook)
+	if err != nil {
+		return fmt.Errorf("Error adding webhook %s : %w", hook.Identifier, err)
+	}
+
+	return nil
+}
+
+func (m *mongoWebhookRepo) Get(id string) (*api.Webhook, error) {
+
+	var hook api.Webhook
+
+	err := m.hooks.FindOne(context.TODO(), bson.M{"id": id}).Decode(&hook)
+	if err != nil {
+
+		if err == mongo.ErrNoDocuments {
+			return nil, &api.WebhookNotFound{Webhook: id}
+		}
+
+		return nil, mongoError(err)
+	}
+
+	return &hook, nil
+}
+
+func (m *mongoWebhookRepo) ListByOwner(owner string) ([]*api.Webhook, error) {
+
+	cursor, err := m.hooks.Find(context.TODO(), bson.M{"owner": owner})
+	if err != nil {
+		return nil, mongoError(err)
+	}
+	defer cursor.Close(context.TODO())
+
+	hooks := make([]*api.Webhook, 0)
+	for cursor.Next(context.TODO()) {
+		var hook api.Webhook
+		if err := cursor.Decode(&hook); err != nil {
+			return nil, fmt.Errorf("Error decoding webhook : %w", err)
+		}
+		hooks = append(hooks, &hook)
+	}
+
+	if err := cursor.Err(); err != nil {
+		return nil, mongoError(err)
+	}
+
+	return hooks, nil
+}
+
+func (m *mongoWebhookRepo) Delete(id string) error {
+
+	_, err := m.hooks.DeleteOne(context.TODO(), bson.M{"id": id})
+	if err != nil {
+		return fmt.Errorf("Error deleting webhook %s : %w", id, err)
+	}
+
+	return nil
+}
+
+func (m *mongoWebhookRepo) AddDelivery(delivery *api.Delivery) error {
+	_, err := m.deliveries.InsertOne(context.TODO(), delivery)
+	if err != nil {
+		return fmt.Errorf("Error adding delivery %s : %w", delivery.Identifier, err)
+	}
+
+	return nil
+}
+
+func (m *mongoWebhookRepo) GetDelivery(id string) (*api.Delivery, error) {
+
+	var delivery api.Delivery
+
+	err := m.deliveries.FindOne(context.TODO(), bson.M{"id": id}).Decode(&delivery)
+	if err != nil {
+
+		if err == mongo.ErrNoDocuments {
+			return nil, &api.DeliveryNotFound{Delivery: id}
+		}
+
+		return nil, mongoError(err)
+	}
+
+	return &delivery, nil
+}
+
+func (m *mongoWebhookRepo) UpdateDelivery(delivery *api.Delivery) error {
+
+	_, err := m.deliveries.ReplaceOne(context.TODO(), bson.M{"id": delivery.Identifier}, delivery)
+	if err != nil {
+		return fmt.Errorf("Error updating delivery %s : %w", delivery.Identifier, err)
+	}
+
+	return nil
+}
+
+// ListDeliveries lists the deliveries of webhook, newest first
+func (m *mongoWebhookRepo) ListDeliveries(webhook string, limit int) ([]*api.Delivery, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "created", Value: -1}})
+	if limit > 0 {
+		opts.SetLimit(int64(limit))
+	}
+	return m.find(bson.M{"webhook": webhook}, opts)
+}
+
+// ClaimDue takes the pending deliveries to attempt by now, oldest first.
+// Each is claimed on its own by moving it out of reach of other servers
+// until the lease is over, a delivery that is not updated by then is due
+// again.
+func (m *mongoWebhookRepo) ClaimDue(now time.Time, lease time.Duration, limit int) ([]*api.Delivery, error) {
+
+	filter := bson.M{"state": api.DeliveryPending, "next": bson.M{"$lte": now}}
+	update := bson.M{"$set": bson.M{"next": now.Add(lease)}}
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "next", Value: 1}}).
+		SetReturnDocument(options.After)
+
+	claimed := make([]*api.Delivery, 0)
+	for limit <= 0 || len(claimed) < limit {
+		var delivery api.Delivery
+		err := m.deliveries.FindOneAndUpdate(context.TODO(), filter, update, opts).Decode(&delivery)
+		if err == mongo.ErrNoDocuments {
+			break
+		}
+		if err != nil {
+			return claimed, mongoError(err)
+		}
+		claimed = append(claimed, &delivery)
+	}
+
+	return claimed, nil
+}
+
+func (m *mongoWebhookRepo) find(filter bson.M, opts *options.FindOptions) ([]*api.Delivery, error) {
+
+	cursor, err := m.deliveries.Find(context.TODO(), filter, opts)
+	if err != nil {
+		return nil, mongoError(err)
+	}
+	defer cursor.Close(context.TODO())
+
+	deliveries := make([]*api.Delivery, 0)
+	for cursor.Next(context.TODO()) {
+		var delivery api.Delivery
+		if err := cursor.Decode(&delivery); err != nil {
+			return nil, fmt.Errorf("Error decoding delivery : %w", err)
+		}
+		deliveries = append(deliveries, &delivery)
+	}
+
+	if err := cursor.Err(); err != nil {
+		return nil, mongoError(err)
+	}
+
+	return deliveries, nil
+}
+
+func (m *mongoWebhookRepo) DeleteDeliveries(webhook string) error {
+
+	_, err := m.deliveries.DeleteMany(context.TODO(), bson.M{"webhook": webhook})
+	if err != nil {
+		return fmt.Errorf("Error deleting deliveries of webhook %s : %w", webhook, err)
+	}
+
+	return nil
+}
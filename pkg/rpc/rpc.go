@@ -0,0 +1,9 @@
+//
+// rpc.go
+//
+
+// Package rpc holds the protobuf messages and gRPC service of the wardrobe
+// api, generated from wardrobe.proto
+package rpc
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative wardrobe.proto
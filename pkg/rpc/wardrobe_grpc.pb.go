@@ -0,0 +1,1061 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+
+package rpc
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+	emptypb "google.golang.org/protobuf/types/known/emptypb"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// WardrobeClient is the client API for Wardrobe service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type WardrobeClient interface {
+	// AddWardrobe streams the item first, then the photo and then the label
+	// in chunks
+	AddWardrobe(ctx context.Context, opts ...grpc.CallOption) (Wardrobe_AddWardrobeClient, error)
+	GetWardrobe(ctx context.Context, in *ItemRequest, opts ...grpc.CallOption) (*Item, error)
+	GetAllWardrobe(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (*ItemPage, error)
+	DeleteWardrobe(ctx context.Context, in *ItemRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	// GetImage streams the info of the image, then its content in chunks
+	GetImage(ctx context.Context, in *ImageRequest, opts ...grpc.CallOption) (Wardrobe_GetImageClient, error)
+	GetUsage(ctx context.Context, in *UserRequest, opts ...grpc.CallOption) (*Usage, error)
+	Search(ctx context.Context, in *SearchRequest, opts ...grpc.CallOption) (*SearchResponse, error)
+	RegisterUser(ctx context.Context, in *NewUserRequest, opts ...grpc.CallOption) (*User, error)
+	GetUser(ctx context.Context, in *UserRequest, opts ...grpc.CallOption) (*User, error)
+	UpdateUser(ctx context.Context, in *UpdateUserRequest, opts ...grpc.CallOption) (*User, error)
+	DeleteUser(ctx context.Context, in *UserRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	ShareCloset(ctx context.Context, in *ShareRequest, opts ...grpc.CallOption) (*Share, error)
+	AcceptShare(ctx context.Context, in *ShareOwnerRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	RevokeShare(ctx context.Context, in *RevokeShareRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	GetShares(ctx context.Context, in *UserRequest, opts ...grpc.CallOption) (*ShareList, error)
+	GetSharedWithMe(ctx context.Context, in *UserRequest, opts ...grpc.CallOption) (*ShareList, error)
+	CreateShareLink(ctx context.Context, in *NewShareLinkRequest, opts ...grpc.CallOption) (*ShareLink, error)
+	GetShareLinks(ctx context.Context, in *UserRequest, opts ...grpc.CallOption) (*ShareLinkList, error)
+	RevokeShareLink(ctx context.Context, in *LinkRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	GetLook(ctx context.Context, in *LookRequest, opts ...grpc.CallOption) (*Look, error)
+	GetLookImage(ctx context.Context, in *LookImageRequest, opts ...grpc.CallOption) (Wardrobe_GetLookImageClient, error)
+	AddOutfit(ctx context.Context, in *NewOutfitRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	DeleteOutfit(ctx context.Context, in *OutfitRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	GetOutfit(ctx context.Context, in *OutfitRequest, opts ...grpc.CallOption) (*Outfit, error)
+	GetAllOutfits(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (*OutfitPage, error)
+}
+
+type wardrobeClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewWardrobeClient(cc grpc.ClientConnInterface) WardrobeClient {
+	return &wardrobeClient{cc}
+}
+
+func (c *wardrobeClient) AddWardrobe(ctx context.Context, opts ...grpc.CallOption) (Wardrobe_AddWardrobeClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Wardrobe_ServiceDesc.Streams[0], "/wardrobe.v1.Wardrobe/AddWardrobe", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &wardrobeAddWardrobeClient{stream}
+	return x, nil
+}
+
+type Wardrobe_AddWardrobeClient interface {
+	Send(*AddWardrobeRequest) error
+	CloseAndRecv() (*emptypb.Empty, error)
+	grpc.ClientStream
+}
+
+type wardrobeAddWardrobeClient struct {
+	grpc.ClientStream
+}
+
+func (x *wardrobeAddWardrobeClient) Send(m *AddWardrobeRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *wardrobeAddWardrobeClient) CloseAndRecv() (*emptypb.Empty, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(emptypb.Empty)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *wardrobeClient) GetWardrobe(ctx context.Context, in *ItemRequest, opts ...grpc.CallOption) (*Item, error) {
+	out := new(Item)
+	err := c.cc.Invoke(ctx, "/wardrobe.v1.Wardrobe/GetWardrobe", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *wardrobeClient) GetAllWardrobe(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (*ItemPage, error) {
+	out := new(ItemPage)
+	err := c.cc.Invoke(ctx, "/wardrobe.v1.Wardrobe/GetAllWardrobe", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *wardrobeClient) DeleteWardrobe(ctx context.Context, in *ItemRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, "/wardrobe.v1.Wardrobe/DeleteWardrobe", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *wardrobeClient) GetImage(ctx context.Context, in *ImageRequest, opts ...grpc.CallOption) (Wardrobe_GetImageClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Wardrobe_ServiceDesc.Streams[1], "/wardrobe.v1.Wardrobe/GetImage", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &wardrobeGetImageClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Wardrobe_GetImageClient interface {
+	Recv() (*ImageChunk, error)
+	grpc.ClientStream
+}
+
+type wardrobeGetImageClient struct {
+	grpc.ClientStream
+}
+
+func (x *wardrobeGetImageClient) Recv() (*ImageChunk, error) {
+	m := new(ImageChunk)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *wardrobeClient) GetUsage(ctx context.Context, in *UserRequest, opts ...grpc.CallOption) (*Usage, error) {
+	out := new(Usage)
+	err := c.cc.Invoke(ctx, "/wardrobe.v1.Wardrobe/GetUsage", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *wardrobeClient) Search(ctx context.Context, in *SearchRequest, opts ...grpc.CallOption) (*SearchResponse, error) {
+	out := new(SearchResponse)
+	err := c.cc.Invoke(ctx, "/wardrobe.v1.Wardrobe/Search", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *wardrobeClient) RegisterUser(ctx context.Context, in *NewUserRequest, opts ...grpc.CallOption) (*User, error) {
+	out := new(User)
+	err := c.cc.Invoke(ctx, "/wardrobe.v1.Wardrobe/RegisterUser", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *wardrobeClient) GetUser(ctx context.Context, in *UserRequest, opts ...grpc.CallOption) (*User, error) {
+	out := new(User)
+	err := c.cc.Invoke(ctx, "/wardrobe.v1.Wardrobe/GetUser", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *wardrobeClient) UpdateUser(ctx context.Context, in *UpdateUserRequest, opts ...grpc.CallOption) (*User, error) {
+	out := new(User)
+	err := c.cc.Invoke(ctx, "/wardrobe.v1.Wardrobe/UpdateUser", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *wardrobeClient) DeleteUser(ctx context.Context, in *UserRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, "/wardrobe.v1.Wardrobe/DeleteUser", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *wardrobeClient) ShareCloset(ctx context.Context, in *ShareRequest, opts ...grpc.CallOption) (*Share, error) {
+	out := new(Share)
+	err := c.cc.Invoke(ctx, "/wardrobe.v1.Wardrobe/ShareCloset", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *wardrobeClient) AcceptShare(ctx context.Context, in *ShareOwnerRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, "/wardrobe.v1.Wardrobe/AcceptShare", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *wardrobeClient) RevokeShare(ctx context.Context, in *RevokeShareRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, "/wardrobe.v1.Wardrobe/RevokeShare", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *wardrobeClient) GetShares(ctx context.Context, in *UserRequest, opts ...grpc.CallOption) (*ShareList, error) {
+	out := new(ShareList)
+	err := c.cc.Invoke(ctx, "/wardrobe.v1.Wardrobe/GetShares", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *wardrobeClient) GetSharedWithMe(ctx context.Context, in *UserRequest, opts ...grpc.CallOption) (*ShareList, error) {
+	out := new(ShareList)
+	err := c.cc.Invoke(ctx, "/wardrobe.v1.Wardrobe/GetSharedWithMe", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *wardrobeClient) CreateShareLink(ctx context.Context, in *NewShareLinkRequest, opts ...grpc.CallOption) (*ShareLink, error) {
+	out := new(ShareLink)
+	err := c.cc.Invoke(ctx, "/wardrobe.v1.Wardrobe/CreateShareLink", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *wardrobeClient) GetShareLinks(ctx context.Context, in *UserRequest, opts ...grpc.CallOption) (*ShareLinkList, error) {
+	out := new(ShareLinkList)
+	err := c.cc.Invoke(ctx, "/wardrobe.v1.Wardrobe/GetShareLinks", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *wardrobeClient) RevokeShareLink(ctx context.Context, in *LinkRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, "/wardrobe.v1.Wardrobe/RevokeShareLink", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *wardrobeClient) GetLook(ctx context.Context, in *LookRequest, opts ...grpc.CallOption) (*Look, error) {
+	out := new(Look)
+	err := c.cc.Invoke(ctx, "/wardrobe.v1.Wardrobe/GetLook", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *wardrobeClient) GetLookImage(ctx context.Context, in *LookImageRequest, opts ...grpc.CallOption) (Wardrobe_GetLookImageClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Wardrobe_ServiceDesc.Streams[2], "/wardrobe.v1.Wardrobe/GetLookImage", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &wardrobeGetLookImageClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Wardrobe_GetLookImageClient interface {
+	Recv() (*ImageChunk, error)
+	grpc.ClientStream
+}
+
+type wardrobeGetLookImageClient struct {
+	grpc.ClientStream
+}
+
+func (x *wardrobeGetLookImageClient) Recv() (*ImageChunk, error) {
+	m := new(ImageChunk)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *wardrobeClient) AddOutfit(ctx context.Context, in *NewOutfitRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, "/wardrobe.v1.Wardrobe/AddOutfit", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *wardrobeClient) DeleteOutfit(ctx context.Context, in *OutfitRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, "/wardrobe.v1.Wardrobe/DeleteOutfit", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *wardrobeClient) GetOutfit(ctx context.Context, in *OutfitRequest, opts ...grpc.CallOption) (*Outfit, error) {
+	out := new(Outfit)
+	err := c.cc.Invoke(ctx, "/wardrobe.v1.Wardrobe/GetOutfit", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *wardrobeClient) GetAllOutfits(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (*OutfitPage, error) {
+	out := new(OutfitPage)
+	err := c.cc.Invoke(ctx, "/wardrobe.v1.Wardrobe/GetAllOutfits", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// WardrobeServer is the server API for Wardrobe service.
+// All implementations must embed UnimplementedWardrobeServer
+// for forward compatibility
+type WardrobeServer interface {
+	// AddWardrobe streams the item first, then the photo and then the label
+	// in chunks
+	AddWardrobe(Wardrobe_AddWardrobeServer) error
+	GetWardrobe(context.Context, *ItemRequest) (*Item, error)
+	GetAllWardrobe(context.Context, *ListRequest) (*ItemPage, error)
+	DeleteWardrobe(context.Context, *ItemRequest) (*emptypb.Empty, error)
+	// GetImage streams the info of the image, then its content in chunks
+	GetImage(*ImageRequest, Wardrobe_GetImageServer) error
+	GetUsage(context.Context, *UserRequest) (*Usage, error)
+	Search(context.Context, *SearchRequest) (*SearchResponse, error)
+	RegisterUser(context.Context, *NewUserRequest) (*User, error)
+	GetUser(context.Context, *UserRequest) (*User, error)
+	UpdateUser(context.Context, *UpdateUserRequest) (*User, error)
+	DeleteUser(context.Context, *UserRequest) (*emptypb.Empty, error)
+	ShareCloset(context.Context, *ShareRequest) (*Share, error)
+	AcceptShare(context.Context, *ShareOwnerRequest) (*emptypb.Empty, error)
+	RevokeShare(context.Context, *RevokeShareRequest) (*emptypb.Empty, error)
+	GetShares(context.Context, *UserRequest) (*ShareList, error)
+	GetSharedWithMe(context.Context, *UserRequest) (*ShareList, error)
+	CreateShareLink(context.Context, *NewShareLinkRequest) (*ShareLink, error)
+	GetShareLinks(context.Context, *UserRequest) (*ShareLinkList, error)
+	RevokeShareLink(context.Context, *LinkRequest) (*emptypb.Empty, error)
+	GetLook(context.Context, *LookRequest) (*Look, error)
+	GetLookImage(*LookImageRequest, Wardrobe_GetLookImageServer) error
+	AddOutfit(context.Context, *NewOutfitRequest) (*emptypb.Empty, error)
+	DeleteOutfit(context.Context, *OutfitRequest) (*emptypb.Empty, error)
+	GetOutfit(context.Context, *OutfitRequest) (*Outfit, error)
+	GetAllOutfits(context.Context, *ListRequest) (*OutfitPage, error)
+	mustEmbedUnimplementedWardrobeServer()
+}
+
+// UnimplementedWardrobeServer must be embedded to have forward compatible implementations.
+type UnimplementedWardrobeServer struct {
+}
+
+func (UnimplementedWardrobeServer) AddWardrobe(Wardrobe_AddWardrobeServer) error {
+	return status.Errorf(codes.Unimplemented, "method AddWardrobe not implemented")
+}
+func (UnimplementedWardrobeServer) GetWardrobe(context.Context, *ItemRequest) (*Item, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetWardrobe not implemented")
+}
+func (UnimplementedWardrobeServer) GetAllWardrobe(context.Context, *ListRequest) (*ItemPage, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetAllWardrobe not implemented")
+}
+func (UnimplementedWardrobeServer) DeleteWardrobe(context.Context, *ItemRequest) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteWardrobe not implemented")
+}
+func (UnimplementedWardrobeServer) GetImage(*ImageRequest, Wardrobe_GetImageServer) error {
+	return status.Errorf(codes.Unimplemented, "method GetImage not implemented")
+}
+func (UnimplementedWardrobeServer) GetUsage(context.Context, *UserRequest) (*Usage, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetUsage not implemented")
+}
+func (UnimplementedWardrobeServer) Search(context.Context, *SearchRequest) (*SearchResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Search not implemented")
+}
+func (UnimplementedWardrobeServer) RegisterUser(context.Context, *NewUserRequest) (*User, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RegisterUser not implemented")
+}
+func (UnimplementedWardrobeServer) GetUser(context.Context, *UserRequest) (*User, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetUser not implemented")
+}
+func (UnimplementedWardrobeServer) UpdateUser(context.Context, *UpdateUserRequest) (*User, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateUser not implemented")
+}
+func (UnimplementedWardrobeServer) DeleteUser(context.Context, *UserRequest) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteUser not implemented")
+}
+func (UnimplementedWardrobeServer) ShareCloset(context.Context, *ShareRequest) (*Share, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ShareCloset not implemented")
+}
+func (UnimplementedWardrobeServer) AcceptShare(context.Context, *ShareOwnerRequest) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AcceptShare not implemented")
+}
+func (UnimplementedWardrobeServer) RevokeShare(context.Context, *RevokeShareRequest) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RevokeShare not implemented")
+}
+func (UnimplementedWardrobeServer) GetShares(context.Context, *UserRequest) (*ShareList, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetShares not implemented")
+}
+func (UnimplementedWardrobeServer) GetSharedWithMe(context.Context, *UserRequest) (*ShareList, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetSharedWithMe not implemented")
+}
+func (UnimplementedWardrobeServer) CreateShareLink(context.Context, *NewShareLinkRequest) (*ShareLink, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateShareLink not implemented")
+}
+func (UnimplementedWardrobeServer) GetShareLinks(context.Context, *UserRequest) (*ShareLinkList, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetShareLinks not implemented")
+}
+func (UnimplementedWardrobeServer) RevokeShareLink(context.Context, *LinkRequest) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RevokeShareLink not implemented")
+}
+func (UnimplementedWardrobeServer) GetLook(context.Context, *LookRequest) (*Look, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetLook not implemented")
+}
+func (UnimplementedWardrobeServer) GetLookImage(*LookImageRequest, Wardrobe_GetLookImageServer) error {
+	return status.Errorf(codes.Unimplemented, "method GetLookImage not implemented")
+}
+func (UnimplementedWardrobeServer) AddOutfit(context.Context, *NewOutfitRequest) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AddOutfit not implemented")
+}
+func (UnimplementedWardrobeServer) DeleteOutfit(context.Context, *OutfitRequest) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteOutfit not implemented")
+}
+func (UnimplementedWardrobeServer) GetOutfit(context.Context, *OutfitRequest) (*Outfit, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetOutfit not implemented")
+}
+func (UnimplementedWardrobeServer) GetAllOutfits(context.Context, *ListRequest) (*OutfitPage, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetAllOutfits not implemented")
+}
+func (UnimplementedWardrobeServer) mustEmbedUnimplementedWardrobeServer() {}
+
+// UnsafeWardrobeServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to WardrobeServer will
+// result in compilation errors.
+type UnsafeWardrobeServer interface {
+	mustEmbedUnimplementedWardrobeServer()
+}
+
+func RegisterWardrobeServer(s grpc.ServiceRegistrar, srv WardrobeServer) {
+	s.RegisterService(&Wardrobe_ServiceDesc, srv)
+}
+
+func _Wardrobe_AddWardrobe_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(WardrobeServer).AddWardrobe(&wardrobeAddWardrobeServer{stream})
+}
+
+type Wardrobe_AddWardrobeServer interface {
+	SendAndClose(*emptypb.Empty) error
+	Recv() (*AddWardrobeRequest, error)
+	grpc.ServerStream
+}
+
+type wardrobeAddWardrobeServer struct {
+	grpc.ServerStream
+}
+
+func (x *wardrobeAddWardrobeServer) SendAndClose(m *emptypb.Empty) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *wardrobeAddWardrobeServer) Recv() (*AddWardrobeRequest, error) {
+	m := new(AddWardrobeRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _Wardrobe_GetWardrobe_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ItemRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(WardrobeServer).GetWardrobe(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/wardrobe.v1.Wardrobe/GetWardrobe",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(WardrobeServer).GetWardrobe(ctx, req.(*ItemRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Wardrobe_GetAllWardrobe_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(WardrobeServer).GetAllWardrobe(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/wardrobe.v1.Wardrobe/GetAllWardrobe",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(WardrobeServer).GetAllWardrobe(ctx, req.(*ListRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Wardrobe_DeleteWardrobe_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ItemRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(WardrobeServer).DeleteWardrobe(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/wardrobe.v1.Wardrobe/DeleteWardrobe",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(WardrobeServer).DeleteWardrobe(ctx, req.(*ItemRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Wardrobe_GetImage_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ImageRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(WardrobeServer).GetImage(m, &wardrobeGetImageServer{stream})
+}
+
+type Wardrobe_GetImageServer interface {
+	Send(*ImageChunk) error
+	grpc.ServerStream
+}
+
+type wardrobeGetImageServer struct {
+	grpc.ServerStream
+}
+
+func (x *wardrobeGetImageServer) Send(m *ImageChunk) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Wardrobe_GetUsage_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UserRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(WardrobeServer).GetUsage(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/wardrobe.v1.Wardrobe/GetUsage",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(WardrobeServer).GetUsage(ctx, req.(*UserRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Wardrobe_Search_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SearchRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(WardrobeServer).Search(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/wardrobe.v1.Wardrobe/Search",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(WardrobeServer).Search(ctx, req.(*SearchRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Wardrobe_RegisterUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(NewUserRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(WardrobeServer).RegisterUser(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/wardrobe.v1.Wardrobe/RegisterUser",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(WardrobeServer).RegisterUser(ctx, req.(*NewUserRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Wardrobe_GetUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UserRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(WardrobeServer).GetUser(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/wardrobe.v1.Wardrobe/GetUser",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(WardrobeServer).GetUser(ctx, req.(*UserRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Wardrobe_UpdateUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateUserRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(WardrobeServer).UpdateUser(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/wardrobe.v1.Wardrobe/UpdateUser",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(WardrobeServer).UpdateUser(ctx, req.(*UpdateUserRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Wardrobe_DeleteUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UserRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(WardrobeServer).DeleteUser(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/wardrobe.v1.Wardrobe/DeleteUser",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(WardrobeServer).DeleteUser(ctx, req.(*UserRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Wardrobe_ShareCloset_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ShareRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(WardrobeServer).ShareCloset(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/wardrobe.v1.Wardrobe/ShareCloset",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(WardrobeServer).ShareCloset(ctx, req.(*ShareRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Wardrobe_AcceptShare_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ShareOwnerRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(WardrobeServer).AcceptShare(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/wardrobe.v1.Wardrobe/AcceptShare",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(WardrobeServer).AcceptShare(ctx, req.(*ShareOwnerRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Wardrobe_RevokeShare_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RevokeShareRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(WardrobeServer).RevokeShare(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/wardrobe.v1.Wardrobe/RevokeShare",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(WardrobeServer).RevokeShare(ctx, req.(*RevokeShareRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Wardrobe_GetShares_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UserRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(WardrobeServer).GetShares(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/wardrobe.v1.Wardrobe/GetShares",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(WardrobeServer).GetShares(ctx, req.(*UserRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Wardrobe_GetSharedWithMe_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UserRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(WardrobeServer).GetSharedWithMe(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/wardrobe.v1.Wardrobe/GetSharedWithMe",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(WardrobeServer).GetSharedWithMe(ctx, req.(*UserRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Wardrobe_CreateShareLink_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(NewShareLinkRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(WardrobeServer).CreateShareLink(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/wardrobe.v1.Wardrobe/CreateShareLink",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(WardrobeServer).CreateShareLink(ctx, req.(*NewShareLinkRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Wardrobe_GetShareLinks_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UserRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(WardrobeServer).GetShareLinks(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/wardrobe.v1.Wardrobe/GetShareLinks",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(WardrobeServer).GetShareLinks(ctx, req.(*UserRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Wardrobe_RevokeShareLink_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(LinkRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(WardrobeServer).RevokeShareLink(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/wardrobe.v1.Wardrobe/RevokeShareLink",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(WardrobeServer).RevokeShareLink(ctx, req.(*LinkRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Wardrobe_GetLook_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(LookRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(WardrobeServer).GetLook(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/wardrobe.v1.Wardrobe/GetLook",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(WardrobeServer).GetLook(ctx, req.(*LookRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Wardrobe_GetLookImage_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(LookImageRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(WardrobeServer).GetLookImage(m, &wardrobeGetLookImageServer{stream})
+}
+
+type Wardrobe_GetLookImageServer interface {
+	Send(*ImageChunk) error
+	grpc.ServerStream
+}
+
+type wardrobeGetLookImageServer struct {
+	grpc.ServerStream
+}
+
+func (x *wardrobeGetLookImageServer) Send(m *ImageChunk) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Wardrobe_AddOutfit_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(NewOutfitRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(WardrobeServer).AddOutfit(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/wardrobe.v1.Wardrobe/AddOutfit",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(WardrobeServer).AddOutfit(ctx, req.(*NewOutfitRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Wardrobe_DeleteOutfit_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(OutfitRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(WardrobeServer).DeleteOutfit(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/wardrobe.v1.Wardrobe/DeleteOutfit",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(WardrobeServer).DeleteOutfit(ctx, req.(*OutfitRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Wardrobe_GetOutfit_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(OutfitRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(WardrobeServer).GetOutfit(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/wardrobe.v1.Wardrobe/GetOutfit",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(WardrobeServer).GetOutfit(ctx, req.(*OutfitRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Wardrobe_GetAllOutfits_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(WardrobeServer).GetAllOutfits(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/wardrobe.v1.Wardrobe/GetAllOutfits",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(WardrobeServer).GetAllOutfits(ctx, req.(*ListRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Wardrobe_ServiceDesc is the grpc.ServiceDesc for Wardrobe service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Wardrobe_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "wardrobe.v1.Wardrobe",
+	HandlerType: (*WardrobeServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetWardrobe",
+			Handler:    _Wardrobe_GetWardrobe_Handler,
+		},
+		{
+			MethodName: "GetAllWardrobe",
+			Handler:    _Wardrobe_GetAllWardrobe_Handler,
+		},
+		{
+			MethodName: "DeleteWardrobe",
+			Handler:    _Wardrobe_DeleteWardrobe_Handler,
+		},
+		{
+			MethodName: "GetUsage",
+			Handler:    _Wardrobe_GetUsage_Handler,
+		},
+		{
+			MethodName: "Search",
+			Handler:    _Wardrobe_Search_Handler,
+		},
+		{
+			MethodName: "RegisterUser",
+			Handler:    _Wardrobe_RegisterUser_Handler,
+		},
+		{
+			MethodName: "GetUser",
+			Handler:    _Wardrobe_GetUser_Handler,
+		},
+		{
+			MethodName: "UpdateUser",
+			Handler:    _Wardrobe_UpdateUser_Handler,
+		},
+		{
+			MethodName: "DeleteUser",
+			Handler:    _Wardrobe_DeleteUser_Handler,
+		},
+		{
+			MethodName: "ShareCloset",
+			Handler:    _Wardrobe_ShareCloset_Handler,
+		},
+		{
+			MethodName: "AcceptShare",
+			Handler:    _Wardrobe_AcceptShare_Handler,
+		},
+		{
+			MethodName: "RevokeShare",
+			Handler:    _Wardrobe_RevokeShare_Handler,
+		},
+		{
+			MethodName: "GetShares",
+			Handler:    _Wardrobe_GetShares_Handler,
+		},
+		{
+			MethodName: "GetSharedWithMe",
+			Handler:    _Wardrobe_GetSharedWithMe_Handler,
+		},
+		{
+			MethodName: "CreateShareLink",
+			Handler:    _Wardrobe_CreateShareLink_Handler,
+		},
+		{
+			MethodName: "GetShareLinks",
+			Handler:    _Wardrobe_GetShareLinks_Handler,
+		},
+		{
+			MethodName: "RevokeShareLink",
+			Handler:    _Wardrobe_RevokeShareLink_Handler,
+		},
+		{
+			MethodName: "GetLook",
+			Handler:    _Wardrobe_GetLook_Handler,
+		},
+		{
+			MethodName: "AddOutfit",
+			Handler:    _Wardrobe_AddOutfit_Handler,
+		},
+		{
+			MethodName: "DeleteOutfit",
+			Handler:    _Wardrobe_DeleteOutfit_Handler,
+		},
+		{
+			MethodName: "GetOutfit",
+			Handler:    _Wardrobe_GetOutfit_Handler,
+		},
+		{
+			MethodName: "GetAllOutfits",
+			Handler:    _Wardrobe_GetAllOutfits_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "AddWardrobe",
+			Handler:       _Wardrobe_AddWardrobe_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "GetImage",
+			Handler:       _Wardrobe_GetImage_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "GetLookImage",
+			Handler:       _Wardrobe_GetLookImage_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "wardrobe.proto",
+}
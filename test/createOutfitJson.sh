@@ -1,2 +0,0 @@
-#!/bin/bash
-echo "{\"top-id\":\"6c555e40-24fb-42a3-afeb-f7dc0763a88f\",\"bottom-id\":\"goo\",\"description\":\"new outfit\"}" > $1
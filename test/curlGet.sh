@@ -1,2 +0,0 @@
-!#/bin/bash
-curl http://127.0.0.1:57401/users/a@a.com/wardrobes
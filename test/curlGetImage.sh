@@ -1 +0,0 @@
-curl http://127.0.0.1:57401/images/$1 --output /tmp/$1 --trace -
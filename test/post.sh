@@ -1 +0,0 @@
-curl --header "Content-Type: application/json"   --request POST   -d @$1  http://localhost:57401/wardrobe/$2/$3